@@ -0,0 +1,3 @@
+ALTER TABLE xi_users ADD COLUMN is_incognito BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE xi_usage ADD COLUMN is_incognito BOOLEAN NOT NULL DEFAULT false;
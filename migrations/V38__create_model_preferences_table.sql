@@ -0,0 +1,9 @@
+CREATE TABLE xi_model_preferences (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES xi_users(id) ON DELETE CASCADE,
+    chat_id BIGINT NOT NULL,
+    model VARCHAR(255) NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_xi_model_preferences_user_chat ON xi_model_preferences(user_id, chat_id);
@@ -0,0 +1,19 @@
+CREATE TABLE xi_models (
+    id VARCHAR(255) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    context_length BIGINT NOT NULL DEFAULT 0,
+    max_completion_tokens BIGINT NOT NULL DEFAULT 0,
+
+    input_price DECIMAL(20, 12) NOT NULL DEFAULT 0,
+    output_price DECIMAL(20, 12) NOT NULL DEFAULT 0,
+    cache_read_price DECIMAL(20, 12) NOT NULL DEFAULT 0,
+    cache_write_price DECIMAL(20, 12) NOT NULL DEFAULT 0,
+
+    supports_images BOOLEAN NOT NULL DEFAULT FALSE,
+    supports_tools BOOLEAN NOT NULL DEFAULT FALSE,
+    supports_reasoning BOOLEAN NOT NULL DEFAULT FALSE,
+
+    synced_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_xi_models_synced_at ON xi_models(synced_at);
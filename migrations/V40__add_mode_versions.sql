@@ -0,0 +1,8 @@
+ALTER TABLE xi_modes ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+UPDATE xi_modes m
+SET version = v.version
+FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY type ORDER BY created_at) AS version FROM xi_modes) v
+WHERE m.id = v.id;
+
+CREATE UNIQUE INDEX idx_xi_modes_type_version ON xi_modes(type, version);
@@ -0,0 +1,9 @@
+CREATE TABLE xi_chat_variables (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    chat_id BIGINT NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    value TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_xi_chat_variables_chat_name ON xi_chat_variables(chat_id, name);
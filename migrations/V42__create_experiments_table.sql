@@ -0,0 +1,24 @@
+CREATE TABLE xi_experiments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    key VARCHAR(50) NOT NULL,
+    mode_type VARCHAR(50) NOT NULL,
+    unit VARCHAR(10) NOT NULL DEFAULT 'chat',
+    variants JSON NOT NULL,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_by UUID REFERENCES xi_users(id) ON DELETE SET NULL,
+    stopped_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_xi_experiments_key ON xi_experiments(key);
+CREATE UNIQUE INDEX idx_xi_experiments_active_mode ON xi_experiments(mode_type) WHERE is_active;
+
+ALTER TABLE xi_usage ADD COLUMN experiment_id UUID REFERENCES xi_experiments(id) ON DELETE SET NULL;
+ALTER TABLE xi_usage ADD COLUMN variant VARCHAR(50);
+ALTER TABLE xi_usage ADD COLUMN latency_ms BIGINT;
+
+ALTER TABLE xi_feedbacks ADD COLUMN experiment_id UUID REFERENCES xi_experiments(id) ON DELETE SET NULL;
+ALTER TABLE xi_feedbacks ADD COLUMN variant VARCHAR(50);
+
+CREATE INDEX idx_xi_usage_experiment ON xi_usage(experiment_id, variant) WHERE experiment_id IS NOT NULL;
+CREATE INDEX idx_xi_feedbacks_experiment ON xi_feedbacks(experiment_id, variant) WHERE experiment_id IS NOT NULL;
@@ -0,0 +1,17 @@
+ALTER TABLE xi_usage ADD COLUMN model VARCHAR(255);
+ALTER TABLE xi_usage ADD COLUMN mode_type VARCHAR(50);
+ALTER TABLE xi_usage ADD COLUMN mode_version INTEGER;
+ALTER TABLE xi_usage ADD COLUMN response_message_id BIGINT;
+
+CREATE INDEX idx_xi_usage_response ON xi_usage(chat_id, response_message_id) WHERE response_message_id IS NOT NULL;
+
+ALTER TABLE xi_feedbacks ADD COLUMN chat_id BIGINT;
+ALTER TABLE xi_feedbacks ADD COLUMN message_id BIGINT;
+ALTER TABLE xi_feedbacks ADD COLUMN usage_id UUID REFERENCES xi_usage(id) ON DELETE SET NULL;
+ALTER TABLE xi_feedbacks ADD COLUMN model VARCHAR(255);
+ALTER TABLE xi_feedbacks ADD COLUMN mode_type VARCHAR(50);
+ALTER TABLE xi_feedbacks ADD COLUMN mode_version INTEGER;
+ALTER TABLE xi_feedbacks ADD COLUMN reason VARCHAR(20);
+ALTER TABLE xi_feedbacks ADD COLUMN comment TEXT;
+
+CREATE INDEX idx_xi_feedbacks_created_at ON xi_feedbacks(created_at);
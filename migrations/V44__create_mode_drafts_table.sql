@@ -0,0 +1,10 @@
+CREATE TABLE xi_mode_drafts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    mode_type VARCHAR(50) NOT NULL,
+    prompt TEXT NOT NULL,
+    base_version INTEGER NOT NULL,
+    created_by UUID REFERENCES xi_users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_xi_mode_drafts_mode_type ON xi_mode_drafts(mode_type);
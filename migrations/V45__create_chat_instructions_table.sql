@@ -0,0 +1,15 @@
+CREATE TABLE xi_chat_instructions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    chat_id BIGINT NOT NULL,
+    text TEXT NOT NULL,
+    updated_by UUID REFERENCES xi_users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_xi_chat_instructions_chat_id ON xi_chat_instructions(chat_id);
+
+ALTER TABLE xi_tariffs ADD COLUMN chat_instructions_max_length INTEGER NOT NULL DEFAULT 500;
+
+UPDATE xi_tariffs SET chat_instructions_max_length = 300 WHERE key = 'bronze';
+UPDATE xi_tariffs SET chat_instructions_max_length = 1000 WHERE key = 'silver';
+UPDATE xi_tariffs SET chat_instructions_max_length = 2000 WHERE key = 'gold';
@@ -0,0 +1,3 @@
+ALTER TABLE xi_selected_modes ADD COLUMN thread_id INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_xi_selected_modes_chat_id_thread_id ON xi_selected_modes(chat_id, thread_id);
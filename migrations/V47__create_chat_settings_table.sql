@@ -0,0 +1,9 @@
+CREATE TABLE xi_chat_settings (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    chat_id BIGINT NOT NULL,
+    language VARCHAR(8) NOT NULL DEFAULT '',
+    updated_by UUID REFERENCES xi_users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_xi_chat_settings_chat_id ON xi_chat_settings(chat_id);
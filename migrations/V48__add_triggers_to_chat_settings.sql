@@ -0,0 +1,6 @@
+ALTER TABLE xi_chat_settings ADD COLUMN trigger_policy VARCHAR(16) NOT NULL DEFAULT 'all';
+ALTER TABLE xi_chat_settings ADD COLUMN trigger_keywords TEXT NOT NULL DEFAULT '';
+ALTER TABLE xi_chat_settings ADD COLUMN lurker_chance INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE xi_chat_settings ADD COLUMN quiet_from INTEGER;
+ALTER TABLE xi_chat_settings ADD COLUMN quiet_to INTEGER;
+ALTER TABLE xi_chat_settings ADD COLUMN time_zone VARCHAR(64) NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE xi_usage ADD COLUMN source VARCHAR(16) NOT NULL DEFAULT 'chat';
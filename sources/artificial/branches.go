@@ -0,0 +1,314 @@
+package artificial
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"ximanager/sources/platform"
+	"ximanager/sources/tracing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	ContextMainBranch = "main"
+	// ContextReplyBranch prefixes branches continuing the conversation from an older answer, one per such reply
+	ContextReplyBranch = "reply"
+)
+
+var (
+	ErrContextBranchInvalidName = errors.New("context branch name is invalid")
+	ErrContextBranchExists      = errors.New("context branch already exists")
+	ErrContextBranchNotFound    = errors.New("context branch not found")
+	ErrContextBranchMain        = errors.New("main context branch cannot be removed")
+	ErrContextAnchorNotFound    = errors.New("replied message is not present in context")
+)
+
+var contextBranchNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+type ContextBranch struct {
+	Name     string
+	Messages int
+	Active   bool
+}
+
+func (x *ContextManager) getActiveBranchKey(chat platform.ChatTopic) string {
+	return fmt.Sprintf("chat_context_branch:%s", chat)
+}
+
+func (x *ContextManager) getBranchesKey(chat platform.ChatTopic) string {
+	return fmt.Sprintf("chat_context_branches:%s", chat)
+}
+
+// Maps every Telegram message sent as an answer to the user message it answers
+func (x *ContextManager) getMessageRefsKey(chat platform.ChatTopic) string {
+	return fmt.Sprintf("chat_history_refs:%s", chat)
+}
+
+func (x *ContextManager) ActiveBranch(logger *tracing.Logger, chat platform.ChatTopic) string {
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 5*time.Second)
+	defer cancel()
+
+	branch, err := x.redis.Get(ctx, x.getActiveBranchKey(chat)).Result()
+	if err == redis.Nil || branch == "" {
+		return ContextMainBranch
+	}
+	if err != nil {
+		logger.W("Failed to get active context branch, using main", tracing.InnerError, err)
+		return ContextMainBranch
+	}
+
+	return branch
+}
+
+// BindReplies remembers which Telegram messages carry the answer to requestID, so replies to them can be anchored later
+func (x *ContextManager) BindReplies(logger *tracing.Logger, chat platform.ChatTopic, requestID int, replyIDs []int) {
+	if requestID == 0 || len(replyIDs) == 0 {
+		return
+	}
+
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 5*time.Second)
+	defer cancel()
+
+	key := x.getMessageRefsKey(chat)
+	limits := x.getContextLimits("")
+
+	values := make([]interface{}, 0, len(replyIDs)*2)
+	for _, replyID := range replyIDs {
+		values = append(values, strconv.Itoa(replyID), requestID)
+	}
+
+	pipe := x.redis.TxPipeline()
+	pipe.HSet(ctx, key, values...)
+	pipe.Expire(ctx, key, time.Duration(limits.TTL)*time.Second)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.W("Failed to bind reply messages to context", "key", key, tracing.InnerError, err)
+	}
+}
+
+// findAnchor returns the index of the assistant entry that was sent as the replied message, or -1
+func (x *ContextManager) findAnchor(ctx context.Context, logger *tracing.Logger, chat platform.ChatTopic, messages []platform.RedisMessage, replyTo int) int {
+	requestID, err := x.redis.HGet(ctx, x.getMessageRefsKey(chat), strconv.Itoa(replyTo)).Int()
+	if err == redis.Nil {
+		return -1
+	}
+	if err != nil {
+		logger.W("Failed to resolve replied message", "reply_to", replyTo, tracing.InnerError, err)
+		return -1
+	}
+
+	for idx := len(messages) - 1; idx >= 0; idx-- {
+		if messages[idx].Role == platform.MessageRoleAssistant && messages[idx].ReplyTo == requestID {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+func (x *ContextManager) Branches(logger *tracing.Logger, chat platform.ChatTopic) ([]ContextBranch, error) {
+	defer tracing.ProfilePoint(logger, "Context branches completed", "artificial.context.branches", "chat_id", chat)()
+
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 5*time.Second)
+	defer cancel()
+
+	names, err := x.redis.SMembers(ctx, x.getBranchesKey(chat)).Result()
+	if err != nil {
+		logger.E("Failed to list context branches", tracing.InnerError, err)
+		return nil, err
+	}
+
+	slices.Sort(names)
+	names = append([]string{ContextMainBranch}, names...)
+	active := x.ActiveBranch(logger, chat)
+
+	branches := make([]ContextBranch, 0, len(names))
+	for _, name := range names {
+		count, err := x.redis.LLen(ctx, x.getChatHistoryKey(chat, name)).Result()
+		if err != nil {
+			logger.W("Failed to count context branch messages", "branch", name, tracing.InnerError, err)
+		}
+
+		branches = append(branches, ContextBranch{
+			Name:     name,
+			Messages: int(count),
+			Active:   name == active,
+		})
+	}
+
+	return branches, nil
+}
+
+// Fork copies the active history into a new branch and switches to it, replyTo (if not 0) cuts the copy at the replied answer
+func (x *ContextManager) Fork(logger *tracing.Logger, chat platform.ChatTopic, name string, replyTo int) (int, error) {
+	defer tracing.ProfilePoint(logger, "Context fork completed", "artificial.context.fork", "chat_id", chat, "branch", name, "reply_to", replyTo)()
+
+	if name == ContextMainBranch || isReplyBranch(name) || !contextBranchNamePattern.MatchString(name) {
+		return 0, ErrContextBranchInvalidName
+	}
+
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 10*time.Second)
+	defer cancel()
+
+	exists, err := x.redis.SIsMember(ctx, x.getBranchesKey(chat), name).Result()
+	if err != nil {
+		logger.E("Failed to check context branch", tracing.InnerError, err)
+		return 0, err
+	}
+	if exists {
+		return 0, ErrContextBranchExists
+	}
+
+	messages, err := x.History(logger, chat)
+	if err != nil {
+		return 0, err
+	}
+
+	if replyTo != 0 {
+		anchor := x.findAnchor(ctx, logger, chat, messages, replyTo)
+		if anchor < 0 {
+			return 0, ErrContextAnchorNotFound
+		}
+		messages = messages[:anchor+1]
+	}
+
+	key := x.getChatHistoryKey(chat, name)
+	if err := x.replaceHistoryInRedis(logger, chat, key, messages); err != nil {
+		return 0, err
+	}
+
+	pipe := x.redis.TxPipeline()
+	pipe.SAdd(ctx, x.getBranchesKey(chat), name)
+	pipe.Set(ctx, x.getActiveBranchKey(chat), name, 0)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.E("Failed to register context branch", tracing.InnerError, err)
+		return 0, err
+	}
+
+	logger.I("Context branch forked", "chat_id", chat, "branch", name, "message_count", len(messages))
+	return len(messages), nil
+}
+
+// isReplyBranch reports whether the name is reserved for branches made by ContinueFromReply
+func isReplyBranch(name string) bool {
+	return name == ContextReplyBranch || strings.HasPrefix(name, ContextReplyBranch+"-")
+}
+
+// ContinueFromReply forks the history up to an older answer into a new branch named after the request and switches
+// to it, so the new turn and the ones after it follow that answer while every branch that was there stays untouched.
+// The name of the new branch is returned, empty when the reply did not rewind anything.
+func (x *ContextManager) ContinueFromReply(logger *tracing.Logger, chat platform.ChatTopic, replyTo int, requestID int) (string, error) {
+	defer tracing.ProfilePoint(logger, "Context continue from reply completed", "artificial.context.continue.reply", "chat_id", chat, "reply_to", replyTo)()
+
+	if replyTo == 0 || !x.IsEnabled(logger, chat.ChatID) {
+		return "", nil
+	}
+
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 10*time.Second)
+	defer cancel()
+
+	messages, err := x.History(logger, chat)
+	if err != nil {
+		return "", err
+	}
+
+	anchor := x.findAnchor(ctx, logger, chat, messages, replyTo)
+	if anchor < 0 || anchor == len(messages)-1 {
+		return "", nil
+	}
+
+	// message ids are unique in a chat, so the branch of one reply never replaces the branch of another
+	name := fmt.Sprintf("%s-%d", ContextReplyBranch, requestID)
+
+	messages = messages[:anchor+1]
+	if err := x.replaceHistoryInRedis(logger, chat, x.getChatHistoryKey(chat, name), messages); err != nil {
+		return "", err
+	}
+
+	pipe := x.redis.TxPipeline()
+	pipe.SAdd(ctx, x.getBranchesKey(chat), name)
+	pipe.Set(ctx, x.getActiveBranchKey(chat), name, 0)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.E("Failed to switch to reply context branch", tracing.InnerError, err)
+		return "", err
+	}
+
+	logger.I("Context continued from reply", "chat_id", chat, "reply_to", replyTo, "branch", name, "message_count", len(messages))
+	return name, nil
+}
+
+func (x *ContextManager) SwitchBranch(logger *tracing.Logger, chat platform.ChatTopic, name string) error {
+	defer tracing.ProfilePoint(logger, "Context switch branch completed", "artificial.context.switch.branch", "chat_id", chat, "branch", name)()
+
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 5*time.Second)
+	defer cancel()
+
+	key := x.getActiveBranchKey(chat)
+
+	if name == ContextMainBranch {
+		if err := x.redis.Del(ctx, key).Err(); err != nil {
+			logger.E("Failed to switch to main context branch", tracing.InnerError, err)
+			return err
+		}
+		return nil
+	}
+
+	exists, err := x.redis.SIsMember(ctx, x.getBranchesKey(chat), name).Result()
+	if err != nil {
+		logger.E("Failed to check context branch", tracing.InnerError, err)
+		return err
+	}
+	if !exists {
+		return ErrContextBranchNotFound
+	}
+
+	if err := x.redis.Set(ctx, key, name, 0).Err(); err != nil {
+		logger.E("Failed to switch context branch", tracing.InnerError, err)
+		return err
+	}
+
+	logger.I("Context branch switched", "chat_id", chat, "branch", name)
+	return nil
+}
+
+func (x *ContextManager) DeleteBranch(logger *tracing.Logger, chat platform.ChatTopic, name string) error {
+	defer tracing.ProfilePoint(logger, "Context delete branch completed", "artificial.context.delete.branch", "chat_id", chat, "branch", name)()
+
+	if name == ContextMainBranch {
+		return ErrContextBranchMain
+	}
+
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 5*time.Second)
+	defer cancel()
+
+	removed, err := x.redis.SRem(ctx, x.getBranchesKey(chat), name).Result()
+	if err != nil {
+		logger.E("Failed to remove context branch", tracing.InnerError, err)
+		return err
+	}
+	if removed == 0 {
+		return ErrContextBranchNotFound
+	}
+
+	pipe := x.redis.TxPipeline()
+	pipe.Del(ctx, x.getChatHistoryKey(chat, name))
+	if x.ActiveBranch(logger, chat) == name {
+		pipe.Del(ctx, x.getActiveBranchKey(chat))
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.E("Failed to delete context branch history", tracing.InnerError, err)
+		return err
+	}
+
+	logger.I("Context branch deleted", "chat_id", chat, "branch", name)
+	return nil
+}
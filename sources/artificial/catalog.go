@@ -0,0 +1,389 @@
+package artificial
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"ximanager/sources/configuration"
+	"ximanager/sources/persistence/entities"
+	"ximanager/sources/platform"
+	"ximanager/sources/repository"
+	"ximanager/sources/texting/tokenizer"
+	"ximanager/sources/tracing"
+
+	openrouter "github.com/revrost/go-openrouter"
+	"github.com/shopspring/decimal"
+	"go.uber.org/fx"
+)
+
+const (
+	defaultCatalogSyncInterval         = 6 * time.Hour
+	defaultCatalogContextWindowPercent = 60
+)
+
+var (
+	ErrCatalogModelUnknown   = errors.New("model is not present in the provider catalog")
+	ErrCatalogModelNoImages  = errors.New("model does not accept images")
+	ErrCatalogPromptTooLarge = errors.New("prompt does not fit the model context window")
+)
+
+var tokensPerMillion = decimal.NewFromInt(1_000_000)
+
+// CatalogIssue describes a configured model that does not match the provider catalog
+type CatalogIssue struct {
+	Scope string
+	Model string
+	Err   error
+}
+
+// ModelCatalog keeps the provider model list in memory and periodically refreshes it into xi_models
+type ModelCatalog struct {
+	ai     *openrouter.Client
+	config *configuration.Config
+	models *repository.ModelsRepository
+	log    *tracing.Logger
+
+	mu       sync.RWMutex
+	entries  map[string]*entities.CatalogModel
+	syncedAt time.Time
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func NewModelCatalog(
+	lc fx.Lifecycle,
+	ai *openrouter.Client,
+	config *configuration.Config,
+	models *repository.ModelsRepository,
+	log *tracing.Logger,
+) *ModelCatalog {
+	x := &ModelCatalog{
+		ai:      ai,
+		config:  config,
+		models:  models,
+		log:     log,
+		entries: map[string]*entities.CatalogModel{},
+	}
+
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			runCtx, cancel := context.WithCancel(context.Background())
+			x.cancel, x.done = cancel, make(chan struct{})
+			go x.start(runCtx)
+			return nil
+		},
+		// waits for a sync in progress, so it never writes to a closing database
+		OnStop: func(ctx context.Context) error {
+			x.cancel()
+			select {
+			case <-x.done:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	})
+
+	return x
+}
+
+func (x *ModelCatalog) syncInterval() time.Duration {
+	if x.config.AI.Catalog.SyncInterval <= 0 {
+		return defaultCatalogSyncInterval
+	}
+	return x.config.AI.Catalog.SyncInterval
+}
+
+func (x *ModelCatalog) start(ctx context.Context) {
+	defer close(x.done)
+
+	if err := x.load(x.log); err != nil {
+		x.log.W("Failed to load model catalog from database", tracing.InnerError, err)
+	}
+
+	if time.Since(x.SyncedAt()) >= x.syncInterval() {
+		if _, err := x.Sync(x.log); err != nil {
+			x.log.E("Initial model catalog sync failed", tracing.InnerError, err)
+		}
+	}
+
+	ticker := time.NewTicker(x.syncInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			x.log.I("Model catalog sync stopped")
+			return
+		case <-ticker.C:
+			if _, err := x.Sync(x.log); err != nil {
+				x.log.E("Model catalog sync failed", tracing.InnerError, err)
+			}
+		}
+	}
+}
+
+func (x *ModelCatalog) load(log *tracing.Logger) error {
+	models, err := x.models.GetAllModels(log)
+	if err != nil {
+		return err
+	}
+
+	x.replace(models)
+	return nil
+}
+
+func (x *ModelCatalog) replace(models []*entities.CatalogModel) {
+	entries := make(map[string]*entities.CatalogModel, len(models))
+	var syncedAt time.Time
+	for _, model := range models {
+		entries[model.ID] = model
+		if model.SyncedAt.After(syncedAt) {
+			syncedAt = model.SyncedAt
+		}
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.entries = entries
+	x.syncedAt = syncedAt
+}
+
+// Sync pulls the provider model list, stores it and returns the number of synced models
+func (x *ModelCatalog) Sync(log *tracing.Logger) (int, error) {
+	defer tracing.ProfilePoint(log, "Model catalog sync completed", "artificial.catalog.sync")()
+
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 60*time.Second)
+	defer cancel()
+
+	listed, err := x.ai.ListModels(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list provider models: %w", err)
+	}
+
+	if len(listed) == 0 {
+		return 0, fmt.Errorf("provider returned an empty model list")
+	}
+
+	syncedAt := time.Now().UTC()
+	models := make([]*entities.CatalogModel, 0, len(listed))
+	for _, model := range listed {
+		models = append(models, catalogModelFromProvider(model, syncedAt))
+	}
+
+	removed, err := x.models.ReplaceModels(log, models, syncedAt)
+	if err != nil {
+		return 0, err
+	}
+
+	x.replace(models)
+
+	log.I("model_catalog_synced", "models", len(models), "removed", removed)
+	for _, issue := range x.TariffIssues() {
+		log.W("Configured model does not match the catalog", "scope", issue.Scope, "model", issue.Model, tracing.InnerError, issue.Err)
+	}
+
+	return len(models), nil
+}
+
+func catalogModelFromProvider(model openrouter.Model, syncedAt time.Time) *entities.CatalogModel {
+	contextLength := int64(0)
+	if model.TopProvider.ContextLength != nil {
+		contextLength = *model.TopProvider.ContextLength
+	}
+	if model.ContextLength != nil && *model.ContextLength > contextLength {
+		contextLength = *model.ContextLength
+	}
+
+	maxCompletionTokens := int64(0)
+	if model.TopProvider.MaxCompletionTokens != nil {
+		maxCompletionTokens = *model.TopProvider.MaxCompletionTokens
+	}
+
+	return &entities.CatalogModel{
+		ID:                  model.ID,
+		Name:                model.Name,
+		ContextLength:       contextLength,
+		MaxCompletionTokens: maxCompletionTokens,
+		InputPrice:          parseCatalogPrice(&model.Pricing.Prompt),
+		OutputPrice:         parseCatalogPrice(&model.Pricing.Completion),
+		CacheReadPrice:      parseCatalogPrice(model.Pricing.InputCacheRead),
+		CacheWritePrice:     parseCatalogPrice(model.Pricing.InputCacheWrite),
+		SupportsImages:      slices.Contains(model.Architecture.InputModalities, "image"),
+		SupportsTools:       slices.Contains(model.SupportedParameters, "tools"),
+		SupportsReasoning:   slices.Contains(model.SupportedParameters, "reasoning") || slices.Contains(model.SupportedParameters, "include_reasoning"),
+		SyncedAt:            syncedAt,
+	}
+}
+
+// parseCatalogPrice reads a per-token price, the provider uses negative values for variable pricing
+func parseCatalogPrice(value *string) decimal.Decimal {
+	if value == nil || *value == "" {
+		return decimal.Zero
+	}
+
+	price, err := decimal.NewFromString(*value)
+	if err != nil || price.IsNegative() {
+		return decimal.Zero
+	}
+
+	return price
+}
+
+func (x *ModelCatalog) SyncedAt() time.Time {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.syncedAt
+}
+
+func (x *ModelCatalog) Size() int {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return len(x.entries)
+}
+
+// Lookup finds the model by id, variants like "model:free" fall back to the base model
+func (x *ModelCatalog) Lookup(model string) (*entities.CatalogModel, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+
+	if entry, ok := x.entries[model]; ok {
+		return entry, true
+	}
+
+	if base, _, found := strings.Cut(model, ":"); found {
+		entry, ok := x.entries[base]
+		return entry, ok
+	}
+
+	return nil, false
+}
+
+// ContextBudget narrows the history token limit to the share of the model context window
+func (x *ModelCatalog) ContextBudget(model string, limit int) int {
+	entry, ok := x.Lookup(model)
+	if !ok || entry.ContextLength <= 0 {
+		return limit
+	}
+
+	percent := x.config.AI.Catalog.ContextWindowPercent
+	if percent <= 0 || percent > 100 {
+		percent = defaultCatalogContextWindowPercent
+	}
+
+	budget := int(entry.ContextLength * int64(percent) / 100)
+	if limit > 0 && budget > limit {
+		return limit
+	}
+
+	return budget
+}
+
+// EstimateCost returns the expected price of a request, false if the model pricing is unknown
+func (x *ModelCatalog) EstimateCost(model string, inputTokens int, outputTokens int) (decimal.Decimal, bool) {
+	entry, ok := x.Lookup(model)
+	if !ok {
+		return decimal.Zero, false
+	}
+
+	input := entry.InputPrice.Mul(decimal.NewFromInt(int64(inputTokens)))
+	output := entry.OutputPrice.Mul(decimal.NewFromInt(int64(outputTokens)))
+	return input.Add(output), true
+}
+
+// PriceHint formats input / output prices per million tokens, empty if the model is unknown
+func (x *ModelCatalog) PriceHint(model string) string {
+	entry, ok := x.Lookup(model)
+	if !ok {
+		return ""
+	}
+
+	return fmt.Sprintf("$%s / $%s", FormatPricePerMillion(entry.InputPrice), FormatPricePerMillion(entry.OutputPrice))
+}
+
+func FormatPricePerMillion(price decimal.Decimal) string {
+	return price.Mul(tokensPerMillion).StringFixed(2)
+}
+
+// Validate checks the model against the catalog, an empty catalog accepts everything since it is not synced yet
+func (x *ModelCatalog) Validate(model string, needImages bool) error {
+	if x.Size() == 0 {
+		return nil
+	}
+
+	entry, ok := x.Lookup(model)
+	if !ok {
+		return ErrCatalogModelUnknown
+	}
+
+	if needImages && !entry.SupportsImages {
+		return ErrCatalogModelNoImages
+	}
+
+	return nil
+}
+
+// TariffIssues lists configured tariff and limit override models the provider does not serve
+func (x *ModelCatalog) TariffIssues() []CatalogIssue {
+	var issues []CatalogIssue
+
+	check := func(scope string, model string) {
+		if model == "" {
+			return
+		}
+		if err := x.Validate(model, false); err != nil {
+			issues = append(issues, CatalogIssue{Scope: scope, Model: model, Err: err})
+		}
+	}
+
+	for _, grade := range []platform.UserGrade{platform.GradeBronze, platform.GradeSilver, platform.GradeGold} {
+		tariffModelConfig := getTariffModelConfig(x.config, grade)
+		check(fmt.Sprintf("%s.primary", grade), tariffModelConfig.PrimaryModel)
+		check(fmt.Sprintf("%s.fallback", grade), tariffModelConfig.FallbackModel)
+		for _, selectable := range tariffModelConfig.SelectableModels {
+			check(fmt.Sprintf("%s.selectable", grade), selectable.Model)
+		}
+	}
+
+	check("limit_exceeded", x.config.AI.LimitExceededModel)
+	for _, model := range x.config.AI.LimitExceededFallbackModels {
+		check("limit_exceeded.fallback", model)
+	}
+
+	return issues
+}
+
+// ValidatePrompt checks that a mode prompt leaves at least half of the history budget of every model of the grade,
+// it returns the prompt size and the allowed size in tokens (0 when no model of the grade is known)
+func (x *ModelCatalog) ValidatePrompt(log *tracing.Logger, userGrade platform.UserGrade, prompt string) (int, int, error) {
+	tokens := tokenizer.Tokens(log, prompt)
+
+	tariffModelConfig := getTariffModelConfig(x.config, userGrade)
+	models := []string{tariffModelConfig.PrimaryModel, tariffModelConfig.FallbackModel}
+	for _, selectable := range tariffModelConfig.SelectableModels {
+		models = append(models, selectable.Model)
+	}
+
+	limit := 0
+	for _, model := range models {
+		if budget := x.ContextBudget(model, 0); budget > 0 && (limit == 0 || budget < limit) {
+			limit = budget
+		}
+	}
+
+	if limit == 0 {
+		return tokens, 0, nil
+	}
+
+	limit /= 2
+	if tokens > limit {
+		return tokens, limit, ErrCatalogPromptTooLarge
+	}
+
+	return tokens, limit, nil
+}
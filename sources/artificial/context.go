@@ -14,6 +14,7 @@ import (
 	"ximanager/sources/tracing"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/shopspring/decimal"
 )
 
 type ContextManager struct {
@@ -23,6 +24,8 @@ type ContextManager struct {
 	agentSystem *AgentSystem
 	features    *features.FeatureManager
 	tariffs     *repository.TariffsRepository
+	catalog     *ModelCatalog
+	topics      *repository.TopicsRepository
 	log         *tracing.Logger
 }
 
@@ -33,6 +36,8 @@ func NewContextManager(
 	agentSystem *AgentSystem,
 	fm *features.FeatureManager,
 	tariffs *repository.TariffsRepository,
+	catalog *ModelCatalog,
+	topics *repository.TopicsRepository,
 	log *tracing.Logger,
 ) (*ContextManager, error) {
 	return &ContextManager{
@@ -42,26 +47,53 @@ func NewContextManager(
 		agentSystem: agentSystem,
 		features:    fm,
 		tariffs:     tariffs,
+		catalog:     catalog,
+		topics:      topics,
 		log:         log,
 	}, nil
 }
 
-func (x *ContextManager) getContextLimits() ContextLimits {
+// getContextLimits returns history limits, a known model narrows the token limit to its context window
+func (x *ContextManager) getContextLimits(model string) ContextLimits {
+	maxTokens := x.config.AI.Agents.Summarization.MaxContextTokens
+	if model != "" {
+		maxTokens = x.catalog.ContextBudget(model, maxTokens)
+	}
+
 	return ContextLimits{
 		TTL:       int(x.config.Redis.MessagesTTL.Seconds()),
-		MaxTokens: x.config.AI.Agents.Summarization.MaxContextTokens,
+		MaxTokens: maxTokens,
+	}
+}
+
+func (x *ContextManager) getChatHistoryKey(chat platform.ChatTopic, branch string) string {
+	if branch == "" || branch == ContextMainBranch {
+		return fmt.Sprintf("chat_history:%s", chat)
 	}
+	return fmt.Sprintf("chat_history:%s:%s", chat, branch)
 }
 
-func (x *ContextManager) getChatHistoryKey(chatID platform.ChatID) string {
-	return fmt.Sprintf("chat_history:%d", chatID)
+// historyKey resolves the history list of the branch currently active in the chat
+func (x *ContextManager) historyKey(logger *tracing.Logger, chat platform.ChatTopic) string {
+	return x.getChatHistoryKey(chat, x.ActiveBranch(logger, chat))
 }
 
-func (x *ContextManager) Fetch(logger *tracing.Logger, chatID platform.ChatID, userGrade platform.UserGrade) ([]platform.RedisMessage, bool, error) {
-	defer tracing.ProfilePoint(logger, "Context fetch completed", "artificial.context.fetch", "chat_id", chatID, "user_grade", userGrade)()
+// Fetch returns the history for the next request to the model, replyTo is the Telegram message the request replies to (0 if none)
+func (x *ContextManager) Fetch(logger *tracing.Logger, chat platform.ChatTopic, userGrade platform.UserGrade, model string, replyTo int) ([]platform.RedisMessage, bool, error) {
+	defer tracing.ProfilePoint(logger, "Context fetch completed", "artificial.context.fetch", "chat_id", chat, "user_grade", userGrade, "model", model, "reply_to", replyTo)()
+	return x.fetch(logger, chat, userGrade, model, replyTo, false)
+}
+
+// Peek returns the history Fetch would return without summarizing it, the flag reports whether Fetch would summarize.
+// Nothing is written back, so a dry run can see the context without changing it
+func (x *ContextManager) Peek(logger *tracing.Logger, chat platform.ChatTopic, userGrade platform.UserGrade, model string, replyTo int) ([]platform.RedisMessage, bool, error) {
+	defer tracing.ProfilePoint(logger, "Context peek completed", "artificial.context.peek", "chat_id", chat, "user_grade", userGrade, "model", model, "reply_to", replyTo)()
+	return x.fetch(logger, chat, userGrade, model, replyTo, true)
+}
 
-	if !x.IsEnabled(logger, chatID) {
-		logger.I("Context collection is disabled for this chat, returning empty", "chat_id", chatID)
+func (x *ContextManager) fetch(logger *tracing.Logger, chat platform.ChatTopic, userGrade platform.UserGrade, model string, replyTo int, peek bool) ([]platform.RedisMessage, bool, error) {
+	if !x.IsEnabled(logger, chat.ChatID) {
+		logger.I("Context collection is disabled for this chat, returning empty", "chat_id", chat)
 		return []platform.RedisMessage{}, false, nil
 	}
 
@@ -70,8 +102,8 @@ func (x *ContextManager) Fetch(logger *tracing.Logger, chatID platform.ChatID, u
 	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 5*time.Second)
 	defer cancel()
 
-	limits := x.getContextLimits()
-	key := x.getChatHistoryKey(chatID)
+	limits := x.getContextLimits(model)
+	key := x.historyKey(logger, chat)
 
 	messageStrings, err := x.redis.LRange(ctx, key, 0, -1).Result()
 	redisLatency := time.Since(startTime)
@@ -97,6 +129,16 @@ func (x *ContextManager) Fetch(logger *tracing.Logger, chatID platform.ChatID, u
 
 	x.reverseMessages(allMessages)
 
+	// Replying to an older answer rewinds the conversation to that answer, later turns stay out of the request
+	rewound := false
+	if replyTo != 0 {
+		if anchor := x.findAnchor(ctx, logger, chat, allMessages, replyTo); anchor >= 0 && anchor < len(allMessages)-1 {
+			logger.I("context_rewound_to_reply", "chat_id", chat, "reply_to", replyTo, "messages_total", len(allMessages), "messages_kept", anchor+1)
+			allMessages = allMessages[:anchor+1]
+			rewound = true
+		}
+	}
+
 	recentCount := x.config.AI.Agents.Summarization.RecentMessagesToKeep
 	if recentCount <= 0 {
 		recentCount = 3
@@ -108,9 +150,16 @@ func (x *ContextManager) Fetch(logger *tracing.Logger, chatID platform.ChatID, u
 		triggerThreshold = int(float64(limits.MaxTokens) * 0.75)
 	}
 
-	summarizationNeeded := totalTokens > triggerThreshold
+	// A rewound history is a view over the stored one, so it must not be summarized back into Redis
+	summarizationNeeded := !rewound && totalTokens > triggerThreshold
 	summarizationOccurred := false
 
+	if peek {
+		messages := x.applyTokenLimit(logger, allMessages, limits.MaxTokens)
+		logger.I("context_peek_success", "chat_id", chat, "messages_count", len(messages), "summarization_needed", summarizationNeeded)
+		return messages, summarizationNeeded && len(allMessages) > recentCount, nil
+	}
+
 	var finalMessages []platform.RedisMessage
 	if summarizationNeeded && len(allMessages) > recentCount {
 		logger.I("context_summarization_triggered",
@@ -133,30 +182,30 @@ func (x *ContextManager) Fetch(logger *tracing.Logger, chatID platform.ChatID, u
 	}
 
 	if summarizationOccurred {
-		x.updateRedisAfterSummarization(logger, chatID, userGrade, finalMessages)
+		x.updateRedisAfterSummarization(logger, chat, key, finalMessages)
 	}
 
 	messages := x.applyTokenLimit(logger, finalMessages, limits.MaxTokens)
-	x.logFetchSuccess(logger, chatID, userGrade, rawMessageCount, messages, skippedMessages, summarizationOccurred, redisLatency, time.Since(startTime), limits.MaxTokens)
+	x.logFetchSuccess(logger, chat, userGrade, rawMessageCount, messages, skippedMessages, summarizationOccurred, redisLatency, time.Since(startTime), limits.MaxTokens)
 
 	return messages, summarizationOccurred, nil
 }
 
 func (x *ContextManager) Store(
 	logger *tracing.Logger,
-	chatID platform.ChatID,
+	chat platform.ChatTopic,
 	userGrade platform.UserGrade,
 	message platform.RedisMessage,
 ) error {
-	defer tracing.ProfilePoint(logger, "Context store completed", "artificial.context.store", "chat_id", chatID, "user_grade", userGrade, "message_role", message.Role)()
+	defer tracing.ProfilePoint(logger, "Context store completed", "artificial.context.store", "chat_id", chat, "user_grade", userGrade, "message_role", message.Role)()
 
 	if message.Role == platform.MessageRoleTool {
-		logger.D("Skipping tool message storage", "chat_id", chatID)
+		logger.D("Skipping tool message storage", "chat_id", chat)
 		return nil
 	}
 
-	if !x.IsEnabled(logger, chatID) {
-		logger.I("Context collection is disabled for this chat, skipping store", "chat_id", chatID)
+	if !x.IsEnabled(logger, chat.ChatID) {
+		logger.I("Context collection is disabled for this chat, skipping store", "chat_id", chat)
 		return nil
 	}
 
@@ -165,8 +214,8 @@ func (x *ContextManager) Store(
 	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 5*time.Second)
 	defer cancel()
 
-	limits := x.getContextLimits()
-	key := x.getChatHistoryKey(chatID)
+	limits := x.getContextLimits("")
+	key := x.historyKey(logger, chat)
 
 	messageStr, err := json.Marshal(message)
 	if err != nil {
@@ -188,7 +237,7 @@ func (x *ContextManager) Store(
 
 	duration := time.Since(startTime)
 	logger.I("context_store_success",
-		"chat_id", chatID,
+		"chat_id", chat,
 		"user_grade", userGrade,
 		"message_role", message.Role,
 		"message_tokens", messageTokens,
@@ -199,9 +248,9 @@ func (x *ContextManager) Store(
 	return nil
 }
 
-func (x *ContextManager) Clear(logger *tracing.Logger, chatID platform.ChatID) error {
-	defer tracing.ProfilePoint(logger, "Context clear completed", "artificial.context.clear", "chat_id", chatID)()
-	key := x.getChatHistoryKey(chatID)
+func (x *ContextManager) Clear(logger *tracing.Logger, chat platform.ChatTopic) error {
+	defer tracing.ProfilePoint(logger, "Context clear completed", "artificial.context.clear", "chat_id", chat)()
+	key := x.historyKey(logger, chat)
 
 	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 5*time.Second)
 	defer cancel()
@@ -216,6 +265,112 @@ func (x *ContextManager) Clear(logger *tracing.Logger, chatID platform.ChatID) e
 	return nil
 }
 
+func (x *ContextManager) Export(logger *tracing.Logger, chat platform.ChatTopic) (*ContextBundle, error) {
+	defer tracing.ProfilePoint(logger, "Context export completed", "artificial.context.export", "chat_id", chat)()
+
+	messages, err := x.History(logger, chat)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.I("Chat history exported", "chat_id", chat, "message_count", len(messages))
+	return NewContextBundle(chat.ChatID, messages), nil
+}
+
+// History returns stored messages as is (without summarization or token limits), ordered from oldest to newest
+func (x *ContextManager) History(logger *tracing.Logger, chat platform.ChatTopic) ([]platform.RedisMessage, error) {
+	defer tracing.ProfilePoint(logger, "Context history completed", "artificial.context.history", "chat_id", chat)()
+
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 5*time.Second)
+	defer cancel()
+
+	key := x.historyKey(logger, chat)
+	messageStrings, err := x.redis.LRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		logger.E("Failed to fetch chat history", "key", key, tracing.InnerError, err)
+		return nil, err
+	}
+
+	return x.decodeHistory(logger, messageStrings), nil
+}
+
+// Drop removes messages at the given 1-based positions (oldest message is 1) in a single transaction
+func (x *ContextManager) Drop(logger *tracing.Logger, chat platform.ChatTopic, positions []int) (int, error) {
+	defer tracing.ProfilePoint(logger, "Context drop completed", "artificial.context.drop", "chat_id", chat, "positions", len(positions))()
+
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 10*time.Second)
+	defer cancel()
+
+	key := x.historyKey(logger, chat)
+	limits := x.getContextLimits("")
+
+	toDrop := make(map[int]bool, len(positions))
+	for _, position := range positions {
+		toDrop[position] = true
+	}
+
+	dropped := 0
+
+	// WATCH guards against a concurrent Store between reading and rewriting the list
+	err := x.redis.Watch(ctx, func(tx *redis.Tx) error {
+		messageStrings, err := tx.LRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+
+		total := len(messageStrings)
+		kept := make([]interface{}, 0, total)
+		dropped = 0
+
+		// Redis keeps newest first, position 1 is the last element of the list
+		for idx, msgStr := range messageStrings {
+			if toDrop[total-idx] {
+				dropped++
+				continue
+			}
+			kept = append(kept, msgStr)
+		}
+
+		if dropped == 0 {
+			return nil
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			if len(kept) > 0 {
+				pipe.RPush(ctx, key, kept...)
+				pipe.Expire(ctx, key, time.Duration(limits.TTL)*time.Second)
+			}
+			return nil
+		})
+		return err
+	}, key)
+
+	if err != nil {
+		logger.E("Failed to drop messages from chat history", "key", key, tracing.InnerError, err)
+		return 0, err
+	}
+
+	logger.I("Messages dropped from chat history", "chat_id", chat, "requested", len(positions), "dropped", dropped)
+	return dropped, nil
+}
+
+func (x *ContextManager) Import(logger *tracing.Logger, chat platform.ChatTopic, userGrade platform.UserGrade, bundle *ContextBundle) error {
+	defer tracing.ProfilePoint(logger, "Context import completed", "artificial.context.import", "chat_id", chat)()
+
+	if err := validateContextMessages(bundle.Messages); err != nil {
+		logger.W("Context bundle validation failed", tracing.InnerError, err)
+		return err
+	}
+
+	if err := x.replaceHistoryInRedis(logger, chat, x.historyKey(logger, chat), bundle.Messages); err != nil {
+		return err
+	}
+
+	logger.I("Chat history imported", "chat_id", chat, "source_chat_id", bundle.ChatID, "message_count", len(bundle.Messages))
+	return nil
+}
+
 func (x *ContextManager) getContextEnabledKey(chatID platform.ChatID) string {
 	return fmt.Sprintf("chat_context_enabled:%d", chatID)
 }
@@ -272,16 +427,22 @@ type ContextStats struct {
 	MaxMessages       int
 	CurrentTokens     int
 	MaxTokens         int
+	Branch            string
+	PerTopic          bool
+	Model             string
+	EstimatedCost     decimal.Decimal
+	IsCostEstimated   bool
 }
 
-func (x *ContextManager) GetStats(logger *tracing.Logger, chatID platform.ChatID, userGrade platform.UserGrade) (*ContextStats, error) {
-	defer tracing.ProfilePoint(logger, "Context get stats completed", "artificial.context.get.stats", "chat_id", chatID)()
+// GetStats describes the chat history as it would be sent to the model, including the estimated input price
+func (x *ContextManager) GetStats(logger *tracing.Logger, chat platform.ChatTopic, userGrade platform.UserGrade, model string) (*ContextStats, error) {
+	defer tracing.ProfilePoint(logger, "Context get stats completed", "artificial.context.get.stats", "chat_id", chat, "model", model)()
 
 	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 5*time.Second)
 	defer cancel()
 
-	limits := x.getContextLimits()
-	key := x.getChatHistoryKey(chatID)
+	limits := x.getContextLimits(model)
+	key := x.historyKey(logger, chat)
 	messageStrings, err := x.redis.LRange(ctx, key, 0, -1).Result()
 	if err != nil {
 		logger.E("Failed to fetch chat history for stats", tracing.InnerError, err)
@@ -297,17 +458,38 @@ func (x *ContextManager) GetStats(logger *tracing.Logger, chatID platform.ChatID
 		totalTokens += tokenizer.Tokens(logger, msg.Content)
 	}
 
-	enabled := x.IsEnabled(logger, chatID)
+	enabled := x.IsEnabled(logger, chat.ChatID)
+	estimatedCost, costEstimated := x.catalog.EstimateCost(model, min(totalTokens, limits.MaxTokens), 0)
 
 	return &ContextStats{
+		Branch:          x.ActiveBranch(logger, chat),
+		PerTopic:        chat.ThreadID != 0,
 		Enabled:         enabled,
 		CurrentMessages: len(messageStrings),
 		MaxMessages:     0,
 		CurrentTokens:   totalTokens,
 		MaxTokens:       limits.MaxTokens,
+		Model:           model,
+		EstimatedCost:   estimatedCost,
+		IsCostEstimated: costEstimated,
 	}, nil
 }
 
+func (x *ContextManager) decodeHistory(logger *tracing.Logger, messageStrings []string) []platform.RedisMessage {
+	messages := make([]platform.RedisMessage, 0, len(messageStrings))
+	for _, msgStr := range messageStrings {
+		var msg platform.RedisMessage
+		if err := json.Unmarshal([]byte(msgStr), &msg); err != nil {
+			logger.W("Failed to parse message from Redis, skipping", "message", msgStr, tracing.InnerError, err)
+			continue
+		}
+		messages = append(messages, msg)
+	}
+
+	x.reverseMessages(messages)
+	return messages
+}
+
 func (x *ContextManager) reverseMessages(messages []platform.RedisMessage) {
 	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
 		messages[i], messages[j] = messages[j], messages[i]
@@ -337,15 +519,15 @@ func (x *ContextManager) applyTokenLimit(logger *tracing.Logger, messages []plat
 
 func (x *ContextManager) updateRedisAfterSummarization(
 	logger *tracing.Logger,
-	chatID platform.ChatID,
-	userGrade platform.UserGrade,
+	chat platform.ChatTopic,
+	key string,
 	finalMessages []platform.RedisMessage,
 ) {
-	if err := x.replaceHistoryInRedis(logger, chatID, userGrade, finalMessages); err != nil {
+	if err := x.replaceHistoryInRedis(logger, chat, key, finalMessages); err != nil {
 		logger.E("Failed to update Redis with summarized history", tracing.InnerError, err)
 	} else {
 		logger.I("redis_history_updated_after_summarization",
-			"chat_id", chatID,
+			"chat_id", chat,
 			"total_messages", len(finalMessages),
 		)
 	}
@@ -353,7 +535,7 @@ func (x *ContextManager) updateRedisAfterSummarization(
 
 func (x *ContextManager) logFetchSuccess(
 	logger *tracing.Logger,
-	chatID platform.ChatID,
+	chat platform.ChatTopic,
 	userGrade platform.UserGrade,
 	rawCount int,
 	messages []platform.RedisMessage,
@@ -370,7 +552,7 @@ func (x *ContextManager) logFetchSuccess(
 	}
 
 	logger.I("context_fetch_success",
-		"chat_id", chatID,
+		"chat_id", chat,
 		"user_grade", userGrade,
 		"raw_message_count", rawCount,
 		"fetched_message_count", len(messages),
@@ -481,16 +663,15 @@ func (x *ContextManager) formatHistoryForSummarization(messages []platform.Redis
 
 func (x *ContextManager) replaceHistoryInRedis(
 	logger *tracing.Logger,
-	chatID platform.ChatID,
-	userGrade platform.UserGrade,
+	chat platform.ChatTopic,
+	key string,
 	messages []platform.RedisMessage,
 ) error {
-	key := x.getChatHistoryKey(chatID)
 
 	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 10*time.Second)
 	defer cancel()
 
-	limits := x.getContextLimits()
+	limits := x.getContextLimits("")
 
 	// Use transaction pipeline for atomicity — Del + LPush + Expire all together
 	pipe := x.redis.TxPipeline()
@@ -498,8 +679,8 @@ func (x *ContextManager) replaceHistoryInRedis(
 	// Delete old history (inside pipeline for atomicity)
 	pipe.Del(ctx, key)
 
-	// Store new history in reverse order (LPUSH adds to the beginning)
-	for i := len(messages) - 1; i >= 0; i-- {
+	// Messages are ordered oldest first and LPUSH adds to the beginning, so the newest ends up at the head as in Store
+	for i := 0; i < len(messages); i++ {
 		msgStr, err := json.Marshal(messages[i])
 		if err != nil {
 			logger.W("Failed to marshal message, skipping", tracing.InnerError, err)
@@ -517,7 +698,8 @@ func (x *ContextManager) replaceHistoryInRedis(
 	}
 
 	logger.I("redis_history_replaced",
-		"chat_id", chatID,
+		"chat_id", chat,
+		"key", key,
 		"message_count", len(messages),
 		"ttl_seconds", limits.TTL,
 	)
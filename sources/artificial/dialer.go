@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"time"
 	"ximanager/sources/configuration"
@@ -14,9 +15,11 @@ import (
 	"ximanager/sources/persistence/entities"
 	"ximanager/sources/platform"
 	"ximanager/sources/repository"
+	"ximanager/sources/texting/tokenizer"
 	"ximanager/sources/tracing"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/google/uuid"
 	openrouter "github.com/revrost/go-openrouter"
 	"github.com/shopspring/decimal"
 	"golang.org/x/sync/errgroup"
@@ -39,6 +42,13 @@ type Dialer struct {
 	features         *features.FeatureManager
 	localization     *localization.LocalizationManager
 	tariffs          *repository.TariffsRepository
+	modelPreferences *repository.ModelPreferencesRepository
+	chatVariables    *repository.ChatVariablesRepository
+	chatInstructions *repository.ChatInstructionsRepository
+	topics           *repository.TopicsRepository
+	experiments      *repository.ExperimentsRepository
+	catalog          *ModelCatalog
+	traces           *TraceStore
 	metrics          *metrics.MetricsService
 	log              *tracing.Logger
 }
@@ -59,6 +69,13 @@ func NewDialer(
 	fm *features.FeatureManager,
 	localization *localization.LocalizationManager,
 	tariffs *repository.TariffsRepository,
+	modelPreferences *repository.ModelPreferencesRepository,
+	chatVariables *repository.ChatVariablesRepository,
+	chatInstructions *repository.ChatInstructionsRepository,
+	topics *repository.TopicsRepository,
+	experiments *repository.ExperimentsRepository,
+	catalog *ModelCatalog,
+	traces *TraceStore,
 	metrics *metrics.MetricsService,
 	log *tracing.Logger,
 ) *Dialer {
@@ -79,6 +96,13 @@ func NewDialer(
 		features:         fm,
 		localization:     localization,
 		tariffs:          tariffs,
+		modelPreferences: modelPreferences,
+		chatVariables:    chatVariables,
+		chatInstructions: chatInstructions,
+		topics:           topics,
+		experiments:      experiments,
+		catalog:          catalog,
+		traces:           traces,
 		metrics:          metrics,
 		log:              log,
 	}
@@ -92,6 +116,22 @@ type AgentDecisions struct {
 type DialResult struct {
 	Text         string
 	IsSummarized bool
+	IsStateless  bool
+	IsStored     bool
+	UsageID      uuid.UUID
+	Trace        *DialTrace
+}
+
+// plannedAgents names the agents runAgentsParallel calls under the policy
+func (x *Dialer) plannedAgents(policy *repository.ModePolicy) []string {
+	agents := []string{}
+	if policy.EffortAgentEnabled() {
+		agents = append(agents, "effort")
+	}
+	if x.features.IsEnabled(features.FeatureResponseLengthDetection) && policy.ResponseLengthAgentEnabled() {
+		agents = append(agents, "length")
+	}
+	return agents
 }
 
 func (x *Dialer) runAgentsParallel(
@@ -100,28 +140,31 @@ func (x *Dialer) runAgentsParallel(
 	history []platform.RedisMessage,
 	req string,
 	userGrade platform.UserGrade,
+	policy *repository.ModePolicy,
 	agentUsage *AgentUsageAccumulator,
 ) (*AgentDecisions, error) {
 	g, ctx := errgroup.WithContext(ctx)
 	results := &AgentDecisions{}
 
 	// 1. Effort Selection
-	g.Go(func() error {
-		recentHistory := history
-		if len(recentHistory) > 6 {
-			recentHistory = recentHistory[len(recentHistory)-6:]
-		}
+	if policy.EffortAgentEnabled() {
+		g.Go(func() error {
+			recentHistory := history
+			if len(recentHistory) > 6 {
+				recentHistory = recentHistory[len(recentHistory)-6:]
+			}
 
-		selection, err := x.agentSystem.SelectEffort(log, recentHistory, req, userGrade, agentUsage)
-		if err != nil {
-			return err
-		}
-		results.EffortSelection = selection
-		return nil
-	})
+			selection, err := x.agentSystem.SelectEffort(log, recentHistory, req, userGrade, agentUsage)
+			if err != nil {
+				return err
+			}
+			results.EffortSelection = selection
+			return nil
+		})
+	}
 
 	// 2. Response Length
-	if x.features.IsEnabled(features.FeatureResponseLengthDetection) {
+	if x.features.IsEnabled(features.FeatureResponseLengthDetection) && policy.ResponseLengthAgentEnabled() {
 		g.Go(func() error {
 			length, err := x.agentSystem.DetermineResponseLength(log, req, agentUsage)
 			if err != nil {
@@ -140,15 +183,52 @@ func (x *Dialer) runAgentsParallel(
 	return results, nil
 }
 
-func (x *Dialer) Dial(log *tracing.Logger, msg *tgbotapi.Message, req string, imageURL string, persona string, stackful bool) (*DialResult, error) {
+// DialOptions tune a single answer, the zero value answers statelessly like a voice transcription does
+type DialOptions struct {
+	ImageURL string
+	Persona  string
+	// Stackful answers read and write chat history
+	Stackful bool
+	// Incognito answers neither read nor write chat history and skip personalization
+	Incognito bool
+	// DryRun plans the request and returns its trace without calling the main model, limits and usage are left untouched
+	DryRun bool
+
+	inline  bool
+	sandbox *entities.Mode
+}
+
+func (x *Dialer) Dial(log *tracing.Logger, msg *tgbotapi.Message, req string, opts DialOptions) (*DialResult, error) {
 	defer tracing.ProfilePoint(log, "Dialer dial completed", "artificial.dialer.dial")()
+	return x.dial(log, msg, req, opts)
+}
+
+// DialSandbox answers with the given mode instead of the chat one, usually an unpublished draft.
+// The answer neither reads nor writes chat history and never takes part in experiments
+func (x *Dialer) DialSandbox(log *tracing.Logger, msg *tgbotapi.Message, req string, persona string, mode *entities.Mode) (*DialResult, error) {
+	defer tracing.ProfilePoint(log, "Dialer dial sandbox completed", "artificial.dialer.dial.sandbox", "mode_type", mode.Type, "mode_version", mode.Version)()
+	return x.dial(log.With("sandbox", true), msg, req, DialOptions{Persona: persona, sandbox: mode})
+}
+
+// DialInline answers an inline query fast and statelessly: no history, personalization, agents or tools,
+// low reasoning effort and a brief answer. Limits and usage are counted as for a regular answer
+func (x *Dialer) DialInline(log *tracing.Logger, msg *tgbotapi.Message, req string, persona string) (*DialResult, error) {
+	defer tracing.ProfilePoint(log, "Dialer dial inline completed", "artificial.dialer.dial.inline")()
+	return x.dial(log.With("inline", true), msg, req, DialOptions{Persona: persona, inline: true})
+}
+
+func (x *Dialer) dial(log *tracing.Logger, msg *tgbotapi.Message, req string, opts DialOptions) (*DialResult, error) {
 	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 10*time.Minute)
 	defer cancel()
 
-	mode, err := x.modes.GetCurrentModeForChat(log, msg.Chat.ID)
-	if err != nil {
-		log.E("Failed to get mode config", tracing.InnerError, err)
-		return nil, err
+	mode := opts.sandbox
+	if mode == nil {
+		chatMode, err := x.modes.GetCurrentModeForChat(log, msg.Chat.ID, x.topics.ThreadOf(log, msg))
+		if err != nil {
+			log.E("Failed to get mode config", tracing.InnerError, err)
+			return nil, err
+		}
+		mode = chatMode
 	}
 
 	if mode == nil {
@@ -156,88 +236,166 @@ func (x *Dialer) Dial(log *tracing.Logger, msg *tgbotapi.Message, req string, im
 		return nil, errors.New("no available mode config")
 	}
 
-	modeConfig := x.modes.ParseModeConfig(mode, log)
-
 	user, err := x.users.GetUserByEid(log, msg.From.ID)
 	if err != nil {
 		log.E("Failed to get user", tracing.InnerError, err)
 		return nil, err
 	}
 
+	var assignment *repository.ExperimentAssignment
+	if opts.sandbox == nil && !opts.inline {
+		assignment = x.experiments.Assign(log, mode.Type, msg.Chat.ID, user.UserID)
+	}
+	if assignment != nil {
+		log = log.With("experiment", assignment.Key, "variant", assignment.Variant.Key)
+		if version := assignment.Variant.ModeVersion; version > 0 && version != mode.Version {
+			variantMode, err := x.modes.GetModeVersion(log, mode.Type, version)
+			if err != nil {
+				log.E("Failed to load experiment mode version, serving without experiment", "version", version, tracing.InnerError, err)
+				assignment = nil
+			} else {
+				mode = variantMode
+			}
+		}
+	}
+
+	modeConfig := x.modes.ParseModeConfig(mode, log)
+	policy := modeConfig.Policy
+
+	trace := &DialTrace{
+		CreatedAt:   time.Now(),
+		ChatID:      msg.Chat.ID,
+		MessageID:   msg.MessageID,
+		DryRun:      opts.DryRun,
+		ModeType:    mode.Type,
+		ModeVersion: mode.Version,
+	}
+
 	userGrade, err := x.donations.GetUserGrade(log, user)
 	if err != nil {
 		log.W("Failed to get user grade, using bronze as default", tracing.InnerError, err)
 		userGrade = platform.GradeBronze
 	}
+	trace.UserGrade = userGrade
+
+	incognito := opts.Incognito || platform.BoolValue(user.IsIncognito, false)
+	if incognito {
+		log = log.With("incognito", true)
+	}
+
+	// stateless answers leave chat history and personalization alone, sandbox and inline ones are not incognito though
+	stateless := incognito || opts.sandbox != nil || opts.inline
+	source := repository.UsageSourceChat
+	switch {
+	case opts.sandbox != nil:
+		source = repository.UsageSourceSandbox
+	case opts.inline:
+		source = repository.UsageSourceInline
+	}
 
 	usageType := UsageTypeDialer
-	if imageURL != "" {
+	if opts.ImageURL != "" {
 		usageType = UsageTypeVision
 	}
 
-	limitResult, err := x.usageLimiter.checkAndIncrement(log, user.UserID, userGrade, usageType)
-	if err != nil {
-		log.E("Failed to check usage limits", tracing.InnerError, err)
-		return nil, err
-	}
+	if !opts.DryRun {
+		limitResult, err := x.usageLimiter.checkAndIncrement(log, user.UserID, userGrade, usageType)
+		if err != nil {
+			log.E("Failed to check usage limits", tracing.InnerError, err)
+			return nil, err
+		}
 
-	if limitResult.Exceeded {
-		if limitResult.IsDaily {
-			return &DialResult{Text: x.localization.LocalizeBy(msg, "MsgDailyLimitExceeded"), IsSummarized: false}, nil
+		if limitResult.Exceeded {
+			if limitResult.IsDaily {
+				return &DialResult{Text: x.localization.LocalizeBy(msg, "MsgDailyLimitExceeded"), IsSummarized: false}, nil
+			}
+			return &DialResult{Text: x.localization.LocalizeBy(msg, "MsgMonthlyLimitExceeded"), IsSummarized: false}, nil
 		}
-		return &DialResult{Text: x.localization.LocalizeBy(msg, "MsgMonthlyLimitExceeded"), IsSummarized: false}, nil
-	}
 
-	tokenLimitResult, err := x.usageLimiter.CheckTokenLimits(log, user.UserID, userGrade)
-	if err != nil {
-		log.E("Failed to check token limits", tracing.InnerError, err)
-		return nil, err
-	}
+		tokenLimitResult, err := x.usageLimiter.CheckTokenLimits(log, user.UserID, userGrade)
+		if err != nil {
+			log.E("Failed to check token limits", tracing.InnerError, err)
+			return nil, err
+		}
 
-	if tokenLimitResult.Exceeded {
-		if tokenLimitResult.IsDaily {
-			return &DialResult{Text: x.localization.LocalizeBy(msg, "MsgDailyTokenLimitExceeded"), IsSummarized: false}, nil
+		if tokenLimitResult.Exceeded {
+			if tokenLimitResult.IsDaily {
+				return &DialResult{Text: x.localization.LocalizeBy(msg, "MsgDailyTokenLimitExceeded"), IsSummarized: false}, nil
+			}
+			return &DialResult{Text: x.localization.LocalizeBy(msg, "MsgMonthlyTokenLimitExceeded"), IsSummarized: false}, nil
 		}
-		return &DialResult{Text: x.localization.LocalizeBy(msg, "MsgMonthlyTokenLimitExceeded"), IsSummarized: false}, nil
 	}
 
-	var tariffModelConfig configuration.AI_TariffModelConfig
-	switch userGrade {
-	case platform.GradeBronze:
-		tariffModelConfig = x.config.AI.TariffModels.Bronze
-	case platform.GradeSilver:
-		tariffModelConfig = x.config.AI.TariffModels.Silver
-	case platform.GradeGold:
-		tariffModelConfig = x.config.AI.TariffModels.Gold
-	default:
-		tariffModelConfig = x.config.AI.TariffModels.Bronze
+	modelGrade := policyModelGrade(userGrade, policy)
+	tariffModelConfig := getTariffModelConfig(x.config, modelGrade)
+
+	modelToUse, modelSource := x.EffectiveModel(log, user, msg.Chat.ID, modelGrade)
+	if policy != nil && policy.Model != "" {
+		modelToUse, modelSource = policy.Model, ModelSourceMode
+	}
+	if assignment != nil && assignment.Variant.Model != "" {
+		modelToUse, modelSource = assignment.Variant.Model, ModelSourceExperiment
+	}
+	fallbackModel := tariffModelConfig.FallbackModel
+	if modelToUse == fallbackModel {
+		fallbackModel = tariffModelConfig.PrimaryModel
 	}
 
-	req = formatUserRequest(persona, req)
+	if opts.ImageURL != "" {
+		if err := x.catalog.Validate(modelToUse, true); errors.Is(err, ErrCatalogModelNoImages) && x.catalog.Validate(fallbackModel, true) == nil {
+			log.W("Selected model does not accept images, using fallback", "model", modelToUse, "fallback_model", fallbackModel)
+			modelToUse, fallbackModel = fallbackModel, ""
+		}
+	}
+
+	req = formatUserRequest(opts.Persona, req)
 	prompt := modeConfig.Prompt
 
 	agentUsage := &AgentUsageAccumulator{}
 
 	var history []platform.RedisMessage
 	summarizationOccurred := false
-	if stackful {
-		history, summarizationOccurred, err = x.contextManager.Fetch(log, platform.ChatID(msg.Chat.ID), userGrade)
+	replyTo := 0
+	if msg.ReplyToMessage != nil && msg.ReplyToMessage.From != nil && msg.ReplyToMessage.From.IsBot {
+		replyTo = msg.ReplyToMessage.MessageID
+	}
+
+	if opts.Stackful && !stateless {
+		chat := x.contextManager.Chat(log, msg)
+		if opts.DryRun {
+			history, summarizationOccurred, err = x.contextManager.Peek(log, chat, userGrade, modelToUse, replyTo)
+		} else {
+			history, summarizationOccurred, err = x.contextManager.Fetch(log, chat, userGrade, modelToUse, replyTo)
+		}
 		if err != nil {
 			log.E("Failed to get message pairs", tracing.InnerError, err)
 			history = []platform.RedisMessage{}
 		}
 	}
 
-	agentDecisions, err := x.runAgentsParallel(ctx, log, history, req, userGrade, agentUsage)
-	if err != nil {
-		log.E("Failed to run agents parallel", tracing.InnerError, err)
-		agentDecisions = &AgentDecisions{}
+	trace.HistoryCount = len(history)
+	trace.Summarized = summarizationOccurred
+	trace.ContextBudget = x.catalog.ContextBudget(modelToUse, 0)
+	for _, h := range history {
+		trace.HistoryTokens += tokenizer.Tokens(log, h.Content)
+	}
+
+	// inline answers skip agents, their latency is the main cost of a fast answer, a dry run only names them
+	agentDecisions := &AgentDecisions{}
+	if opts.DryRun {
+		trace.PlannedAgents = x.plannedAgents(policy)
+	} else if !opts.inline {
+		agentDecisions, err = x.runAgentsParallel(ctx, log, history, req, userGrade, policy, agentUsage)
+		if err != nil {
+			log.E("Failed to run agents parallel", tracing.InnerError, err)
+			agentDecisions = &AgentDecisions{}
+		}
 	}
+	trace.EffortAgent = agentDecisions.EffortSelection
+	trace.LengthAgent = agentDecisions.ResponseLength
 
 	effortSelection := agentDecisions.EffortSelection
 
-	modelToUse := tariffModelConfig.PrimaryModel
-	fallbackModel := tariffModelConfig.FallbackModel
 	var reasoningEffort string
 	var temperature float32
 	var limitWarning string
@@ -250,9 +408,17 @@ func (x *Dialer) Dial(log *tracing.Logger, msg *tgbotapi.Message, req string, im
 	)
 
 	if !agentSuccess {
-		log.E("Effort selection agent failed or returned nil, using defaults")
+		if policy.EffortAgentEnabled() && !opts.inline && !opts.DryRun {
+			log.E("Effort selection agent failed or returned nil, using defaults")
+		}
 		reasoningEffort = "medium"
+		if opts.inline {
+			reasoningEffort = "low"
+		}
 		temperature = 1.0
+		if modeConfig.Params != nil && modeConfig.Params.Temperature != nil && *modeConfig.Params.Temperature != 0 {
+			temperature = *modeConfig.Params.Temperature
+		}
 	} else {
 		reasoningEffort = effortSelection.ReasoningEffort
 
@@ -289,6 +455,17 @@ func (x *Dialer) Dial(log *tracing.Logger, msg *tgbotapi.Message, req string, im
 				fallbackModel = x.config.AI.LimitExceededFallbackModels[0]
 			}
 			reasoningEffort = "low"
+			modelSource = ModelSourceLimitOverride
+
+			// the overridden answer says nothing about the variant, keep it out of the experiment stats
+			assignment = nil
+
+			trace.LimitOverride = &DialTraceOverride{
+				OriginalModel: originalModel,
+				LimitType:     string(spendingErr.LimitType),
+				Spent:         spendingErr.CurrentSpend.String(),
+				Limit:         spendingErr.LimitAmount.String(),
+			}
 
 			log.I("spending_limit_override",
 				"original_model", originalModel,
@@ -313,13 +490,44 @@ func (x *Dialer) Dial(log *tracing.Logger, msg *tgbotapi.Message, req string, im
 		}
 	}
 
+	x.metrics.RecordModelSelection(modelToUse, modelSource)
+	log.I("dialer_model_selected", "model", modelToUse, "fallback_model", fallbackModel, "model_source", modelSource)
+
+	trace.Model, trace.FallbackModel, trace.ModelSource = modelToUse, fallbackModel, modelSource
+	if assignment != nil {
+		trace.Experiment, trace.Variant = assignment.Key, assignment.Variant.Key
+	}
+
+	// extraction rewrites the whole profile, so it runs only when the current one was read, never over one left unread
+	var personalization *entities.Personalization
+	personalizationPrompt := ""
+	personalizationLoaded := false
+	if !stateless && policy.PersonalizationEnabled() {
+		personalization, err = x.personalizations.GetPersonalizationByUser(log, user)
+		if err == nil && personalization != nil {
+			personalizationPrompt = personalization.Prompt
+		}
+		personalizationLoaded = err == nil || errors.Is(err, repository.ErrPersonalizationNotFound)
+	}
+	personalizationUsed := personalizationPrompt != ""
+
+	if rendered, err := x.RenderModePrompt(log, msg, prompt, userGrade, personalizationPrompt); err != nil {
+		log.E("Failed to render mode prompt template, using raw prompt", tracing.ModeId, mode.ID, tracing.InnerError, err)
+	} else {
+		prompt = rendered
+	}
+
+	if instructions, err := x.chatInstructions.GetInstructions(log, msg.Chat.ID); err == nil {
+		prompt += fmt.Sprintf(ChatInstructionsBlockTemplate, instructions.Text)
+		trace.Instructions = true
+	} else if !errors.Is(err, repository.ErrChatInstructionsNotFound) {
+		log.W("Failed to get chat instructions, skipping them", tracing.InnerError, err)
+	}
+
 	prompt += x.formatEnvironmentBlock(msg)
 
-	personalization, err := x.personalizations.GetPersonalizationByUser(log, user)
-	personalizationUsed := false
-	if err == nil && personalization != nil {
-		prompt += fmt.Sprintf(PersonalizationBlockTemplate, personalization.Prompt)
-		personalizationUsed = true
+	if personalizationUsed {
+		prompt += fmt.Sprintf(PersonalizationBlockTemplate, personalizationPrompt)
 	}
 
 	log.I("dialer_personalization_status",
@@ -327,7 +535,10 @@ func (x *Dialer) Dial(log *tracing.Logger, msg *tgbotapi.Message, req string, im
 		"user_id", user.ID,
 	)
 
-	if agentDecisions.ResponseLength != nil {
+	if opts.inline {
+		prompt += x.getResponseLengthGuideline("brief")
+		trace.LengthGuide = true
+	} else if agentDecisions.ResponseLength != nil {
 		log.I("response_length_detected",
 			"length", agentDecisions.ResponseLength.Length,
 			"confidence", agentDecisions.ResponseLength.Confidence,
@@ -335,9 +546,13 @@ func (x *Dialer) Dial(log *tracing.Logger, msg *tgbotapi.Message, req string, im
 		)
 		if guideline := x.getResponseLengthGuideline(agentDecisions.ResponseLength.Length); guideline != "" {
 			prompt += guideline
+			trace.LengthGuide = true
 		}
 	}
 
+	trace.Personalized = personalizationUsed
+	trace.PromptTokens = tokenizer.Tokens(log, prompt)
+
 	messages := []openrouter.ChatCompletionMessage{
 		{
 			Role:    openrouter.ChatMessageRoleSystem,
@@ -372,10 +587,10 @@ func (x *Dialer) Dial(log *tracing.Logger, msg *tgbotapi.Message, req string, im
 		},
 	}
 
-	if imageURL != "" {
+	if opts.ImageURL != "" {
 		userContent.Multi = append(userContent.Multi, openrouter.ChatMessagePart{
 			Type:     openrouter.ChatMessagePartTypeImageURL,
-			ImageURL: &openrouter.ChatMessageImageURL{URL: imageURL, Detail: openrouter.ImageURLDetailHigh},
+			ImageURL: &openrouter.ChatMessageImageURL{URL: opts.ImageURL, Detail: openrouter.ImageURLDetailHigh},
 		})
 	}
 
@@ -409,7 +624,13 @@ func (x *Dialer) Dial(log *tracing.Logger, msg *tgbotapi.Message, req string, im
 
 	request.Transforms = []string{}
 
-	request.Tools = x.buildTools(user)
+	if !opts.inline {
+		request.Tools = x.buildTools(user, policy)
+	}
+
+	if policy != nil && policy.MaxOutputTokens > 0 {
+		request.MaxTokens = policy.MaxOutputTokens
+	}
 
 	request.Temperature = temperature
 
@@ -428,6 +649,20 @@ func (x *Dialer) Dial(log *tracing.Logger, msg *tgbotapi.Message, req string, im
 		}
 	}
 
+	trace.Effort = reasoningEffort
+	trace.Temperature = request.Temperature
+	trace.MaxTokens = request.MaxTokens
+	trace.ProviderSort = string(sort)
+	trace.Tools = make([]string, 0, len(request.Tools))
+	for _, tool := range request.Tools {
+		trace.Tools = append(trace.Tools, tool.Function.Name)
+	}
+
+	if opts.DryRun {
+		log.I("dialer_dry_run_planned", "model", modelToUse, "prompt_tokens", trace.PromptTokens, "history_tokens", trace.HistoryTokens)
+		return &DialResult{IsStateless: stateless, Trace: trace}, nil
+	}
+
 	log = log.With("ai requested", tracing.AiKind, "openrouter/variable", tracing.AiModel, request.Model, "reasoning_effort", reasoningEffort, "temperature", request.Temperature, "context_messages", len(history))
 
 	var responseText string
@@ -442,10 +677,12 @@ func (x *Dialer) Dial(log *tracing.Logger, msg *tgbotapi.Message, req string, im
 		maxWebSearchCalls = 3
 	}
 
-	responseText, banNotice, totalTokens, totalCost, cacheReadTokens, cacheWriteTokens, err = x.dialNonStreaming(ctx, log, user, msg, request, messages, modelToUse, userGrade, agentUsage, &webSearchCalls, maxWebSearchCalls)
+	dialStart := time.Now()
+	responseText, banNotice, totalTokens, totalCost, cacheReadTokens, cacheWriteTokens, err = x.dialNonStreaming(ctx, log, user, msg, request, messages, modelToUse, userGrade, agentUsage, &webSearchCalls, maxWebSearchCalls, trace)
 	if err != nil {
 		return nil, err
 	}
+	latency := time.Since(dialStart)
 
 	if err := x.messages.SaveMessage(log, msg, false); err != nil {
 		log.E("Error saving user message", tracing.InnerError, err)
@@ -454,22 +691,51 @@ func (x *Dialer) Dial(log *tracing.Logger, msg *tgbotapi.Message, req string, im
 		log.E("Error saving Xi response", tracing.InnerError, err)
 	}
 
-	userMessage := platform.RedisMessage{Role: platform.MessageRoleUser, Content: req}
-	if err := x.contextManager.Store(log, platform.ChatID(msg.Chat.ID), userGrade, userMessage); err != nil {
-		log.E("Error saving user message to context", tracing.InnerError, err)
-	}
+	stored := false
+	replyBranch := ""
+	if !stateless {
+		chat := x.contextManager.Chat(log, msg)
+
+		if opts.Stackful {
+			replyBranch, err = x.contextManager.ContinueFromReply(log, chat, replyTo, msg.MessageID)
+			if err != nil {
+				log.E("Error continuing context from reply", tracing.InnerError, err)
+			}
+		}
+
+		userMessage := platform.RedisMessage{Role: platform.MessageRoleUser, Content: req, MessageID: msg.MessageID}
+		userErr := x.contextManager.Store(log, chat, userGrade, userMessage)
+		if userErr != nil {
+			log.E("Error saving user message to context", tracing.InnerError, userErr)
+		}
+
+		assistantMessage := platform.RedisMessage{Role: platform.MessageRoleAssistant, Content: responseText, ReplyTo: msg.MessageID}
+		assistantErr := x.contextManager.Store(log, chat, userGrade, assistantMessage)
+		if assistantErr != nil {
+			log.E("Error saving assistant message to context", tracing.InnerError, assistantErr)
+		}
 
-	assistantMessage := platform.RedisMessage{Role: platform.MessageRoleAssistant, Content: responseText}
-	if err := x.contextManager.Store(log, platform.ChatID(msg.Chat.ID), userGrade, assistantMessage); err != nil {
-		log.E("Error saving assistant message to context", tracing.InnerError, err)
+		stored = userErr == nil && assistantErr == nil
 	}
 
 	anotherCost := decimal.NewFromFloat(agentUsage.GetCost())
 	anotherTokens := agentUsage.GetTotalTokens()
-	if err := x.usage.SaveUsage(log, user.ID, msg.Chat.ID, totalCost, totalTokens, cacheReadTokens, cacheWriteTokens, anotherCost, anotherTokens); err != nil {
+	usageResponse := repository.UsageResponse{Model: modelToUse, Mode: mode, Latency: latency, Assignment: assignment, Source: source}
+	usage, err := x.usage.SaveUsage(log, user.ID, msg.Chat.ID, totalCost, totalTokens, cacheReadTokens, cacheWriteTokens, anotherCost, anotherTokens, incognito, usageResponse)
+	if err != nil {
 		log.E("Error saving usage", tracing.InnerError, err)
 	}
 
+	trace.Tokens, trace.Cost = totalTokens, totalCost.String()
+	trace.AgentTokens, trace.AgentCost = anotherTokens, anotherCost.String()
+	trace.Latency = latency
+	trace.Incognito = incognito
+
+	// incognito answers leave no trace, tool arguments would reveal what was asked
+	if usage != nil && !stateless {
+		x.traces.Save(log, usage.ID, trace)
+	}
+
 	totalTokensUsed := totalTokens + anotherTokens
 	if err := x.usageLimiter.AddTokens(log, user.UserID, totalTokensUsed); err != nil {
 		log.E("Error adding tokens to limiter", tracing.InnerError, err)
@@ -482,7 +748,7 @@ func (x *Dialer) Dial(log *tracing.Logger, msg *tgbotapi.Message, req string, im
 
 	x.spendingLimiter.AddSpend(log, user, totalCost)
 
-	if x.features.IsEnabled(features.FeaturePersonalizationExtraction) {
+	if x.features.IsEnabled(features.FeaturePersonalizationExtraction) && personalizationLoaded {
 		go x.extractAndSavePersonalization(log, user, req, personalization)
 	}
 
@@ -494,10 +760,28 @@ func (x *Dialer) Dial(log *tracing.Logger, msg *tgbotapi.Message, req string, im
 		responseText += banNotice
 	}
 
-	return &DialResult{
+	if incognito && opts.sandbox == nil && !opts.inline {
+		responseText += x.localization.LocalizeBy(msg, "MsgIncognitoMarker")
+	}
+
+	// the whole chat follows the active branch, so everyone sees where the conversation went
+	if replyBranch != "" {
+		responseText += x.localization.LocalizeByTd(msg, "MsgContextReplyBranchMarker", map[string]interface{}{
+			"Name": replyBranch,
+		})
+	}
+
+	result := &DialResult{
 		Text:         responseText,
 		IsSummarized: summarizationOccurred,
-	}, nil
+		IsStateless:  stateless,
+		IsStored:     stored,
+	}
+	if usage != nil {
+		result.UsageID = usage.ID
+	}
+
+	return result, nil
 }
 
 func (x *Dialer) dialNonStreaming(
@@ -512,6 +796,7 @@ func (x *Dialer) dialNonStreaming(
 	agentUsage *AgentUsageAccumulator,
 	webSearchCalls *int,
 	maxWebSearchCalls int,
+	trace *DialTrace,
 ) (string, string, int, decimal.Decimal, int, int, error) {
 	var responseText string
 	var banNotice string
@@ -556,6 +841,7 @@ func (x *Dialer) dialNonStreaming(
 	responseText = choice.Message.Content.Text
 
 	finishReason := choice.FinishReason
+	trace.AddIteration(DialTraceIteration{Duration: duration, Tokens: response.Usage.TotalTokens, Cost: response.Usage.Cost, FinishReason: string(finishReason)})
 	log.I("ai_response_finish_reason", "finish_reason", finishReason)
 
 	switch finishReason {
@@ -588,7 +874,7 @@ func (x *Dialer) dialNonStreaming(
 		break
 	}
 
-		toolResults := x.processToolCalls(log, user, msg, choice.Message.ToolCalls, &banNotice, webSearchCalls, maxWebSearchCalls, agentUsage)
+		toolResults := x.processToolCalls(log, user, msg, choice.Message.ToolCalls, &banNotice, webSearchCalls, maxWebSearchCalls, agentUsage, trace)
 
 		if len(toolResults) == 0 {
 			break
@@ -628,14 +914,21 @@ func (x *Dialer) processToolCalls(
 	webSearchCalls *int,
 	maxWebSearchCalls int,
 	agentUsage *AgentUsageAccumulator,
+	trace *DialTrace,
 ) []ToolResult {
 	var results []ToolResult
 
 	for _, toolCall := range toolCalls {
+		callStart := time.Now()
+		record := func(err string) {
+			trace.AddToolCall(toolCall.Function.Name, toolCall.Function.Arguments, time.Since(callStart), err)
+		}
+
 		switch toolCall.Function.Name {
 		case "web_search":
 			if *webSearchCalls >= maxWebSearchCalls {
 				log.W("Web search call limit reached", "max", maxWebSearchCalls)
+				record("call limit reached")
 				results = append(results, ToolResult{
 					ToolCallID: toolCall.ID,
 					Content:    "Web search limit reached for this query. Please provide your response based on the information already gathered.",
@@ -652,6 +945,7 @@ func (x *Dialer) processToolCalls(
 
 			if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &searchArgs); err != nil {
 				log.E("Failed to parse web_search tool arguments", tracing.InnerError, err)
+				record(err.Error())
 				results = append(results, ToolResult{
 					ToolCallID: toolCall.ID,
 					Content:    "Error: Failed to parse search parameters.",
@@ -664,6 +958,7 @@ func (x *Dialer) processToolCalls(
 			searchResult, err := x.agentSystem.WebSearch(log, searchArgs.Query, searchArgs.IsDeepSearch, searchArgs.Effort, agentUsage)
 			if err != nil {
 				log.E("Web search agent error", tracing.InnerError, err)
+				record(err.Error())
 				results = append(results, ToolResult{
 					ToolCallID: toolCall.ID,
 					Content:    "Error: Web search failed. Please try to answer based on your knowledge.",
@@ -671,6 +966,7 @@ func (x *Dialer) processToolCalls(
 				continue
 			}
 
+			record(searchResult.Error)
 			if searchResult.Error != "" {
 				results = append(results, ToolResult{
 					ToolCallID: toolCall.ID,
@@ -694,13 +990,16 @@ func (x *Dialer) processToolCalls(
 
 			if err := json.Unmarshal([]byte(toolCall.Function.Arguments), &banArgs); err != nil {
 				log.E("Failed to parse ban tool arguments", tracing.InnerError, err)
+				record(err.Error())
 				continue
 			}
 
 			_, err := x.bans.CreateBan(log, user.ID, msg.Chat.ID, banArgs.Reason, banArgs.Duration)
 			if err != nil {
 				log.E("Failed to create ban from tool call", tracing.InnerError, err)
+				record(err.Error())
 			} else {
+				record("")
 				log.I("Ban created by LLM", "user_id", user.ID, "duration", banArgs.Duration, "reason", banArgs.Reason, "notice", banArgs.Notice)
 				if banArgs.Notice != "" {
 					*banNotice = "\n\n" + banArgs.Notice
@@ -713,12 +1012,12 @@ func (x *Dialer) processToolCalls(
 }
 
 
-func (x *Dialer) buildTools(user *entities.User) []openrouter.Tool {
+func (x *Dialer) buildTools(user *entities.User, policy *repository.ModePolicy) []openrouter.Tool {
 	tools := []openrouter.Tool{
 		{
 			Type: openrouter.ToolTypeFunction,
 			Function: &openrouter.FunctionDefinition{
-				Name:        "web_search",
+				Name:        repository.ModeToolWebSearch,
 				Description: "Search the web for current, real-time information. Use ONLY when:\n\n1. User explicitly asks about current events, news, or recent happenings\n2. Question involves time-sensitive data (prices, stocks, weather, sports scores)\n3. User asks 'what is happening now', 'latest news about', 'current status of'\n4. Need to verify facts that may have changed recently\n5. Question mentions specific dates in the future or recent past\n6. Looking for real-time statistics or live data\n\nDO NOT USE for:\n- General knowledge questions\n- Historical facts\n- Programming/coding help\n- Math calculations\n- Personal advice\n- Creative writing\n- Explaining concepts\n- Anything you already know with confidence",
 				Parameters: map[string]interface{}{
 					"type": "object",
@@ -747,7 +1046,7 @@ func (x *Dialer) buildTools(user *entities.User) []openrouter.Tool {
 		tools = append(tools, openrouter.Tool{
 			Type: openrouter.ToolTypeFunction,
 			Function: &openrouter.FunctionDefinition{
-				Name:        "temporary_ban",
+				Name:        repository.ModeToolTemporaryBan,
 				Description: "Temporarily ban user for violations. STRICT RULES:\n\nWHEN TO CALL:\n- Minimum 3 similar violations within last 10 messages\n- After explicit warning given (or include warning in current response)\n- Pattern of repeated behavior, NOT isolated incident\n- User ignored previous warning\n\nVIOLATION TYPES (severity → duration):\n1. Explicit prolonged rudeness/insults → 30m-2h\n2. Explicit prolonged trolling → 10m-1h\n3. Explicit prolonged spam/flood → 1m-10m\n4. Meaningless message chains → 1m-5m\n5. Very heavy computational tasks → 30s-2m\n\nDO NOT BAN FOR:\n- Criticism, disagreement, debate\n- Single off-topic messages\n- Poor language quality, typos, slang\n- Questions or confusion\n- First-time minor violations\n- Sarcasm or humor\n- Simple misunderstandings\n\nPROCESS:\n1. Warn user first (in current response)\n2. If violation continues → call this tool\n3. Tool will send notice to user automatically\n4. Do NOT mention ban in your response text\n\nMax ban: 12h. When in doubt, DON'T call.",
 				Parameters: map[string]interface{}{
 					"type": "object",
@@ -772,7 +1071,10 @@ func (x *Dialer) buildTools(user *entities.User) []openrouter.Tool {
 		})
 	}
 
-	return tools
+	// The mode policy may narrow the tool set, e.g. a roleplay mode without web search
+	return slices.DeleteFunc(tools, func(tool openrouter.Tool) bool {
+		return !policy.AllowsTool(tool.Function.Name)
+	})
 }
 
 func (x *Dialer) getResponseLengthGuideline(length string) string {
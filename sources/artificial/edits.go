@@ -0,0 +1,181 @@
+package artificial
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+	"ximanager/sources/platform"
+	"ximanager/sources/tracing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Maps an answered user message to the Telegram messages carrying its answer, lives only for the edit window
+func (x *ContextManager) getAnswerKey(chat platform.ChatTopic, requestID int) string {
+	return fmt.Sprintf("chat_answer:%s:%d", chat, requestID)
+}
+
+// RememberAnswer keeps reply IDs of requestID for the edit window, so an edit of the request can rewrite them in place
+func (x *ContextManager) RememberAnswer(logger *tracing.Logger, chat platform.ChatTopic, requestID int, replyIDs []int) {
+	window := x.config.Telegram.Edits.Window
+	if window <= 0 || requestID == 0 || len(replyIDs) == 0 {
+		return
+	}
+
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 5*time.Second)
+	defer cancel()
+
+	key := x.getAnswerKey(chat, requestID)
+	values := make([]interface{}, 0, len(replyIDs))
+	for _, replyID := range replyIDs {
+		values = append(values, replyID)
+	}
+
+	pipe := x.redis.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.RPush(ctx, key, values...)
+	pipe.Expire(ctx, key, window)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.W("Failed to remember answer messages", "key", key, tracing.InnerError, err)
+	}
+}
+
+// AnswerOf returns reply IDs of requestID in the order they were sent, empty when the edit window is over
+func (x *ContextManager) AnswerOf(logger *tracing.Logger, chat platform.ChatTopic, requestID int) []int {
+	if x.config.Telegram.Edits.Window <= 0 {
+		return nil
+	}
+
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 5*time.Second)
+	defer cancel()
+
+	key := x.getAnswerKey(chat, requestID)
+	values, err := x.redis.LRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		logger.W("Failed to get answer messages", "key", key, tracing.InnerError, err)
+		return nil
+	}
+
+	replyIDs := make([]int, 0, len(values))
+	for _, value := range values {
+		replyID, err := strconv.Atoi(value)
+		if err != nil {
+			continue
+		}
+		replyIDs = append(replyIDs, replyID)
+	}
+
+	return replyIDs
+}
+
+// Rewind removes the user turn of requestID and the answers to it from the active branch, so the edited request
+// can be dialed again. Turns already folded into a summary are left as is. The returned restore puts the removed
+// turns back when the edited request could not be answered, so a failed dial does not lose them.
+func (x *ContextManager) Rewind(logger *tracing.Logger, chat platform.ChatTopic, requestID int) (func(), error) {
+	defer tracing.ProfilePoint(logger, "Context rewind completed", "artificial.context.rewind", "chat_id", chat, "request_id", requestID)()
+
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 10*time.Second)
+	defer cancel()
+
+	key := x.historyKey(logger, chat)
+	limits := x.getContextLimits("")
+
+	removed := 0
+	var original []interface{}
+	var kept []interface{}
+
+	// WATCH guards against a concurrent Store between reading and rewriting the list
+	err := x.redis.Watch(ctx, func(tx *redis.Tx) error {
+		messageStrings, err := tx.LRange(ctx, key, 0, -1).Result()
+		if err != nil {
+			return err
+		}
+
+		original = make([]interface{}, 0, len(messageStrings))
+		kept = make([]interface{}, 0, len(messageStrings))
+		removed = 0
+
+		for _, msgStr := range messageStrings {
+			original = append(original, msgStr)
+
+			var message platform.RedisMessage
+			if err := json.Unmarshal([]byte(msgStr), &message); err == nil && !message.IsCompressed {
+				isRequest := message.Role == platform.MessageRoleUser && message.MessageID == requestID
+				isAnswer := message.Role == platform.MessageRoleAssistant && message.ReplyTo == requestID
+				if isRequest || isAnswer {
+					removed++
+					continue
+				}
+			}
+			kept = append(kept, msgStr)
+		}
+
+		if removed == 0 {
+			return nil
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			if len(kept) > 0 {
+				pipe.RPush(ctx, key, kept...)
+				pipe.Expire(ctx, key, time.Duration(limits.TTL)*time.Second)
+			}
+			return nil
+		})
+		return err
+	}, key)
+
+	if err != nil {
+		logger.E("Failed to rewind chat history", "key", key, tracing.InnerError, err)
+		return func() {}, err
+	}
+
+	logger.I("Chat history rewound for edited message", "chat_id", chat, "request_id", requestID, "removed", removed)
+	if removed == 0 {
+		return func() {}, nil
+	}
+
+	return func() { x.restoreRewound(logger, key, original, len(kept)) }, nil
+}
+
+// restoreRewound writes back the history as it was before Rewind, unless anything was stored or dropped since
+func (x *ContextManager) restoreRewound(logger *tracing.Logger, key string, original []interface{}, rewoundLen int) {
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 10*time.Second)
+	defer cancel()
+
+	limits := x.getContextLimits("")
+	restored := false
+
+	err := x.redis.Watch(ctx, func(tx *redis.Tx) error {
+		length, err := tx.LLen(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if int(length) != rewoundLen {
+			return nil
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, key)
+			pipe.RPush(ctx, key, original...)
+			pipe.Expire(ctx, key, time.Duration(limits.TTL)*time.Second)
+			return nil
+		})
+		restored = err == nil
+		return err
+	}, key)
+
+	if err != nil {
+		logger.E("Failed to restore rewound chat history", "key", key, tracing.InnerError, err)
+		return
+	}
+	if !restored {
+		logger.W("Chat history changed since rewind, rewound turns are not restored", "key", key)
+		return
+	}
+
+	logger.I("Rewound chat history restored", "key", key, "message_count", len(original))
+}
@@ -13,5 +13,7 @@ var Module = fx.Module(
 		NewDialer,
 		NewWhisper,
 		NewAgentSystem,
+		NewModelCatalog,
+		NewTraceStore,
 	),
 )
\ No newline at end of file
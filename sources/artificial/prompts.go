@@ -22,6 +22,16 @@ Date and time: %s
 Participant: '%s'
 
 Message:
+%s`
+
+	ChatInstructionsBlockTemplate = `
+
+⸻
+
+📜 Chat instructions
+
+Administrators of this chat asked to follow these instructions on top of the mode above, unless they contradict it or safety rules:
+
 %s`
 
 	PersonalizationBlockTemplate = `
@@ -0,0 +1,121 @@
+package artificial
+
+import (
+	"ximanager/sources/configuration"
+	"ximanager/sources/persistence/entities"
+	"ximanager/sources/platform"
+	"ximanager/sources/repository"
+	"ximanager/sources/tracing"
+)
+
+const (
+	ModelSourceTariff        = "tariff"
+	ModelSourceUser          = "user"
+	ModelSourceLimitOverride = "limit_override"
+	ModelSourceMode          = "mode"
+	ModelSourceExperiment    = "experiment"
+)
+
+func getTariffModelConfig(config *configuration.Config, userGrade platform.UserGrade) configuration.AI_TariffModelConfig {
+	switch userGrade {
+	case platform.GradeSilver:
+		return config.AI.TariffModels.Silver
+	case platform.GradeGold:
+		return config.AI.TariffModels.Gold
+	default:
+		return config.AI.TariffModels.Bronze
+	}
+}
+
+func gradeRank(grade platform.UserGrade) int {
+	switch grade {
+	case platform.GradeGold:
+		return 2
+	case platform.GradeSilver:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// policyModelGrade returns the grade whose tariff models serve the request, a mode may require a higher one
+func policyModelGrade(userGrade platform.UserGrade, policy *repository.ModePolicy) platform.UserGrade {
+	if policy == nil || policy.MinGrade == "" || gradeRank(policy.MinGrade) <= gradeRank(userGrade) {
+		return userGrade
+	}
+	return policy.MinGrade
+}
+
+// SelectableModels returns models a user of the grade may pick, the tariff primary model always goes first.
+// Models the provider catalog does not serve are skipped, missing titles and price hints are taken from the catalog.
+func (x *Dialer) SelectableModels(userGrade platform.UserGrade) []configuration.AI_SelectableModelConfig {
+	tariffModelConfig := getTariffModelConfig(x.config, userGrade)
+
+	models := []configuration.AI_SelectableModelConfig{x.describeModel(configuration.AI_SelectableModelConfig{Model: tariffModelConfig.PrimaryModel})}
+	for _, selectable := range tariffModelConfig.SelectableModels {
+		if selectable.Model == tariffModelConfig.PrimaryModel {
+			models[0] = x.describeModel(selectable)
+			continue
+		}
+		if x.catalog.Validate(selectable.Model, false) != nil {
+			continue
+		}
+		models = append(models, x.describeModel(selectable))
+	}
+
+	return models
+}
+
+func (x *Dialer) describeModel(selectable configuration.AI_SelectableModelConfig) configuration.AI_SelectableModelConfig {
+	if entry, ok := x.catalog.Lookup(selectable.Model); ok && selectable.Title == "" {
+		selectable.Title = entry.Name
+	}
+	if selectable.Title == "" {
+		selectable.Title = selectable.Model
+	}
+	if selectable.PriceHint == "" {
+		selectable.PriceHint = x.catalog.PriceHint(selectable.Model)
+	}
+	return selectable
+}
+
+func (x *Dialer) IsModelSelectable(userGrade platform.UserGrade, model string) bool {
+	for _, selectable := range x.SelectableModels(userGrade) {
+		if selectable.Model == model {
+			return true
+		}
+	}
+	return false
+}
+
+// PreferredModel returns the model chosen by the user for the chat, or an empty string if there is no choice
+// or the chosen model is not allowed by the current tariff anymore
+func (x *Dialer) PreferredModel(log *tracing.Logger, user *entities.User, chatID int64, userGrade platform.UserGrade) string {
+	model, err := x.modelPreferences.GetModel(log, user, chatID)
+	if err != nil || model == "" {
+		return ""
+	}
+
+	if !x.IsModelSelectable(userGrade, model) {
+		log.W("Preferred model is not allowed by tariff anymore, ignoring", "model", model, "user_grade", userGrade)
+		return ""
+	}
+
+	return model
+}
+
+// EffectiveModel returns the model that will answer the user in the chat, without spending limit overrides
+func (x *Dialer) EffectiveModel(log *tracing.Logger, user *entities.User, chatID int64, userGrade platform.UserGrade) (string, string) {
+	if model := x.PreferredModel(log, user, chatID, userGrade); model != "" {
+		return model, ModelSourceUser
+	}
+	return getTariffModelConfig(x.config, userGrade).PrimaryModel, ModelSourceTariff
+}
+
+func (x *Dialer) SetPreferredModel(log *tracing.Logger, user *entities.User, chatID int64, model string) error {
+	return x.modelPreferences.SetModel(log, user, chatID, model)
+}
+
+func (x *Dialer) ResetPreferredModel(log *tracing.Logger, user *entities.User, chatID int64) error {
+	return x.modelPreferences.ResetModel(log, user, chatID)
+}
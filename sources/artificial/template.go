@@ -0,0 +1,254 @@
+package artificial
+
+import (
+	"errors"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+	"unicode/utf8"
+	"ximanager/sources/platform"
+	"ximanager/sources/tracing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const promptTemplateMaxOutput = 64 * 1024
+
+var (
+	ErrPromptTemplateTooLarge = errors.New("rendered prompt template is too large")
+	ErrPromptTemplateRange    = errors.New("range is allowed only over a field like .Vars and cannot be nested")
+	ErrPromptTemplateCall     = errors.New("define, block and template actions are not allowed")
+)
+
+// PromptTemplateData is everything a mode prompt template can refer to, e.g. "{{.FirstName}}" or "{{.Vars.city}}"
+type PromptTemplateData struct {
+	FirstName       string
+	LastName        string
+	Username        string
+	Language        string
+	Grade           string
+	ChatType        string
+	ChatTitle       string
+	Now             time.Time
+	Personalization string
+	Vars            map[string]string
+}
+
+// promptTemplateFuncs is the whole function set available to templates besides the text/template builtins
+var promptTemplateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+	"default": func(fallback string, value string) string {
+		if strings.TrimSpace(value) == "" {
+			return fallback
+		}
+		return value
+	},
+	"date": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+	"truncate": func(length int, value string) string {
+		if length < 0 || utf8.RuneCountInString(value) <= length {
+			return value
+		}
+		return string([]rune(value)[:length]) + "…"
+	},
+}
+
+// IsPromptTemplate reports whether the prompt has template actions, plain prompts are used as is
+func IsPromptTemplate(prompt string) bool {
+	return strings.Contains(prompt, "{{")
+}
+
+func parsePromptTemplate(prompt string) (*template.Template, error) {
+	tmpl, err := template.New("prompt").Funcs(promptTemplateFuncs).Option("missingkey=zero").Parse(prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkPromptTemplate(tmpl); err != nil {
+		return nil, err
+	}
+
+	return tmpl, nil
+}
+
+// checkPromptTemplate rejects loops the output limit cannot stop, as they write nothing: ranges over integers
+// (e.g. {{range 200000000}}), variables and function results, nested ranges and recursive template calls.
+// What is left ranges once over the chat variables at most.
+func checkPromptTemplate(tmpl *template.Template) error {
+	if len(tmpl.Templates()) > 1 {
+		return ErrPromptTemplateCall
+	}
+	if tmpl.Tree == nil {
+		return nil
+	}
+	return checkPromptNode(tmpl.Tree.Root, false)
+}
+
+func checkPromptNode(node parse.Node, inRange bool) error {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return nil
+		}
+		for _, child := range node.Nodes {
+			if err := checkPromptNode(child, inRange); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return checkPromptPipe(node.Pipe, inRange)
+	case *parse.IfNode:
+		return checkPromptBranch(&node.BranchNode, inRange)
+	case *parse.WithNode:
+		return checkPromptBranch(&node.BranchNode, inRange)
+	case *parse.RangeNode:
+		if inRange || !isPromptField(node.Pipe) {
+			return ErrPromptTemplateRange
+		}
+		return checkPromptBranch(&node.BranchNode, true)
+	case *parse.TemplateNode:
+		return ErrPromptTemplateCall
+	}
+	return nil
+}
+
+func checkPromptBranch(node *parse.BranchNode, inRange bool) error {
+	if err := checkPromptPipe(node.Pipe, inRange); err != nil {
+		return err
+	}
+	if err := checkPromptNode(node.List, inRange); err != nil {
+		return err
+	}
+	return checkPromptNode(node.ElseList, inRange)
+}
+
+// checkPromptPipe looks into parenthesized pipelines, they are the only way to nest actions into arguments
+func checkPromptPipe(pipe *parse.PipeNode, inRange bool) error {
+	if pipe == nil {
+		return nil
+	}
+	for _, cmd := range pipe.Cmds {
+		for _, arg := range cmd.Args {
+			if nested, ok := arg.(*parse.PipeNode); ok {
+				if err := checkPromptPipe(nested, inRange); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// isPromptField reports whether the pipeline is a bare field of the data, e.g. .Vars or $.Vars
+func isPromptField(pipe *parse.PipeNode) bool {
+	if pipe == nil || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+
+	switch arg := pipe.Cmds[0].Args[0].(type) {
+	case *parse.FieldNode:
+		return true
+	case *parse.VariableNode:
+		return len(arg.Ident) > 1 && arg.Ident[0] == "$"
+	}
+	return false
+}
+
+// ValidatePromptTemplate parses the prompt and renders it with sample data, so both syntax and field errors surface on save
+func ValidatePromptTemplate(prompt string) error {
+	if !IsPromptTemplate(prompt) {
+		return nil
+	}
+
+	_, err := RenderPromptTemplate(prompt, SamplePromptTemplateData())
+	return err
+}
+
+func RenderPromptTemplate(prompt string, data *PromptTemplateData) (string, error) {
+	if !IsPromptTemplate(prompt) {
+		return prompt, nil
+	}
+
+	tmpl, err := parsePromptTemplate(prompt)
+	if err != nil {
+		return "", err
+	}
+
+	output := &limitedBuilder{limit: promptTemplateMaxOutput}
+	if err := tmpl.Execute(output, data); err != nil {
+		return "", err
+	}
+
+	return output.String(), nil
+}
+
+func SamplePromptTemplateData() *PromptTemplateData {
+	return &PromptTemplateData{
+		FirstName: "Xi",
+		Username:  "xi",
+		Language:  "en",
+		Grade:     string(platform.GradeBronze),
+		ChatType:  "private",
+		ChatTitle: "Private chat",
+		Now:       time.Now().In(time.Local),
+		Vars:      map[string]string{},
+	}
+}
+
+// limitedBuilder stops the template execution once the output grows over the limit
+type limitedBuilder struct {
+	strings.Builder
+	limit int
+}
+
+func (x *limitedBuilder) Write(p []byte) (int, error) {
+	if x.Len()+len(p) > x.limit {
+		return 0, ErrPromptTemplateTooLarge
+	}
+	return x.Builder.Write(p)
+}
+
+// PromptTemplateData collects the template values for the message, personalization is empty for incognito requests
+func (x *Dialer) PromptTemplateData(log *tracing.Logger, msg *tgbotapi.Message, userGrade platform.UserGrade, personalization string) *PromptTemplateData {
+	data := &PromptTemplateData{
+		Grade:           string(userGrade),
+		ChatType:        msg.Chat.Type,
+		ChatTitle:       msg.Chat.Title,
+		Now:             time.Now().In(time.Local),
+		Personalization: personalization,
+		Vars:            map[string]string{},
+	}
+
+	if msg.From != nil {
+		data.FirstName = msg.From.FirstName
+		data.LastName = msg.From.LastName
+		data.Username = msg.From.UserName
+		data.Language = msg.From.LanguageCode
+	}
+
+	if data.ChatTitle == "" && msg.Chat.Type == "private" {
+		data.ChatTitle = "Private chat"
+	}
+
+	vars, err := x.chatVariables.GetVariables(log, msg.Chat.ID)
+	if err != nil {
+		log.W("Failed to get chat variables for prompt template", tracing.InnerError, err)
+	} else {
+		data.Vars = vars
+	}
+
+	return data
+}
+
+// RenderModePrompt renders the mode prompt for the message
+func (x *Dialer) RenderModePrompt(log *tracing.Logger, msg *tgbotapi.Message, prompt string, userGrade platform.UserGrade, personalization string) (string, error) {
+	if !IsPromptTemplate(prompt) {
+		return prompt, nil
+	}
+
+	return RenderPromptTemplate(prompt, x.PromptTemplateData(log, msg, userGrade, personalization))
+}
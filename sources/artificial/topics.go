@@ -0,0 +1,69 @@
+package artificial
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"ximanager/sources/platform"
+	"ximanager/sources/tracing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+func (x *ContextManager) getContextTopicsKey(chatID platform.ChatID) string {
+	return fmt.Sprintf("chat_context_topics:%d", chatID)
+}
+
+// SetPerTopic makes every forum topic of the chat keep its own history, branches included.
+// Histories are not moved, switching it on starts topics empty and switching it off returns to the chat history
+func (x *ContextManager) SetPerTopic(logger *tracing.Logger, chatID platform.ChatID, perTopic bool) error {
+	defer tracing.ProfilePoint(logger, "Context set per topic completed", "artificial.context.set.per_topic", "chat_id", chatID, "per_topic", perTopic)()
+
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 5*time.Second)
+	defer cancel()
+
+	key := x.getContextTopicsKey(chatID)
+
+	var err error
+	if perTopic {
+		err = x.redis.Set(ctx, key, "1", 0).Err()
+	} else {
+		// Remove the key to share the history (default)
+		err = x.redis.Del(ctx, key).Err()
+	}
+	if err != nil {
+		logger.E("Failed to change context per topic status", "key", key, tracing.InnerError, err)
+		return err
+	}
+
+	logger.I("Context per topic status changed", "chat_id", chatID, "per_topic", perTopic)
+	return nil
+}
+
+func (x *ContextManager) IsPerTopic(logger *tracing.Logger, chatID platform.ChatID) bool {
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 5*time.Second)
+	defer cancel()
+
+	key := x.getContextTopicsKey(chatID)
+	val, err := x.redis.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return false
+	}
+	if err != nil {
+		logger.W("Failed to check context per topic status, assuming shared", tracing.InnerError, err)
+		return false
+	}
+
+	return val == "1"
+}
+
+// Chat resolves the history scope of the message: its forum topic when the chat keeps history per topic, else the whole chat
+func (x *ContextManager) Chat(logger *tracing.Logger, msg *tgbotapi.Message) platform.ChatTopic {
+	chat := platform.ChatTopic{ChatID: platform.ChatID(msg.Chat.ID)}
+	if !msg.Chat.IsSuperGroup() || !x.IsPerTopic(logger, chat.ChatID) {
+		return chat
+	}
+
+	return x.topics.Topic(logger, msg)
+}
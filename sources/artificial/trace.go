@@ -0,0 +1,182 @@
+package artificial
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+	"ximanager/sources/platform"
+	"ximanager/sources/tracing"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	dialTraceTTL             = 24 * time.Hour
+	dialTraceToolArgsMaxSize = 300
+)
+
+// DialTrace records every decision the dialer made for one request, it is kept in Redis for a short time for /debug
+type DialTrace struct {
+	CreatedAt time.Time `json:"created_at"`
+	ChatID    int64     `json:"chat_id"`
+	MessageID int       `json:"message_id"`
+	DryRun    bool      `json:"dry_run,omitempty"`
+	Incognito bool      `json:"incognito,omitempty"`
+
+	UserGrade   platform.UserGrade `json:"user_grade"`
+	ModeType    string             `json:"mode_type"`
+	ModeVersion int                `json:"mode_version"`
+	Experiment  string             `json:"experiment,omitempty"`
+	Variant     string             `json:"variant,omitempty"`
+
+	EffortAgent *EffortSelectionResponse `json:"effort_agent,omitempty"`
+	LengthAgent *ResponseLengthResponse  `json:"length_agent,omitempty"`
+	// PlannedAgents are the agents a dry run would have called, it calls none of them
+	PlannedAgents []string `json:"planned_agents,omitempty"`
+
+	Model         string               `json:"model"`
+	FallbackModel string               `json:"fallback_model,omitempty"`
+	ModelSource   string               `json:"model_source"`
+	LimitOverride *DialTraceOverride   `json:"limit_override,omitempty"`
+	Effort        string               `json:"effort"`
+	Temperature   float32              `json:"temperature"`
+	MaxTokens     int                  `json:"max_tokens,omitempty"`
+	ProviderSort  string               `json:"provider_sort"`
+	Tools         []string             `json:"tools"`
+	Personalized  bool                 `json:"personalized,omitempty"`
+	Instructions  bool                 `json:"chat_instructions,omitempty"`
+	LengthGuide   bool                 `json:"length_guide,omitempty"`
+	PromptTokens  int                  `json:"prompt_tokens"`
+	HistoryCount  int                  `json:"history_count"`
+	HistoryTokens int                  `json:"history_tokens"`
+	ContextBudget int                  `json:"context_budget"`
+	Summarized    bool                 `json:"summarized,omitempty"`
+	Iterations    []DialTraceIteration `json:"iterations,omitempty"`
+	ToolCalls     []DialTraceToolCall  `json:"tool_calls,omitempty"`
+
+	Tokens      int           `json:"tokens"`
+	Cost        string        `json:"cost"`
+	AgentTokens int           `json:"agent_tokens"`
+	AgentCost   string        `json:"agent_cost"`
+	Latency     time.Duration `json:"latency"`
+}
+
+// DialTraceOverride describes the spending limiter replacing the selected model
+type DialTraceOverride struct {
+	OriginalModel string `json:"original_model"`
+	LimitType     string `json:"limit_type"`
+	Spent         string `json:"spent"`
+	Limit         string `json:"limit"`
+}
+
+// DialTraceIteration is one completion call of the main model, tool calls make more than one
+type DialTraceIteration struct {
+	Duration     time.Duration `json:"duration"`
+	Tokens       int           `json:"tokens"`
+	Cost         float64       `json:"cost"`
+	FinishReason string        `json:"finish_reason"`
+}
+
+type DialTraceToolCall struct {
+	Name      string        `json:"name"`
+	Arguments string        `json:"arguments,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	Error     string        `json:"error,omitempty"`
+}
+
+func (t *DialTrace) AddIteration(iteration DialTraceIteration) {
+	t.Iterations = append(t.Iterations, iteration)
+}
+
+// AddToolCall stores the call, arguments are cut since web search queries may be long and are not needed in full
+func (t *DialTrace) AddToolCall(name string, arguments string, duration time.Duration, err string) {
+	if runes := []rune(arguments); len(runes) > dialTraceToolArgsMaxSize {
+		arguments = string(runes[:dialTraceToolArgsMaxSize]) + "…"
+	}
+
+	t.ToolCalls = append(t.ToolCalls, DialTraceToolCall{Name: name, Arguments: arguments, Duration: duration, Error: err})
+}
+
+// TraceStore keeps dialer traces by usage id and remembers the last traced answer of every chat
+type TraceStore struct {
+	redis *redis.Client
+	log   *tracing.Logger
+}
+
+func NewTraceStore(redis *redis.Client, log *tracing.Logger) *TraceStore {
+	return &TraceStore{redis: redis, log: log}
+}
+
+func (x *TraceStore) traceKey(usageID uuid.UUID) string {
+	return fmt.Sprintf("dial_trace:%s", usageID)
+}
+
+func (x *TraceStore) lastTraceKey(chatID int64) string {
+	return fmt.Sprintf("dial_trace_last:%d", chatID)
+}
+
+func (x *TraceStore) Save(log *tracing.Logger, usageID uuid.UUID, trace *DialTrace) {
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data, err := json.Marshal(trace)
+	if err != nil {
+		log.W("Failed to marshal dial trace", tracing.InnerError, err)
+		return
+	}
+
+	pipe := x.redis.TxPipeline()
+	pipe.Set(ctx, x.traceKey(usageID), data, dialTraceTTL)
+	pipe.Set(ctx, x.lastTraceKey(trace.ChatID), usageID.String(), dialTraceTTL)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.W("Failed to save dial trace", "usage_id", usageID, tracing.InnerError, err)
+	}
+}
+
+// Get returns the trace of the answer, nil if it has expired or was never stored
+func (x *TraceStore) Get(log *tracing.Logger, usageID uuid.UUID) (*DialTrace, error) {
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 5*time.Second)
+	defer cancel()
+
+	data, err := x.redis.Get(ctx, x.traceKey(usageID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		log.E("Failed to get dial trace", "usage_id", usageID, tracing.InnerError, err)
+		return nil, err
+	}
+
+	var trace DialTrace
+	if err := json.Unmarshal(data, &trace); err != nil {
+		log.E("Failed to unmarshal dial trace", "usage_id", usageID, tracing.InnerError, err)
+		return nil, err
+	}
+
+	return &trace, nil
+}
+
+// Last returns the trace of the latest traced answer in the chat
+func (x *TraceStore) Last(log *tracing.Logger, chatID int64) (*DialTrace, error) {
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 5*time.Second)
+	defer cancel()
+
+	value, err := x.redis.Get(ctx, x.lastTraceKey(chatID)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		log.E("Failed to get last dial trace", "chat_id", chatID, tracing.InnerError, err)
+		return nil, err
+	}
+
+	usageID, err := uuid.Parse(value)
+	if err != nil {
+		return nil, nil
+	}
+
+	return x.Get(log, usageID)
+}
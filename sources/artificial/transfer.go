@@ -0,0 +1,177 @@
+package artificial
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"ximanager/sources/platform"
+)
+
+const (
+	ContextBundleVersion = 1
+
+	// Every message in the markdown export is preceded by a marker comment, so the file
+	// renders nicely in any viewer and still can be parsed back without ambiguity.
+	contextMarkdownMarker = "<!-- xi:message role=%s compressed=%t -->"
+)
+
+var (
+	ErrContextBundleEmpty       = errors.New("context bundle contains no messages")
+	ErrContextBundleInvalidRole = errors.New("context bundle contains unsupported message role")
+	ErrContextBundleMalformed   = errors.New("context bundle is malformed")
+	ErrContextBundleVersion     = errors.New("context bundle version is not supported")
+)
+
+var contextMarkdownMarkerPattern = regexp.MustCompile(`(?m)^<!-- xi:message role=([a-z]+) compressed=(true|false) -->\n?`)
+
+// ContextBundle is a portable representation of chat history, messages are ordered from oldest to newest
+type ContextBundle struct {
+	Version    int                     `json:"version"`
+	ChatID     int64                   `json:"chat_id"`
+	ExportedAt time.Time               `json:"exported_at"`
+	Messages   []platform.RedisMessage `json:"messages"`
+}
+
+func NewContextBundle(chatID platform.ChatID, messages []platform.RedisMessage) *ContextBundle {
+	return &ContextBundle{
+		Version:    ContextBundleVersion,
+		ChatID:     int64(chatID),
+		ExportedAt: time.Now().UTC(),
+		Messages:   messages,
+	}
+}
+
+func (x *ContextBundle) JSON() ([]byte, error) {
+	return json.MarshalIndent(x, "", "  ")
+}
+
+func (x *ContextBundle) Markdown() []byte {
+	var builder strings.Builder
+
+	builder.WriteString("# Xi context export\n\n")
+	builder.WriteString(fmt.Sprintf("- Chat: `%d`\n", x.ChatID))
+	builder.WriteString(fmt.Sprintf("- Exported at: %s\n", x.ExportedAt.Format(time.RFC3339)))
+	builder.WriteString(fmt.Sprintf("- Messages: %d\n", len(x.Messages)))
+
+	for idx, msg := range x.Messages {
+		title := msg.Role
+		if msg.IsCompressed {
+			title = "summary"
+		}
+
+		builder.WriteString("\n")
+		builder.WriteString(fmt.Sprintf(contextMarkdownMarker, msg.Role, msg.IsCompressed))
+		builder.WriteString(fmt.Sprintf("\n## %d. %s\n\n", idx+1, title))
+		builder.WriteString(strings.TrimSpace(msg.Content))
+		builder.WriteString("\n")
+	}
+
+	return []byte(builder.String())
+}
+
+// ParseContextBundle accepts both JSON and markdown exports and validates message roles
+func ParseContextBundle(data []byte) (*ContextBundle, error) {
+	trimmed := strings.TrimSpace(string(data))
+	if trimmed == "" {
+		return nil, ErrContextBundleEmpty
+	}
+
+	var bundle *ContextBundle
+	var err error
+
+	if strings.HasPrefix(trimmed, "{") {
+		bundle, err = parseContextBundleJSON([]byte(trimmed))
+	} else {
+		bundle, err = parseContextBundleMarkdown(trimmed)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateContextMessages(bundle.Messages); err != nil {
+		return nil, err
+	}
+
+	return bundle, nil
+}
+
+func parseContextBundleJSON(data []byte) (*ContextBundle, error) {
+	var bundle ContextBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrContextBundleMalformed, err)
+	}
+
+	if bundle.Version > ContextBundleVersion {
+		return nil, ErrContextBundleVersion
+	}
+
+	return &bundle, nil
+}
+
+func parseContextBundleMarkdown(data string) (*ContextBundle, error) {
+	markers := contextMarkdownMarkerPattern.FindAllStringSubmatchIndex(data, -1)
+	if len(markers) == 0 {
+		return nil, ErrContextBundleMalformed
+	}
+
+	bundle := &ContextBundle{Version: ContextBundleVersion}
+
+	for i, marker := range markers {
+		end := len(data)
+		if i+1 < len(markers) {
+			end = markers[i+1][0]
+		}
+
+		role := data[marker[2]:marker[3]]
+		compressed := data[marker[4]:marker[5]] == "true"
+		body := strings.TrimSpace(data[marker[1]:end])
+
+		// Drop the "## N. role" heading that follows every marker
+		if strings.HasPrefix(body, "## ") {
+			if newline := strings.Index(body, "\n"); newline >= 0 {
+				body = strings.TrimSpace(body[newline+1:])
+			} else {
+				body = ""
+			}
+		}
+
+		bundle.Messages = append(bundle.Messages, platform.RedisMessage{
+			Role:         role,
+			Content:      body,
+			IsCompressed: compressed,
+		})
+	}
+
+	return bundle, nil
+}
+
+func validateContextMessages(messages []platform.RedisMessage) error {
+	if len(messages) == 0 {
+		return ErrContextBundleEmpty
+	}
+
+	for idx, msg := range messages {
+		switch msg.Role {
+		case platform.MessageRoleUser, platform.MessageRoleAssistant:
+			if msg.IsCompressed {
+				return fmt.Errorf("%w: message %d is marked compressed but has role %q", ErrContextBundleInvalidRole, idx+1, msg.Role)
+			}
+		case platform.MessageRoleSystem:
+			if !msg.IsCompressed {
+				return fmt.Errorf("%w: message %d has role %q but is not a summary", ErrContextBundleInvalidRole, idx+1, msg.Role)
+			}
+		default:
+			return fmt.Errorf("%w: message %d has role %q", ErrContextBundleInvalidRole, idx+1, msg.Role)
+		}
+
+		if strings.TrimSpace(msg.Content) == "" {
+			return fmt.Errorf("%w: message %d is empty", ErrContextBundleMalformed, idx+1)
+		}
+	}
+
+	return nil
+}
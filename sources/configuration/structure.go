@@ -44,12 +44,73 @@ type RedisConfig struct {
 }
 
 type TelegramConfig struct {
-	BotToken          string   `yaml:"bot_token"`
-	APIEndpoint       string   `yaml:"api_endpoint"`
-	FileAPIEndpoint   string   `yaml:"file_api_endpoint"`
-	PollerTimeout     int      `yaml:"poller_timeout"`
-	AllowedUpdates    []string `yaml:"allowed_updates"`
-	DiplomatChunkSize int      `yaml:"diplomat_chunk_size"`
+	BotToken          string                    `yaml:"bot_token"`
+	APIEndpoint       string                    `yaml:"api_endpoint"`
+	FileAPIEndpoint   string                    `yaml:"file_api_endpoint"`
+	Mode              string                    `yaml:"mode"`
+	PollerTimeout     int                       `yaml:"poller_timeout"`
+	Webhook           Telegram_WebhookConfig    `yaml:"webhook"`
+	Dispatcher        Telegram_DispatcherConfig `yaml:"dispatcher"`
+	Coalescing        Telegram_CoalescingConfig `yaml:"coalescing"`
+	Edits             Telegram_EditsConfig      `yaml:"edits"`
+	Inline            Telegram_InlineConfig     `yaml:"inline"`
+	Triggers          Telegram_TriggersConfig   `yaml:"triggers"`
+	Outbound          Telegram_OutboundConfig   `yaml:"outbound"`
+	AllowedUpdates    []string                  `yaml:"allowed_updates"`
+	DiplomatChunkSize int                       `yaml:"diplomat_chunk_size"`
+}
+
+// Telegram_WebhookConfig is used when mode is "webhook", updates are received on the startup server at Path
+type Telegram_WebhookConfig struct {
+	URL                string `yaml:"url"`
+	Path               string `yaml:"path"`
+	SecretToken        string `yaml:"secret_token"`
+	MaxConnections     int    `yaml:"max_connections"`
+	DropPendingUpdates bool   `yaml:"drop_pending_updates"`
+}
+
+// Telegram_DispatcherConfig chooses where per-chat queues live: "local" keeps them in memory of a single instance,
+// "redis" shares them between instances, worker_only instances handle updates but do not receive them from Telegram
+type Telegram_DispatcherConfig struct {
+	Kind           string        `yaml:"kind"`
+	WorkerOnly     bool          `yaml:"worker_only"`
+	Workers        int           `yaml:"workers"`
+	Lease          time.Duration `yaml:"lease"`
+	IdleInterval   time.Duration `yaml:"idle_interval"`
+	MaxQueueLength int64         `yaml:"max_queue_length"`
+}
+
+// Telegram_EditsConfig re-answers edited messages by editing the original reply, zero window disables it
+type Telegram_EditsConfig struct {
+	Window time.Duration `yaml:"window"`
+}
+
+// Telegram_InlineConfig answers inline queries, only the last query typed within the debounce window is answered
+type Telegram_InlineConfig struct {
+	Debounce  time.Duration `yaml:"debounce"`
+	CacheTime int           `yaml:"cache_time"`
+}
+
+// Telegram_TriggersConfig holds defaults of group trigger policies, a chat may override both in its settings
+type Telegram_TriggersConfig struct {
+	TimeZone     string `yaml:"time_zone"`
+	LurkerChance int    `yaml:"lurker_chance"`
+}
+
+// Telegram_OutboundConfig paces messages sent by the bot below Telegram flood limits. Rates are per instance:
+// GlobalRate messages per second overall, ChatRate per second in one chat and GroupRate per minute in one group
+type Telegram_OutboundConfig struct {
+	GlobalRate float64 `yaml:"global_rate"`
+	ChatRate   float64 `yaml:"chat_rate"`
+	ChatBurst  int     `yaml:"chat_burst"`
+	GroupRate  float64 `yaml:"group_rate"`
+	MaxRetries int     `yaml:"max_retries"`
+}
+
+// Telegram_CoalescingConfig merges bursts of plain-text messages of one user into one request, zero window disables it
+type Telegram_CoalescingConfig struct {
+	Window      time.Duration `yaml:"window"`
+	MaxMessages int           `yaml:"max_messages"`
 }
 
 type AIConfig struct {
@@ -67,6 +128,8 @@ type AIConfig struct {
 	LimitExceededFallbackModels []string `yaml:"limit_exceeded_fallback_models"`
 
 	TariffModels AI_TariffModelsConfig `yaml:"tariff_models"`
+
+	Catalog AI_CatalogConfig `yaml:"catalog"`
 }
 
 type AI_AgentsConfig struct {
@@ -115,8 +178,20 @@ type AI_TariffModelsConfig struct {
 }
 
 type AI_TariffModelConfig struct {
-	PrimaryModel  string   `yaml:"primary_model"`
-	FallbackModel string   `yaml:"fallback_model"`
+	PrimaryModel     string                     `yaml:"primary_model"`
+	FallbackModel    string                     `yaml:"fallback_model"`
+	SelectableModels []AI_SelectableModelConfig `yaml:"selectable_models"`
+}
+
+type AI_SelectableModelConfig struct {
+	Model     string `yaml:"model"`
+	Title     string `yaml:"title"`
+	PriceHint string `yaml:"price_hint"`
+}
+
+type AI_CatalogConfig struct {
+	SyncInterval         time.Duration `yaml:"sync_interval"`
+	ContextWindowPercent int           `yaml:"context_window_percent"`
 }
 
 type ProxyConfig struct {
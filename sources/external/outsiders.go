@@ -16,6 +16,7 @@ type Outsiders struct {
 	log    *tracing.Logger
 	config *configuration.Config
 	ss     *http.Server
+	sm     *http.ServeMux
 	sms    *http.Server
 	as     *http.Server
 }
@@ -29,17 +30,20 @@ func NewOutsiders(log *tracing.Logger, config *configuration.Config) *Outsiders
 		collectors.NewBuildInfoCollector(),
 	)
 
+	startupMux := platform.Curry(http.NewServeMux, func(m *http.ServeMux) {
+		m.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+			startuphandler(log, w, r)
+		})
+	})
+
 	return &Outsiders{
 		log:    log,
 		config: config,
 		ss: &http.Server{
-			Addr: fmt.Sprintf(":%d", config.Service.StartupPort),
-			Handler: platform.Curry(http.NewServeMux, func(m *http.ServeMux) {
-				m.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-					startuphandler(log, w, r)
-				})
-			}),
+			Addr:    fmt.Sprintf(":%d", config.Service.StartupPort),
+			Handler: startupMux,
 		},
+		sm: startupMux,
 		sms: &http.Server{
 			Addr: fmt.Sprintf(":%d", config.Service.SystemMetricsPort),
 			Handler: platform.Curry(http.NewServeMux, func(m *http.ServeMux) {
@@ -55,6 +59,12 @@ func NewOutsiders(log *tracing.Logger, config *configuration.Config) *Outsiders
 	}
 }
 
+// Handle mounts an additional handler on the startup server, e.g. the Telegram webhook
+func (x *Outsiders) Handle(pattern string, handler http.Handler) {
+	x.sm.Handle(pattern, handler)
+	x.log.I("Startup server handler mounted", tracing.OutsiderKind, "startup", "pattern", pattern)
+}
+
 func (x *Outsiders) startup() {
 	x.log.I("Startup server is starting", tracing.OutsiderKind, "startup", "port", x.config.Service.StartupPort)
 
@@ -18,10 +18,12 @@ import (
 var localesFS embed.FS
 
 type LocalizationManager struct {
-	bundle   *i18n.Bundle
+	bundle    *i18n.Bundle
+	languages []string
 	detector *LanguageDetector
 	log      *tracing.Logger
 	locbuff  sync.Map
+	chatbuff sync.Map
 }
 
 func NewLocalizationManager(
@@ -50,7 +52,7 @@ func NewLocalizationManager(
 	}
 
 	log.I("LocalizationManager initialized successfully")
-	return &LocalizationManager{bundle: bundle, detector: detector, log: log}, nil
+	return &LocalizationManager{bundle: bundle, languages: config.Localization.SupportedLanguages, detector: detector, log: log}, nil
 }
 
 func (x *LocalizationManager) GetLocalizer(userText string) *i18n.Localizer {
@@ -76,6 +78,20 @@ func (x *LocalizationManager) LocalizeTd(localizer *i18n.Localizer, messageID st
 	return msg
 }
 
+// Languages lists the loaded locales in the order of the configuration
+func (x *LocalizationManager) Languages() []string {
+	return x.languages
+}
+
+// SetChatLanguage pins the language of the chat chosen in its settings, an empty language returns the chat to detection
+func (x *LocalizationManager) SetChatLanguage(chatID int64, lang string) {
+	if lang == "" {
+		x.chatbuff.Delete(chatID)
+		return
+	}
+	x.chatbuff.Store(chatID, lang)
+}
+
 func (x *LocalizationManager) LocalizeBy(msg *tgbotapi.Message, messageID string) string {
 	return x.LocalizeByTd(msg, messageID, nil)
 }
@@ -92,7 +108,10 @@ func (x *LocalizationManager) LocalizeByTd(msg *tgbotapi.Message, messageID stri
 	var detectedLang string
 	userId := msg.From.ID
 
-	if cleanText != "" {
+	if pinned, ok := x.chatbuff.Load(msg.Chat.ID); ok {
+		detectedLang = pinned.(string)
+		x.log.D("Locale pinned by chat settings", "chat_id", msg.Chat.ID, "locale", detectedLang)
+	} else if cleanText != "" {
 		detectedLang = x.detector.DetectLanguage(cleanText)
 		x.locbuff.Store(userId, detectedLang)
 		x.log.D("Locale detected from text and cached", "user_id", userId, "locale", detectedLang)
@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"strconv"
 	"time"
 	"ximanager/sources/tracing"
 
@@ -157,6 +158,76 @@ var (
 		},
 		[]string{"status"},
 	)
+
+	modelRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ximanager_dialer_model_requests_total",
+			Help: "Total number of dialer requests by model and selection source",
+		},
+		[]string{"model", "source"},
+	)
+
+	messagesCoalesced = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ximanager_messages_coalesced_total",
+			Help: "Total number of messages merged into another request by coalescing",
+		},
+	)
+
+	coalescedRequests = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ximanager_coalesced_requests_total",
+			Help: "Total number of requests built from several coalesced messages",
+		},
+	)
+
+	dispatcherQueueDepth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ximanager_dispatcher_chat_queue_depth",
+			Help: "Number of updates waiting in the dispatcher stream of a chat",
+		},
+		[]string{"chat_id"},
+	)
+
+	dispatcherReclaimed = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "ximanager_dispatcher_reclaimed_total",
+			Help: "Total number of dispatcher stream entries reclaimed from crashed workers",
+		},
+	)
+
+	inlineQueries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ximanager_inline_queries_total",
+			Help: "Total number of inline queries by result",
+		},
+		[]string{"result"},
+	)
+
+	outboundQueueLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "ximanager_outbound_queue_latency_seconds",
+			Help:    "Time outbound Telegram calls wait for rate limits and flood control before being sent",
+			Buckets: []float64{0.005, 0.05, 0.25, 1, 2.5, 5, 15, 30, 60, 180},
+		},
+		[]string{"priority"},
+	)
+
+	outboundWaiting = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "ximanager_outbound_waiting",
+			Help: "Number of outbound Telegram calls currently waiting for rate limits",
+		},
+		[]string{"priority"},
+	)
+
+	outboundFloodRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "ximanager_outbound_flood_retries_total",
+			Help: "Total number of outbound Telegram calls retried after a 429 response",
+		},
+		[]string{"priority"},
+	)
 )
 
 func init() {
@@ -179,6 +250,15 @@ func init() {
 	prometheus.MustRegister(statsMAU)
 	prometheus.MustRegister(feedbacksReceived)
 	prometheus.MustRegister(personalizationExtracted)
+	prometheus.MustRegister(modelRequests)
+	prometheus.MustRegister(messagesCoalesced)
+	prometheus.MustRegister(coalescedRequests)
+	prometheus.MustRegister(dispatcherQueueDepth)
+	prometheus.MustRegister(dispatcherReclaimed)
+	prometheus.MustRegister(inlineQueries)
+	prometheus.MustRegister(outboundQueueLatency)
+	prometheus.MustRegister(outboundWaiting)
+	prometheus.MustRegister(outboundFloodRetries)
 }
 
 func NewMetricsService(log *tracing.Logger) *MetricsService {
@@ -266,4 +346,43 @@ func (s *MetricsService) RecordFeedback(feedbackType string) {
 
 func (s *MetricsService) RecordPersonalizationExtracted(status string) {
 	personalizationExtracted.WithLabelValues(status).Inc()
-}
\ No newline at end of file
+}
+
+func (s *MetricsService) RecordModelSelection(model string, source string) {
+	modelRequests.WithLabelValues(model, source).Inc()
+}
+
+// RecordMessagesCoalesced counts one request merged from count messages, count-1 of them were merged into the first
+func (s *MetricsService) RecordMessagesCoalesced(count int) {
+	coalescedRequests.Inc()
+	messagesCoalesced.Add(float64(count - 1))
+}
+
+func (s *MetricsService) SetChatQueueDepth(chatID int64, depth float64) {
+	dispatcherQueueDepth.WithLabelValues(strconv.FormatInt(chatID, 10)).Set(depth)
+}
+
+func (s *MetricsService) DeleteChatQueueDepth(chatID int64) {
+	dispatcherQueueDepth.DeleteLabelValues(strconv.FormatInt(chatID, 10))
+}
+
+func (s *MetricsService) RecordDispatcherReclaimed(count int) {
+	dispatcherReclaimed.Add(float64(count))
+}
+
+// RecordInlineQuery counts inline queries: answered, debounced (replaced by a newer one), denied or error
+func (s *MetricsService) RecordInlineQuery(result string) {
+	inlineQueries.WithLabelValues(result).Inc()
+}
+
+func (s *MetricsService) RecordOutboundLatency(priority string, duration time.Duration) {
+	outboundQueueLatency.WithLabelValues(priority).Observe(duration.Seconds())
+}
+
+func (s *MetricsService) AddOutboundWaiting(priority string, delta float64) {
+	outboundWaiting.WithLabelValues(priority).Add(delta)
+}
+
+func (s *MetricsService) RecordOutboundFloodRetry(priority string) {
+	outboundFloodRetries.WithLabelValues(priority).Inc()
+}
@@ -21,11 +21,21 @@ type (
 	}
 
 	Feedback struct {
-		ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
-		UserID    uuid.UUID `gorm:"type:uuid;not null;column:user_id" json:"user_id"`
-		Liked     int       `gorm:"not null" json:"liked"`
-		Kind      string    `gorm:"size:20;not null;default:dialer" json:"kind"`
-		CreatedAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+		ID           uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+		UserID       uuid.UUID  `gorm:"type:uuid;not null;column:user_id" json:"user_id"`
+		Liked        int        `gorm:"not null" json:"liked"`
+		Kind         string     `gorm:"size:20;not null;default:dialer" json:"kind"`
+		ChatID       *int64     `gorm:"" json:"chat_id"`
+		MessageID    *int       `gorm:"" json:"message_id"`
+		UsageID      *uuid.UUID `gorm:"type:uuid" json:"usage_id"`
+		Model        *string    `gorm:"size:255" json:"model"`
+		ModeType     *string    `gorm:"size:50" json:"mode_type"`
+		ModeVersion  *int       `gorm:"" json:"mode_version"`
+		Reason       *string    `gorm:"size:20" json:"reason"`
+		Comment      *string    `gorm:"type:text" json:"comment"`
+		ExperimentID *uuid.UUID `gorm:"type:uuid" json:"experiment_id"`
+		Variant      *string    `gorm:"size:50" json:"variant"`
+		CreatedAt    time.Time  `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
 
 		User User `gorm:"foreignKey:UserID;references:ID" json:"user"`
 	}
@@ -39,6 +49,71 @@ type (
 		User User `gorm:"foreignKey:UserID;references:ID" json:"user"`
 	}
 
+	// CatalogModel is a provider model as seen by the last catalog sync, prices are in USD per token
+	CatalogModel struct {
+		ID                  string          `gorm:"size:255;primaryKey" json:"id"`
+		Name                string          `gorm:"size:255;not null" json:"name"`
+		ContextLength       int64           `gorm:"not null;default:0" json:"context_length"`
+		MaxCompletionTokens int64           `gorm:"not null;default:0" json:"max_completion_tokens"`
+		InputPrice          decimal.Decimal `gorm:"type:decimal(20,12);not null;default:0" json:"input_price"`
+		OutputPrice         decimal.Decimal `gorm:"type:decimal(20,12);not null;default:0" json:"output_price"`
+		CacheReadPrice      decimal.Decimal `gorm:"type:decimal(20,12);not null;default:0" json:"cache_read_price"`
+		CacheWritePrice     decimal.Decimal `gorm:"type:decimal(20,12);not null;default:0" json:"cache_write_price"`
+		SupportsImages      bool            `gorm:"not null;default:false" json:"supports_images"`
+		SupportsTools       bool            `gorm:"not null;default:false" json:"supports_tools"`
+		SupportsReasoning   bool            `gorm:"not null;default:false" json:"supports_reasoning"`
+		SyncedAt            time.Time       `gorm:"not null;default:CURRENT_TIMESTAMP" json:"synced_at"`
+	}
+
+	// ChatVariable is a custom value available to mode prompt templates of a single chat
+	ChatVariable struct {
+		ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+		ChatID    int64     `gorm:"not null" json:"chat_id"`
+		Name      string    `gorm:"size:50;not null" json:"name"`
+		Value     string    `gorm:"type:text;not null" json:"value"`
+		UpdatedAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
+	}
+
+	// ChatInstruction is a per-chat block of instructions layered on top of the mode prompt
+	ChatInstruction struct {
+		ID        uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+		ChatID    int64      `gorm:"not null" json:"chat_id"`
+		Text      string     `gorm:"type:text;not null" json:"text"`
+		UpdatedBy *uuid.UUID `gorm:"type:uuid" json:"updated_by"`
+		UpdatedAt time.Time  `gorm:"not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
+
+		Updater *User `gorm:"foreignKey:UpdatedBy;references:ID" json:"updater"`
+	}
+
+	// ChatSetting holds preferences of a chat set from the /settings panel, a chat without a row uses the defaults.
+	// Quiet hours are minutes of the day in TimeZone, both nil when the chat has none
+	ChatSetting struct {
+		ID              uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+		ChatID          int64      `gorm:"not null" json:"chat_id"`
+		Language        string     `gorm:"size:8;not null;default:''" json:"language"`
+		TriggerPolicy   string     `gorm:"size:16;not null;default:'all'" json:"trigger_policy"`
+		TriggerKeywords string     `gorm:"type:text;not null;default:''" json:"trigger_keywords"`
+		LurkerChance    int        `gorm:"not null;default:0" json:"lurker_chance"`
+		QuietFrom       *int       `gorm:"" json:"quiet_from"`
+		QuietTo         *int       `gorm:"" json:"quiet_to"`
+		TimeZone        string     `gorm:"size:64;not null;default:''" json:"time_zone"`
+		UpdatedBy       *uuid.UUID `gorm:"type:uuid" json:"updated_by"`
+		UpdatedAt       time.Time  `gorm:"not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
+	}
+
+	// Experiment splits chats or users of a mode between variants, Variants holds the JSON list of variants
+	Experiment struct {
+		ID        uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+		Key       string     `gorm:"size:50;not null" json:"key"`
+		ModeType  string     `gorm:"size:50;not null" json:"mode_type"`
+		Unit      string     `gorm:"size:10;not null;default:chat" json:"unit"`
+		Variants  string     `gorm:"type:json;not null" json:"variants"`
+		IsActive  *bool      `gorm:"not null;default:true" json:"is_active"`
+		CreatedAt time.Time  `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
+		CreatedBy *uuid.UUID `gorm:"type:uuid" json:"created_by"`
+		StoppedAt *time.Time `gorm:"" json:"stopped_at"`
+	}
+
 	Donation struct {
 		ID        uuid.UUID       `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
 		User      uuid.UUID       `gorm:"type:uuid;not null;column:user" json:"user"`
@@ -67,6 +142,7 @@ type (
 		Grade     *string    `gorm:"size:50;column:grade" json:"grade"`
 		Final     *bool      `gorm:"not null;default:false" json:"final"`
 		IsEnabled *bool      `gorm:"not null;default:true" json:"is_enabled"`
+		Version   int        `gorm:"not null;default:1" json:"version"`
 		CreatedAt time.Time  `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
 		CreatedBy *uuid.UUID `gorm:"type:uuid" json:"created_by"`
 
@@ -74,9 +150,21 @@ type (
 		SelectedModes []SelectedMode `gorm:"foreignKey:ModeID;references:ID" json:"selected_modes"`
 	}
 
+	ModeDraft struct {
+		ID          uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+		ModeType    string     `gorm:"size:50;not null" json:"mode_type"`
+		Prompt      string     `gorm:"type:text;not null" json:"prompt"`
+		BaseVersion int        `gorm:"not null" json:"base_version"`
+		CreatedBy   *uuid.UUID `gorm:"type:uuid" json:"created_by"`
+		UpdatedAt   time.Time  `gorm:"not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
+
+		Creator *User `gorm:"foreignKey:CreatedBy;references:ID" json:"creator"`
+	}
+
 	SelectedMode struct {
 		ID         uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
 		ChatID     int64     `gorm:"not null" json:"chat_id"`
+		ThreadID   int       `gorm:"not null;default:0" json:"thread_id"`
 		ModeID     uuid.UUID `gorm:"type:uuid;not null" json:"mode_id"`
 		SwitchedAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"switched_at"`
 		SwitchedBy uuid.UUID `gorm:"type:uuid;not null" json:"switched_by"`
@@ -85,6 +173,16 @@ type (
 		User User `gorm:"foreignKey:SwitchedBy;references:ID" json:"user"`
 	}
 
+	ModelPreference struct {
+		ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+		UserID    uuid.UUID `gorm:"type:uuid;not null;column:user_id" json:"user_id"`
+		ChatID    int64     `gorm:"not null" json:"chat_id"`
+		Model     string    `gorm:"size:255;not null" json:"model"`
+		UpdatedAt time.Time `gorm:"not null;default:CURRENT_TIMESTAMP" json:"updated_at"`
+
+		User User `gorm:"foreignKey:UserID;references:ID" json:"user"`
+	}
+
 	Personalization struct {
 		ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
 		UserID    uuid.UUID `gorm:"type:uuid;not null;column:user_id" json:"user_id"`
@@ -105,6 +203,15 @@ type (
 		AnotherCost      *decimal.Decimal `gorm:"type:decimal(10,6)" json:"another_cost"`
 		AnotherTokens *int             `gorm:"" json:"another_tokens"`
 		ChatID        int64            `gorm:"not null" json:"chat_id"`
+		IsIncognito   bool             `gorm:"not null;default:false" json:"is_incognito"`
+		Source        string           `gorm:"size:16;not null;default:chat" json:"source"`
+		Model             *string          `gorm:"size:255" json:"model"`
+		ModeType          *string          `gorm:"size:50" json:"mode_type"`
+		ModeVersion       *int             `gorm:"" json:"mode_version"`
+		ResponseMessageID *int             `gorm:"" json:"response_message_id"`
+		ExperimentID  *uuid.UUID       `gorm:"type:uuid" json:"experiment_id"`
+		Variant       *string          `gorm:"size:50" json:"variant"`
+		LatencyMs     *int64           `gorm:"" json:"latency_ms"`
 		CreatedAt     time.Time        `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
 
 		User User `gorm:"foreignKey:UserID;references:ID" json:"user"`
@@ -119,6 +226,7 @@ type (
 		IsActive       *bool          `gorm:"not null;default:true" json:"is_active"`
 		IsBanless      *bool          `gorm:"not null;default:false" json:"is_banless"`
 		IsUnsubscribed *bool          `gorm:"not null;default:false" json:"is_unsubscribed"`
+		IsIncognito    *bool          `gorm:"not null;default:false" json:"is_incognito"`
 		CreatedAt      time.Time      `gorm:"not null;default:CURRENT_TIMESTAMP" json:"created_at"`
 
 		Messages         []Message         `gorm:"foreignKey:UserID;references:ID" json:"messages"`
@@ -145,15 +253,24 @@ type (
 		SpendingMonthlyLimit decimal.Decimal `gorm:"column:spending_monthly_limit;type:decimal(10,2);not null"`
 
 		Price int `gorm:"column:price;not null;default:0"`
+
+		ChatInstructionsMaxLength int `gorm:"column:chat_instructions_max_length;not null;default:500"`
 	}
 )
 
 func (Ban) TableName() string             { return "xi_bans" }
 func (Broadcast) TableName() string       { return "xi_broadcasts" }
+func (CatalogModel) TableName() string    { return "xi_models" }
+func (ChatInstruction) TableName() string { return "xi_chat_instructions" }
+func (ChatSetting) TableName() string     { return "xi_chat_settings" }
+func (ChatVariable) TableName() string    { return "xi_chat_variables" }
 func (Donation) TableName() string        { return "xi_donations" }
+func (Experiment) TableName() string      { return "xi_experiments" }
 func (Feedback) TableName() string        { return "xi_feedbacks" }
 func (Message) TableName() string         { return "xi_messages" }
 func (Mode) TableName() string            { return "xi_modes" }
+func (ModeDraft) TableName() string       { return "xi_mode_drafts" }
+func (ModelPreference) TableName() string { return "xi_model_preferences" }
 func (Personalization) TableName() string { return "xi_personalizations" }
 func (SelectedMode) TableName() string    { return "xi_selected_modes" }
 func (Usage) TableName() string           { return "xi_usage" }
@@ -19,10 +19,17 @@ var (
 	Q               = new(Query)
 	Ban             *ban
 	Broadcast       *broadcast
+	CatalogModel    *catalogModel
+	ChatInstruction *chatInstruction
+	ChatSetting     *chatSetting
+	ChatVariable    *chatVariable
 	Donation        *donation
+	Experiment      *experiment
 	Feedback        *feedback
 	Message         *message
 	Mode            *mode
+	ModeDraft       *modeDraft
+	ModelPreference *modelPreference
 	Personalization *personalization
 	SelectedMode    *selectedMode
 	Tariff          *tariff
@@ -34,10 +41,17 @@ func SetDefault(db *gorm.DB, opts ...gen.DOOption) {
 	*Q = *Use(db, opts...)
 	Ban = &Q.Ban
 	Broadcast = &Q.Broadcast
+	CatalogModel = &Q.CatalogModel
+	ChatInstruction = &Q.ChatInstruction
+	ChatSetting = &Q.ChatSetting
+	ChatVariable = &Q.ChatVariable
 	Donation = &Q.Donation
+	Experiment = &Q.Experiment
 	Feedback = &Q.Feedback
 	Message = &Q.Message
 	Mode = &Q.Mode
+	ModeDraft = &Q.ModeDraft
+	ModelPreference = &Q.ModelPreference
 	Personalization = &Q.Personalization
 	SelectedMode = &Q.SelectedMode
 	Tariff = &Q.Tariff
@@ -50,10 +64,17 @@ func Use(db *gorm.DB, opts ...gen.DOOption) *Query {
 		db:              db,
 		Ban:             newBan(db, opts...),
 		Broadcast:       newBroadcast(db, opts...),
+		CatalogModel:    newCatalogModel(db, opts...),
+		ChatInstruction: newChatInstruction(db, opts...),
+		ChatSetting:     newChatSetting(db, opts...),
+		ChatVariable:    newChatVariable(db, opts...),
 		Donation:        newDonation(db, opts...),
+		Experiment:      newExperiment(db, opts...),
 		Feedback:        newFeedback(db, opts...),
 		Message:         newMessage(db, opts...),
 		Mode:            newMode(db, opts...),
+		ModeDraft:       newModeDraft(db, opts...),
+		ModelPreference: newModelPreference(db, opts...),
 		Personalization: newPersonalization(db, opts...),
 		SelectedMode:    newSelectedMode(db, opts...),
 		Tariff:          newTariff(db, opts...),
@@ -67,10 +88,17 @@ type Query struct {
 
 	Ban             ban
 	Broadcast       broadcast
+	CatalogModel    catalogModel
+	ChatInstruction chatInstruction
+	ChatSetting     chatSetting
+	ChatVariable    chatVariable
 	Donation        donation
+	Experiment      experiment
 	Feedback        feedback
 	Message         message
 	Mode            mode
+	ModeDraft       modeDraft
+	ModelPreference modelPreference
 	Personalization personalization
 	SelectedMode    selectedMode
 	Tariff          tariff
@@ -85,10 +113,17 @@ func (q *Query) clone(db *gorm.DB) *Query {
 		db:              db,
 		Ban:             q.Ban.clone(db),
 		Broadcast:       q.Broadcast.clone(db),
+		CatalogModel:    q.CatalogModel.clone(db),
+		ChatInstruction: q.ChatInstruction.clone(db),
+		ChatSetting:     q.ChatSetting.clone(db),
+		ChatVariable:    q.ChatVariable.clone(db),
 		Donation:        q.Donation.clone(db),
+		Experiment:      q.Experiment.clone(db),
 		Feedback:        q.Feedback.clone(db),
 		Message:         q.Message.clone(db),
 		Mode:            q.Mode.clone(db),
+		ModeDraft:       q.ModeDraft.clone(db),
+		ModelPreference: q.ModelPreference.clone(db),
 		Personalization: q.Personalization.clone(db),
 		SelectedMode:    q.SelectedMode.clone(db),
 		Tariff:          q.Tariff.clone(db),
@@ -110,10 +145,17 @@ func (q *Query) ReplaceDB(db *gorm.DB) *Query {
 		db:              db,
 		Ban:             q.Ban.replaceDB(db),
 		Broadcast:       q.Broadcast.replaceDB(db),
+		CatalogModel:    q.CatalogModel.replaceDB(db),
+		ChatInstruction: q.ChatInstruction.replaceDB(db),
+		ChatSetting:     q.ChatSetting.replaceDB(db),
+		ChatVariable:    q.ChatVariable.replaceDB(db),
 		Donation:        q.Donation.replaceDB(db),
+		Experiment:      q.Experiment.replaceDB(db),
 		Feedback:        q.Feedback.replaceDB(db),
 		Message:         q.Message.replaceDB(db),
 		Mode:            q.Mode.replaceDB(db),
+		ModeDraft:       q.ModeDraft.replaceDB(db),
+		ModelPreference: q.ModelPreference.replaceDB(db),
 		Personalization: q.Personalization.replaceDB(db),
 		SelectedMode:    q.SelectedMode.replaceDB(db),
 		Tariff:          q.Tariff.replaceDB(db),
@@ -125,10 +167,17 @@ func (q *Query) ReplaceDB(db *gorm.DB) *Query {
 type queryCtx struct {
 	Ban             IBanDo
 	Broadcast       IBroadcastDo
+	CatalogModel    ICatalogModelDo
+	ChatInstruction IChatInstructionDo
+	ChatSetting     IChatSettingDo
+	ChatVariable    IChatVariableDo
 	Donation        IDonationDo
+	Experiment      IExperimentDo
 	Feedback        IFeedbackDo
 	Message         IMessageDo
 	Mode            IModeDo
+	ModeDraft       IModeDraftDo
+	ModelPreference IModelPreferenceDo
 	Personalization IPersonalizationDo
 	SelectedMode    ISelectedModeDo
 	Tariff          ITariffDo
@@ -140,10 +189,17 @@ func (q *Query) WithContext(ctx context.Context) *queryCtx {
 	return &queryCtx{
 		Ban:             q.Ban.WithContext(ctx),
 		Broadcast:       q.Broadcast.WithContext(ctx),
+		CatalogModel:    q.CatalogModel.WithContext(ctx),
+		ChatInstruction: q.ChatInstruction.WithContext(ctx),
+		ChatSetting:     q.ChatSetting.WithContext(ctx),
+		ChatVariable:    q.ChatVariable.WithContext(ctx),
 		Donation:        q.Donation.WithContext(ctx),
+		Experiment:      q.Experiment.WithContext(ctx),
 		Feedback:        q.Feedback.WithContext(ctx),
 		Message:         q.Message.WithContext(ctx),
 		Mode:            q.Mode.WithContext(ctx),
+		ModeDraft:       q.ModeDraft.WithContext(ctx),
+		ModelPreference: q.ModelPreference.WithContext(ctx),
 		Personalization: q.Personalization.WithContext(ctx),
 		SelectedMode:    q.SelectedMode.WithContext(ctx),
 		Tariff:          q.Tariff.WithContext(ctx),
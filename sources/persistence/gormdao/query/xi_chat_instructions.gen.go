@@ -0,0 +1,664 @@
+// Code generated by gorm.io/gen. DO NOT EDIT.
+// Code generated by gorm.io/gen. DO NOT EDIT.
+// Code generated by gorm.io/gen. DO NOT EDIT.
+
+package query
+
+import (
+	"context"
+	"database/sql"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"gorm.io/gen"
+	"gorm.io/gen/field"
+
+	"gorm.io/plugin/dbresolver"
+
+	"ximanager/sources/persistence/entities"
+)
+
+func newChatInstruction(db *gorm.DB, opts ...gen.DOOption) chatInstruction {
+	_chatInstruction := chatInstruction{}
+
+	_chatInstruction.chatInstructionDo.UseDB(db, opts...)
+	_chatInstruction.chatInstructionDo.UseModel(&entities.ChatInstruction{})
+
+	tableName := _chatInstruction.chatInstructionDo.TableName()
+	_chatInstruction.ALL = field.NewAsterisk(tableName)
+	_chatInstruction.ID = field.NewField(tableName, "id")
+	_chatInstruction.ChatID = field.NewInt64(tableName, "chat_id")
+	_chatInstruction.Text = field.NewString(tableName, "text")
+	_chatInstruction.UpdatedBy = field.NewField(tableName, "updated_by")
+	_chatInstruction.UpdatedAt = field.NewTime(tableName, "updated_at")
+	_chatInstruction.Updater = chatInstructionBelongsToUpdater{
+		db: db.Session(&gorm.Session{}),
+
+		RelationField: field.NewRelation("Updater", "entities.User"),
+		Messages: struct {
+			field.RelationField
+			User struct {
+				field.RelationField
+			}
+		}{
+			RelationField: field.NewRelation("Updater.Messages", "entities.Message"),
+			User: struct {
+				field.RelationField
+			}{
+				RelationField: field.NewRelation("Updater.Messages.User", "entities.User"),
+			},
+		},
+		Donations: struct {
+			field.RelationField
+			UserEntity struct {
+				field.RelationField
+			}
+		}{
+			RelationField: field.NewRelation("Updater.Donations", "entities.Donation"),
+			UserEntity: struct {
+				field.RelationField
+			}{
+				RelationField: field.NewRelation("Updater.Donations.UserEntity", "entities.User"),
+			},
+		},
+		CreatedModes: struct {
+			field.RelationField
+			Creator struct {
+				field.RelationField
+			}
+			SelectedModes struct {
+				field.RelationField
+				Mode struct {
+					field.RelationField
+				}
+				User struct {
+					field.RelationField
+				}
+			}
+		}{
+			RelationField: field.NewRelation("Updater.CreatedModes", "entities.Mode"),
+			Creator: struct {
+				field.RelationField
+			}{
+				RelationField: field.NewRelation("Updater.CreatedModes.Creator", "entities.User"),
+			},
+			SelectedModes: struct {
+				field.RelationField
+				Mode struct {
+					field.RelationField
+				}
+				User struct {
+					field.RelationField
+				}
+			}{
+				RelationField: field.NewRelation("Updater.CreatedModes.SelectedModes", "entities.SelectedMode"),
+				Mode: struct {
+					field.RelationField
+				}{
+					RelationField: field.NewRelation("Updater.CreatedModes.SelectedModes.Mode", "entities.Mode"),
+				},
+				User: struct {
+					field.RelationField
+				}{
+					RelationField: field.NewRelation("Updater.CreatedModes.SelectedModes.User", "entities.User"),
+				},
+			},
+		},
+		SelectedModes: struct {
+			field.RelationField
+		}{
+			RelationField: field.NewRelation("Updater.SelectedModes", "entities.SelectedMode"),
+		},
+		Personalizations: struct {
+			field.RelationField
+			User struct {
+				field.RelationField
+			}
+		}{
+			RelationField: field.NewRelation("Updater.Personalizations", "entities.Personalization"),
+			User: struct {
+				field.RelationField
+			}{
+				RelationField: field.NewRelation("Updater.Personalizations.User", "entities.User"),
+			},
+		},
+		Usages: struct {
+			field.RelationField
+			User struct {
+				field.RelationField
+			}
+		}{
+			RelationField: field.NewRelation("Updater.Usages", "entities.Usage"),
+			User: struct {
+				field.RelationField
+			}{
+				RelationField: field.NewRelation("Updater.Usages.User", "entities.User"),
+			},
+		},
+		Bans: struct {
+			field.RelationField
+			User struct {
+				field.RelationField
+			}
+		}{
+			RelationField: field.NewRelation("Updater.Bans", "entities.Ban"),
+			User: struct {
+				field.RelationField
+			}{
+				RelationField: field.NewRelation("Updater.Bans.User", "entities.User"),
+			},
+		},
+	}
+
+	_chatInstruction.fillFieldMap()
+
+	return _chatInstruction
+}
+
+type chatInstruction struct {
+	chatInstructionDo chatInstructionDo
+
+	ALL       field.Asterisk
+	ID        field.Field
+	ChatID    field.Int64
+	Text      field.String
+	UpdatedBy field.Field
+	UpdatedAt field.Time
+	Updater   chatInstructionBelongsToUpdater
+
+	fieldMap map[string]field.Expr
+}
+
+func (c chatInstruction) Table(newTableName string) *chatInstruction {
+	c.chatInstructionDo.UseTable(newTableName)
+	return c.updateTableName(newTableName)
+}
+
+func (c chatInstruction) As(alias string) *chatInstruction {
+	c.chatInstructionDo.DO = *(c.chatInstructionDo.As(alias).(*gen.DO))
+	return c.updateTableName(alias)
+}
+
+func (c *chatInstruction) updateTableName(table string) *chatInstruction {
+	c.ALL = field.NewAsterisk(table)
+	c.ID = field.NewField(table, "id")
+	c.ChatID = field.NewInt64(table, "chat_id")
+	c.Text = field.NewString(table, "text")
+	c.UpdatedBy = field.NewField(table, "updated_by")
+	c.UpdatedAt = field.NewTime(table, "updated_at")
+
+	c.fillFieldMap()
+
+	return c
+}
+
+func (c *chatInstruction) WithContext(ctx context.Context) IChatInstructionDo {
+	return c.chatInstructionDo.WithContext(ctx)
+}
+
+func (c chatInstruction) TableName() string { return c.chatInstructionDo.TableName() }
+
+func (c chatInstruction) Alias() string { return c.chatInstructionDo.Alias() }
+
+func (c chatInstruction) Columns(cols ...field.Expr) gen.Columns {
+	return c.chatInstructionDo.Columns(cols...)
+}
+
+func (c *chatInstruction) GetFieldByName(fieldName string) (field.OrderExpr, bool) {
+	_f, ok := c.fieldMap[fieldName]
+	if !ok || _f == nil {
+		return nil, false
+	}
+	_oe, ok := _f.(field.OrderExpr)
+	return _oe, ok
+}
+
+func (c *chatInstruction) fillFieldMap() {
+	c.fieldMap = make(map[string]field.Expr, 6)
+	c.fieldMap["id"] = c.ID
+	c.fieldMap["chat_id"] = c.ChatID
+	c.fieldMap["text"] = c.Text
+	c.fieldMap["updated_by"] = c.UpdatedBy
+	c.fieldMap["updated_at"] = c.UpdatedAt
+
+}
+
+func (c chatInstruction) clone(db *gorm.DB) chatInstruction {
+	c.chatInstructionDo.ReplaceConnPool(db.Statement.ConnPool)
+	c.Updater.db = db.Session(&gorm.Session{Initialized: true})
+	c.Updater.db.Statement.ConnPool = db.Statement.ConnPool
+	return c
+}
+
+func (c chatInstruction) replaceDB(db *gorm.DB) chatInstruction {
+	c.chatInstructionDo.ReplaceDB(db)
+	c.Updater.db = db.Session(&gorm.Session{})
+	return c
+}
+
+type chatInstructionBelongsToUpdater struct {
+	db *gorm.DB
+
+	field.RelationField
+
+	Messages struct {
+		field.RelationField
+		User struct {
+			field.RelationField
+		}
+	}
+	Donations struct {
+		field.RelationField
+		UserEntity struct {
+			field.RelationField
+		}
+	}
+	CreatedModes struct {
+		field.RelationField
+		Creator struct {
+			field.RelationField
+		}
+		SelectedModes struct {
+			field.RelationField
+			Mode struct {
+				field.RelationField
+			}
+			User struct {
+				field.RelationField
+			}
+		}
+	}
+	SelectedModes struct {
+		field.RelationField
+	}
+	Personalizations struct {
+		field.RelationField
+		User struct {
+			field.RelationField
+		}
+	}
+	Usages struct {
+		field.RelationField
+		User struct {
+			field.RelationField
+		}
+	}
+	Bans struct {
+		field.RelationField
+		User struct {
+			field.RelationField
+		}
+	}
+}
+
+func (a chatInstructionBelongsToUpdater) Where(conds ...field.Expr) *chatInstructionBelongsToUpdater {
+	if len(conds) == 0 {
+		return &a
+	}
+
+	exprs := make([]clause.Expression, 0, len(conds))
+	for _, cond := range conds {
+		exprs = append(exprs, cond.BeCond().(clause.Expression))
+	}
+	a.db = a.db.Clauses(clause.Where{Exprs: exprs})
+	return &a
+}
+
+func (a chatInstructionBelongsToUpdater) WithContext(ctx context.Context) *chatInstructionBelongsToUpdater {
+	a.db = a.db.WithContext(ctx)
+	return &a
+}
+
+func (a chatInstructionBelongsToUpdater) Session(session *gorm.Session) *chatInstructionBelongsToUpdater {
+	a.db = a.db.Session(session)
+	return &a
+}
+
+func (a chatInstructionBelongsToUpdater) Model(m *entities.ChatInstruction) *chatInstructionBelongsToUpdaterTx {
+	return &chatInstructionBelongsToUpdaterTx{a.db.Model(m).Association(a.Name())}
+}
+
+func (a chatInstructionBelongsToUpdater) Unscoped() *chatInstructionBelongsToUpdater {
+	a.db = a.db.Unscoped()
+	return &a
+}
+
+type chatInstructionBelongsToUpdaterTx struct{ tx *gorm.Association }
+
+func (a chatInstructionBelongsToUpdaterTx) Find() (result *entities.User, err error) {
+	return result, a.tx.Find(&result)
+}
+
+func (a chatInstructionBelongsToUpdaterTx) Append(values ...*entities.User) (err error) {
+	targetValues := make([]interface{}, len(values))
+	for i, v := range values {
+		targetValues[i] = v
+	}
+	return a.tx.Append(targetValues...)
+}
+
+func (a chatInstructionBelongsToUpdaterTx) Replace(values ...*entities.User) (err error) {
+	targetValues := make([]interface{}, len(values))
+	for i, v := range values {
+		targetValues[i] = v
+	}
+	return a.tx.Replace(targetValues...)
+}
+
+func (a chatInstructionBelongsToUpdaterTx) Delete(values ...*entities.User) (err error) {
+	targetValues := make([]interface{}, len(values))
+	for i, v := range values {
+		targetValues[i] = v
+	}
+	return a.tx.Delete(targetValues...)
+}
+
+func (a chatInstructionBelongsToUpdaterTx) Clear() error {
+	return a.tx.Clear()
+}
+
+func (a chatInstructionBelongsToUpdaterTx) Count() int64 {
+	return a.tx.Count()
+}
+
+func (a chatInstructionBelongsToUpdaterTx) Unscoped() *chatInstructionBelongsToUpdaterTx {
+	a.tx = a.tx.Unscoped()
+	return &a
+}
+
+type chatInstructionDo struct{ gen.DO }
+
+type IChatInstructionDo interface {
+	gen.SubQuery
+	Debug() IChatInstructionDo
+	WithContext(ctx context.Context) IChatInstructionDo
+	WithResult(fc func(tx gen.Dao)) gen.ResultInfo
+	ReplaceDB(db *gorm.DB)
+	ReadDB() IChatInstructionDo
+	WriteDB() IChatInstructionDo
+	As(alias string) gen.Dao
+	Session(config *gorm.Session) IChatInstructionDo
+	Columns(cols ...field.Expr) gen.Columns
+	Clauses(conds ...clause.Expression) IChatInstructionDo
+	Not(conds ...gen.Condition) IChatInstructionDo
+	Or(conds ...gen.Condition) IChatInstructionDo
+	Select(conds ...field.Expr) IChatInstructionDo
+	Where(conds ...gen.Condition) IChatInstructionDo
+	Order(conds ...field.Expr) IChatInstructionDo
+	Distinct(cols ...field.Expr) IChatInstructionDo
+	Omit(cols ...field.Expr) IChatInstructionDo
+	Join(table schema.Tabler, on ...field.Expr) IChatInstructionDo
+	LeftJoin(table schema.Tabler, on ...field.Expr) IChatInstructionDo
+	RightJoin(table schema.Tabler, on ...field.Expr) IChatInstructionDo
+	Group(cols ...field.Expr) IChatInstructionDo
+	Having(conds ...gen.Condition) IChatInstructionDo
+	Limit(limit int) IChatInstructionDo
+	Offset(offset int) IChatInstructionDo
+	Count() (count int64, err error)
+	Scopes(funcs ...func(gen.Dao) gen.Dao) IChatInstructionDo
+	Unscoped() IChatInstructionDo
+	Create(values ...*entities.ChatInstruction) error
+	CreateInBatches(values []*entities.ChatInstruction, batchSize int) error
+	Save(values ...*entities.ChatInstruction) error
+	First() (*entities.ChatInstruction, error)
+	Take() (*entities.ChatInstruction, error)
+	Last() (*entities.ChatInstruction, error)
+	Find() ([]*entities.ChatInstruction, error)
+	FindInBatch(batchSize int, fc func(tx gen.Dao, batch int) error) (results []*entities.ChatInstruction, err error)
+	FindInBatches(result *[]*entities.ChatInstruction, batchSize int, fc func(tx gen.Dao, batch int) error) error
+	Pluck(column field.Expr, dest interface{}) error
+	Delete(...*entities.ChatInstruction) (info gen.ResultInfo, err error)
+	Update(column field.Expr, value interface{}) (info gen.ResultInfo, err error)
+	UpdateSimple(columns ...field.AssignExpr) (info gen.ResultInfo, err error)
+	Updates(value interface{}) (info gen.ResultInfo, err error)
+	UpdateColumn(column field.Expr, value interface{}) (info gen.ResultInfo, err error)
+	UpdateColumnSimple(columns ...field.AssignExpr) (info gen.ResultInfo, err error)
+	UpdateColumns(value interface{}) (info gen.ResultInfo, err error)
+	UpdateFrom(q gen.SubQuery) gen.Dao
+	Attrs(attrs ...field.AssignExpr) IChatInstructionDo
+	Assign(attrs ...field.AssignExpr) IChatInstructionDo
+	Joins(fields ...field.RelationField) IChatInstructionDo
+	Preload(fields ...field.RelationField) IChatInstructionDo
+	FirstOrInit() (*entities.ChatInstruction, error)
+	FirstOrCreate() (*entities.ChatInstruction, error)
+	FindByPage(offset int, limit int) (result []*entities.ChatInstruction, count int64, err error)
+	ScanByPage(result interface{}, offset int, limit int) (count int64, err error)
+	Rows() (*sql.Rows, error)
+	Row() *sql.Row
+	Scan(result interface{}) (err error)
+	Returning(value interface{}, columns ...string) IChatInstructionDo
+	UnderlyingDB() *gorm.DB
+	schema.Tabler
+}
+
+func (c chatInstructionDo) Debug() IChatInstructionDo {
+	return c.withDO(c.DO.Debug())
+}
+
+func (c chatInstructionDo) WithContext(ctx context.Context) IChatInstructionDo {
+	return c.withDO(c.DO.WithContext(ctx))
+}
+
+func (c chatInstructionDo) ReadDB() IChatInstructionDo {
+	return c.Clauses(dbresolver.Read)
+}
+
+func (c chatInstructionDo) WriteDB() IChatInstructionDo {
+	return c.Clauses(dbresolver.Write)
+}
+
+func (c chatInstructionDo) Session(config *gorm.Session) IChatInstructionDo {
+	return c.withDO(c.DO.Session(config))
+}
+
+func (c chatInstructionDo) Clauses(conds ...clause.Expression) IChatInstructionDo {
+	return c.withDO(c.DO.Clauses(conds...))
+}
+
+func (c chatInstructionDo) Returning(value interface{}, columns ...string) IChatInstructionDo {
+	return c.withDO(c.DO.Returning(value, columns...))
+}
+
+func (c chatInstructionDo) Not(conds ...gen.Condition) IChatInstructionDo {
+	return c.withDO(c.DO.Not(conds...))
+}
+
+func (c chatInstructionDo) Or(conds ...gen.Condition) IChatInstructionDo {
+	return c.withDO(c.DO.Or(conds...))
+}
+
+func (c chatInstructionDo) Select(conds ...field.Expr) IChatInstructionDo {
+	return c.withDO(c.DO.Select(conds...))
+}
+
+func (c chatInstructionDo) Where(conds ...gen.Condition) IChatInstructionDo {
+	return c.withDO(c.DO.Where(conds...))
+}
+
+func (c chatInstructionDo) Order(conds ...field.Expr) IChatInstructionDo {
+	return c.withDO(c.DO.Order(conds...))
+}
+
+func (c chatInstructionDo) Distinct(cols ...field.Expr) IChatInstructionDo {
+	return c.withDO(c.DO.Distinct(cols...))
+}
+
+func (c chatInstructionDo) Omit(cols ...field.Expr) IChatInstructionDo {
+	return c.withDO(c.DO.Omit(cols...))
+}
+
+func (c chatInstructionDo) Join(table schema.Tabler, on ...field.Expr) IChatInstructionDo {
+	return c.withDO(c.DO.Join(table, on...))
+}
+
+func (c chatInstructionDo) LeftJoin(table schema.Tabler, on ...field.Expr) IChatInstructionDo {
+	return c.withDO(c.DO.LeftJoin(table, on...))
+}
+
+func (c chatInstructionDo) RightJoin(table schema.Tabler, on ...field.Expr) IChatInstructionDo {
+	return c.withDO(c.DO.RightJoin(table, on...))
+}
+
+func (c chatInstructionDo) Group(cols ...field.Expr) IChatInstructionDo {
+	return c.withDO(c.DO.Group(cols...))
+}
+
+func (c chatInstructionDo) Having(conds ...gen.Condition) IChatInstructionDo {
+	return c.withDO(c.DO.Having(conds...))
+}
+
+func (c chatInstructionDo) Limit(limit int) IChatInstructionDo {
+	return c.withDO(c.DO.Limit(limit))
+}
+
+func (c chatInstructionDo) Offset(offset int) IChatInstructionDo {
+	return c.withDO(c.DO.Offset(offset))
+}
+
+func (c chatInstructionDo) Scopes(funcs ...func(gen.Dao) gen.Dao) IChatInstructionDo {
+	return c.withDO(c.DO.Scopes(funcs...))
+}
+
+func (c chatInstructionDo) Unscoped() IChatInstructionDo {
+	return c.withDO(c.DO.Unscoped())
+}
+
+func (c chatInstructionDo) Create(values ...*entities.ChatInstruction) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return c.DO.Create(values)
+}
+
+func (c chatInstructionDo) CreateInBatches(values []*entities.ChatInstruction, batchSize int) error {
+	return c.DO.CreateInBatches(values, batchSize)
+}
+
+// Save : !!! underlying implementation is different with GORM
+// The method is equivalent to executing the statement: db.Clauses(clause.OnConflict{UpdateAll: true}).Create(values)
+func (c chatInstructionDo) Save(values ...*entities.ChatInstruction) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return c.DO.Save(values)
+}
+
+func (c chatInstructionDo) First() (*entities.ChatInstruction, error) {
+	if result, err := c.DO.First(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ChatInstruction), nil
+	}
+}
+
+func (c chatInstructionDo) Take() (*entities.ChatInstruction, error) {
+	if result, err := c.DO.Take(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ChatInstruction), nil
+	}
+}
+
+func (c chatInstructionDo) Last() (*entities.ChatInstruction, error) {
+	if result, err := c.DO.Last(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ChatInstruction), nil
+	}
+}
+
+func (c chatInstructionDo) Find() ([]*entities.ChatInstruction, error) {
+	result, err := c.DO.Find()
+	return result.([]*entities.ChatInstruction), err
+}
+
+func (c chatInstructionDo) FindInBatch(batchSize int, fc func(tx gen.Dao, batch int) error) (results []*entities.ChatInstruction, err error) {
+	buf := make([]*entities.ChatInstruction, 0, batchSize)
+	err = c.DO.FindInBatches(&buf, batchSize, func(tx gen.Dao, batch int) error {
+		defer func() { results = append(results, buf...) }()
+		return fc(tx, batch)
+	})
+	return results, err
+}
+
+func (c chatInstructionDo) FindInBatches(result *[]*entities.ChatInstruction, batchSize int, fc func(tx gen.Dao, batch int) error) error {
+	return c.DO.FindInBatches(result, batchSize, fc)
+}
+
+func (c chatInstructionDo) Attrs(attrs ...field.AssignExpr) IChatInstructionDo {
+	return c.withDO(c.DO.Attrs(attrs...))
+}
+
+func (c chatInstructionDo) Assign(attrs ...field.AssignExpr) IChatInstructionDo {
+	return c.withDO(c.DO.Assign(attrs...))
+}
+
+func (c chatInstructionDo) Joins(fields ...field.RelationField) IChatInstructionDo {
+	for _, _f := range fields {
+		c = *c.withDO(c.DO.Joins(_f))
+	}
+	return &c
+}
+
+func (c chatInstructionDo) Preload(fields ...field.RelationField) IChatInstructionDo {
+	for _, _f := range fields {
+		c = *c.withDO(c.DO.Preload(_f))
+	}
+	return &c
+}
+
+func (c chatInstructionDo) FirstOrInit() (*entities.ChatInstruction, error) {
+	if result, err := c.DO.FirstOrInit(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ChatInstruction), nil
+	}
+}
+
+func (c chatInstructionDo) FirstOrCreate() (*entities.ChatInstruction, error) {
+	if result, err := c.DO.FirstOrCreate(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ChatInstruction), nil
+	}
+}
+
+func (c chatInstructionDo) FindByPage(offset int, limit int) (result []*entities.ChatInstruction, count int64, err error) {
+	result, err = c.Offset(offset).Limit(limit).Find()
+	if err != nil {
+		return
+	}
+
+	if size := len(result); 0 < limit && 0 < size && size < limit {
+		count = int64(size + offset)
+		return
+	}
+
+	count, err = c.Offset(-1).Limit(-1).Count()
+	return
+}
+
+func (c chatInstructionDo) ScanByPage(result interface{}, offset int, limit int) (count int64, err error) {
+	count, err = c.Count()
+	if err != nil {
+		return
+	}
+
+	err = c.Offset(offset).Limit(limit).Scan(result)
+	return
+}
+
+func (c chatInstructionDo) Scan(result interface{}) (err error) {
+	return c.DO.Scan(result)
+}
+
+func (c chatInstructionDo) Delete(models ...*entities.ChatInstruction) (result gen.ResultInfo, err error) {
+	return c.DO.Delete(models)
+}
+
+func (c *chatInstructionDo) withDO(do gen.Dao) *chatInstructionDo {
+	c.DO = *do.(*gen.DO)
+	return c
+}
@@ -0,0 +1,433 @@
+// Code generated by gorm.io/gen. DO NOT EDIT.
+// Code generated by gorm.io/gen. DO NOT EDIT.
+// Code generated by gorm.io/gen. DO NOT EDIT.
+
+package query
+
+import (
+	"context"
+	"database/sql"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"gorm.io/gen"
+	"gorm.io/gen/field"
+
+	"gorm.io/plugin/dbresolver"
+
+	"ximanager/sources/persistence/entities"
+)
+
+func newChatSetting(db *gorm.DB, opts ...gen.DOOption) chatSetting {
+	_chatSetting := chatSetting{}
+
+	_chatSetting.chatSettingDo.UseDB(db, opts...)
+	_chatSetting.chatSettingDo.UseModel(&entities.ChatSetting{})
+
+	tableName := _chatSetting.chatSettingDo.TableName()
+	_chatSetting.ALL = field.NewAsterisk(tableName)
+	_chatSetting.ID = field.NewField(tableName, "id")
+	_chatSetting.ChatID = field.NewInt64(tableName, "chat_id")
+	_chatSetting.Language = field.NewString(tableName, "language")
+	_chatSetting.TriggerPolicy = field.NewString(tableName, "trigger_policy")
+	_chatSetting.TriggerKeywords = field.NewString(tableName, "trigger_keywords")
+	_chatSetting.LurkerChance = field.NewInt(tableName, "lurker_chance")
+	_chatSetting.QuietFrom = field.NewInt(tableName, "quiet_from")
+	_chatSetting.QuietTo = field.NewInt(tableName, "quiet_to")
+	_chatSetting.TimeZone = field.NewString(tableName, "time_zone")
+	_chatSetting.UpdatedBy = field.NewField(tableName, "updated_by")
+	_chatSetting.UpdatedAt = field.NewTime(tableName, "updated_at")
+
+	_chatSetting.fillFieldMap()
+
+	return _chatSetting
+}
+
+type chatSetting struct {
+	chatSettingDo chatSettingDo
+
+	ALL             field.Asterisk
+	ID              field.Field
+	ChatID          field.Int64
+	Language        field.String
+	TriggerPolicy   field.String
+	TriggerKeywords field.String
+	LurkerChance    field.Int
+	QuietFrom       field.Int
+	QuietTo         field.Int
+	TimeZone        field.String
+	UpdatedBy       field.Field
+	UpdatedAt       field.Time
+
+	fieldMap map[string]field.Expr
+}
+
+func (c chatSetting) Table(newTableName string) *chatSetting {
+	c.chatSettingDo.UseTable(newTableName)
+	return c.updateTableName(newTableName)
+}
+
+func (c chatSetting) As(alias string) *chatSetting {
+	c.chatSettingDo.DO = *(c.chatSettingDo.As(alias).(*gen.DO))
+	return c.updateTableName(alias)
+}
+
+func (c *chatSetting) updateTableName(table string) *chatSetting {
+	c.ALL = field.NewAsterisk(table)
+	c.ID = field.NewField(table, "id")
+	c.ChatID = field.NewInt64(table, "chat_id")
+	c.Language = field.NewString(table, "language")
+	c.TriggerPolicy = field.NewString(table, "trigger_policy")
+	c.TriggerKeywords = field.NewString(table, "trigger_keywords")
+	c.LurkerChance = field.NewInt(table, "lurker_chance")
+	c.QuietFrom = field.NewInt(table, "quiet_from")
+	c.QuietTo = field.NewInt(table, "quiet_to")
+	c.TimeZone = field.NewString(table, "time_zone")
+	c.UpdatedBy = field.NewField(table, "updated_by")
+	c.UpdatedAt = field.NewTime(table, "updated_at")
+
+	c.fillFieldMap()
+
+	return c
+}
+
+func (c *chatSetting) WithContext(ctx context.Context) IChatSettingDo {
+	return c.chatSettingDo.WithContext(ctx)
+}
+
+func (c chatSetting) TableName() string { return c.chatSettingDo.TableName() }
+
+func (c chatSetting) Alias() string { return c.chatSettingDo.Alias() }
+
+func (c chatSetting) Columns(cols ...field.Expr) gen.Columns { return c.chatSettingDo.Columns(cols...) }
+
+func (c *chatSetting) GetFieldByName(fieldName string) (field.OrderExpr, bool) {
+	_f, ok := c.fieldMap[fieldName]
+	if !ok || _f == nil {
+		return nil, false
+	}
+	_oe, ok := _f.(field.OrderExpr)
+	return _oe, ok
+}
+
+func (c *chatSetting) fillFieldMap() {
+	c.fieldMap = make(map[string]field.Expr, 11)
+	c.fieldMap["id"] = c.ID
+	c.fieldMap["chat_id"] = c.ChatID
+	c.fieldMap["language"] = c.Language
+	c.fieldMap["trigger_policy"] = c.TriggerPolicy
+	c.fieldMap["trigger_keywords"] = c.TriggerKeywords
+	c.fieldMap["lurker_chance"] = c.LurkerChance
+	c.fieldMap["quiet_from"] = c.QuietFrom
+	c.fieldMap["quiet_to"] = c.QuietTo
+	c.fieldMap["time_zone"] = c.TimeZone
+	c.fieldMap["updated_by"] = c.UpdatedBy
+	c.fieldMap["updated_at"] = c.UpdatedAt
+}
+
+func (c chatSetting) clone(db *gorm.DB) chatSetting {
+	c.chatSettingDo.ReplaceConnPool(db.Statement.ConnPool)
+	return c
+}
+
+func (c chatSetting) replaceDB(db *gorm.DB) chatSetting {
+	c.chatSettingDo.ReplaceDB(db)
+	return c
+}
+
+type chatSettingDo struct{ gen.DO }
+
+type IChatSettingDo interface {
+	gen.SubQuery
+	Debug() IChatSettingDo
+	WithContext(ctx context.Context) IChatSettingDo
+	WithResult(fc func(tx gen.Dao)) gen.ResultInfo
+	ReplaceDB(db *gorm.DB)
+	ReadDB() IChatSettingDo
+	WriteDB() IChatSettingDo
+	As(alias string) gen.Dao
+	Session(config *gorm.Session) IChatSettingDo
+	Columns(cols ...field.Expr) gen.Columns
+	Clauses(conds ...clause.Expression) IChatSettingDo
+	Not(conds ...gen.Condition) IChatSettingDo
+	Or(conds ...gen.Condition) IChatSettingDo
+	Select(conds ...field.Expr) IChatSettingDo
+	Where(conds ...gen.Condition) IChatSettingDo
+	Order(conds ...field.Expr) IChatSettingDo
+	Distinct(cols ...field.Expr) IChatSettingDo
+	Omit(cols ...field.Expr) IChatSettingDo
+	Join(table schema.Tabler, on ...field.Expr) IChatSettingDo
+	LeftJoin(table schema.Tabler, on ...field.Expr) IChatSettingDo
+	RightJoin(table schema.Tabler, on ...field.Expr) IChatSettingDo
+	Group(cols ...field.Expr) IChatSettingDo
+	Having(conds ...gen.Condition) IChatSettingDo
+	Limit(limit int) IChatSettingDo
+	Offset(offset int) IChatSettingDo
+	Count() (count int64, err error)
+	Scopes(funcs ...func(gen.Dao) gen.Dao) IChatSettingDo
+	Unscoped() IChatSettingDo
+	Create(values ...*entities.ChatSetting) error
+	CreateInBatches(values []*entities.ChatSetting, batchSize int) error
+	Save(values ...*entities.ChatSetting) error
+	First() (*entities.ChatSetting, error)
+	Take() (*entities.ChatSetting, error)
+	Last() (*entities.ChatSetting, error)
+	Find() ([]*entities.ChatSetting, error)
+	FindInBatch(batchSize int, fc func(tx gen.Dao, batch int) error) (results []*entities.ChatSetting, err error)
+	FindInBatches(result *[]*entities.ChatSetting, batchSize int, fc func(tx gen.Dao, batch int) error) error
+	Pluck(column field.Expr, dest interface{}) error
+	Delete(...*entities.ChatSetting) (info gen.ResultInfo, err error)
+	Update(column field.Expr, value interface{}) (info gen.ResultInfo, err error)
+	UpdateSimple(columns ...field.AssignExpr) (info gen.ResultInfo, err error)
+	Updates(value interface{}) (info gen.ResultInfo, err error)
+	UpdateColumn(column field.Expr, value interface{}) (info gen.ResultInfo, err error)
+	UpdateColumnSimple(columns ...field.AssignExpr) (info gen.ResultInfo, err error)
+	UpdateColumns(value interface{}) (info gen.ResultInfo, err error)
+	UpdateFrom(q gen.SubQuery) gen.Dao
+	Attrs(attrs ...field.AssignExpr) IChatSettingDo
+	Assign(attrs ...field.AssignExpr) IChatSettingDo
+	Joins(fields ...field.RelationField) IChatSettingDo
+	Preload(fields ...field.RelationField) IChatSettingDo
+	FirstOrInit() (*entities.ChatSetting, error)
+	FirstOrCreate() (*entities.ChatSetting, error)
+	FindByPage(offset int, limit int) (result []*entities.ChatSetting, count int64, err error)
+	ScanByPage(result interface{}, offset int, limit int) (count int64, err error)
+	Rows() (*sql.Rows, error)
+	Row() *sql.Row
+	Scan(result interface{}) (err error)
+	Returning(value interface{}, columns ...string) IChatSettingDo
+	UnderlyingDB() *gorm.DB
+	schema.Tabler
+}
+
+func (c chatSettingDo) Debug() IChatSettingDo {
+	return c.withDO(c.DO.Debug())
+}
+
+func (c chatSettingDo) WithContext(ctx context.Context) IChatSettingDo {
+	return c.withDO(c.DO.WithContext(ctx))
+}
+
+func (c chatSettingDo) ReadDB() IChatSettingDo {
+	return c.Clauses(dbresolver.Read)
+}
+
+func (c chatSettingDo) WriteDB() IChatSettingDo {
+	return c.Clauses(dbresolver.Write)
+}
+
+func (c chatSettingDo) Session(config *gorm.Session) IChatSettingDo {
+	return c.withDO(c.DO.Session(config))
+}
+
+func (c chatSettingDo) Clauses(conds ...clause.Expression) IChatSettingDo {
+	return c.withDO(c.DO.Clauses(conds...))
+}
+
+func (c chatSettingDo) Returning(value interface{}, columns ...string) IChatSettingDo {
+	return c.withDO(c.DO.Returning(value, columns...))
+}
+
+func (c chatSettingDo) Not(conds ...gen.Condition) IChatSettingDo {
+	return c.withDO(c.DO.Not(conds...))
+}
+
+func (c chatSettingDo) Or(conds ...gen.Condition) IChatSettingDo {
+	return c.withDO(c.DO.Or(conds...))
+}
+
+func (c chatSettingDo) Select(conds ...field.Expr) IChatSettingDo {
+	return c.withDO(c.DO.Select(conds...))
+}
+
+func (c chatSettingDo) Where(conds ...gen.Condition) IChatSettingDo {
+	return c.withDO(c.DO.Where(conds...))
+}
+
+func (c chatSettingDo) Order(conds ...field.Expr) IChatSettingDo {
+	return c.withDO(c.DO.Order(conds...))
+}
+
+func (c chatSettingDo) Distinct(cols ...field.Expr) IChatSettingDo {
+	return c.withDO(c.DO.Distinct(cols...))
+}
+
+func (c chatSettingDo) Omit(cols ...field.Expr) IChatSettingDo {
+	return c.withDO(c.DO.Omit(cols...))
+}
+
+func (c chatSettingDo) Join(table schema.Tabler, on ...field.Expr) IChatSettingDo {
+	return c.withDO(c.DO.Join(table, on...))
+}
+
+func (c chatSettingDo) LeftJoin(table schema.Tabler, on ...field.Expr) IChatSettingDo {
+	return c.withDO(c.DO.LeftJoin(table, on...))
+}
+
+func (c chatSettingDo) RightJoin(table schema.Tabler, on ...field.Expr) IChatSettingDo {
+	return c.withDO(c.DO.RightJoin(table, on...))
+}
+
+func (c chatSettingDo) Group(cols ...field.Expr) IChatSettingDo {
+	return c.withDO(c.DO.Group(cols...))
+}
+
+func (c chatSettingDo) Having(conds ...gen.Condition) IChatSettingDo {
+	return c.withDO(c.DO.Having(conds...))
+}
+
+func (c chatSettingDo) Limit(limit int) IChatSettingDo {
+	return c.withDO(c.DO.Limit(limit))
+}
+
+func (c chatSettingDo) Offset(offset int) IChatSettingDo {
+	return c.withDO(c.DO.Offset(offset))
+}
+
+func (c chatSettingDo) Scopes(funcs ...func(gen.Dao) gen.Dao) IChatSettingDo {
+	return c.withDO(c.DO.Scopes(funcs...))
+}
+
+func (c chatSettingDo) Unscoped() IChatSettingDo {
+	return c.withDO(c.DO.Unscoped())
+}
+
+func (c chatSettingDo) Create(values ...*entities.ChatSetting) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return c.DO.Create(values)
+}
+
+func (c chatSettingDo) CreateInBatches(values []*entities.ChatSetting, batchSize int) error {
+	return c.DO.CreateInBatches(values, batchSize)
+}
+
+// Save : !!! underlying implementation is different with GORM
+// The method is equivalent to executing the statement: db.Clauses(clause.OnConflict{UpdateAll: true}).Create(values)
+func (c chatSettingDo) Save(values ...*entities.ChatSetting) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return c.DO.Save(values)
+}
+
+func (c chatSettingDo) First() (*entities.ChatSetting, error) {
+	if result, err := c.DO.First(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ChatSetting), nil
+	}
+}
+
+func (c chatSettingDo) Take() (*entities.ChatSetting, error) {
+	if result, err := c.DO.Take(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ChatSetting), nil
+	}
+}
+
+func (c chatSettingDo) Last() (*entities.ChatSetting, error) {
+	if result, err := c.DO.Last(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ChatSetting), nil
+	}
+}
+
+func (c chatSettingDo) Find() ([]*entities.ChatSetting, error) {
+	result, err := c.DO.Find()
+	return result.([]*entities.ChatSetting), err
+}
+
+func (c chatSettingDo) FindInBatch(batchSize int, fc func(tx gen.Dao, batch int) error) (results []*entities.ChatSetting, err error) {
+	buf := make([]*entities.ChatSetting, 0, batchSize)
+	err = c.DO.FindInBatches(&buf, batchSize, func(tx gen.Dao, batch int) error {
+		defer func() { results = append(results, buf...) }()
+		return fc(tx, batch)
+	})
+	return results, err
+}
+
+func (c chatSettingDo) FindInBatches(result *[]*entities.ChatSetting, batchSize int, fc func(tx gen.Dao, batch int) error) error {
+	return c.DO.FindInBatches(result, batchSize, fc)
+}
+
+func (c chatSettingDo) Attrs(attrs ...field.AssignExpr) IChatSettingDo {
+	return c.withDO(c.DO.Attrs(attrs...))
+}
+
+func (c chatSettingDo) Assign(attrs ...field.AssignExpr) IChatSettingDo {
+	return c.withDO(c.DO.Assign(attrs...))
+}
+
+func (c chatSettingDo) Joins(fields ...field.RelationField) IChatSettingDo {
+	for _, _f := range fields {
+		c = *c.withDO(c.DO.Joins(_f))
+	}
+	return &c
+}
+
+func (c chatSettingDo) Preload(fields ...field.RelationField) IChatSettingDo {
+	for _, _f := range fields {
+		c = *c.withDO(c.DO.Preload(_f))
+	}
+	return &c
+}
+
+func (c chatSettingDo) FirstOrInit() (*entities.ChatSetting, error) {
+	if result, err := c.DO.FirstOrInit(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ChatSetting), nil
+	}
+}
+
+func (c chatSettingDo) FirstOrCreate() (*entities.ChatSetting, error) {
+	if result, err := c.DO.FirstOrCreate(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ChatSetting), nil
+	}
+}
+
+func (c chatSettingDo) FindByPage(offset int, limit int) (result []*entities.ChatSetting, count int64, err error) {
+	result, err = c.Offset(offset).Limit(limit).Find()
+	if err != nil {
+		return
+	}
+
+	if size := len(result); 0 < limit && 0 < size && size < limit {
+		count = int64(size + offset)
+		return
+	}
+
+	count, err = c.Offset(-1).Limit(-1).Count()
+	return
+}
+
+func (c chatSettingDo) ScanByPage(result interface{}, offset int, limit int) (count int64, err error) {
+	count, err = c.Count()
+	if err != nil {
+		return
+	}
+
+	err = c.Offset(offset).Limit(limit).Scan(result)
+	return
+}
+
+func (c chatSettingDo) Scan(result interface{}) (err error) {
+	return c.DO.Scan(result)
+}
+
+func (c chatSettingDo) Delete(models ...*entities.ChatSetting) (result gen.ResultInfo, err error) {
+	return c.DO.Delete(models)
+}
+
+func (c *chatSettingDo) withDO(do gen.Dao) *chatSettingDo {
+	c.DO = *do.(*gen.DO)
+	return c
+}
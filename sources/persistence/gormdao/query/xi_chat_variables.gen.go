@@ -0,0 +1,411 @@
+// Code generated by gorm.io/gen. DO NOT EDIT.
+// Code generated by gorm.io/gen. DO NOT EDIT.
+// Code generated by gorm.io/gen. DO NOT EDIT.
+
+package query
+
+import (
+	"context"
+	"database/sql"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"gorm.io/gen"
+	"gorm.io/gen/field"
+
+	"gorm.io/plugin/dbresolver"
+
+	"ximanager/sources/persistence/entities"
+)
+
+func newChatVariable(db *gorm.DB, opts ...gen.DOOption) chatVariable {
+	_chatVariable := chatVariable{}
+
+	_chatVariable.chatVariableDo.UseDB(db, opts...)
+	_chatVariable.chatVariableDo.UseModel(&entities.ChatVariable{})
+
+	tableName := _chatVariable.chatVariableDo.TableName()
+	_chatVariable.ALL = field.NewAsterisk(tableName)
+	_chatVariable.ID = field.NewField(tableName, "id")
+	_chatVariable.ChatID = field.NewInt64(tableName, "chat_id")
+	_chatVariable.Name = field.NewString(tableName, "name")
+	_chatVariable.Value = field.NewString(tableName, "value")
+	_chatVariable.UpdatedAt = field.NewTime(tableName, "updated_at")
+
+	_chatVariable.fillFieldMap()
+
+	return _chatVariable
+}
+
+type chatVariable struct {
+	chatVariableDo chatVariableDo
+
+	ALL       field.Asterisk
+	ID        field.Field
+	ChatID    field.Int64
+	Name      field.String
+	Value     field.String
+	UpdatedAt field.Time
+
+	fieldMap map[string]field.Expr
+}
+
+func (c chatVariable) Table(newTableName string) *chatVariable {
+	c.chatVariableDo.UseTable(newTableName)
+	return c.updateTableName(newTableName)
+}
+
+func (c chatVariable) As(alias string) *chatVariable {
+	c.chatVariableDo.DO = *(c.chatVariableDo.As(alias).(*gen.DO))
+	return c.updateTableName(alias)
+}
+
+func (c *chatVariable) updateTableName(table string) *chatVariable {
+	c.ALL = field.NewAsterisk(table)
+	c.ID = field.NewField(table, "id")
+	c.ChatID = field.NewInt64(table, "chat_id")
+	c.Name = field.NewString(table, "name")
+	c.Value = field.NewString(table, "value")
+	c.UpdatedAt = field.NewTime(table, "updated_at")
+
+	c.fillFieldMap()
+
+	return c
+}
+
+func (c *chatVariable) WithContext(ctx context.Context) IChatVariableDo {
+	return c.chatVariableDo.WithContext(ctx)
+}
+
+func (c chatVariable) TableName() string { return c.chatVariableDo.TableName() }
+
+func (c chatVariable) Alias() string { return c.chatVariableDo.Alias() }
+
+func (c chatVariable) Columns(cols ...field.Expr) gen.Columns {
+	return c.chatVariableDo.Columns(cols...)
+}
+
+func (c *chatVariable) GetFieldByName(fieldName string) (field.OrderExpr, bool) {
+	_f, ok := c.fieldMap[fieldName]
+	if !ok || _f == nil {
+		return nil, false
+	}
+	_oe, ok := _f.(field.OrderExpr)
+	return _oe, ok
+}
+
+func (c *chatVariable) fillFieldMap() {
+	c.fieldMap = make(map[string]field.Expr, 5)
+	c.fieldMap["id"] = c.ID
+	c.fieldMap["chat_id"] = c.ChatID
+	c.fieldMap["name"] = c.Name
+	c.fieldMap["value"] = c.Value
+	c.fieldMap["updated_at"] = c.UpdatedAt
+}
+
+func (c chatVariable) clone(db *gorm.DB) chatVariable {
+	c.chatVariableDo.ReplaceConnPool(db.Statement.ConnPool)
+	return c
+}
+
+func (c chatVariable) replaceDB(db *gorm.DB) chatVariable {
+	c.chatVariableDo.ReplaceDB(db)
+	return c
+}
+
+type chatVariableDo struct{ gen.DO }
+
+type IChatVariableDo interface {
+	gen.SubQuery
+	Debug() IChatVariableDo
+	WithContext(ctx context.Context) IChatVariableDo
+	WithResult(fc func(tx gen.Dao)) gen.ResultInfo
+	ReplaceDB(db *gorm.DB)
+	ReadDB() IChatVariableDo
+	WriteDB() IChatVariableDo
+	As(alias string) gen.Dao
+	Session(config *gorm.Session) IChatVariableDo
+	Columns(cols ...field.Expr) gen.Columns
+	Clauses(conds ...clause.Expression) IChatVariableDo
+	Not(conds ...gen.Condition) IChatVariableDo
+	Or(conds ...gen.Condition) IChatVariableDo
+	Select(conds ...field.Expr) IChatVariableDo
+	Where(conds ...gen.Condition) IChatVariableDo
+	Order(conds ...field.Expr) IChatVariableDo
+	Distinct(cols ...field.Expr) IChatVariableDo
+	Omit(cols ...field.Expr) IChatVariableDo
+	Join(table schema.Tabler, on ...field.Expr) IChatVariableDo
+	LeftJoin(table schema.Tabler, on ...field.Expr) IChatVariableDo
+	RightJoin(table schema.Tabler, on ...field.Expr) IChatVariableDo
+	Group(cols ...field.Expr) IChatVariableDo
+	Having(conds ...gen.Condition) IChatVariableDo
+	Limit(limit int) IChatVariableDo
+	Offset(offset int) IChatVariableDo
+	Count() (count int64, err error)
+	Scopes(funcs ...func(gen.Dao) gen.Dao) IChatVariableDo
+	Unscoped() IChatVariableDo
+	Create(values ...*entities.ChatVariable) error
+	CreateInBatches(values []*entities.ChatVariable, batchSize int) error
+	Save(values ...*entities.ChatVariable) error
+	First() (*entities.ChatVariable, error)
+	Take() (*entities.ChatVariable, error)
+	Last() (*entities.ChatVariable, error)
+	Find() ([]*entities.ChatVariable, error)
+	FindInBatch(batchSize int, fc func(tx gen.Dao, batch int) error) (results []*entities.ChatVariable, err error)
+	FindInBatches(result *[]*entities.ChatVariable, batchSize int, fc func(tx gen.Dao, batch int) error) error
+	Pluck(column field.Expr, dest interface{}) error
+	Delete(...*entities.ChatVariable) (info gen.ResultInfo, err error)
+	Update(column field.Expr, value interface{}) (info gen.ResultInfo, err error)
+	UpdateSimple(columns ...field.AssignExpr) (info gen.ResultInfo, err error)
+	Updates(value interface{}) (info gen.ResultInfo, err error)
+	UpdateColumn(column field.Expr, value interface{}) (info gen.ResultInfo, err error)
+	UpdateColumnSimple(columns ...field.AssignExpr) (info gen.ResultInfo, err error)
+	UpdateColumns(value interface{}) (info gen.ResultInfo, err error)
+	UpdateFrom(q gen.SubQuery) gen.Dao
+	Attrs(attrs ...field.AssignExpr) IChatVariableDo
+	Assign(attrs ...field.AssignExpr) IChatVariableDo
+	Joins(fields ...field.RelationField) IChatVariableDo
+	Preload(fields ...field.RelationField) IChatVariableDo
+	FirstOrInit() (*entities.ChatVariable, error)
+	FirstOrCreate() (*entities.ChatVariable, error)
+	FindByPage(offset int, limit int) (result []*entities.ChatVariable, count int64, err error)
+	ScanByPage(result interface{}, offset int, limit int) (count int64, err error)
+	Rows() (*sql.Rows, error)
+	Row() *sql.Row
+	Scan(result interface{}) (err error)
+	Returning(value interface{}, columns ...string) IChatVariableDo
+	UnderlyingDB() *gorm.DB
+	schema.Tabler
+}
+
+func (c chatVariableDo) Debug() IChatVariableDo {
+	return c.withDO(c.DO.Debug())
+}
+
+func (c chatVariableDo) WithContext(ctx context.Context) IChatVariableDo {
+	return c.withDO(c.DO.WithContext(ctx))
+}
+
+func (c chatVariableDo) ReadDB() IChatVariableDo {
+	return c.Clauses(dbresolver.Read)
+}
+
+func (c chatVariableDo) WriteDB() IChatVariableDo {
+	return c.Clauses(dbresolver.Write)
+}
+
+func (c chatVariableDo) Session(config *gorm.Session) IChatVariableDo {
+	return c.withDO(c.DO.Session(config))
+}
+
+func (c chatVariableDo) Clauses(conds ...clause.Expression) IChatVariableDo {
+	return c.withDO(c.DO.Clauses(conds...))
+}
+
+func (c chatVariableDo) Returning(value interface{}, columns ...string) IChatVariableDo {
+	return c.withDO(c.DO.Returning(value, columns...))
+}
+
+func (c chatVariableDo) Not(conds ...gen.Condition) IChatVariableDo {
+	return c.withDO(c.DO.Not(conds...))
+}
+
+func (c chatVariableDo) Or(conds ...gen.Condition) IChatVariableDo {
+	return c.withDO(c.DO.Or(conds...))
+}
+
+func (c chatVariableDo) Select(conds ...field.Expr) IChatVariableDo {
+	return c.withDO(c.DO.Select(conds...))
+}
+
+func (c chatVariableDo) Where(conds ...gen.Condition) IChatVariableDo {
+	return c.withDO(c.DO.Where(conds...))
+}
+
+func (c chatVariableDo) Order(conds ...field.Expr) IChatVariableDo {
+	return c.withDO(c.DO.Order(conds...))
+}
+
+func (c chatVariableDo) Distinct(cols ...field.Expr) IChatVariableDo {
+	return c.withDO(c.DO.Distinct(cols...))
+}
+
+func (c chatVariableDo) Omit(cols ...field.Expr) IChatVariableDo {
+	return c.withDO(c.DO.Omit(cols...))
+}
+
+func (c chatVariableDo) Join(table schema.Tabler, on ...field.Expr) IChatVariableDo {
+	return c.withDO(c.DO.Join(table, on...))
+}
+
+func (c chatVariableDo) LeftJoin(table schema.Tabler, on ...field.Expr) IChatVariableDo {
+	return c.withDO(c.DO.LeftJoin(table, on...))
+}
+
+func (c chatVariableDo) RightJoin(table schema.Tabler, on ...field.Expr) IChatVariableDo {
+	return c.withDO(c.DO.RightJoin(table, on...))
+}
+
+func (c chatVariableDo) Group(cols ...field.Expr) IChatVariableDo {
+	return c.withDO(c.DO.Group(cols...))
+}
+
+func (c chatVariableDo) Having(conds ...gen.Condition) IChatVariableDo {
+	return c.withDO(c.DO.Having(conds...))
+}
+
+func (c chatVariableDo) Limit(limit int) IChatVariableDo {
+	return c.withDO(c.DO.Limit(limit))
+}
+
+func (c chatVariableDo) Offset(offset int) IChatVariableDo {
+	return c.withDO(c.DO.Offset(offset))
+}
+
+func (c chatVariableDo) Scopes(funcs ...func(gen.Dao) gen.Dao) IChatVariableDo {
+	return c.withDO(c.DO.Scopes(funcs...))
+}
+
+func (c chatVariableDo) Unscoped() IChatVariableDo {
+	return c.withDO(c.DO.Unscoped())
+}
+
+func (c chatVariableDo) Create(values ...*entities.ChatVariable) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return c.DO.Create(values)
+}
+
+func (c chatVariableDo) CreateInBatches(values []*entities.ChatVariable, batchSize int) error {
+	return c.DO.CreateInBatches(values, batchSize)
+}
+
+// Save : !!! underlying implementation is different with GORM
+// The method is equivalent to executing the statement: db.Clauses(clause.OnConflict{UpdateAll: true}).Create(values)
+func (c chatVariableDo) Save(values ...*entities.ChatVariable) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return c.DO.Save(values)
+}
+
+func (c chatVariableDo) First() (*entities.ChatVariable, error) {
+	if result, err := c.DO.First(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ChatVariable), nil
+	}
+}
+
+func (c chatVariableDo) Take() (*entities.ChatVariable, error) {
+	if result, err := c.DO.Take(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ChatVariable), nil
+	}
+}
+
+func (c chatVariableDo) Last() (*entities.ChatVariable, error) {
+	if result, err := c.DO.Last(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ChatVariable), nil
+	}
+}
+
+func (c chatVariableDo) Find() ([]*entities.ChatVariable, error) {
+	result, err := c.DO.Find()
+	return result.([]*entities.ChatVariable), err
+}
+
+func (c chatVariableDo) FindInBatch(batchSize int, fc func(tx gen.Dao, batch int) error) (results []*entities.ChatVariable, err error) {
+	buf := make([]*entities.ChatVariable, 0, batchSize)
+	err = c.DO.FindInBatches(&buf, batchSize, func(tx gen.Dao, batch int) error {
+		defer func() { results = append(results, buf...) }()
+		return fc(tx, batch)
+	})
+	return results, err
+}
+
+func (c chatVariableDo) FindInBatches(result *[]*entities.ChatVariable, batchSize int, fc func(tx gen.Dao, batch int) error) error {
+	return c.DO.FindInBatches(result, batchSize, fc)
+}
+
+func (c chatVariableDo) Attrs(attrs ...field.AssignExpr) IChatVariableDo {
+	return c.withDO(c.DO.Attrs(attrs...))
+}
+
+func (c chatVariableDo) Assign(attrs ...field.AssignExpr) IChatVariableDo {
+	return c.withDO(c.DO.Assign(attrs...))
+}
+
+func (c chatVariableDo) Joins(fields ...field.RelationField) IChatVariableDo {
+	for _, _f := range fields {
+		c = *c.withDO(c.DO.Joins(_f))
+	}
+	return &c
+}
+
+func (c chatVariableDo) Preload(fields ...field.RelationField) IChatVariableDo {
+	for _, _f := range fields {
+		c = *c.withDO(c.DO.Preload(_f))
+	}
+	return &c
+}
+
+func (c chatVariableDo) FirstOrInit() (*entities.ChatVariable, error) {
+	if result, err := c.DO.FirstOrInit(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ChatVariable), nil
+	}
+}
+
+func (c chatVariableDo) FirstOrCreate() (*entities.ChatVariable, error) {
+	if result, err := c.DO.FirstOrCreate(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ChatVariable), nil
+	}
+}
+
+func (c chatVariableDo) FindByPage(offset int, limit int) (result []*entities.ChatVariable, count int64, err error) {
+	result, err = c.Offset(offset).Limit(limit).Find()
+	if err != nil {
+		return
+	}
+
+	if size := len(result); 0 < limit && 0 < size && size < limit {
+		count = int64(size + offset)
+		return
+	}
+
+	count, err = c.Offset(-1).Limit(-1).Count()
+	return
+}
+
+func (c chatVariableDo) ScanByPage(result interface{}, offset int, limit int) (count int64, err error) {
+	count, err = c.Count()
+	if err != nil {
+		return
+	}
+
+	err = c.Offset(offset).Limit(limit).Scan(result)
+	return
+}
+
+func (c chatVariableDo) Scan(result interface{}) (err error) {
+	return c.DO.Scan(result)
+}
+
+func (c chatVariableDo) Delete(models ...*entities.ChatVariable) (result gen.ResultInfo, err error) {
+	return c.DO.Delete(models)
+}
+
+func (c *chatVariableDo) withDO(do gen.Dao) *chatVariableDo {
+	c.DO = *do.(*gen.DO)
+	return c
+}
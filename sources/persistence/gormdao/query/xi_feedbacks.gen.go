@@ -32,6 +32,16 @@ func newFeedback(db *gorm.DB, opts ...gen.DOOption) feedback {
 	_feedback.UserID = field.NewField(tableName, "user_id")
 	_feedback.Liked = field.NewInt(tableName, "liked")
 	_feedback.Kind = field.NewString(tableName, "kind")
+	_feedback.ChatID = field.NewInt64(tableName, "chat_id")
+	_feedback.MessageID = field.NewInt(tableName, "message_id")
+	_feedback.UsageID = field.NewField(tableName, "usage_id")
+	_feedback.Model = field.NewString(tableName, "model")
+	_feedback.ModeType = field.NewString(tableName, "mode_type")
+	_feedback.ModeVersion = field.NewInt(tableName, "mode_version")
+	_feedback.Reason = field.NewString(tableName, "reason")
+	_feedback.Comment = field.NewString(tableName, "comment")
+	_feedback.ExperimentID = field.NewField(tableName, "experiment_id")
+	_feedback.Variant = field.NewString(tableName, "variant")
 	_feedback.CreatedAt = field.NewTime(tableName, "created_at")
 	_feedback.User = feedbackHasOneUser{
 		db: db.Session(&gorm.Session{}),
@@ -160,13 +170,23 @@ func newFeedback(db *gorm.DB, opts ...gen.DOOption) feedback {
 type feedback struct {
 	feedbackDo feedbackDo
 
-	ALL       field.Asterisk
-	ID        field.Field
-	UserID    field.Field
-	Liked     field.Int
-	Kind      field.String
-	CreatedAt field.Time
-	User      feedbackHasOneUser
+	ALL          field.Asterisk
+	ID           field.Field
+	UserID       field.Field
+	Liked        field.Int
+	Kind         field.String
+	ChatID       field.Int64
+	MessageID    field.Int
+	UsageID      field.Field
+	Model        field.String
+	ModeType     field.String
+	ModeVersion  field.Int
+	Reason       field.String
+	Comment      field.String
+	ExperimentID field.Field
+	Variant      field.String
+	CreatedAt    field.Time
+	User         feedbackHasOneUser
 
 	fieldMap map[string]field.Expr
 }
@@ -187,6 +207,16 @@ func (f *feedback) updateTableName(table string) *feedback {
 	f.UserID = field.NewField(table, "user_id")
 	f.Liked = field.NewInt(table, "liked")
 	f.Kind = field.NewString(table, "kind")
+	f.ChatID = field.NewInt64(table, "chat_id")
+	f.MessageID = field.NewInt(table, "message_id")
+	f.UsageID = field.NewField(table, "usage_id")
+	f.Model = field.NewString(table, "model")
+	f.ModeType = field.NewString(table, "mode_type")
+	f.ModeVersion = field.NewInt(table, "mode_version")
+	f.Reason = field.NewString(table, "reason")
+	f.Comment = field.NewString(table, "comment")
+	f.ExperimentID = field.NewField(table, "experiment_id")
+	f.Variant = field.NewString(table, "variant")
 	f.CreatedAt = field.NewTime(table, "created_at")
 
 	f.fillFieldMap()
@@ -212,11 +242,21 @@ func (f *feedback) GetFieldByName(fieldName string) (field.OrderExpr, bool) {
 }
 
 func (f *feedback) fillFieldMap() {
-	f.fieldMap = make(map[string]field.Expr, 6)
+	f.fieldMap = make(map[string]field.Expr, 16)
 	f.fieldMap["id"] = f.ID
 	f.fieldMap["user_id"] = f.UserID
 	f.fieldMap["liked"] = f.Liked
 	f.fieldMap["kind"] = f.Kind
+	f.fieldMap["chat_id"] = f.ChatID
+	f.fieldMap["message_id"] = f.MessageID
+	f.fieldMap["usage_id"] = f.UsageID
+	f.fieldMap["model"] = f.Model
+	f.fieldMap["mode_type"] = f.ModeType
+	f.fieldMap["mode_version"] = f.ModeVersion
+	f.fieldMap["reason"] = f.Reason
+	f.fieldMap["comment"] = f.Comment
+	f.fieldMap["experiment_id"] = f.ExperimentID
+	f.fieldMap["variant"] = f.Variant
 	f.fieldMap["created_at"] = f.CreatedAt
 
 }
@@ -0,0 +1,666 @@
+// Code generated by gorm.io/gen. DO NOT EDIT.
+// Code generated by gorm.io/gen. DO NOT EDIT.
+// Code generated by gorm.io/gen. DO NOT EDIT.
+
+package query
+
+import (
+	"context"
+	"database/sql"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"gorm.io/gen"
+	"gorm.io/gen/field"
+
+	"gorm.io/plugin/dbresolver"
+
+	"ximanager/sources/persistence/entities"
+)
+
+func newModeDraft(db *gorm.DB, opts ...gen.DOOption) modeDraft {
+	_modeDraft := modeDraft{}
+
+	_modeDraft.modeDraftDo.UseDB(db, opts...)
+	_modeDraft.modeDraftDo.UseModel(&entities.ModeDraft{})
+
+	tableName := _modeDraft.modeDraftDo.TableName()
+	_modeDraft.ALL = field.NewAsterisk(tableName)
+	_modeDraft.ID = field.NewField(tableName, "id")
+	_modeDraft.ModeType = field.NewString(tableName, "mode_type")
+	_modeDraft.Prompt = field.NewString(tableName, "prompt")
+	_modeDraft.BaseVersion = field.NewInt(tableName, "base_version")
+	_modeDraft.CreatedBy = field.NewField(tableName, "created_by")
+	_modeDraft.UpdatedAt = field.NewTime(tableName, "updated_at")
+	_modeDraft.Creator = modeDraftBelongsToCreator{
+		db: db.Session(&gorm.Session{}),
+
+		RelationField: field.NewRelation("Creator", "entities.User"),
+		Messages: struct {
+			field.RelationField
+			User struct {
+				field.RelationField
+			}
+		}{
+			RelationField: field.NewRelation("Creator.Messages", "entities.Message"),
+			User: struct {
+				field.RelationField
+			}{
+				RelationField: field.NewRelation("Creator.Messages.User", "entities.User"),
+			},
+		},
+		Donations: struct {
+			field.RelationField
+			UserEntity struct {
+				field.RelationField
+			}
+		}{
+			RelationField: field.NewRelation("Creator.Donations", "entities.Donation"),
+			UserEntity: struct {
+				field.RelationField
+			}{
+				RelationField: field.NewRelation("Creator.Donations.UserEntity", "entities.User"),
+			},
+		},
+		CreatedModes: struct {
+			field.RelationField
+			Creator struct {
+				field.RelationField
+			}
+			SelectedModes struct {
+				field.RelationField
+				Mode struct {
+					field.RelationField
+				}
+				User struct {
+					field.RelationField
+				}
+			}
+		}{
+			RelationField: field.NewRelation("Creator.CreatedModes", "entities.Mode"),
+			Creator: struct {
+				field.RelationField
+			}{
+				RelationField: field.NewRelation("Creator.CreatedModes.Creator", "entities.User"),
+			},
+			SelectedModes: struct {
+				field.RelationField
+				Mode struct {
+					field.RelationField
+				}
+				User struct {
+					field.RelationField
+				}
+			}{
+				RelationField: field.NewRelation("Creator.CreatedModes.SelectedModes", "entities.SelectedMode"),
+				Mode: struct {
+					field.RelationField
+				}{
+					RelationField: field.NewRelation("Creator.CreatedModes.SelectedModes.Mode", "entities.Mode"),
+				},
+				User: struct {
+					field.RelationField
+				}{
+					RelationField: field.NewRelation("Creator.CreatedModes.SelectedModes.User", "entities.User"),
+				},
+			},
+		},
+		SelectedModes: struct {
+			field.RelationField
+		}{
+			RelationField: field.NewRelation("Creator.SelectedModes", "entities.SelectedMode"),
+		},
+		Personalizations: struct {
+			field.RelationField
+			User struct {
+				field.RelationField
+			}
+		}{
+			RelationField: field.NewRelation("Creator.Personalizations", "entities.Personalization"),
+			User: struct {
+				field.RelationField
+			}{
+				RelationField: field.NewRelation("Creator.Personalizations.User", "entities.User"),
+			},
+		},
+		Usages: struct {
+			field.RelationField
+			User struct {
+				field.RelationField
+			}
+		}{
+			RelationField: field.NewRelation("Creator.Usages", "entities.Usage"),
+			User: struct {
+				field.RelationField
+			}{
+				RelationField: field.NewRelation("Creator.Usages.User", "entities.User"),
+			},
+		},
+		Bans: struct {
+			field.RelationField
+			User struct {
+				field.RelationField
+			}
+		}{
+			RelationField: field.NewRelation("Creator.Bans", "entities.Ban"),
+			User: struct {
+				field.RelationField
+			}{
+				RelationField: field.NewRelation("Creator.Bans.User", "entities.User"),
+			},
+		},
+	}
+
+	_modeDraft.fillFieldMap()
+
+	return _modeDraft
+}
+
+type modeDraft struct {
+	modeDraftDo modeDraftDo
+
+	ALL         field.Asterisk
+	ID          field.Field
+	ModeType    field.String
+	Prompt      field.String
+	BaseVersion field.Int
+	CreatedBy   field.Field
+	UpdatedAt   field.Time
+	Creator     modeDraftBelongsToCreator
+
+	fieldMap map[string]field.Expr
+}
+
+func (m modeDraft) Table(newTableName string) *modeDraft {
+	m.modeDraftDo.UseTable(newTableName)
+	return m.updateTableName(newTableName)
+}
+
+func (m modeDraft) As(alias string) *modeDraft {
+	m.modeDraftDo.DO = *(m.modeDraftDo.As(alias).(*gen.DO))
+	return m.updateTableName(alias)
+}
+
+func (m *modeDraft) updateTableName(table string) *modeDraft {
+	m.ALL = field.NewAsterisk(table)
+	m.ID = field.NewField(table, "id")
+	m.ModeType = field.NewString(table, "mode_type")
+	m.Prompt = field.NewString(table, "prompt")
+	m.BaseVersion = field.NewInt(table, "base_version")
+	m.CreatedBy = field.NewField(table, "created_by")
+	m.UpdatedAt = field.NewTime(table, "updated_at")
+
+	m.fillFieldMap()
+
+	return m
+}
+
+func (m *modeDraft) WithContext(ctx context.Context) IModeDraftDo {
+	return m.modeDraftDo.WithContext(ctx)
+}
+
+func (m modeDraft) TableName() string { return m.modeDraftDo.TableName() }
+
+func (m modeDraft) Alias() string { return m.modeDraftDo.Alias() }
+
+func (m modeDraft) Columns(cols ...field.Expr) gen.Columns { return m.modeDraftDo.Columns(cols...) }
+
+func (m *modeDraft) GetFieldByName(fieldName string) (field.OrderExpr, bool) {
+	_f, ok := m.fieldMap[fieldName]
+	if !ok || _f == nil {
+		return nil, false
+	}
+	_oe, ok := _f.(field.OrderExpr)
+	return _oe, ok
+}
+
+func (m *modeDraft) fillFieldMap() {
+	m.fieldMap = make(map[string]field.Expr, 7)
+	m.fieldMap["id"] = m.ID
+	m.fieldMap["mode_type"] = m.ModeType
+	m.fieldMap["prompt"] = m.Prompt
+	m.fieldMap["base_version"] = m.BaseVersion
+	m.fieldMap["created_by"] = m.CreatedBy
+	m.fieldMap["updated_at"] = m.UpdatedAt
+
+}
+
+func (m modeDraft) clone(db *gorm.DB) modeDraft {
+	m.modeDraftDo.ReplaceConnPool(db.Statement.ConnPool)
+	m.Creator.db = db.Session(&gorm.Session{Initialized: true})
+	m.Creator.db.Statement.ConnPool = db.Statement.ConnPool
+	return m
+}
+
+func (m modeDraft) replaceDB(db *gorm.DB) modeDraft {
+	m.modeDraftDo.ReplaceDB(db)
+	m.Creator.db = db.Session(&gorm.Session{})
+	return m
+}
+
+type modeDraftBelongsToCreator struct {
+	db *gorm.DB
+
+	field.RelationField
+
+	Messages struct {
+		field.RelationField
+		User struct {
+			field.RelationField
+		}
+	}
+	Donations struct {
+		field.RelationField
+		UserEntity struct {
+			field.RelationField
+		}
+	}
+	CreatedModes struct {
+		field.RelationField
+		Creator struct {
+			field.RelationField
+		}
+		SelectedModes struct {
+			field.RelationField
+			Mode struct {
+				field.RelationField
+			}
+			User struct {
+				field.RelationField
+			}
+		}
+	}
+	SelectedModes struct {
+		field.RelationField
+	}
+	Personalizations struct {
+		field.RelationField
+		User struct {
+			field.RelationField
+		}
+	}
+	Usages struct {
+		field.RelationField
+		User struct {
+			field.RelationField
+		}
+	}
+	Bans struct {
+		field.RelationField
+		User struct {
+			field.RelationField
+		}
+	}
+}
+
+func (a modeDraftBelongsToCreator) Where(conds ...field.Expr) *modeDraftBelongsToCreator {
+	if len(conds) == 0 {
+		return &a
+	}
+
+	exprs := make([]clause.Expression, 0, len(conds))
+	for _, cond := range conds {
+		exprs = append(exprs, cond.BeCond().(clause.Expression))
+	}
+	a.db = a.db.Clauses(clause.Where{Exprs: exprs})
+	return &a
+}
+
+func (a modeDraftBelongsToCreator) WithContext(ctx context.Context) *modeDraftBelongsToCreator {
+	a.db = a.db.WithContext(ctx)
+	return &a
+}
+
+func (a modeDraftBelongsToCreator) Session(session *gorm.Session) *modeDraftBelongsToCreator {
+	a.db = a.db.Session(session)
+	return &a
+}
+
+func (a modeDraftBelongsToCreator) Model(m *entities.ModeDraft) *modeDraftBelongsToCreatorTx {
+	return &modeDraftBelongsToCreatorTx{a.db.Model(m).Association(a.Name())}
+}
+
+func (a modeDraftBelongsToCreator) Unscoped() *modeDraftBelongsToCreator {
+	a.db = a.db.Unscoped()
+	return &a
+}
+
+type modeDraftBelongsToCreatorTx struct{ tx *gorm.Association }
+
+func (a modeDraftBelongsToCreatorTx) Find() (result *entities.User, err error) {
+	return result, a.tx.Find(&result)
+}
+
+func (a modeDraftBelongsToCreatorTx) Append(values ...*entities.User) (err error) {
+	targetValues := make([]interface{}, len(values))
+	for i, v := range values {
+		targetValues[i] = v
+	}
+	return a.tx.Append(targetValues...)
+}
+
+func (a modeDraftBelongsToCreatorTx) Replace(values ...*entities.User) (err error) {
+	targetValues := make([]interface{}, len(values))
+	for i, v := range values {
+		targetValues[i] = v
+	}
+	return a.tx.Replace(targetValues...)
+}
+
+func (a modeDraftBelongsToCreatorTx) Delete(values ...*entities.User) (err error) {
+	targetValues := make([]interface{}, len(values))
+	for i, v := range values {
+		targetValues[i] = v
+	}
+	return a.tx.Delete(targetValues...)
+}
+
+func (a modeDraftBelongsToCreatorTx) Clear() error {
+	return a.tx.Clear()
+}
+
+func (a modeDraftBelongsToCreatorTx) Count() int64 {
+	return a.tx.Count()
+}
+
+func (a modeDraftBelongsToCreatorTx) Unscoped() *modeDraftBelongsToCreatorTx {
+	a.tx = a.tx.Unscoped()
+	return &a
+}
+
+type modeDraftDo struct{ gen.DO }
+
+type IModeDraftDo interface {
+	gen.SubQuery
+	Debug() IModeDraftDo
+	WithContext(ctx context.Context) IModeDraftDo
+	WithResult(fc func(tx gen.Dao)) gen.ResultInfo
+	ReplaceDB(db *gorm.DB)
+	ReadDB() IModeDraftDo
+	WriteDB() IModeDraftDo
+	As(alias string) gen.Dao
+	Session(config *gorm.Session) IModeDraftDo
+	Columns(cols ...field.Expr) gen.Columns
+	Clauses(conds ...clause.Expression) IModeDraftDo
+	Not(conds ...gen.Condition) IModeDraftDo
+	Or(conds ...gen.Condition) IModeDraftDo
+	Select(conds ...field.Expr) IModeDraftDo
+	Where(conds ...gen.Condition) IModeDraftDo
+	Order(conds ...field.Expr) IModeDraftDo
+	Distinct(cols ...field.Expr) IModeDraftDo
+	Omit(cols ...field.Expr) IModeDraftDo
+	Join(table schema.Tabler, on ...field.Expr) IModeDraftDo
+	LeftJoin(table schema.Tabler, on ...field.Expr) IModeDraftDo
+	RightJoin(table schema.Tabler, on ...field.Expr) IModeDraftDo
+	Group(cols ...field.Expr) IModeDraftDo
+	Having(conds ...gen.Condition) IModeDraftDo
+	Limit(limit int) IModeDraftDo
+	Offset(offset int) IModeDraftDo
+	Count() (count int64, err error)
+	Scopes(funcs ...func(gen.Dao) gen.Dao) IModeDraftDo
+	Unscoped() IModeDraftDo
+	Create(values ...*entities.ModeDraft) error
+	CreateInBatches(values []*entities.ModeDraft, batchSize int) error
+	Save(values ...*entities.ModeDraft) error
+	First() (*entities.ModeDraft, error)
+	Take() (*entities.ModeDraft, error)
+	Last() (*entities.ModeDraft, error)
+	Find() ([]*entities.ModeDraft, error)
+	FindInBatch(batchSize int, fc func(tx gen.Dao, batch int) error) (results []*entities.ModeDraft, err error)
+	FindInBatches(result *[]*entities.ModeDraft, batchSize int, fc func(tx gen.Dao, batch int) error) error
+	Pluck(column field.Expr, dest interface{}) error
+	Delete(...*entities.ModeDraft) (info gen.ResultInfo, err error)
+	Update(column field.Expr, value interface{}) (info gen.ResultInfo, err error)
+	UpdateSimple(columns ...field.AssignExpr) (info gen.ResultInfo, err error)
+	Updates(value interface{}) (info gen.ResultInfo, err error)
+	UpdateColumn(column field.Expr, value interface{}) (info gen.ResultInfo, err error)
+	UpdateColumnSimple(columns ...field.AssignExpr) (info gen.ResultInfo, err error)
+	UpdateColumns(value interface{}) (info gen.ResultInfo, err error)
+	UpdateFrom(q gen.SubQuery) gen.Dao
+	Attrs(attrs ...field.AssignExpr) IModeDraftDo
+	Assign(attrs ...field.AssignExpr) IModeDraftDo
+	Joins(fields ...field.RelationField) IModeDraftDo
+	Preload(fields ...field.RelationField) IModeDraftDo
+	FirstOrInit() (*entities.ModeDraft, error)
+	FirstOrCreate() (*entities.ModeDraft, error)
+	FindByPage(offset int, limit int) (result []*entities.ModeDraft, count int64, err error)
+	ScanByPage(result interface{}, offset int, limit int) (count int64, err error)
+	Rows() (*sql.Rows, error)
+	Row() *sql.Row
+	Scan(result interface{}) (err error)
+	Returning(value interface{}, columns ...string) IModeDraftDo
+	UnderlyingDB() *gorm.DB
+	schema.Tabler
+}
+
+func (m modeDraftDo) Debug() IModeDraftDo {
+	return m.withDO(m.DO.Debug())
+}
+
+func (m modeDraftDo) WithContext(ctx context.Context) IModeDraftDo {
+	return m.withDO(m.DO.WithContext(ctx))
+}
+
+func (m modeDraftDo) ReadDB() IModeDraftDo {
+	return m.Clauses(dbresolver.Read)
+}
+
+func (m modeDraftDo) WriteDB() IModeDraftDo {
+	return m.Clauses(dbresolver.Write)
+}
+
+func (m modeDraftDo) Session(config *gorm.Session) IModeDraftDo {
+	return m.withDO(m.DO.Session(config))
+}
+
+func (m modeDraftDo) Clauses(conds ...clause.Expression) IModeDraftDo {
+	return m.withDO(m.DO.Clauses(conds...))
+}
+
+func (m modeDraftDo) Returning(value interface{}, columns ...string) IModeDraftDo {
+	return m.withDO(m.DO.Returning(value, columns...))
+}
+
+func (m modeDraftDo) Not(conds ...gen.Condition) IModeDraftDo {
+	return m.withDO(m.DO.Not(conds...))
+}
+
+func (m modeDraftDo) Or(conds ...gen.Condition) IModeDraftDo {
+	return m.withDO(m.DO.Or(conds...))
+}
+
+func (m modeDraftDo) Select(conds ...field.Expr) IModeDraftDo {
+	return m.withDO(m.DO.Select(conds...))
+}
+
+func (m modeDraftDo) Where(conds ...gen.Condition) IModeDraftDo {
+	return m.withDO(m.DO.Where(conds...))
+}
+
+func (m modeDraftDo) Order(conds ...field.Expr) IModeDraftDo {
+	return m.withDO(m.DO.Order(conds...))
+}
+
+func (m modeDraftDo) Distinct(cols ...field.Expr) IModeDraftDo {
+	return m.withDO(m.DO.Distinct(cols...))
+}
+
+func (m modeDraftDo) Omit(cols ...field.Expr) IModeDraftDo {
+	return m.withDO(m.DO.Omit(cols...))
+}
+
+func (m modeDraftDo) Join(table schema.Tabler, on ...field.Expr) IModeDraftDo {
+	return m.withDO(m.DO.Join(table, on...))
+}
+
+func (m modeDraftDo) LeftJoin(table schema.Tabler, on ...field.Expr) IModeDraftDo {
+	return m.withDO(m.DO.LeftJoin(table, on...))
+}
+
+func (m modeDraftDo) RightJoin(table schema.Tabler, on ...field.Expr) IModeDraftDo {
+	return m.withDO(m.DO.RightJoin(table, on...))
+}
+
+func (m modeDraftDo) Group(cols ...field.Expr) IModeDraftDo {
+	return m.withDO(m.DO.Group(cols...))
+}
+
+func (m modeDraftDo) Having(conds ...gen.Condition) IModeDraftDo {
+	return m.withDO(m.DO.Having(conds...))
+}
+
+func (m modeDraftDo) Limit(limit int) IModeDraftDo {
+	return m.withDO(m.DO.Limit(limit))
+}
+
+func (m modeDraftDo) Offset(offset int) IModeDraftDo {
+	return m.withDO(m.DO.Offset(offset))
+}
+
+func (m modeDraftDo) Scopes(funcs ...func(gen.Dao) gen.Dao) IModeDraftDo {
+	return m.withDO(m.DO.Scopes(funcs...))
+}
+
+func (m modeDraftDo) Unscoped() IModeDraftDo {
+	return m.withDO(m.DO.Unscoped())
+}
+
+func (m modeDraftDo) Create(values ...*entities.ModeDraft) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return m.DO.Create(values)
+}
+
+func (m modeDraftDo) CreateInBatches(values []*entities.ModeDraft, batchSize int) error {
+	return m.DO.CreateInBatches(values, batchSize)
+}
+
+// Save : !!! underlying implementation is different with GORM
+// The method is equivalent to executing the statement: db.Clauses(clause.OnConflict{UpdateAll: true}).Create(values)
+func (m modeDraftDo) Save(values ...*entities.ModeDraft) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return m.DO.Save(values)
+}
+
+func (m modeDraftDo) First() (*entities.ModeDraft, error) {
+	if result, err := m.DO.First(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ModeDraft), nil
+	}
+}
+
+func (m modeDraftDo) Take() (*entities.ModeDraft, error) {
+	if result, err := m.DO.Take(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ModeDraft), nil
+	}
+}
+
+func (m modeDraftDo) Last() (*entities.ModeDraft, error) {
+	if result, err := m.DO.Last(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ModeDraft), nil
+	}
+}
+
+func (m modeDraftDo) Find() ([]*entities.ModeDraft, error) {
+	result, err := m.DO.Find()
+	return result.([]*entities.ModeDraft), err
+}
+
+func (m modeDraftDo) FindInBatch(batchSize int, fc func(tx gen.Dao, batch int) error) (results []*entities.ModeDraft, err error) {
+	buf := make([]*entities.ModeDraft, 0, batchSize)
+	err = m.DO.FindInBatches(&buf, batchSize, func(tx gen.Dao, batch int) error {
+		defer func() { results = append(results, buf...) }()
+		return fc(tx, batch)
+	})
+	return results, err
+}
+
+func (m modeDraftDo) FindInBatches(result *[]*entities.ModeDraft, batchSize int, fc func(tx gen.Dao, batch int) error) error {
+	return m.DO.FindInBatches(result, batchSize, fc)
+}
+
+func (m modeDraftDo) Attrs(attrs ...field.AssignExpr) IModeDraftDo {
+	return m.withDO(m.DO.Attrs(attrs...))
+}
+
+func (m modeDraftDo) Assign(attrs ...field.AssignExpr) IModeDraftDo {
+	return m.withDO(m.DO.Assign(attrs...))
+}
+
+func (m modeDraftDo) Joins(fields ...field.RelationField) IModeDraftDo {
+	for _, _f := range fields {
+		m = *m.withDO(m.DO.Joins(_f))
+	}
+	return &m
+}
+
+func (m modeDraftDo) Preload(fields ...field.RelationField) IModeDraftDo {
+	for _, _f := range fields {
+		m = *m.withDO(m.DO.Preload(_f))
+	}
+	return &m
+}
+
+func (m modeDraftDo) FirstOrInit() (*entities.ModeDraft, error) {
+	if result, err := m.DO.FirstOrInit(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ModeDraft), nil
+	}
+}
+
+func (m modeDraftDo) FirstOrCreate() (*entities.ModeDraft, error) {
+	if result, err := m.DO.FirstOrCreate(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ModeDraft), nil
+	}
+}
+
+func (m modeDraftDo) FindByPage(offset int, limit int) (result []*entities.ModeDraft, count int64, err error) {
+	result, err = m.Offset(offset).Limit(limit).Find()
+	if err != nil {
+		return
+	}
+
+	if size := len(result); 0 < limit && 0 < size && size < limit {
+		count = int64(size + offset)
+		return
+	}
+
+	count, err = m.Offset(-1).Limit(-1).Count()
+	return
+}
+
+func (m modeDraftDo) ScanByPage(result interface{}, offset int, limit int) (count int64, err error) {
+	count, err = m.Count()
+	if err != nil {
+		return
+	}
+
+	err = m.Offset(offset).Limit(limit).Scan(result)
+	return
+}
+
+func (m modeDraftDo) Scan(result interface{}) (err error) {
+	return m.DO.Scan(result)
+}
+
+func (m modeDraftDo) Delete(models ...*entities.ModeDraft) (result gen.ResultInfo, err error) {
+	return m.DO.Delete(models)
+}
+
+func (m *modeDraftDo) withDO(do gen.Dao) *modeDraftDo {
+	m.DO = *do.(*gen.DO)
+	return m
+}
@@ -0,0 +1,664 @@
+// Code generated by gorm.io/gen. DO NOT EDIT.
+// Code generated by gorm.io/gen. DO NOT EDIT.
+// Code generated by gorm.io/gen. DO NOT EDIT.
+
+package query
+
+import (
+	"context"
+	"database/sql"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"gorm.io/gen"
+	"gorm.io/gen/field"
+
+	"gorm.io/plugin/dbresolver"
+
+	"ximanager/sources/persistence/entities"
+)
+
+func newModelPreference(db *gorm.DB, opts ...gen.DOOption) modelPreference {
+	_modelPreference := modelPreference{}
+
+	_modelPreference.modelPreferenceDo.UseDB(db, opts...)
+	_modelPreference.modelPreferenceDo.UseModel(&entities.ModelPreference{})
+
+	tableName := _modelPreference.modelPreferenceDo.TableName()
+	_modelPreference.ALL = field.NewAsterisk(tableName)
+	_modelPreference.ID = field.NewField(tableName, "id")
+	_modelPreference.UserID = field.NewField(tableName, "user_id")
+	_modelPreference.ChatID = field.NewInt64(tableName, "chat_id")
+	_modelPreference.Model = field.NewString(tableName, "model")
+	_modelPreference.UpdatedAt = field.NewTime(tableName, "updated_at")
+	_modelPreference.User = modelPreferenceHasOneUser{
+		db: db.Session(&gorm.Session{}),
+
+		RelationField: field.NewRelation("User", "entities.User"),
+		Messages: struct {
+			field.RelationField
+			User struct {
+				field.RelationField
+			}
+		}{
+			RelationField: field.NewRelation("User.Messages", "entities.Message"),
+			User: struct {
+				field.RelationField
+			}{
+				RelationField: field.NewRelation("User.Messages.User", "entities.User"),
+			},
+		},
+		Donations: struct {
+			field.RelationField
+			UserEntity struct {
+				field.RelationField
+			}
+		}{
+			RelationField: field.NewRelation("User.Donations", "entities.Donation"),
+			UserEntity: struct {
+				field.RelationField
+			}{
+				RelationField: field.NewRelation("User.Donations.UserEntity", "entities.User"),
+			},
+		},
+		CreatedModes: struct {
+			field.RelationField
+			Creator struct {
+				field.RelationField
+			}
+			SelectedModes struct {
+				field.RelationField
+				Mode struct {
+					field.RelationField
+				}
+				User struct {
+					field.RelationField
+				}
+			}
+		}{
+			RelationField: field.NewRelation("User.CreatedModes", "entities.Mode"),
+			Creator: struct {
+				field.RelationField
+			}{
+				RelationField: field.NewRelation("User.CreatedModes.Creator", "entities.User"),
+			},
+			SelectedModes: struct {
+				field.RelationField
+				Mode struct {
+					field.RelationField
+				}
+				User struct {
+					field.RelationField
+				}
+			}{
+				RelationField: field.NewRelation("User.CreatedModes.SelectedModes", "entities.SelectedMode"),
+				Mode: struct {
+					field.RelationField
+				}{
+					RelationField: field.NewRelation("User.CreatedModes.SelectedModes.Mode", "entities.Mode"),
+				},
+				User: struct {
+					field.RelationField
+				}{
+					RelationField: field.NewRelation("User.CreatedModes.SelectedModes.User", "entities.User"),
+				},
+			},
+		},
+		SelectedModes: struct {
+			field.RelationField
+		}{
+			RelationField: field.NewRelation("User.SelectedModes", "entities.SelectedMode"),
+		},
+		Personalizations: struct {
+			field.RelationField
+			User struct {
+				field.RelationField
+			}
+		}{
+			RelationField: field.NewRelation("User.Personalizations", "entities.Personalization"),
+			User: struct {
+				field.RelationField
+			}{
+				RelationField: field.NewRelation("User.Personalizations.User", "entities.User"),
+			},
+		},
+		Usages: struct {
+			field.RelationField
+			User struct {
+				field.RelationField
+			}
+		}{
+			RelationField: field.NewRelation("User.Usages", "entities.Usage"),
+			User: struct {
+				field.RelationField
+			}{
+				RelationField: field.NewRelation("User.Usages.User", "entities.User"),
+			},
+		},
+		Bans: struct {
+			field.RelationField
+			User struct {
+				field.RelationField
+			}
+		}{
+			RelationField: field.NewRelation("User.Bans", "entities.Ban"),
+			User: struct {
+				field.RelationField
+			}{
+				RelationField: field.NewRelation("User.Bans.User", "entities.User"),
+			},
+		},
+	}
+
+	_modelPreference.fillFieldMap()
+
+	return _modelPreference
+}
+
+type modelPreference struct {
+	modelPreferenceDo modelPreferenceDo
+
+	ALL       field.Asterisk
+	ID        field.Field
+	UserID    field.Field
+	ChatID    field.Int64
+	Model     field.String
+	UpdatedAt field.Time
+	User      modelPreferenceHasOneUser
+
+	fieldMap map[string]field.Expr
+}
+
+func (m modelPreference) Table(newTableName string) *modelPreference {
+	m.modelPreferenceDo.UseTable(newTableName)
+	return m.updateTableName(newTableName)
+}
+
+func (m modelPreference) As(alias string) *modelPreference {
+	m.modelPreferenceDo.DO = *(m.modelPreferenceDo.As(alias).(*gen.DO))
+	return m.updateTableName(alias)
+}
+
+func (m *modelPreference) updateTableName(table string) *modelPreference {
+	m.ALL = field.NewAsterisk(table)
+	m.ID = field.NewField(table, "id")
+	m.UserID = field.NewField(table, "user_id")
+	m.ChatID = field.NewInt64(table, "chat_id")
+	m.Model = field.NewString(table, "model")
+	m.UpdatedAt = field.NewTime(table, "updated_at")
+
+	m.fillFieldMap()
+
+	return m
+}
+
+func (m *modelPreference) WithContext(ctx context.Context) IModelPreferenceDo {
+	return m.modelPreferenceDo.WithContext(ctx)
+}
+
+func (m modelPreference) TableName() string { return m.modelPreferenceDo.TableName() }
+
+func (m modelPreference) Alias() string { return m.modelPreferenceDo.Alias() }
+
+func (m modelPreference) Columns(cols ...field.Expr) gen.Columns {
+	return m.modelPreferenceDo.Columns(cols...)
+}
+
+func (m *modelPreference) GetFieldByName(fieldName string) (field.OrderExpr, bool) {
+	_f, ok := m.fieldMap[fieldName]
+	if !ok || _f == nil {
+		return nil, false
+	}
+	_oe, ok := _f.(field.OrderExpr)
+	return _oe, ok
+}
+
+func (m *modelPreference) fillFieldMap() {
+	m.fieldMap = make(map[string]field.Expr, 6)
+	m.fieldMap["id"] = m.ID
+	m.fieldMap["user_id"] = m.UserID
+	m.fieldMap["chat_id"] = m.ChatID
+	m.fieldMap["model"] = m.Model
+	m.fieldMap["updated_at"] = m.UpdatedAt
+
+}
+
+func (m modelPreference) clone(db *gorm.DB) modelPreference {
+	m.modelPreferenceDo.ReplaceConnPool(db.Statement.ConnPool)
+	m.User.db = db.Session(&gorm.Session{Initialized: true})
+	m.User.db.Statement.ConnPool = db.Statement.ConnPool
+	return m
+}
+
+func (m modelPreference) replaceDB(db *gorm.DB) modelPreference {
+	m.modelPreferenceDo.ReplaceDB(db)
+	m.User.db = db.Session(&gorm.Session{})
+	return m
+}
+
+type modelPreferenceHasOneUser struct {
+	db *gorm.DB
+
+	field.RelationField
+
+	Messages struct {
+		field.RelationField
+		User struct {
+			field.RelationField
+		}
+	}
+	Donations struct {
+		field.RelationField
+		UserEntity struct {
+			field.RelationField
+		}
+	}
+	CreatedModes struct {
+		field.RelationField
+		Creator struct {
+			field.RelationField
+		}
+		SelectedModes struct {
+			field.RelationField
+			Mode struct {
+				field.RelationField
+			}
+			User struct {
+				field.RelationField
+			}
+		}
+	}
+	SelectedModes struct {
+		field.RelationField
+	}
+	Personalizations struct {
+		field.RelationField
+		User struct {
+			field.RelationField
+		}
+	}
+	Usages struct {
+		field.RelationField
+		User struct {
+			field.RelationField
+		}
+	}
+	Bans struct {
+		field.RelationField
+		User struct {
+			field.RelationField
+		}
+	}
+}
+
+func (a modelPreferenceHasOneUser) Where(conds ...field.Expr) *modelPreferenceHasOneUser {
+	if len(conds) == 0 {
+		return &a
+	}
+
+	exprs := make([]clause.Expression, 0, len(conds))
+	for _, cond := range conds {
+		exprs = append(exprs, cond.BeCond().(clause.Expression))
+	}
+	a.db = a.db.Clauses(clause.Where{Exprs: exprs})
+	return &a
+}
+
+func (a modelPreferenceHasOneUser) WithContext(ctx context.Context) *modelPreferenceHasOneUser {
+	a.db = a.db.WithContext(ctx)
+	return &a
+}
+
+func (a modelPreferenceHasOneUser) Session(session *gorm.Session) *modelPreferenceHasOneUser {
+	a.db = a.db.Session(session)
+	return &a
+}
+
+func (a modelPreferenceHasOneUser) Model(m *entities.ModelPreference) *modelPreferenceHasOneUserTx {
+	return &modelPreferenceHasOneUserTx{a.db.Model(m).Association(a.Name())}
+}
+
+func (a modelPreferenceHasOneUser) Unscoped() *modelPreferenceHasOneUser {
+	a.db = a.db.Unscoped()
+	return &a
+}
+
+type modelPreferenceHasOneUserTx struct{ tx *gorm.Association }
+
+func (a modelPreferenceHasOneUserTx) Find() (result *entities.User, err error) {
+	return result, a.tx.Find(&result)
+}
+
+func (a modelPreferenceHasOneUserTx) Append(values ...*entities.User) (err error) {
+	targetValues := make([]interface{}, len(values))
+	for i, v := range values {
+		targetValues[i] = v
+	}
+	return a.tx.Append(targetValues...)
+}
+
+func (a modelPreferenceHasOneUserTx) Replace(values ...*entities.User) (err error) {
+	targetValues := make([]interface{}, len(values))
+	for i, v := range values {
+		targetValues[i] = v
+	}
+	return a.tx.Replace(targetValues...)
+}
+
+func (a modelPreferenceHasOneUserTx) Delete(values ...*entities.User) (err error) {
+	targetValues := make([]interface{}, len(values))
+	for i, v := range values {
+		targetValues[i] = v
+	}
+	return a.tx.Delete(targetValues...)
+}
+
+func (a modelPreferenceHasOneUserTx) Clear() error {
+	return a.tx.Clear()
+}
+
+func (a modelPreferenceHasOneUserTx) Count() int64 {
+	return a.tx.Count()
+}
+
+func (a modelPreferenceHasOneUserTx) Unscoped() *modelPreferenceHasOneUserTx {
+	a.tx = a.tx.Unscoped()
+	return &a
+}
+
+type modelPreferenceDo struct{ gen.DO }
+
+type IModelPreferenceDo interface {
+	gen.SubQuery
+	Debug() IModelPreferenceDo
+	WithContext(ctx context.Context) IModelPreferenceDo
+	WithResult(fc func(tx gen.Dao)) gen.ResultInfo
+	ReplaceDB(db *gorm.DB)
+	ReadDB() IModelPreferenceDo
+	WriteDB() IModelPreferenceDo
+	As(alias string) gen.Dao
+	Session(config *gorm.Session) IModelPreferenceDo
+	Columns(cols ...field.Expr) gen.Columns
+	Clauses(conds ...clause.Expression) IModelPreferenceDo
+	Not(conds ...gen.Condition) IModelPreferenceDo
+	Or(conds ...gen.Condition) IModelPreferenceDo
+	Select(conds ...field.Expr) IModelPreferenceDo
+	Where(conds ...gen.Condition) IModelPreferenceDo
+	Order(conds ...field.Expr) IModelPreferenceDo
+	Distinct(cols ...field.Expr) IModelPreferenceDo
+	Omit(cols ...field.Expr) IModelPreferenceDo
+	Join(table schema.Tabler, on ...field.Expr) IModelPreferenceDo
+	LeftJoin(table schema.Tabler, on ...field.Expr) IModelPreferenceDo
+	RightJoin(table schema.Tabler, on ...field.Expr) IModelPreferenceDo
+	Group(cols ...field.Expr) IModelPreferenceDo
+	Having(conds ...gen.Condition) IModelPreferenceDo
+	Limit(limit int) IModelPreferenceDo
+	Offset(offset int) IModelPreferenceDo
+	Count() (count int64, err error)
+	Scopes(funcs ...func(gen.Dao) gen.Dao) IModelPreferenceDo
+	Unscoped() IModelPreferenceDo
+	Create(values ...*entities.ModelPreference) error
+	CreateInBatches(values []*entities.ModelPreference, batchSize int) error
+	Save(values ...*entities.ModelPreference) error
+	First() (*entities.ModelPreference, error)
+	Take() (*entities.ModelPreference, error)
+	Last() (*entities.ModelPreference, error)
+	Find() ([]*entities.ModelPreference, error)
+	FindInBatch(batchSize int, fc func(tx gen.Dao, batch int) error) (results []*entities.ModelPreference, err error)
+	FindInBatches(result *[]*entities.ModelPreference, batchSize int, fc func(tx gen.Dao, batch int) error) error
+	Pluck(column field.Expr, dest interface{}) error
+	Delete(...*entities.ModelPreference) (info gen.ResultInfo, err error)
+	Update(column field.Expr, value interface{}) (info gen.ResultInfo, err error)
+	UpdateSimple(columns ...field.AssignExpr) (info gen.ResultInfo, err error)
+	Updates(value interface{}) (info gen.ResultInfo, err error)
+	UpdateColumn(column field.Expr, value interface{}) (info gen.ResultInfo, err error)
+	UpdateColumnSimple(columns ...field.AssignExpr) (info gen.ResultInfo, err error)
+	UpdateColumns(value interface{}) (info gen.ResultInfo, err error)
+	UpdateFrom(q gen.SubQuery) gen.Dao
+	Attrs(attrs ...field.AssignExpr) IModelPreferenceDo
+	Assign(attrs ...field.AssignExpr) IModelPreferenceDo
+	Joins(fields ...field.RelationField) IModelPreferenceDo
+	Preload(fields ...field.RelationField) IModelPreferenceDo
+	FirstOrInit() (*entities.ModelPreference, error)
+	FirstOrCreate() (*entities.ModelPreference, error)
+	FindByPage(offset int, limit int) (result []*entities.ModelPreference, count int64, err error)
+	ScanByPage(result interface{}, offset int, limit int) (count int64, err error)
+	Rows() (*sql.Rows, error)
+	Row() *sql.Row
+	Scan(result interface{}) (err error)
+	Returning(value interface{}, columns ...string) IModelPreferenceDo
+	UnderlyingDB() *gorm.DB
+	schema.Tabler
+}
+
+func (m modelPreferenceDo) Debug() IModelPreferenceDo {
+	return m.withDO(m.DO.Debug())
+}
+
+func (m modelPreferenceDo) WithContext(ctx context.Context) IModelPreferenceDo {
+	return m.withDO(m.DO.WithContext(ctx))
+}
+
+func (m modelPreferenceDo) ReadDB() IModelPreferenceDo {
+	return m.Clauses(dbresolver.Read)
+}
+
+func (m modelPreferenceDo) WriteDB() IModelPreferenceDo {
+	return m.Clauses(dbresolver.Write)
+}
+
+func (m modelPreferenceDo) Session(config *gorm.Session) IModelPreferenceDo {
+	return m.withDO(m.DO.Session(config))
+}
+
+func (m modelPreferenceDo) Clauses(conds ...clause.Expression) IModelPreferenceDo {
+	return m.withDO(m.DO.Clauses(conds...))
+}
+
+func (m modelPreferenceDo) Returning(value interface{}, columns ...string) IModelPreferenceDo {
+	return m.withDO(m.DO.Returning(value, columns...))
+}
+
+func (m modelPreferenceDo) Not(conds ...gen.Condition) IModelPreferenceDo {
+	return m.withDO(m.DO.Not(conds...))
+}
+
+func (m modelPreferenceDo) Or(conds ...gen.Condition) IModelPreferenceDo {
+	return m.withDO(m.DO.Or(conds...))
+}
+
+func (m modelPreferenceDo) Select(conds ...field.Expr) IModelPreferenceDo {
+	return m.withDO(m.DO.Select(conds...))
+}
+
+func (m modelPreferenceDo) Where(conds ...gen.Condition) IModelPreferenceDo {
+	return m.withDO(m.DO.Where(conds...))
+}
+
+func (m modelPreferenceDo) Order(conds ...field.Expr) IModelPreferenceDo {
+	return m.withDO(m.DO.Order(conds...))
+}
+
+func (m modelPreferenceDo) Distinct(cols ...field.Expr) IModelPreferenceDo {
+	return m.withDO(m.DO.Distinct(cols...))
+}
+
+func (m modelPreferenceDo) Omit(cols ...field.Expr) IModelPreferenceDo {
+	return m.withDO(m.DO.Omit(cols...))
+}
+
+func (m modelPreferenceDo) Join(table schema.Tabler, on ...field.Expr) IModelPreferenceDo {
+	return m.withDO(m.DO.Join(table, on...))
+}
+
+func (m modelPreferenceDo) LeftJoin(table schema.Tabler, on ...field.Expr) IModelPreferenceDo {
+	return m.withDO(m.DO.LeftJoin(table, on...))
+}
+
+func (m modelPreferenceDo) RightJoin(table schema.Tabler, on ...field.Expr) IModelPreferenceDo {
+	return m.withDO(m.DO.RightJoin(table, on...))
+}
+
+func (m modelPreferenceDo) Group(cols ...field.Expr) IModelPreferenceDo {
+	return m.withDO(m.DO.Group(cols...))
+}
+
+func (m modelPreferenceDo) Having(conds ...gen.Condition) IModelPreferenceDo {
+	return m.withDO(m.DO.Having(conds...))
+}
+
+func (m modelPreferenceDo) Limit(limit int) IModelPreferenceDo {
+	return m.withDO(m.DO.Limit(limit))
+}
+
+func (m modelPreferenceDo) Offset(offset int) IModelPreferenceDo {
+	return m.withDO(m.DO.Offset(offset))
+}
+
+func (m modelPreferenceDo) Scopes(funcs ...func(gen.Dao) gen.Dao) IModelPreferenceDo {
+	return m.withDO(m.DO.Scopes(funcs...))
+}
+
+func (m modelPreferenceDo) Unscoped() IModelPreferenceDo {
+	return m.withDO(m.DO.Unscoped())
+}
+
+func (m modelPreferenceDo) Create(values ...*entities.ModelPreference) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return m.DO.Create(values)
+}
+
+func (m modelPreferenceDo) CreateInBatches(values []*entities.ModelPreference, batchSize int) error {
+	return m.DO.CreateInBatches(values, batchSize)
+}
+
+// Save : !!! underlying implementation is different with GORM
+// The method is equivalent to executing the statement: db.Clauses(clause.OnConflict{UpdateAll: true}).Create(values)
+func (m modelPreferenceDo) Save(values ...*entities.ModelPreference) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return m.DO.Save(values)
+}
+
+func (m modelPreferenceDo) First() (*entities.ModelPreference, error) {
+	if result, err := m.DO.First(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ModelPreference), nil
+	}
+}
+
+func (m modelPreferenceDo) Take() (*entities.ModelPreference, error) {
+	if result, err := m.DO.Take(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ModelPreference), nil
+	}
+}
+
+func (m modelPreferenceDo) Last() (*entities.ModelPreference, error) {
+	if result, err := m.DO.Last(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ModelPreference), nil
+	}
+}
+
+func (m modelPreferenceDo) Find() ([]*entities.ModelPreference, error) {
+	result, err := m.DO.Find()
+	return result.([]*entities.ModelPreference), err
+}
+
+func (m modelPreferenceDo) FindInBatch(batchSize int, fc func(tx gen.Dao, batch int) error) (results []*entities.ModelPreference, err error) {
+	buf := make([]*entities.ModelPreference, 0, batchSize)
+	err = m.DO.FindInBatches(&buf, batchSize, func(tx gen.Dao, batch int) error {
+		defer func() { results = append(results, buf...) }()
+		return fc(tx, batch)
+	})
+	return results, err
+}
+
+func (m modelPreferenceDo) FindInBatches(result *[]*entities.ModelPreference, batchSize int, fc func(tx gen.Dao, batch int) error) error {
+	return m.DO.FindInBatches(result, batchSize, fc)
+}
+
+func (m modelPreferenceDo) Attrs(attrs ...field.AssignExpr) IModelPreferenceDo {
+	return m.withDO(m.DO.Attrs(attrs...))
+}
+
+func (m modelPreferenceDo) Assign(attrs ...field.AssignExpr) IModelPreferenceDo {
+	return m.withDO(m.DO.Assign(attrs...))
+}
+
+func (m modelPreferenceDo) Joins(fields ...field.RelationField) IModelPreferenceDo {
+	for _, _f := range fields {
+		m = *m.withDO(m.DO.Joins(_f))
+	}
+	return &m
+}
+
+func (m modelPreferenceDo) Preload(fields ...field.RelationField) IModelPreferenceDo {
+	for _, _f := range fields {
+		m = *m.withDO(m.DO.Preload(_f))
+	}
+	return &m
+}
+
+func (m modelPreferenceDo) FirstOrInit() (*entities.ModelPreference, error) {
+	if result, err := m.DO.FirstOrInit(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ModelPreference), nil
+	}
+}
+
+func (m modelPreferenceDo) FirstOrCreate() (*entities.ModelPreference, error) {
+	if result, err := m.DO.FirstOrCreate(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.ModelPreference), nil
+	}
+}
+
+func (m modelPreferenceDo) FindByPage(offset int, limit int) (result []*entities.ModelPreference, count int64, err error) {
+	result, err = m.Offset(offset).Limit(limit).Find()
+	if err != nil {
+		return
+	}
+
+	if size := len(result); 0 < limit && 0 < size && size < limit {
+		count = int64(size + offset)
+		return
+	}
+
+	count, err = m.Offset(-1).Limit(-1).Count()
+	return
+}
+
+func (m modelPreferenceDo) ScanByPage(result interface{}, offset int, limit int) (count int64, err error) {
+	count, err = m.Count()
+	if err != nil {
+		return
+	}
+
+	err = m.Offset(offset).Limit(limit).Scan(result)
+	return
+}
+
+func (m modelPreferenceDo) Scan(result interface{}) (err error) {
+	return m.DO.Scan(result)
+}
+
+func (m modelPreferenceDo) Delete(models ...*entities.ModelPreference) (result gen.ResultInfo, err error) {
+	return m.DO.Delete(models)
+}
+
+func (m *modelPreferenceDo) withDO(do gen.Dao) *modelPreferenceDo {
+	m.DO = *do.(*gen.DO)
+	return m
+}
@@ -0,0 +1,439 @@
+// Code generated by gorm.io/gen. DO NOT EDIT.
+// Code generated by gorm.io/gen. DO NOT EDIT.
+// Code generated by gorm.io/gen. DO NOT EDIT.
+
+package query
+
+import (
+	"context"
+	"database/sql"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+
+	"gorm.io/gen"
+	"gorm.io/gen/field"
+
+	"gorm.io/plugin/dbresolver"
+
+	"ximanager/sources/persistence/entities"
+)
+
+func newCatalogModel(db *gorm.DB, opts ...gen.DOOption) catalogModel {
+	_catalogModel := catalogModel{}
+
+	_catalogModel.catalogModelDo.UseDB(db, opts...)
+	_catalogModel.catalogModelDo.UseModel(&entities.CatalogModel{})
+
+	tableName := _catalogModel.catalogModelDo.TableName()
+	_catalogModel.ALL = field.NewAsterisk(tableName)
+	_catalogModel.ID = field.NewString(tableName, "id")
+	_catalogModel.Name = field.NewString(tableName, "name")
+	_catalogModel.ContextLength = field.NewInt64(tableName, "context_length")
+	_catalogModel.MaxCompletionTokens = field.NewInt64(tableName, "max_completion_tokens")
+	_catalogModel.InputPrice = field.NewField(tableName, "input_price")
+	_catalogModel.OutputPrice = field.NewField(tableName, "output_price")
+	_catalogModel.CacheReadPrice = field.NewField(tableName, "cache_read_price")
+	_catalogModel.CacheWritePrice = field.NewField(tableName, "cache_write_price")
+	_catalogModel.SupportsImages = field.NewBool(tableName, "supports_images")
+	_catalogModel.SupportsTools = field.NewBool(tableName, "supports_tools")
+	_catalogModel.SupportsReasoning = field.NewBool(tableName, "supports_reasoning")
+	_catalogModel.SyncedAt = field.NewTime(tableName, "synced_at")
+
+	_catalogModel.fillFieldMap()
+
+	return _catalogModel
+}
+
+type catalogModel struct {
+	catalogModelDo catalogModelDo
+
+	ALL                 field.Asterisk
+	ID                  field.String
+	Name                field.String
+	ContextLength       field.Int64
+	MaxCompletionTokens field.Int64
+	InputPrice          field.Field
+	OutputPrice         field.Field
+	CacheReadPrice      field.Field
+	CacheWritePrice     field.Field
+	SupportsImages      field.Bool
+	SupportsTools       field.Bool
+	SupportsReasoning   field.Bool
+	SyncedAt            field.Time
+
+	fieldMap map[string]field.Expr
+}
+
+func (c catalogModel) Table(newTableName string) *catalogModel {
+	c.catalogModelDo.UseTable(newTableName)
+	return c.updateTableName(newTableName)
+}
+
+func (c catalogModel) As(alias string) *catalogModel {
+	c.catalogModelDo.DO = *(c.catalogModelDo.As(alias).(*gen.DO))
+	return c.updateTableName(alias)
+}
+
+func (c *catalogModel) updateTableName(table string) *catalogModel {
+	c.ALL = field.NewAsterisk(table)
+	c.ID = field.NewString(table, "id")
+	c.Name = field.NewString(table, "name")
+	c.ContextLength = field.NewInt64(table, "context_length")
+	c.MaxCompletionTokens = field.NewInt64(table, "max_completion_tokens")
+	c.InputPrice = field.NewField(table, "input_price")
+	c.OutputPrice = field.NewField(table, "output_price")
+	c.CacheReadPrice = field.NewField(table, "cache_read_price")
+	c.CacheWritePrice = field.NewField(table, "cache_write_price")
+	c.SupportsImages = field.NewBool(table, "supports_images")
+	c.SupportsTools = field.NewBool(table, "supports_tools")
+	c.SupportsReasoning = field.NewBool(table, "supports_reasoning")
+	c.SyncedAt = field.NewTime(table, "synced_at")
+
+	c.fillFieldMap()
+
+	return c
+}
+
+func (c *catalogModel) WithContext(ctx context.Context) ICatalogModelDo {
+	return c.catalogModelDo.WithContext(ctx)
+}
+
+func (c catalogModel) TableName() string { return c.catalogModelDo.TableName() }
+
+func (c catalogModel) Alias() string { return c.catalogModelDo.Alias() }
+
+func (c catalogModel) Columns(cols ...field.Expr) gen.Columns {
+	return c.catalogModelDo.Columns(cols...)
+}
+
+func (c *catalogModel) GetFieldByName(fieldName string) (field.OrderExpr, bool) {
+	_f, ok := c.fieldMap[fieldName]
+	if !ok || _f == nil {
+		return nil, false
+	}
+	_oe, ok := _f.(field.OrderExpr)
+	return _oe, ok
+}
+
+func (c *catalogModel) fillFieldMap() {
+	c.fieldMap = make(map[string]field.Expr, 12)
+	c.fieldMap["id"] = c.ID
+	c.fieldMap["name"] = c.Name
+	c.fieldMap["context_length"] = c.ContextLength
+	c.fieldMap["max_completion_tokens"] = c.MaxCompletionTokens
+	c.fieldMap["input_price"] = c.InputPrice
+	c.fieldMap["output_price"] = c.OutputPrice
+	c.fieldMap["cache_read_price"] = c.CacheReadPrice
+	c.fieldMap["cache_write_price"] = c.CacheWritePrice
+	c.fieldMap["supports_images"] = c.SupportsImages
+	c.fieldMap["supports_tools"] = c.SupportsTools
+	c.fieldMap["supports_reasoning"] = c.SupportsReasoning
+	c.fieldMap["synced_at"] = c.SyncedAt
+}
+
+func (c catalogModel) clone(db *gorm.DB) catalogModel {
+	c.catalogModelDo.ReplaceConnPool(db.Statement.ConnPool)
+	return c
+}
+
+func (c catalogModel) replaceDB(db *gorm.DB) catalogModel {
+	c.catalogModelDo.ReplaceDB(db)
+	return c
+}
+
+type catalogModelDo struct{ gen.DO }
+
+type ICatalogModelDo interface {
+	gen.SubQuery
+	Debug() ICatalogModelDo
+	WithContext(ctx context.Context) ICatalogModelDo
+	WithResult(fc func(tx gen.Dao)) gen.ResultInfo
+	ReplaceDB(db *gorm.DB)
+	ReadDB() ICatalogModelDo
+	WriteDB() ICatalogModelDo
+	As(alias string) gen.Dao
+	Session(config *gorm.Session) ICatalogModelDo
+	Columns(cols ...field.Expr) gen.Columns
+	Clauses(conds ...clause.Expression) ICatalogModelDo
+	Not(conds ...gen.Condition) ICatalogModelDo
+	Or(conds ...gen.Condition) ICatalogModelDo
+	Select(conds ...field.Expr) ICatalogModelDo
+	Where(conds ...gen.Condition) ICatalogModelDo
+	Order(conds ...field.Expr) ICatalogModelDo
+	Distinct(cols ...field.Expr) ICatalogModelDo
+	Omit(cols ...field.Expr) ICatalogModelDo
+	Join(table schema.Tabler, on ...field.Expr) ICatalogModelDo
+	LeftJoin(table schema.Tabler, on ...field.Expr) ICatalogModelDo
+	RightJoin(table schema.Tabler, on ...field.Expr) ICatalogModelDo
+	Group(cols ...field.Expr) ICatalogModelDo
+	Having(conds ...gen.Condition) ICatalogModelDo
+	Limit(limit int) ICatalogModelDo
+	Offset(offset int) ICatalogModelDo
+	Count() (count int64, err error)
+	Scopes(funcs ...func(gen.Dao) gen.Dao) ICatalogModelDo
+	Unscoped() ICatalogModelDo
+	Create(values ...*entities.CatalogModel) error
+	CreateInBatches(values []*entities.CatalogModel, batchSize int) error
+	Save(values ...*entities.CatalogModel) error
+	First() (*entities.CatalogModel, error)
+	Take() (*entities.CatalogModel, error)
+	Last() (*entities.CatalogModel, error)
+	Find() ([]*entities.CatalogModel, error)
+	FindInBatch(batchSize int, fc func(tx gen.Dao, batch int) error) (results []*entities.CatalogModel, err error)
+	FindInBatches(result *[]*entities.CatalogModel, batchSize int, fc func(tx gen.Dao, batch int) error) error
+	Pluck(column field.Expr, dest interface{}) error
+	Delete(...*entities.CatalogModel) (info gen.ResultInfo, err error)
+	Update(column field.Expr, value interface{}) (info gen.ResultInfo, err error)
+	UpdateSimple(columns ...field.AssignExpr) (info gen.ResultInfo, err error)
+	Updates(value interface{}) (info gen.ResultInfo, err error)
+	UpdateColumn(column field.Expr, value interface{}) (info gen.ResultInfo, err error)
+	UpdateColumnSimple(columns ...field.AssignExpr) (info gen.ResultInfo, err error)
+	UpdateColumns(value interface{}) (info gen.ResultInfo, err error)
+	UpdateFrom(q gen.SubQuery) gen.Dao
+	Attrs(attrs ...field.AssignExpr) ICatalogModelDo
+	Assign(attrs ...field.AssignExpr) ICatalogModelDo
+	Joins(fields ...field.RelationField) ICatalogModelDo
+	Preload(fields ...field.RelationField) ICatalogModelDo
+	FirstOrInit() (*entities.CatalogModel, error)
+	FirstOrCreate() (*entities.CatalogModel, error)
+	FindByPage(offset int, limit int) (result []*entities.CatalogModel, count int64, err error)
+	ScanByPage(result interface{}, offset int, limit int) (count int64, err error)
+	Rows() (*sql.Rows, error)
+	Row() *sql.Row
+	Scan(result interface{}) (err error)
+	Returning(value interface{}, columns ...string) ICatalogModelDo
+	UnderlyingDB() *gorm.DB
+	schema.Tabler
+}
+
+func (c catalogModelDo) Debug() ICatalogModelDo {
+	return c.withDO(c.DO.Debug())
+}
+
+func (c catalogModelDo) WithContext(ctx context.Context) ICatalogModelDo {
+	return c.withDO(c.DO.WithContext(ctx))
+}
+
+func (c catalogModelDo) ReadDB() ICatalogModelDo {
+	return c.Clauses(dbresolver.Read)
+}
+
+func (c catalogModelDo) WriteDB() ICatalogModelDo {
+	return c.Clauses(dbresolver.Write)
+}
+
+func (c catalogModelDo) Session(config *gorm.Session) ICatalogModelDo {
+	return c.withDO(c.DO.Session(config))
+}
+
+func (c catalogModelDo) Clauses(conds ...clause.Expression) ICatalogModelDo {
+	return c.withDO(c.DO.Clauses(conds...))
+}
+
+func (c catalogModelDo) Returning(value interface{}, columns ...string) ICatalogModelDo {
+	return c.withDO(c.DO.Returning(value, columns...))
+}
+
+func (c catalogModelDo) Not(conds ...gen.Condition) ICatalogModelDo {
+	return c.withDO(c.DO.Not(conds...))
+}
+
+func (c catalogModelDo) Or(conds ...gen.Condition) ICatalogModelDo {
+	return c.withDO(c.DO.Or(conds...))
+}
+
+func (c catalogModelDo) Select(conds ...field.Expr) ICatalogModelDo {
+	return c.withDO(c.DO.Select(conds...))
+}
+
+func (c catalogModelDo) Where(conds ...gen.Condition) ICatalogModelDo {
+	return c.withDO(c.DO.Where(conds...))
+}
+
+func (c catalogModelDo) Order(conds ...field.Expr) ICatalogModelDo {
+	return c.withDO(c.DO.Order(conds...))
+}
+
+func (c catalogModelDo) Distinct(cols ...field.Expr) ICatalogModelDo {
+	return c.withDO(c.DO.Distinct(cols...))
+}
+
+func (c catalogModelDo) Omit(cols ...field.Expr) ICatalogModelDo {
+	return c.withDO(c.DO.Omit(cols...))
+}
+
+func (c catalogModelDo) Join(table schema.Tabler, on ...field.Expr) ICatalogModelDo {
+	return c.withDO(c.DO.Join(table, on...))
+}
+
+func (c catalogModelDo) LeftJoin(table schema.Tabler, on ...field.Expr) ICatalogModelDo {
+	return c.withDO(c.DO.LeftJoin(table, on...))
+}
+
+func (c catalogModelDo) RightJoin(table schema.Tabler, on ...field.Expr) ICatalogModelDo {
+	return c.withDO(c.DO.RightJoin(table, on...))
+}
+
+func (c catalogModelDo) Group(cols ...field.Expr) ICatalogModelDo {
+	return c.withDO(c.DO.Group(cols...))
+}
+
+func (c catalogModelDo) Having(conds ...gen.Condition) ICatalogModelDo {
+	return c.withDO(c.DO.Having(conds...))
+}
+
+func (c catalogModelDo) Limit(limit int) ICatalogModelDo {
+	return c.withDO(c.DO.Limit(limit))
+}
+
+func (c catalogModelDo) Offset(offset int) ICatalogModelDo {
+	return c.withDO(c.DO.Offset(offset))
+}
+
+func (c catalogModelDo) Scopes(funcs ...func(gen.Dao) gen.Dao) ICatalogModelDo {
+	return c.withDO(c.DO.Scopes(funcs...))
+}
+
+func (c catalogModelDo) Unscoped() ICatalogModelDo {
+	return c.withDO(c.DO.Unscoped())
+}
+
+func (c catalogModelDo) Create(values ...*entities.CatalogModel) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return c.DO.Create(values)
+}
+
+func (c catalogModelDo) CreateInBatches(values []*entities.CatalogModel, batchSize int) error {
+	return c.DO.CreateInBatches(values, batchSize)
+}
+
+// Save : !!! underlying implementation is different with GORM
+// The method is equivalent to executing the statement: db.Clauses(clause.OnConflict{UpdateAll: true}).Create(values)
+func (c catalogModelDo) Save(values ...*entities.CatalogModel) error {
+	if len(values) == 0 {
+		return nil
+	}
+	return c.DO.Save(values)
+}
+
+func (c catalogModelDo) First() (*entities.CatalogModel, error) {
+	if result, err := c.DO.First(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.CatalogModel), nil
+	}
+}
+
+func (c catalogModelDo) Take() (*entities.CatalogModel, error) {
+	if result, err := c.DO.Take(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.CatalogModel), nil
+	}
+}
+
+func (c catalogModelDo) Last() (*entities.CatalogModel, error) {
+	if result, err := c.DO.Last(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.CatalogModel), nil
+	}
+}
+
+func (c catalogModelDo) Find() ([]*entities.CatalogModel, error) {
+	result, err := c.DO.Find()
+	return result.([]*entities.CatalogModel), err
+}
+
+func (c catalogModelDo) FindInBatch(batchSize int, fc func(tx gen.Dao, batch int) error) (results []*entities.CatalogModel, err error) {
+	buf := make([]*entities.CatalogModel, 0, batchSize)
+	err = c.DO.FindInBatches(&buf, batchSize, func(tx gen.Dao, batch int) error {
+		defer func() { results = append(results, buf...) }()
+		return fc(tx, batch)
+	})
+	return results, err
+}
+
+func (c catalogModelDo) FindInBatches(result *[]*entities.CatalogModel, batchSize int, fc func(tx gen.Dao, batch int) error) error {
+	return c.DO.FindInBatches(result, batchSize, fc)
+}
+
+func (c catalogModelDo) Attrs(attrs ...field.AssignExpr) ICatalogModelDo {
+	return c.withDO(c.DO.Attrs(attrs...))
+}
+
+func (c catalogModelDo) Assign(attrs ...field.AssignExpr) ICatalogModelDo {
+	return c.withDO(c.DO.Assign(attrs...))
+}
+
+func (c catalogModelDo) Joins(fields ...field.RelationField) ICatalogModelDo {
+	for _, _f := range fields {
+		c = *c.withDO(c.DO.Joins(_f))
+	}
+	return &c
+}
+
+func (c catalogModelDo) Preload(fields ...field.RelationField) ICatalogModelDo {
+	for _, _f := range fields {
+		c = *c.withDO(c.DO.Preload(_f))
+	}
+	return &c
+}
+
+func (c catalogModelDo) FirstOrInit() (*entities.CatalogModel, error) {
+	if result, err := c.DO.FirstOrInit(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.CatalogModel), nil
+	}
+}
+
+func (c catalogModelDo) FirstOrCreate() (*entities.CatalogModel, error) {
+	if result, err := c.DO.FirstOrCreate(); err != nil {
+		return nil, err
+	} else {
+		return result.(*entities.CatalogModel), nil
+	}
+}
+
+func (c catalogModelDo) FindByPage(offset int, limit int) (result []*entities.CatalogModel, count int64, err error) {
+	result, err = c.Offset(offset).Limit(limit).Find()
+	if err != nil {
+		return
+	}
+
+	if size := len(result); 0 < limit && 0 < size && size < limit {
+		count = int64(size + offset)
+		return
+	}
+
+	count, err = c.Offset(-1).Limit(-1).Count()
+	return
+}
+
+func (c catalogModelDo) ScanByPage(result interface{}, offset int, limit int) (count int64, err error) {
+	count, err = c.Count()
+	if err != nil {
+		return
+	}
+
+	err = c.Offset(offset).Limit(limit).Scan(result)
+	return
+}
+
+func (c catalogModelDo) Scan(result interface{}) (err error) {
+	return c.DO.Scan(result)
+}
+
+func (c catalogModelDo) Delete(models ...*entities.CatalogModel) (result gen.ResultInfo, err error) {
+	return c.DO.Delete(models)
+}
+
+func (c *catalogModelDo) withDO(do gen.Dao) *catalogModelDo {
+	c.DO = *do.(*gen.DO)
+	return c
+}
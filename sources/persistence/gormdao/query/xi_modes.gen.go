@@ -35,6 +35,7 @@ func newMode(db *gorm.DB, opts ...gen.DOOption) mode {
 	_mode.Grade = field.NewString(tableName, "grade")
 	_mode.Final = field.NewBool(tableName, "final")
 	_mode.IsEnabled = field.NewBool(tableName, "is_enabled")
+	_mode.Version = field.NewInt(tableName, "version")
 	_mode.CreatedAt = field.NewTime(tableName, "created_at")
 	_mode.CreatedBy = field.NewField(tableName, "created_by")
 	_mode.SelectedModes = modeHasManySelectedModes{
@@ -238,6 +239,7 @@ type mode struct {
 	Grade         field.String
 	Final         field.Bool
 	IsEnabled     field.Bool
+	Version       field.Int
 	CreatedAt     field.Time
 	CreatedBy     field.Field
 	SelectedModes modeHasManySelectedModes
@@ -266,6 +268,7 @@ func (m *mode) updateTableName(table string) *mode {
 	m.Grade = field.NewString(table, "grade")
 	m.Final = field.NewBool(table, "final")
 	m.IsEnabled = field.NewBool(table, "is_enabled")
+	m.Version = field.NewInt(table, "version")
 	m.CreatedAt = field.NewTime(table, "created_at")
 	m.CreatedBy = field.NewField(table, "created_by")
 
@@ -292,7 +295,7 @@ func (m *mode) GetFieldByName(fieldName string) (field.OrderExpr, bool) {
 }
 
 func (m *mode) fillFieldMap() {
-	m.fieldMap = make(map[string]field.Expr, 11)
+	m.fieldMap = make(map[string]field.Expr, 12)
 	m.fieldMap["id"] = m.ID
 	m.fieldMap["type"] = m.Type
 	m.fieldMap["name"] = m.Name
@@ -300,6 +303,7 @@ func (m *mode) fillFieldMap() {
 	m.fieldMap["grade"] = m.Grade
 	m.fieldMap["final"] = m.Final
 	m.fieldMap["is_enabled"] = m.IsEnabled
+	m.fieldMap["version"] = m.Version
 	m.fieldMap["created_at"] = m.CreatedAt
 	m.fieldMap["created_by"] = m.CreatedBy
 
@@ -30,6 +30,7 @@ func newSelectedMode(db *gorm.DB, opts ...gen.DOOption) selectedMode {
 	_selectedMode.ALL = field.NewAsterisk(tableName)
 	_selectedMode.ID = field.NewField(tableName, "id")
 	_selectedMode.ChatID = field.NewInt64(tableName, "chat_id")
+	_selectedMode.ThreadID = field.NewInt(tableName, "thread_id")
 	_selectedMode.ModeID = field.NewField(tableName, "mode_id")
 	_selectedMode.SwitchedAt = field.NewTime(tableName, "switched_at")
 	_selectedMode.SwitchedBy = field.NewField(tableName, "switched_by")
@@ -199,6 +200,7 @@ type selectedMode struct {
 	ALL        field.Asterisk
 	ID         field.Field
 	ChatID     field.Int64
+	ThreadID   field.Int
 	ModeID     field.Field
 	SwitchedAt field.Time
 	SwitchedBy field.Field
@@ -223,6 +225,7 @@ func (s *selectedMode) updateTableName(table string) *selectedMode {
 	s.ALL = field.NewAsterisk(table)
 	s.ID = field.NewField(table, "id")
 	s.ChatID = field.NewInt64(table, "chat_id")
+	s.ThreadID = field.NewInt(table, "thread_id")
 	s.ModeID = field.NewField(table, "mode_id")
 	s.SwitchedAt = field.NewTime(table, "switched_at")
 	s.SwitchedBy = field.NewField(table, "switched_by")
@@ -254,9 +257,10 @@ func (s *selectedMode) GetFieldByName(fieldName string) (field.OrderExpr, bool)
 }
 
 func (s *selectedMode) fillFieldMap() {
-	s.fieldMap = make(map[string]field.Expr, 7)
+	s.fieldMap = make(map[string]field.Expr, 8)
 	s.fieldMap["id"] = s.ID
 	s.fieldMap["chat_id"] = s.ChatID
+	s.fieldMap["thread_id"] = s.ThreadID
 	s.fieldMap["mode_id"] = s.ModeID
 	s.fieldMap["switched_at"] = s.SwitchedAt
 	s.fieldMap["switched_by"] = s.SwitchedBy
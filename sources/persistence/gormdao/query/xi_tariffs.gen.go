@@ -32,19 +32,14 @@ func newTariff(db *gorm.DB, opts ...gen.DOOption) tariff {
 	_tariff.Key = field.NewString(tableName, "key")
 	_tariff.DisplayName = field.NewString(tableName, "display_name")
 	_tariff.CreatedAt = field.NewTime(tableName, "created_at")
-	_tariff.DialerModels = field.NewBytes(tableName, "dialer_models")
-	_tariff.DialerReasoningEffort = field.NewString(tableName, "dialer_reasoning_effort")
-	_tariff.ContextTTLSeconds = field.NewInt(tableName, "context_ttl_seconds")
-	_tariff.ContextMaxMessages = field.NewInt(tableName, "context_max_messages")
-	_tariff.ContextMaxTokens = field.NewInt(tableName, "context_max_tokens")
-	_tariff.UsageVisionDaily = field.NewInt(tableName, "usage_vision_daily")
-	_tariff.UsageVisionMonthly = field.NewInt(tableName, "usage_vision_monthly")
-	_tariff.UsageDialerDaily = field.NewInt(tableName, "usage_dialer_daily")
-	_tariff.UsageDialerMonthly = field.NewInt(tableName, "usage_dialer_monthly")
-	_tariff.UsageWhisperDaily = field.NewInt(tableName, "usage_whisper_daily")
-	_tariff.UsageWhisperMonthly = field.NewInt(tableName, "usage_whisper_monthly")
+	_tariff.RequestsPerDay = field.NewInt(tableName, "requests_per_day")
+	_tariff.RequestsPerMonth = field.NewInt(tableName, "requests_per_month")
+	_tariff.TokensPerDay = field.NewInt64(tableName, "tokens_per_day")
+	_tariff.TokensPerMonth = field.NewInt64(tableName, "tokens_per_month")
 	_tariff.SpendingDailyLimit = field.NewField(tableName, "spending_daily_limit")
 	_tariff.SpendingMonthlyLimit = field.NewField(tableName, "spending_monthly_limit")
+	_tariff.Price = field.NewInt(tableName, "price")
+	_tariff.ChatInstructionsMaxLength = field.NewInt(tableName, "chat_instructions_max_length")
 
 	_tariff.fillFieldMap()
 
@@ -54,24 +49,19 @@ func newTariff(db *gorm.DB, opts ...gen.DOOption) tariff {
 type tariff struct {
 	tariffDo tariffDo
 
-	ALL                   field.Asterisk
-	ID                    field.Int64
-	Key                   field.String
-	DisplayName           field.String
-	CreatedAt             field.Time
-	DialerModels          field.Bytes
-	DialerReasoningEffort field.String
-	ContextTTLSeconds     field.Int
-	ContextMaxMessages    field.Int
-	ContextMaxTokens      field.Int
-	UsageVisionDaily      field.Int
-	UsageVisionMonthly    field.Int
-	UsageDialerDaily      field.Int
-	UsageDialerMonthly    field.Int
-	UsageWhisperDaily     field.Int
-	UsageWhisperMonthly   field.Int
-	SpendingDailyLimit    field.Field
-	SpendingMonthlyLimit  field.Field
+	ALL                       field.Asterisk
+	ID                        field.Int64
+	Key                       field.String
+	DisplayName               field.String
+	CreatedAt                 field.Time
+	RequestsPerDay            field.Int
+	RequestsPerMonth          field.Int
+	TokensPerDay              field.Int64
+	TokensPerMonth            field.Int64
+	SpendingDailyLimit        field.Field
+	SpendingMonthlyLimit      field.Field
+	Price                     field.Int
+	ChatInstructionsMaxLength field.Int
 
 	fieldMap map[string]field.Expr
 }
@@ -92,19 +82,14 @@ func (t *tariff) updateTableName(table string) *tariff {
 	t.Key = field.NewString(table, "key")
 	t.DisplayName = field.NewString(table, "display_name")
 	t.CreatedAt = field.NewTime(table, "created_at")
-	t.DialerModels = field.NewBytes(table, "dialer_models")
-	t.DialerReasoningEffort = field.NewString(table, "dialer_reasoning_effort")
-	t.ContextTTLSeconds = field.NewInt(table, "context_ttl_seconds")
-	t.ContextMaxMessages = field.NewInt(table, "context_max_messages")
-	t.ContextMaxTokens = field.NewInt(table, "context_max_tokens")
-	t.UsageVisionDaily = field.NewInt(table, "usage_vision_daily")
-	t.UsageVisionMonthly = field.NewInt(table, "usage_vision_monthly")
-	t.UsageDialerDaily = field.NewInt(table, "usage_dialer_daily")
-	t.UsageDialerMonthly = field.NewInt(table, "usage_dialer_monthly")
-	t.UsageWhisperDaily = field.NewInt(table, "usage_whisper_daily")
-	t.UsageWhisperMonthly = field.NewInt(table, "usage_whisper_monthly")
+	t.RequestsPerDay = field.NewInt(table, "requests_per_day")
+	t.RequestsPerMonth = field.NewInt(table, "requests_per_month")
+	t.TokensPerDay = field.NewInt64(table, "tokens_per_day")
+	t.TokensPerMonth = field.NewInt64(table, "tokens_per_month")
 	t.SpendingDailyLimit = field.NewField(table, "spending_daily_limit")
 	t.SpendingMonthlyLimit = field.NewField(table, "spending_monthly_limit")
+	t.Price = field.NewInt(table, "price")
+	t.ChatInstructionsMaxLength = field.NewInt(table, "chat_instructions_max_length")
 
 	t.fillFieldMap()
 
@@ -129,24 +114,19 @@ func (t *tariff) GetFieldByName(fieldName string) (field.OrderExpr, bool) {
 }
 
 func (t *tariff) fillFieldMap() {
-	t.fieldMap = make(map[string]field.Expr, 17)
+	t.fieldMap = make(map[string]field.Expr, 12)
 	t.fieldMap["id"] = t.ID
 	t.fieldMap["key"] = t.Key
 	t.fieldMap["display_name"] = t.DisplayName
 	t.fieldMap["created_at"] = t.CreatedAt
-	t.fieldMap["dialer_models"] = t.DialerModels
-	t.fieldMap["dialer_reasoning_effort"] = t.DialerReasoningEffort
-	t.fieldMap["context_ttl_seconds"] = t.ContextTTLSeconds
-	t.fieldMap["context_max_messages"] = t.ContextMaxMessages
-	t.fieldMap["context_max_tokens"] = t.ContextMaxTokens
-	t.fieldMap["usage_vision_daily"] = t.UsageVisionDaily
-	t.fieldMap["usage_vision_monthly"] = t.UsageVisionMonthly
-	t.fieldMap["usage_dialer_daily"] = t.UsageDialerDaily
-	t.fieldMap["usage_dialer_monthly"] = t.UsageDialerMonthly
-	t.fieldMap["usage_whisper_daily"] = t.UsageWhisperDaily
-	t.fieldMap["usage_whisper_monthly"] = t.UsageWhisperMonthly
+	t.fieldMap["requests_per_day"] = t.RequestsPerDay
+	t.fieldMap["requests_per_month"] = t.RequestsPerMonth
+	t.fieldMap["tokens_per_day"] = t.TokensPerDay
+	t.fieldMap["tokens_per_month"] = t.TokensPerMonth
 	t.fieldMap["spending_daily_limit"] = t.SpendingDailyLimit
 	t.fieldMap["spending_monthly_limit"] = t.SpendingMonthlyLimit
+	t.fieldMap["price"] = t.Price
+	t.fieldMap["chat_instructions_max_length"] = t.ChatInstructionsMaxLength
 }
 
 func (t tariff) clone(db *gorm.DB) tariff {
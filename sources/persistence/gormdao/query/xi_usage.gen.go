@@ -32,9 +32,20 @@ func newUsage(db *gorm.DB, opts ...gen.DOOption) usage {
 	_usage.UserID = field.NewField(tableName, "user_id")
 	_usage.Cost = field.NewField(tableName, "cost")
 	_usage.Tokens = field.NewInt(tableName, "tokens")
+	_usage.CacheReadTokens = field.NewInt(tableName, "cache_read_tokens")
+	_usage.CacheWriteTokens = field.NewInt(tableName, "cache_write_tokens")
 	_usage.AnotherCost = field.NewField(tableName, "another_cost")
 	_usage.AnotherTokens = field.NewInt(tableName, "another_tokens")
 	_usage.ChatID = field.NewInt64(tableName, "chat_id")
+	_usage.IsIncognito = field.NewBool(tableName, "is_incognito")
+	_usage.Source = field.NewString(tableName, "source")
+	_usage.Model = field.NewString(tableName, "model")
+	_usage.ModeType = field.NewString(tableName, "mode_type")
+	_usage.ModeVersion = field.NewInt(tableName, "mode_version")
+	_usage.ResponseMessageID = field.NewInt(tableName, "response_message_id")
+	_usage.ExperimentID = field.NewField(tableName, "experiment_id")
+	_usage.Variant = field.NewString(tableName, "variant")
+	_usage.LatencyMs = field.NewInt64(tableName, "latency_ms")
 	_usage.CreatedAt = field.NewTime(tableName, "created_at")
 	_usage.User = usageHasOneUser{
 		db: db.Session(&gorm.Session{}),
@@ -163,16 +174,27 @@ func newUsage(db *gorm.DB, opts ...gen.DOOption) usage {
 type usage struct {
 	usageDo usageDo
 
-	ALL           field.Asterisk
-	ID            field.Field
-	UserID        field.Field
-	Cost          field.Field
-	Tokens        field.Int
-	AnotherCost   field.Field
-	AnotherTokens field.Int
-	ChatID        field.Int64
-	CreatedAt     field.Time
-	User          usageHasOneUser
+	ALL               field.Asterisk
+	ID                field.Field
+	UserID            field.Field
+	Cost              field.Field
+	Tokens            field.Int
+	CacheReadTokens   field.Int
+	CacheWriteTokens  field.Int
+	AnotherCost       field.Field
+	AnotherTokens     field.Int
+	ChatID            field.Int64
+	IsIncognito       field.Bool
+	Source            field.String
+	Model             field.String
+	ModeType          field.String
+	ModeVersion       field.Int
+	ResponseMessageID field.Int
+	ExperimentID      field.Field
+	Variant           field.String
+	LatencyMs         field.Int64
+	CreatedAt         field.Time
+	User              usageHasOneUser
 
 	fieldMap map[string]field.Expr
 }
@@ -193,9 +215,20 @@ func (u *usage) updateTableName(table string) *usage {
 	u.UserID = field.NewField(table, "user_id")
 	u.Cost = field.NewField(table, "cost")
 	u.Tokens = field.NewInt(table, "tokens")
+	u.CacheReadTokens = field.NewInt(table, "cache_read_tokens")
+	u.CacheWriteTokens = field.NewInt(table, "cache_write_tokens")
 	u.AnotherCost = field.NewField(table, "another_cost")
 	u.AnotherTokens = field.NewInt(table, "another_tokens")
 	u.ChatID = field.NewInt64(table, "chat_id")
+	u.IsIncognito = field.NewBool(table, "is_incognito")
+	u.Source = field.NewString(table, "source")
+	u.Model = field.NewString(table, "model")
+	u.ModeType = field.NewString(table, "mode_type")
+	u.ModeVersion = field.NewInt(table, "mode_version")
+	u.ResponseMessageID = field.NewInt(table, "response_message_id")
+	u.ExperimentID = field.NewField(table, "experiment_id")
+	u.Variant = field.NewString(table, "variant")
+	u.LatencyMs = field.NewInt64(table, "latency_ms")
 	u.CreatedAt = field.NewTime(table, "created_at")
 
 	u.fillFieldMap()
@@ -221,14 +254,25 @@ func (u *usage) GetFieldByName(fieldName string) (field.OrderExpr, bool) {
 }
 
 func (u *usage) fillFieldMap() {
-	u.fieldMap = make(map[string]field.Expr, 9)
+	u.fieldMap = make(map[string]field.Expr, 20)
 	u.fieldMap["id"] = u.ID
 	u.fieldMap["user_id"] = u.UserID
 	u.fieldMap["cost"] = u.Cost
 	u.fieldMap["tokens"] = u.Tokens
+	u.fieldMap["cache_read_tokens"] = u.CacheReadTokens
+	u.fieldMap["cache_write_tokens"] = u.CacheWriteTokens
 	u.fieldMap["another_cost"] = u.AnotherCost
 	u.fieldMap["another_tokens"] = u.AnotherTokens
 	u.fieldMap["chat_id"] = u.ChatID
+	u.fieldMap["is_incognito"] = u.IsIncognito
+	u.fieldMap["source"] = u.Source
+	u.fieldMap["model"] = u.Model
+	u.fieldMap["mode_type"] = u.ModeType
+	u.fieldMap["mode_version"] = u.ModeVersion
+	u.fieldMap["response_message_id"] = u.ResponseMessageID
+	u.fieldMap["experiment_id"] = u.ExperimentID
+	u.fieldMap["variant"] = u.Variant
+	u.fieldMap["latency_ms"] = u.LatencyMs
 	u.fieldMap["created_at"] = u.CreatedAt
 
 }
@@ -34,11 +34,9 @@ func newUser(db *gorm.DB, opts ...gen.DOOption) user {
 	_user.Fullname = field.NewString(tableName, "fullname")
 	_user.Rights = field.NewField(tableName, "rights")
 	_user.IsActive = field.NewBool(tableName, "is_active")
-	_user.IsStackAllowed = field.NewBool(tableName, "is_stack_allowed")
-	_user.IsStackEnabled = field.NewBool(tableName, "is_stack_enabled")
 	_user.IsBanless = field.NewBool(tableName, "is_banless")
 	_user.IsUnsubscribed = field.NewBool(tableName, "is_unsubscribed")
-	_user.WindowLimit = field.NewInt64(tableName, "window_limit")
+	_user.IsIncognito = field.NewBool(tableName, "is_incognito")
 	_user.CreatedAt = field.NewTime(tableName, "created_at")
 	_user.Messages = userHasManyMessages{
 		db: db.Session(&gorm.Session{}),
@@ -252,11 +250,9 @@ type user struct {
 	Fullname       field.String
 	Rights         field.Field
 	IsActive       field.Bool
-	IsStackAllowed field.Bool
-	IsStackEnabled field.Bool
 	IsBanless      field.Bool
 	IsUnsubscribed field.Bool
-	WindowLimit    field.Int64
+	IsIncognito    field.Bool
 	CreatedAt      field.Time
 	Messages       userHasManyMessages
 
@@ -293,11 +289,9 @@ func (u *user) updateTableName(table string) *user {
 	u.Fullname = field.NewString(table, "fullname")
 	u.Rights = field.NewField(table, "rights")
 	u.IsActive = field.NewBool(table, "is_active")
-	u.IsStackAllowed = field.NewBool(table, "is_stack_allowed")
-	u.IsStackEnabled = field.NewBool(table, "is_stack_enabled")
 	u.IsBanless = field.NewBool(table, "is_banless")
 	u.IsUnsubscribed = field.NewBool(table, "is_unsubscribed")
-	u.WindowLimit = field.NewInt64(table, "window_limit")
+	u.IsIncognito = field.NewBool(table, "is_incognito")
 	u.CreatedAt = field.NewTime(table, "created_at")
 
 	u.fillFieldMap()
@@ -323,18 +317,16 @@ func (u *user) GetFieldByName(fieldName string) (field.OrderExpr, bool) {
 }
 
 func (u *user) fillFieldMap() {
-	u.fieldMap = make(map[string]field.Expr, 19)
+	u.fieldMap = make(map[string]field.Expr, 17)
 	u.fieldMap["id"] = u.ID
 	u.fieldMap["user_id"] = u.UserID
 	u.fieldMap["username"] = u.Username
 	u.fieldMap["fullname"] = u.Fullname
 	u.fieldMap["rights"] = u.Rights
 	u.fieldMap["is_active"] = u.IsActive
-	u.fieldMap["is_stack_allowed"] = u.IsStackAllowed
-	u.fieldMap["is_stack_enabled"] = u.IsStackEnabled
 	u.fieldMap["is_banless"] = u.IsBanless
 	u.fieldMap["is_unsubscribed"] = u.IsUnsubscribed
-	u.fieldMap["window_limit"] = u.WindowLimit
+	u.fieldMap["is_incognito"] = u.IsIncognito
 	u.fieldMap["created_at"] = u.CreatedAt
 
 }
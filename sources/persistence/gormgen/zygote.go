@@ -13,6 +13,6 @@ func main() {
 		Mode:         gen.WithDefaultQuery | gen.WithQueryInterface,
 	})
 
-	g.ApplyBasic(entities.User{}, entities.Ban{}, entities.Donation{}, entities.Message{}, entities.Mode{}, entities.SelectedMode{}, entities.Personalization{}, entities.Usage{}, entities.Tariff{}, entities.Broadcast{}, entities.Feedback{})
+	g.ApplyBasic(entities.User{}, entities.Ban{}, entities.Donation{}, entities.Message{}, entities.Mode{}, entities.SelectedMode{}, entities.Personalization{}, entities.Usage{}, entities.Tariff{}, entities.Broadcast{}, entities.Feedback{}, entities.ModelPreference{}, entities.CatalogModel{}, entities.ChatVariable{}, entities.Experiment{}, entities.ModeDraft{}, entities.ChatInstruction{}, entities.ChatSetting{})
 	g.Execute()
 }
\ No newline at end of file
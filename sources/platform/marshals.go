@@ -1,6 +1,8 @@
 package platform
 
 import (
+	"fmt"
+	"log/slog"
 	"strconv"
 	"strings"
 )
@@ -16,4 +18,15 @@ func (c *ChatID) UnmarshalText(text []byte) error {
 	}
 	*c = ChatID(val)
 	return nil
-}
\ No newline at end of file
+}
+// String keeps keys of the whole chat as they were before topics, a topic is appended after a slash
+func (c ChatTopic) String() string {
+	if c.ThreadID == 0 {
+		return strconv.FormatInt(int64(c.ChatID), 10)
+	}
+	return fmt.Sprintf("%d/%d", c.ChatID, c.ThreadID)
+}
+
+func (c ChatTopic) LogValue() slog.Value {
+	return slog.StringValue(c.String())
+}
@@ -9,4 +9,11 @@ func BoolValue(b *bool, defaultValue bool) bool {
 		return defaultValue
 	}
 	return *b
-}
\ No newline at end of file
+}
+
+func StringValue(s *string, defaultValue string) string {
+	if s == nil {
+		return defaultValue
+	}
+	return *s
+}
@@ -2,6 +2,12 @@ package platform
 
 type ChatID int64
 
+// ChatTopic is the scope of chat data that can be kept per forum topic, zero ThreadID stands for the whole chat
+type ChatTopic struct {
+	ChatID   ChatID
+	ThreadID int
+}
+
 type UserGrade = string
 
 const (
@@ -23,4 +29,6 @@ type RedisMessage struct {
 	Role         MessageRole `json:"role"`
 	Content      string      `json:"content"`
 	IsCompressed bool        `json:"is_compressed,omitempty"`
+	MessageID    int         `json:"message_id,omitempty"` // Telegram message the user entry came from
+	ReplyTo      int         `json:"reply_to,omitempty"`   // Telegram message the assistant entry answers
 }
\ No newline at end of file
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"ximanager/sources/persistence/entities"
+	"ximanager/sources/persistence/gormdao/query"
+	"ximanager/sources/platform"
+	"ximanager/sources/tracing"
+
+	"gorm.io/gorm"
+)
+
+var ErrChatInstructionsNotFound = errors.New("chat instructions not found")
+
+type ChatInstructionsRepository struct{}
+
+func NewChatInstructionsRepository() *ChatInstructionsRepository {
+	return &ChatInstructionsRepository{}
+}
+
+// GetInstructions returns the instructions of the chat with the user who set them last
+func (x *ChatInstructionsRepository) GetInstructions(logger *tracing.Logger, chatID int64) (*entities.ChatInstruction, error) {
+	defer tracing.ProfilePoint(logger, "Chat instructions get completed", "repository.chat_instructions.get", "chat_id", chatID)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	ci := query.Q.ChatInstruction
+	instructions, err := ci.WithContext(ctx).Preload(ci.Updater).Where(ci.ChatID.Eq(chatID)).First()
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrChatInstructionsNotFound
+		}
+		logger.E("Failed to get chat instructions", tracing.InnerError, err)
+		return nil, err
+	}
+
+	return instructions, nil
+}
+
+func (x *ChatInstructionsRepository) SetInstructions(logger *tracing.Logger, chatID int64, text string, editor *entities.User) error {
+	defer tracing.ProfilePoint(logger, "Chat instructions set completed", "repository.chat_instructions.set", "chat_id", chatID)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	ci := query.Q.ChatInstruction
+	instructions, err := ci.WithContext(ctx).Where(ci.ChatID.Eq(chatID)).First()
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.E("Failed to check existing chat instructions", tracing.InnerError, err)
+		return err
+	}
+
+	if instructions == nil {
+		instructions = &entities.ChatInstruction{ChatID: chatID}
+	}
+	instructions.Text = text
+	instructions.UpdatedBy = &editor.ID
+	instructions.UpdatedAt = time.Now()
+
+	if err := ci.WithContext(ctx).Save(instructions); err != nil {
+		logger.E("Failed to save chat instructions", tracing.InnerError, err)
+		return err
+	}
+
+	logger.I("Saved chat instructions", "chat_id", chatID, "length", len([]rune(text)))
+	return nil
+}
+
+func (x *ChatInstructionsRepository) DeleteInstructions(logger *tracing.Logger, chatID int64) error {
+	defer tracing.ProfilePoint(logger, "Chat instructions delete completed", "repository.chat_instructions.delete", "chat_id", chatID)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	ci := query.Q.ChatInstruction
+	result, err := ci.WithContext(ctx).Where(ci.ChatID.Eq(chatID)).Delete()
+	if err != nil {
+		logger.E("Failed to delete chat instructions", tracing.InnerError, err)
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrChatInstructionsNotFound
+	}
+
+	logger.I("Deleted chat instructions", "chat_id", chatID)
+	return nil
+}
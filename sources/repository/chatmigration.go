@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"ximanager/sources/persistence/gormdao/query"
+	"ximanager/sources/platform"
+	"ximanager/sources/tracing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// chatKeyPrefixes are Redis keys starting with a chat ID, followed by nothing, ":" or "/" (a forum topic)
+var chatKeyPrefixes = []string{
+	"chat_history",
+	"chat_history_refs",
+	"chat_context_branch",
+	"chat_context_branches",
+	"chat_context_enabled",
+	"chat_context_topics",
+	"chat_answer",
+	"chat_state",
+	"chat_topic",
+	"dial_trace_last",
+}
+
+// ChatMigrationRepository moves everything stored for a chat to its new ID when a group is upgraded to a supergroup
+type ChatMigrationRepository struct {
+	redis *redis.Client
+}
+
+func NewChatMigrationRepository(redis *redis.Client) *ChatMigrationRepository {
+	return &ChatMigrationRepository{redis: redis}
+}
+
+// MigrateChat moves Redis keys in one MULTI block and then database rows in one transaction. Chat state already
+// created for the new ID (settings, selected modes, context keys) is dropped, the supergroup inherits the group.
+// Keys go first, a second run finds nothing left to rename, so a failed migration can simply be repeated.
+func (x *ChatMigrationRepository) MigrateChat(logger *tracing.Logger, fromChatID int64, toChatID int64) error {
+	defer tracing.ProfilePoint(logger, "Chat migration completed", "repository.chat_migration.migrate", "from_chat_id", fromChatID, "to_chat_id", toChatID)()
+
+	if err := x.migrateKeys(logger, fromChatID, toChatID); err != nil {
+		return err
+	}
+
+	return x.migrateRows(logger, fromChatID, toChatID)
+}
+
+func (x *ChatMigrationRepository) migrateRows(logger *tracing.Logger, fromChatID int64, toChatID int64) error {
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 60*time.Second)
+	defer cancel()
+
+	moved := map[string]int64{}
+	err := query.Q.Transaction(func(tx *query.Query) error {
+		ci := tx.ChatInstruction
+		if _, err := ci.WithContext(ctx).Where(ci.ChatID.Eq(toChatID)).Delete(); err != nil {
+			return err
+		}
+		cs := tx.ChatSetting
+		if _, err := cs.WithContext(ctx).Where(cs.ChatID.Eq(toChatID)).Delete(); err != nil {
+			return err
+		}
+		cv := tx.ChatVariable
+		if _, err := cv.WithContext(ctx).Where(cv.ChatID.Eq(toChatID)).Delete(); err != nil {
+			return err
+		}
+		mp := tx.ModelPreference
+		if _, err := mp.WithContext(ctx).Where(mp.ChatID.Eq(toChatID)).Delete(); err != nil {
+			return err
+		}
+		// the latest selected mode wins, one picked in the supergroup before the migration would shadow the group one
+		sm := tx.SelectedMode
+		if _, err := sm.WithContext(ctx).Where(sm.ChatID.Eq(toChatID)).Delete(); err != nil {
+			return err
+		}
+
+		result, err := sm.WithContext(ctx).Where(sm.ChatID.Eq(fromChatID)).Update(sm.ChatID, toChatID)
+		if err != nil {
+			return err
+		}
+		moved["selected_modes"] = result.RowsAffected
+
+		m := tx.Message
+		if result, err = m.WithContext(ctx).Where(m.ChatID.Eq(fromChatID)).Update(m.ChatID, toChatID); err != nil {
+			return err
+		}
+		moved["messages"] = result.RowsAffected
+
+		u := tx.Usage
+		if result, err = u.WithContext(ctx).Where(u.ChatID.Eq(fromChatID)).Update(u.ChatID, toChatID); err != nil {
+			return err
+		}
+		moved["usage"] = result.RowsAffected
+
+		f := tx.Feedback
+		if result, err = f.WithContext(ctx).Where(f.ChatID.Eq(fromChatID)).Update(f.ChatID, toChatID); err != nil {
+			return err
+		}
+		moved["feedbacks"] = result.RowsAffected
+
+		if result, err = ci.WithContext(ctx).Where(ci.ChatID.Eq(fromChatID)).Update(ci.ChatID, toChatID); err != nil {
+			return err
+		}
+		moved["chat_instructions"] = result.RowsAffected
+
+		if result, err = cs.WithContext(ctx).Where(cs.ChatID.Eq(fromChatID)).Update(cs.ChatID, toChatID); err != nil {
+			return err
+		}
+		moved["chat_settings"] = result.RowsAffected
+
+		if result, err = cv.WithContext(ctx).Where(cv.ChatID.Eq(fromChatID)).Update(cv.ChatID, toChatID); err != nil {
+			return err
+		}
+		moved["chat_variables"] = result.RowsAffected
+
+		if result, err = mp.WithContext(ctx).Where(mp.ChatID.Eq(fromChatID)).Update(mp.ChatID, toChatID); err != nil {
+			return err
+		}
+		moved["model_preferences"] = result.RowsAffected
+
+		return nil
+	})
+
+	if err != nil {
+		logger.E("Failed to migrate chat rows", "from_chat_id", fromChatID, "to_chat_id", toChatID, tracing.InnerError, err)
+		return err
+	}
+
+	logger.I("Chat rows migrated", "from_chat_id", fromChatID, "to_chat_id", toChatID, "moved", moved)
+	return nil
+}
+
+func (x *ChatMigrationRepository) migrateKeys(logger *tracing.Logger, fromChatID int64, toChatID int64) error {
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 60*time.Second)
+	defer cancel()
+
+	renames, err := x.scanChatKeys(ctx, logger, fromChatID, toChatID)
+	if err != nil {
+		return err
+	}
+
+	// keys of the new ID are the migrated ones on a repeated run, they are dropped only while there is what replaces them
+	if len(renames) == 0 {
+		logger.I("Chat has no keys to migrate", "from_chat_id", fromChatID, "to_chat_id", toChatID)
+		return nil
+	}
+
+	stale, err := x.scanChatKeys(ctx, logger, toChatID, toChatID)
+	if err != nil {
+		return err
+	}
+
+	pipe := x.redis.TxPipeline()
+	for key := range stale {
+		pipe.Del(ctx, key)
+	}
+	for from, to := range renames {
+		pipe.Rename(ctx, from, to)
+	}
+
+	// a key expiring between SCAN and EXEC fails its RENAME only, the rest of the block still applies
+	if _, err := pipe.Exec(ctx); err != nil && !strings.Contains(err.Error(), "no such key") {
+		logger.E("Failed to migrate chat keys", "from_chat_id", fromChatID, "to_chat_id", toChatID, tracing.InnerError, err)
+		return err
+	}
+
+	logger.I("Chat keys migrated", "from_chat_id", fromChatID, "to_chat_id", toChatID, "keys", len(renames), "stale_keys", len(stale))
+	return nil
+}
+
+// scanChatKeys maps every key of fromChatID to the same key of toChatID
+func (x *ChatMigrationRepository) scanChatKeys(ctx context.Context, logger *tracing.Logger, fromChatID int64, toChatID int64) (map[string]string, error) {
+	keys := map[string]string{}
+	for _, prefix := range chatKeyPrefixes {
+		from := fmt.Sprintf("%s:%d", prefix, fromChatID)
+		to := fmt.Sprintf("%s:%d", prefix, toChatID)
+
+		for _, pattern := range []string{from, from + "[:/]*"} {
+			iter := x.redis.Scan(ctx, 0, pattern, 1000).Iterator()
+			for iter.Next(ctx) {
+				key := iter.Val()
+				keys[key] = to + strings.TrimPrefix(key, from)
+			}
+			if err := iter.Err(); err != nil {
+				logger.E("Failed to scan chat keys", "pattern", pattern, tracing.InnerError, err)
+				return nil, err
+			}
+		}
+	}
+	return keys, nil
+}
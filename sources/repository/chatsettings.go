@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"ximanager/sources/configuration"
+	"ximanager/sources/persistence/entities"
+	"ximanager/sources/persistence/gormdao/query"
+	"ximanager/sources/platform"
+	"ximanager/sources/tracing"
+
+	"gorm.io/gorm"
+)
+
+// TriggerPolicy decides which group messages not starting with /xi are answered, explicit /xi is always answered
+type TriggerPolicy string
+
+const (
+	TriggerPolicyAll      TriggerPolicy = "all"
+	TriggerPolicyCommand  TriggerPolicy = "command"
+	TriggerPolicyReply    TriggerPolicy = "reply"
+	TriggerPolicyMention  TriggerPolicy = "mention"
+	TriggerPolicyKeywords TriggerPolicy = "keywords"
+	TriggerPolicyLurker   TriggerPolicy = "lurker"
+)
+
+var TriggerPolicies = []TriggerPolicy{TriggerPolicyAll, TriggerPolicyCommand, TriggerPolicyReply, TriggerPolicyMention, TriggerPolicyKeywords, TriggerPolicyLurker}
+
+type ChatSettingsRepository struct {
+	config *configuration.Config
+}
+
+func NewChatSettingsRepository(config *configuration.Config) *ChatSettingsRepository {
+	return &ChatSettingsRepository{config: config}
+}
+
+// GetSettings returns the settings of the chat, a chat that never changed them gets an unsaved row with the defaults
+func (x *ChatSettingsRepository) GetSettings(logger *tracing.Logger, chatID int64) (*entities.ChatSetting, error) {
+	defer tracing.ProfilePoint(logger, "Chat settings get completed", "repository.chat_settings.get", "chat_id", chatID)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	cs := query.Q.ChatSetting
+	settings, err := cs.WithContext(ctx).Where(cs.ChatID.Eq(chatID)).First()
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return DefaultChatSettings(chatID), nil
+		}
+		logger.E("Failed to get chat settings", tracing.InnerError, err)
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// DefaultChatSettings are the settings of a chat that never changed them
+func DefaultChatSettings(chatID int64) *entities.ChatSetting {
+	return &entities.ChatSetting{ChatID: chatID, TriggerPolicy: string(TriggerPolicyAll)}
+}
+
+func (x *ChatSettingsRepository) SaveSettings(logger *tracing.Logger, settings *entities.ChatSetting, editor *entities.User) error {
+	defer tracing.ProfilePoint(logger, "Chat settings save completed", "repository.chat_settings.save", "chat_id", settings.ChatID)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	settings.UpdatedBy = &editor.ID
+	settings.UpdatedAt = time.Now()
+
+	cs := query.Q.ChatSetting
+	if err := cs.WithContext(ctx).Save(settings); err != nil {
+		logger.E("Failed to save chat settings", tracing.InnerError, err)
+		return err
+	}
+
+	logger.I("Saved chat settings", "chat_id", settings.ChatID, "language", settings.Language, "trigger_policy", settings.TriggerPolicy)
+	return nil
+}
+
+// Location is the time zone quiet hours of the chat are set in, the configured one unless the chat chose its own
+func (x *ChatSettingsRepository) Location(logger *tracing.Logger, settings *entities.ChatSetting) *time.Location {
+	for _, name := range []string{settings.TimeZone, x.config.Telegram.Triggers.TimeZone} {
+		if name == "" {
+			continue
+		}
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			logger.W("Unknown time zone of chat settings", "time_zone", name, tracing.InnerError, err)
+			continue
+		}
+		return location
+	}
+	return time.UTC
+}
+
+// LurkerChance is the percent of messages answered unprompted under the lurker policy
+func (x *ChatSettingsRepository) LurkerChance(settings *entities.ChatSetting) int {
+	if settings.LurkerChance > 0 {
+		return settings.LurkerChance
+	}
+	return x.config.Telegram.Triggers.LurkerChance
+}
+
+// QuietUntil reports whether now falls into quiet hours of the chat and when they end, hours may span midnight
+func (x *ChatSettingsRepository) QuietUntil(logger *tracing.Logger, settings *entities.ChatSetting, now time.Time) (time.Time, bool) {
+	if settings.QuietFrom == nil || settings.QuietTo == nil || *settings.QuietFrom == *settings.QuietTo {
+		return time.Time{}, false
+	}
+
+	local := now.In(x.Location(logger, settings))
+	minute := local.Hour()*60 + local.Minute()
+	from, to := *settings.QuietFrom, *settings.QuietTo
+
+	quiet := minute >= from && minute < to
+	if from > to {
+		quiet = minute >= from || minute < to
+	}
+	if !quiet {
+		return time.Time{}, false
+	}
+
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+	until := midnight.Add(time.Duration(to) * time.Minute)
+	if !until.After(local) {
+		until = until.AddDate(0, 0, 1)
+	}
+	return until, true
+}
@@ -26,6 +26,15 @@ const (
 	ChatStateConfirmBroadcast         = 10
 	ChatStateAwaitingTariffKey        = 11
 	ChatStateAwaitingTariffConfig     = 12
+	ChatStateAwaitingContextImport    = 13
+	ChatStateConfirmContextDrop       = 14
+	ChatStateAwaitingModeImport       = 15
+	ChatStateConfirmModeImport        = 16
+	ChatStateAwaitingPolicy           = 17
+	ChatStateAwaitingFeedbackComment  = 18
+	ChatStateAwaitingDraftTest        = 19
+	ChatStateAwaitingDraftCompare     = 20
+	ChatStateAwaitingChatInstructions = 21
 )
 
 const (
@@ -41,6 +50,9 @@ type ChatStateData struct {
 	ModeGrade     string    `json:"mode_grade,omitempty"`
 	BroadcastText string    `json:"broadcast_text,omitempty"`
 	TariffKey     string    `json:"tariff_key,omitempty"`
+	ContextDrop   []int     `json:"context_drop,omitempty"`
+	ModeBundle    string    `json:"mode_bundle,omitempty"`
+	FeedbackID    string    `json:"feedback_id,omitempty"`
 	CreatedAt     time.Time `json:"created_at"`
 }
 
@@ -200,6 +212,15 @@ func (r *ChatStateRepository) InitConfigEdit(logger *tracing.Logger, chatID int6
 	return r.SetState(logger, chatID, userID, state)
 }
 
+func (r *ChatStateRepository) InitPolicyEdit(logger *tracing.Logger, chatID int64, userID int64, modeID uuid.UUID) error {
+	state := &ChatStateData{
+		Status: ChatStateAwaitingPolicy,
+		UserID: userID,
+		ModeID: modeID.String(),
+	}
+	return r.SetState(logger, chatID, userID, state)
+}
+
 func (r *ChatStateRepository) InitDeleteConfirmation(logger *tracing.Logger, chatID int64, userID int64, modeID uuid.UUID) error {
 	state := &ChatStateData{
 		Status: ChatStateConfirmDelete,
@@ -270,6 +291,72 @@ func (r *ChatStateRepository) SetTariffKey(logger *tracing.Logger, chatID int64,
 	return r.SetState(logger, chatID, userID, state)
 }
 
+func (r *ChatStateRepository) InitContextImport(logger *tracing.Logger, chatID int64, userID int64) error {
+	state := &ChatStateData{
+		Status: ChatStateAwaitingContextImport,
+		UserID: userID,
+	}
+	return r.SetState(logger, chatID, userID, state)
+}
+
+func (r *ChatStateRepository) InitContextDropConfirmation(logger *tracing.Logger, chatID int64, userID int64, positions []int) error {
+	state := &ChatStateData{
+		Status:      ChatStateConfirmContextDrop,
+		UserID:      userID,
+		ContextDrop: positions,
+	}
+	return r.SetState(logger, chatID, userID, state)
+}
+
+func (r *ChatStateRepository) InitModeImport(logger *tracing.Logger, chatID int64, userID int64) error {
+	state := &ChatStateData{
+		Status: ChatStateAwaitingModeImport,
+		UserID: userID,
+	}
+	return r.SetState(logger, chatID, userID, state)
+}
+
+func (r *ChatStateRepository) InitModeImportConfirmation(logger *tracing.Logger, chatID int64, userID int64, bundle []byte) error {
+	state := &ChatStateData{
+		Status:     ChatStateConfirmModeImport,
+		UserID:     userID,
+		ModeBundle: string(bundle),
+	}
+	return r.SetState(logger, chatID, userID, state)
+}
+
+func (r *ChatStateRepository) InitFeedbackComment(logger *tracing.Logger, chatID int64, userID int64, feedbackID uuid.UUID) error {
+	state := &ChatStateData{
+		Status:     ChatStateAwaitingFeedbackComment,
+		UserID:     userID,
+		FeedbackID: feedbackID.String(),
+	}
+	return r.SetState(logger, chatID, userID, state)
+}
+
+// InitDraftTest waits for a question to answer with the mode draft, compare also answers it with the live version
+func (r *ChatStateRepository) InitDraftTest(logger *tracing.Logger, chatID int64, userID int64, modeType string, compare bool) error {
+	status := ChatStateAwaitingDraftTest
+	if compare {
+		status = ChatStateAwaitingDraftCompare
+	}
+
+	state := &ChatStateData{
+		Status:   status,
+		UserID:   userID,
+		ModeType: modeType,
+	}
+	return r.SetState(logger, chatID, userID, state)
+}
+
+func (r *ChatStateRepository) InitChatInstructionsEdit(logger *tracing.Logger, chatID int64, userID int64) error {
+	state := &ChatStateData{
+		Status: ChatStateAwaitingChatInstructions,
+		UserID: userID,
+	}
+	return r.SetState(logger, chatID, userID, state)
+}
+
 func GetStatusName(status int) string {
 	switch status {
 	case ChatStateNone:
@@ -298,6 +385,24 @@ func GetStatusName(status int) string {
 		return "awaiting_tariff_key"
 	case ChatStateAwaitingTariffConfig:
 		return "awaiting_tariff_config"
+	case ChatStateAwaitingContextImport:
+		return "awaiting_context_import"
+	case ChatStateConfirmContextDrop:
+		return "confirm_context_drop"
+	case ChatStateAwaitingModeImport:
+		return "awaiting_mode_import"
+	case ChatStateConfirmModeImport:
+		return "confirm_mode_import"
+	case ChatStateAwaitingPolicy:
+		return "awaiting_policy"
+	case ChatStateAwaitingFeedbackComment:
+		return "awaiting_feedback_comment"
+	case ChatStateAwaitingDraftTest:
+		return "awaiting_draft_test"
+	case ChatStateAwaitingDraftCompare:
+		return "awaiting_draft_compare"
+	case ChatStateAwaitingChatInstructions:
+		return "awaiting_chat_instructions"
 	default:
 		return "unknown"
 	}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"ximanager/sources/persistence/entities"
+	"ximanager/sources/persistence/gormdao/query"
+	"ximanager/sources/platform"
+	"ximanager/sources/tracing"
+
+	"gorm.io/gorm"
+)
+
+var ErrChatVariableNotFound = errors.New("chat variable not found")
+
+type ChatVariablesRepository struct{}
+
+func NewChatVariablesRepository() *ChatVariablesRepository {
+	return &ChatVariablesRepository{}
+}
+
+// GetVariables returns custom prompt variables of the chat as a name to value map
+func (x *ChatVariablesRepository) GetVariables(logger *tracing.Logger, chatID int64) (map[string]string, error) {
+	defer tracing.ProfilePoint(logger, "Chat variables get completed", "repository.chat_variables.get", "chat_id", chatID)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	cv := query.Q.ChatVariable
+	variables, err := cv.WithContext(ctx).Where(cv.ChatID.Eq(chatID)).Order(cv.Name).Find()
+	if err != nil {
+		logger.E("Failed to get chat variables", tracing.InnerError, err)
+		return nil, err
+	}
+
+	result := make(map[string]string, len(variables))
+	for _, variable := range variables {
+		result[variable.Name] = variable.Value
+	}
+
+	return result, nil
+}
+
+func (x *ChatVariablesRepository) SetVariable(logger *tracing.Logger, chatID int64, name string, value string) error {
+	defer tracing.ProfilePoint(logger, "Chat variables set completed", "repository.chat_variables.set", "chat_id", chatID, "name", name)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	cv := query.Q.ChatVariable
+	existing, err := cv.WithContext(ctx).Where(cv.ChatID.Eq(chatID), cv.Name.Eq(name)).First()
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.E("Failed to check existing chat variable", tracing.InnerError, err)
+		return err
+	}
+
+	if existing != nil {
+		existing.Value = value
+		existing.UpdatedAt = time.Now()
+		if err := cv.WithContext(ctx).Save(existing); err != nil {
+			logger.E("Failed to update chat variable", tracing.InnerError, err)
+			return err
+		}
+		logger.I("Updated chat variable", "name", name)
+		return nil
+	}
+
+	variable := &entities.ChatVariable{
+		ChatID:    chatID,
+		Name:      name,
+		Value:     value,
+		UpdatedAt: time.Now(),
+	}
+
+	if err := cv.WithContext(ctx).Create(variable); err != nil {
+		logger.E("Failed to create chat variable", tracing.InnerError, err)
+		return err
+	}
+
+	logger.I("Created chat variable", "name", name)
+	return nil
+}
+
+func (x *ChatVariablesRepository) DeleteVariable(logger *tracing.Logger, chatID int64, name string) error {
+	defer tracing.ProfilePoint(logger, "Chat variables delete completed", "repository.chat_variables.delete", "chat_id", chatID, "name", name)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	cv := query.Q.ChatVariable
+	result, err := cv.WithContext(ctx).Where(cv.ChatID.Eq(chatID), cv.Name.Eq(name)).Delete()
+	if err != nil {
+		logger.E("Failed to delete chat variable", tracing.InnerError, err)
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrChatVariableNotFound
+	}
+
+	logger.I("Deleted chat variable", "name", name)
+	return nil
+}
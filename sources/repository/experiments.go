@@ -0,0 +1,427 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"ximanager/sources/persistence/entities"
+	"ximanager/sources/persistence/gormdao/query"
+	"ximanager/sources/platform"
+	"ximanager/sources/tracing"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrExperimentNotFound       = errors.New("experiment not found")
+	ErrExperimentExists         = errors.New("experiment with this key already exists")
+	ErrExperimentModeBusy       = errors.New("mode already has an active experiment")
+	ErrExperimentNotActive      = errors.New("experiment is not active")
+	ErrExperimentInvalidKey     = errors.New("experiment key is invalid")
+	ErrExperimentInvalidUnit    = errors.New("experiment unit is invalid")
+	ErrExperimentInvalidVariant = errors.New("experiment variants are invalid")
+)
+
+type ExperimentUnit string
+
+const (
+	ExperimentUnitChat ExperimentUnit = "chat"
+	ExperimentUnitUser ExperimentUnit = "user"
+)
+
+const (
+	experimentMinVariants = 2
+	experimentMaxVariants = 5
+	experimentListLimit   = 20
+)
+
+var (
+	experimentKeyPattern = regexp.MustCompile(`^[a-z0-9_-]{1,50}$`)
+	variantKeyPattern    = regexp.MustCompile(`^[a-z0-9_-]{1,20}$`)
+)
+
+// ExperimentVariant overrides the mode version, the model or both for the assigned chats or users
+type ExperimentVariant struct {
+	Key         string `json:"key"`
+	ModeVersion int    `json:"mode_version,omitempty"`
+	Model       string `json:"model,omitempty"`
+}
+
+// String formats the variant target back to the spec form, e.g. "v3+openai/gpt-5"
+func (v ExperimentVariant) String() string {
+	parts := []string{}
+	if v.ModeVersion > 0 {
+		parts = append(parts, "v"+strconv.Itoa(v.ModeVersion))
+	}
+	if v.Model != "" {
+		parts = append(parts, v.Model)
+	}
+	return strings.Join(parts, "+")
+}
+
+// ExperimentAssignment is the variant a request was served with
+type ExperimentAssignment struct {
+	ExperimentID uuid.UUID
+	Key          string
+	Variant      ExperimentVariant
+}
+
+// ExperimentVariantStats aggregates usage and feedback rows recorded for a variant
+type ExperimentVariantStats struct {
+	Variant    ExperimentVariant
+	Responses  int64
+	Cost       decimal.Decimal
+	AvgLatency time.Duration
+	Likes      int64
+	Dislikes   int64
+}
+
+func (s ExperimentVariantStats) Feedbacks() int64 {
+	return s.Likes + s.Dislikes
+}
+
+func (s ExperimentVariantStats) LikeRate() float64 {
+	if s.Feedbacks() == 0 {
+		return 0
+	}
+	return float64(s.Likes) / float64(s.Feedbacks())
+}
+
+func (s ExperimentVariantStats) AvgCost() decimal.Decimal {
+	if s.Responses == 0 {
+		return decimal.Zero
+	}
+	return s.Cost.Div(decimal.NewFromInt(s.Responses))
+}
+
+// LikeRateSignificance compares like-rates with a two-proportion z-test and returns the two-sided p-value,
+// false if one of the variants has no feedback yet
+func LikeRateSignificance(control ExperimentVariantStats, candidate ExperimentVariantStats) (float64, bool) {
+	n1, n2 := float64(control.Feedbacks()), float64(candidate.Feedbacks())
+	if n1 == 0 || n2 == 0 {
+		return 0, false
+	}
+
+	pooled := float64(control.Likes+candidate.Likes) / (n1 + n2)
+	se := math.Sqrt(pooled * (1 - pooled) * (1/n1 + 1/n2))
+	if se == 0 {
+		return 1, true
+	}
+
+	z := (candidate.LikeRate() - control.LikeRate()) / se
+	return math.Erfc(math.Abs(z) / math.Sqrt2), true
+}
+
+// ParseExperimentVariants reads the variants spec, e.g. "control=v3,candidate=v4+openai/gpt-5"
+func ParseExperimentVariants(spec string) ([]ExperimentVariant, error) {
+	entries := strings.Split(spec, ",")
+	if len(entries) < experimentMinVariants || len(entries) > experimentMaxVariants {
+		return nil, fmt.Errorf("%w: expected %d-%d variants", ErrExperimentInvalidVariant, experimentMinVariants, experimentMaxVariants)
+	}
+
+	variants := make([]ExperimentVariant, 0, len(entries))
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		key, target, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found || !variantKeyPattern.MatchString(key) || target == "" {
+			return nil, fmt.Errorf("%w: malformed variant %q", ErrExperimentInvalidVariant, entry)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("%w: duplicate variant %q", ErrExperimentInvalidVariant, key)
+		}
+		seen[key] = true
+
+		variant := ExperimentVariant{Key: key}
+		for _, part := range strings.Split(target, "+") {
+			if version, err := strconv.Atoi(strings.TrimPrefix(part, "v")); strings.HasPrefix(part, "v") && err == nil {
+				if version <= 0 || variant.ModeVersion != 0 {
+					return nil, fmt.Errorf("%w: bad mode version in %q", ErrExperimentInvalidVariant, entry)
+				}
+				variant.ModeVersion = version
+				continue
+			}
+			if part == "" || variant.Model != "" {
+				return nil, fmt.Errorf("%w: bad model in %q", ErrExperimentInvalidVariant, entry)
+			}
+			variant.Model = part
+		}
+
+		variants = append(variants, variant)
+	}
+
+	return variants, nil
+}
+
+func ParseExperimentUnit(unit string) (ExperimentUnit, error) {
+	switch ExperimentUnit(unit) {
+	case ExperimentUnitChat, ExperimentUnitUser:
+		return ExperimentUnit(unit), nil
+	default:
+		return "", ErrExperimentInvalidUnit
+	}
+}
+
+// ExperimentVariants decodes the variants stored on the experiment
+func ExperimentVariants(experiment *entities.Experiment) ([]ExperimentVariant, error) {
+	var variants []ExperimentVariant
+	if err := json.Unmarshal([]byte(experiment.Variants), &variants); err != nil {
+		return nil, err
+	}
+	if len(variants) == 0 {
+		return nil, ErrExperimentInvalidVariant
+	}
+	return variants, nil
+}
+
+// AssignExperimentVariant picks the variant by hashing the experiment key with the chat or user id,
+// so the same unit always lands in the same variant while the experiment runs
+func AssignExperimentVariant(experiment *entities.Experiment, variants []ExperimentVariant, chatID int64, userEID int64) ExperimentVariant {
+	unitID := chatID
+	if ExperimentUnit(experiment.Unit) == ExperimentUnitUser {
+		unitID = userEID
+	}
+
+	hash := fnv.New64a()
+	hash.Write([]byte(experiment.Key + ":" + strconv.FormatInt(unitID, 10)))
+	return variants[hash.Sum64()%uint64(len(variants))]
+}
+
+type ExperimentsRepository struct{}
+
+func NewExperimentsRepository() *ExperimentsRepository {
+	return &ExperimentsRepository{}
+}
+
+func (x *ExperimentsRepository) CreateExperiment(logger *tracing.Logger, key string, modeType string, unit ExperimentUnit, variants []ExperimentVariant, createdBy uuid.UUID) (*entities.Experiment, error) {
+	defer tracing.ProfilePoint(logger, "Experiments create completed", "repository.experiments.create", "key", key, "mode_type", modeType)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	if !experimentKeyPattern.MatchString(key) {
+		return nil, ErrExperimentInvalidKey
+	}
+
+	data, err := json.Marshal(variants)
+	if err != nil {
+		return nil, err
+	}
+
+	e := query.Q.Experiment
+
+	if count, err := e.WithContext(ctx).Where(e.Key.Eq(key)).Count(); err != nil {
+		logger.E("Failed to check experiment key", tracing.InnerError, err)
+		return nil, err
+	} else if count > 0 {
+		return nil, ErrExperimentExists
+	}
+
+	if count, err := e.WithContext(ctx).Where(e.ModeType.Eq(modeType), e.IsActive.Is(true)).Count(); err != nil {
+		logger.E("Failed to check active experiments of mode", tracing.InnerError, err)
+		return nil, err
+	} else if count > 0 {
+		return nil, ErrExperimentModeBusy
+	}
+
+	experiment := &entities.Experiment{
+		Key:       key,
+		ModeType:  modeType,
+		Unit:      string(unit),
+		Variants:  string(data),
+		IsActive:  platform.BoolPtr(true),
+		CreatedBy: &createdBy,
+	}
+
+	if err := e.WithContext(ctx).Create(experiment); err != nil {
+		logger.E("Failed to create experiment", tracing.InnerError, err)
+		return nil, err
+	}
+
+	logger.I("Experiment created", "experiment_id", experiment.ID, "key", key, "mode_type", modeType, "unit", unit, "variants", len(variants))
+	return experiment, nil
+}
+
+// GetExperiments returns the most recent experiments, newest first
+func (x *ExperimentsRepository) GetExperiments(logger *tracing.Logger) ([]*entities.Experiment, error) {
+	defer tracing.ProfilePoint(logger, "Experiments get all completed", "repository.experiments.get.all")()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	e := query.Q.Experiment
+	experiments, err := e.WithContext(ctx).Order(e.CreatedAt.Desc()).Limit(experimentListLimit).Find()
+	if err != nil {
+		logger.E("Failed to get experiments", tracing.InnerError, err)
+		return nil, err
+	}
+
+	return experiments, nil
+}
+
+func (x *ExperimentsRepository) GetExperimentByKey(logger *tracing.Logger, key string) (*entities.Experiment, error) {
+	defer tracing.ProfilePoint(logger, "Experiments get by key completed", "repository.experiments.get.by.key", "key", key)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	e := query.Q.Experiment
+	experiment, err := e.WithContext(ctx).Where(e.Key.Eq(key)).First()
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrExperimentNotFound
+		}
+		logger.E("Failed to get experiment", tracing.InnerError, err)
+		return nil, err
+	}
+
+	return experiment, nil
+}
+
+// GetActiveExperiment returns the running experiment of the mode type, nil if there is none
+func (x *ExperimentsRepository) GetActiveExperiment(logger *tracing.Logger, modeType string) (*entities.Experiment, error) {
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	e := query.Q.Experiment
+	experiment, err := e.WithContext(ctx).Where(e.ModeType.Eq(modeType), e.IsActive.Is(true)).First()
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		logger.E("Failed to get active experiment", tracing.InnerError, err)
+		return nil, err
+	}
+
+	return experiment, nil
+}
+
+func (x *ExperimentsRepository) StopExperiment(logger *tracing.Logger, key string) error {
+	defer tracing.ProfilePoint(logger, "Experiments stop completed", "repository.experiments.stop", "key", key)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	experiment, err := x.GetExperimentByKey(logger, key)
+	if err != nil {
+		return err
+	}
+
+	if !platform.BoolValue(experiment.IsActive, false) {
+		return ErrExperimentNotActive
+	}
+
+	e := query.Q.Experiment
+	if _, err := e.WithContext(ctx).Where(e.ID.Eq(experiment.ID)).UpdateSimple(e.IsActive.Value(false), e.StoppedAt.Value(time.Now())); err != nil {
+		logger.E("Failed to stop experiment", tracing.InnerError, err)
+		return err
+	}
+
+	logger.I("Experiment stopped", "experiment_id", experiment.ID, "key", key)
+	return nil
+}
+
+// Assign resolves the variant of the active experiment of the mode type, nil if the mode has no experiment
+func (x *ExperimentsRepository) Assign(logger *tracing.Logger, modeType string, chatID int64, userEID int64) *ExperimentAssignment {
+	experiment, err := x.GetActiveExperiment(logger, modeType)
+	if err != nil || experiment == nil {
+		return nil
+	}
+
+	variants, err := ExperimentVariants(experiment)
+	if err != nil {
+		logger.E("Failed to parse experiment variants", "key", experiment.Key, tracing.InnerError, err)
+		return nil
+	}
+
+	return &ExperimentAssignment{
+		ExperimentID: experiment.ID,
+		Key:          experiment.Key,
+		Variant:      AssignExperimentVariant(experiment, variants, chatID, userEID),
+	}
+}
+
+// GetExperimentReport aggregates usage and feedback of every variant in the declared order
+func (x *ExperimentsRepository) GetExperimentReport(logger *tracing.Logger, experiment *entities.Experiment) ([]ExperimentVariantStats, error) {
+	defer tracing.ProfilePoint(logger, "Experiments get report completed", "repository.experiments.get.report", "key", experiment.Key)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	variants, err := ExperimentVariants(experiment)
+	if err != nil {
+		return nil, err
+	}
+
+	u := query.Usage
+	var usageRows []struct {
+		Variant   string           `gorm:"column:variant"`
+		Responses int64            `gorm:"column:responses"`
+		Cost      *decimal.Decimal `gorm:"column:cost"`
+		Latency   *float64         `gorm:"column:latency"`
+	}
+
+	err = u.WithContext(ctx).
+		Select(u.Variant, u.ID.Count().As("responses"), u.Cost.Sum().As("cost"), u.LatencyMs.Avg().As("latency")).
+		Where(u.ExperimentID.Eq(experiment.ID)).
+		Group(u.Variant).
+		Scan(&usageRows)
+
+	if err != nil {
+		logger.E("Failed to aggregate experiment usage", tracing.InnerError, err)
+		return nil, err
+	}
+
+	f := query.Feedback
+	var feedbackRows []struct {
+		Variant string `gorm:"column:variant"`
+		Total   int64  `gorm:"column:total"`
+		Likes   int64  `gorm:"column:likes"`
+	}
+
+	err = f.WithContext(ctx).
+		Select(f.Variant, f.ID.Count().As("total"), f.Liked.Sum().As("likes")).
+		Where(f.ExperimentID.Eq(experiment.ID)).
+		Group(f.Variant).
+		Scan(&feedbackRows)
+
+	if err != nil {
+		logger.E("Failed to aggregate experiment feedback", tracing.InnerError, err)
+		return nil, err
+	}
+
+	stats := make([]ExperimentVariantStats, len(variants))
+	index := make(map[string]int, len(variants))
+	for i, variant := range variants {
+		stats[i] = ExperimentVariantStats{Variant: variant, Cost: decimal.Zero}
+		index[variant.Key] = i
+	}
+
+	for _, row := range usageRows {
+		i, ok := index[row.Variant]
+		if !ok {
+			continue
+		}
+		stats[i].Responses = row.Responses
+		if row.Cost != nil {
+			stats[i].Cost = *row.Cost
+		}
+		if row.Latency != nil {
+			stats[i].AvgLatency = time.Duration(*row.Latency) * time.Millisecond
+		}
+	}
+
+	for _, row := range feedbackRows {
+		i, ok := index[row.Variant]
+		if !ok {
+			continue
+		}
+		stats[i].Likes = row.Likes
+		stats[i].Dislikes = row.Total - row.Likes
+	}
+
+	return stats, nil
+}
@@ -1,7 +1,11 @@
 package repository
 
 import (
+	"cmp"
 	"context"
+	"errors"
+	"slices"
+	"strings"
 	"time"
 	"ximanager/sources/persistence/entities"
 	"ximanager/sources/persistence/gormdao/query"
@@ -9,6 +13,7 @@ import (
 	"ximanager/sources/tracing"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type FeedbacksRepository struct{}
@@ -24,7 +29,52 @@ const (
 	FeedbackKindWhisper FeedbackKind = "whisper"
 )
 
-func (x *FeedbacksRepository) CreateFeedback(logger *tracing.Logger, userID uuid.UUID, liked int, kind FeedbackKind) (*entities.Feedback, error) {
+type FeedbackReason string
+
+const (
+	FeedbackReasonWrong   FeedbackReason = "wrong"
+	FeedbackReasonTooLong FeedbackReason = "too_long"
+	FeedbackReasonRefused FeedbackReason = "refused"
+	FeedbackReasonOther   FeedbackReason = "other"
+)
+
+var FeedbackReasons = []FeedbackReason{FeedbackReasonWrong, FeedbackReasonTooLong, FeedbackReasonRefused, FeedbackReasonOther}
+
+const (
+	feedbackCommentMaxLength  = 1000
+	feedbackReportRecentLimit = 5
+)
+
+var ErrFeedbackNotFound = errors.New("feedback not found")
+
+// FeedbackGroup counts feedback of a single model or mode
+type FeedbackGroup struct {
+	Key      string
+	Likes    int64
+	Dislikes int64
+	Reasons  map[FeedbackReason]int64
+}
+
+func (g *FeedbackGroup) Total() int64 {
+	return g.Likes + g.Dislikes
+}
+
+func (g *FeedbackGroup) LikeRate() float64 {
+	if g.Total() == 0 {
+		return 0
+	}
+	return float64(g.Likes) / float64(g.Total())
+}
+
+type FeedbackReport struct {
+	Total   FeedbackGroup
+	ByModel []*FeedbackGroup
+	ByMode  []*FeedbackGroup
+	Recent  []*entities.Feedback
+}
+
+// CreateFeedback records a like or dislike, usage links it to the response it was given for and may be nil
+func (x *FeedbacksRepository) CreateFeedback(logger *tracing.Logger, userID uuid.UUID, liked int, kind FeedbackKind, chatID int64, messageID int, usage *entities.Usage) (*entities.Feedback, error) {
 	defer tracing.ProfilePoint(logger, "Feedbacks create feedback completed", "repository.feedbacks.create", "user_id", userID, "liked", liked, "kind", kind)()
 
 	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
@@ -33,9 +83,20 @@ func (x *FeedbacksRepository) CreateFeedback(logger *tracing.Logger, userID uuid
 	q := query.Q.WithContext(ctx)
 
 	feedback := &entities.Feedback{
-		UserID: userID,
-		Liked:  liked,
-		Kind:   string(kind),
+		UserID:    userID,
+		Liked:     liked,
+		Kind:      string(kind),
+		ChatID:    &chatID,
+		MessageID: &messageID,
+	}
+
+	if usage != nil {
+		feedback.UsageID = &usage.ID
+		feedback.Model = usage.Model
+		feedback.ModeType = usage.ModeType
+		feedback.ModeVersion = usage.ModeVersion
+		feedback.ExperimentID = usage.ExperimentID
+		feedback.Variant = usage.Variant
 	}
 
 	if err := q.Feedback.Create(feedback); err != nil {
@@ -43,10 +104,144 @@ func (x *FeedbacksRepository) CreateFeedback(logger *tracing.Logger, userID uuid
 		return nil, err
 	}
 
-	logger.I("Feedback created successfully", "feedback_id", feedback.ID, "user_id", userID, "liked", liked, "kind", kind)
+	logger.I("Feedback created successfully", "feedback_id", feedback.ID, "user_id", userID, "liked", liked, "kind", kind, "linked", usage != nil)
+	return feedback, nil
+}
+
+func (x *FeedbacksRepository) GetFeedbackByID(logger *tracing.Logger, feedbackID uuid.UUID) (*entities.Feedback, error) {
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	f := query.Feedback
+	feedback, err := f.WithContext(ctx).Where(f.ID.Eq(feedbackID)).First()
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFeedbackNotFound
+		}
+		logger.E("Failed to get feedback", tracing.InnerError, err)
+		return nil, err
+	}
+
 	return feedback, nil
 }
 
+func (x *FeedbacksRepository) SetFeedbackReason(logger *tracing.Logger, feedbackID uuid.UUID, reason FeedbackReason) error {
+	defer tracing.ProfilePoint(logger, "Feedbacks set reason completed", "repository.feedbacks.set.reason", "feedback_id", feedbackID, "reason", reason)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	f := query.Feedback
+	if _, err := f.WithContext(ctx).Where(f.ID.Eq(feedbackID)).UpdateSimple(f.Reason.Value(string(reason))); err != nil {
+		logger.E("Failed to set feedback reason", tracing.InnerError, err)
+		return err
+	}
+
+	return nil
+}
+
+// SetFeedbackComment stores the free text reason, it also marks the reason as "other"
+func (x *FeedbacksRepository) SetFeedbackComment(logger *tracing.Logger, feedbackID uuid.UUID, comment string) error {
+	defer tracing.ProfilePoint(logger, "Feedbacks set comment completed", "repository.feedbacks.set.comment", "feedback_id", feedbackID)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	if runes := []rune(comment); len(runes) > feedbackCommentMaxLength {
+		comment = string(runes[:feedbackCommentMaxLength])
+	}
+
+	f := query.Feedback
+	if _, err := f.WithContext(ctx).Where(f.ID.Eq(feedbackID)).UpdateSimple(f.Reason.Value(string(FeedbackReasonOther)), f.Comment.Value(comment)); err != nil {
+		logger.E("Failed to set feedback comment", tracing.InnerError, err)
+		return err
+	}
+
+	return nil
+}
+
+// GetFeedbackReport groups dialer feedback since the given time by model and by mode, newest comments included
+func (x *FeedbacksRepository) GetFeedbackReport(logger *tracing.Logger, since time.Time) (*FeedbackReport, error) {
+	defer tracing.ProfilePoint(logger, "Feedbacks get report completed", "repository.feedbacks.get.report", "since", since)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	f := query.Feedback
+	var rows []struct {
+		Model    *string `gorm:"column:model"`
+		ModeType *string `gorm:"column:mode_type"`
+		Liked    int     `gorm:"column:liked"`
+		Reason   *string `gorm:"column:reason"`
+		Count    int64   `gorm:"column:count"`
+	}
+
+	err := f.WithContext(ctx).
+		Select(f.Model, f.ModeType, f.Liked, f.Reason, f.ID.Count().As("count")).
+		Where(f.Kind.Eq(string(FeedbackKindDialer)), f.CreatedAt.Gte(since)).
+		Group(f.Model, f.ModeType, f.Liked, f.Reason).
+		Scan(&rows)
+
+	if err != nil {
+		logger.E("Failed to aggregate feedback", tracing.InnerError, err)
+		return nil, err
+	}
+
+	report := &FeedbackReport{Total: FeedbackGroup{Reasons: map[FeedbackReason]int64{}}}
+	byModel := map[string]*FeedbackGroup{}
+	byMode := map[string]*FeedbackGroup{}
+
+	group := func(groups map[string]*FeedbackGroup, key string) *FeedbackGroup {
+		if groups[key] == nil {
+			groups[key] = &FeedbackGroup{Key: key, Reasons: map[FeedbackReason]int64{}}
+		}
+		return groups[key]
+	}
+
+	for _, row := range rows {
+		for _, target := range []*FeedbackGroup{&report.Total, group(byModel, platform.StringValue(row.Model, "")), group(byMode, platform.StringValue(row.ModeType, ""))} {
+			if row.Liked == 1 {
+				target.Likes += row.Count
+				continue
+			}
+			target.Dislikes += row.Count
+			if row.Reason != nil {
+				target.Reasons[FeedbackReason(*row.Reason)] += row.Count
+			}
+		}
+	}
+
+	report.ByModel = sortedFeedbackGroups(byModel)
+	report.ByMode = sortedFeedbackGroups(byMode)
+
+	report.Recent, err = f.WithContext(ctx).
+		Preload(f.User).
+		Where(f.Kind.Eq(string(FeedbackKindDialer)), f.CreatedAt.Gte(since), f.Comment.IsNotNull()).
+		Order(f.CreatedAt.Desc()).
+		Limit(feedbackReportRecentLimit).
+		Find()
+
+	if err != nil {
+		logger.E("Failed to get recent feedback comments", tracing.InnerError, err)
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func sortedFeedbackGroups(groups map[string]*FeedbackGroup) []*FeedbackGroup {
+	result := make([]*FeedbackGroup, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, group)
+	}
+
+	slices.SortFunc(result, func(a, b *FeedbackGroup) int {
+		if a.Total() != b.Total() {
+			return cmp.Compare(b.Total(), a.Total())
+		}
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	return result
+}
+
 func (x *FeedbacksRepository) GetFeedbackStats(logger *tracing.Logger) (likes int64, dislikes int64, err error) {
 	defer tracing.ProfilePoint(logger, "Feedbacks get stats completed", "repository.feedbacks.get.stats")()
 
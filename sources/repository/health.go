@@ -15,6 +15,11 @@ import (
 	openrouter "github.com/revrost/go-openrouter"
 )
 
+// TelegramBot is the part of the bot the health check needs
+type TelegramBot interface {
+	GetMe() (tgbotapi.User, error)
+}
+
 type HealthRepository struct {
 	redis        *redis.Client
 	openrouter   *openrouter.Client
@@ -135,7 +140,7 @@ func (x *HealthRepository) CheckUnleashHealth(logger *tracing.Logger) error {
 	return nil
 }
 
-func (x *HealthRepository) CheckTelegramHealth(logger *tracing.Logger, bot *tgbotapi.BotAPI) error {
+func (x *HealthRepository) CheckTelegramHealth(logger *tracing.Logger, bot TelegramBot) error {
 	defer tracing.ProfilePoint(logger, "Health check telegram completed", "repository.health.check.telegram")()
 
 	if bot == nil {
@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"ximanager/sources/persistence/entities"
+	"ximanager/sources/platform"
+	"ximanager/sources/tracing"
+)
+
+const ModeBundleVersion = 1
+
+var (
+	ErrModeBundleMalformed    = errors.New("mode bundle is malformed")
+	ErrModeBundleVersion      = errors.New("mode bundle version is not supported")
+	ErrModeBundleInvalidName  = errors.New("mode bundle name must be 2-100 characters long")
+	ErrModeBundleInvalidGrade = errors.New("mode bundle grade must be empty, bronze, silver or gold")
+	ErrModeBundleEmptyPrompt  = errors.New("mode bundle prompt is empty")
+)
+
+// ModeBundle is a portable representation of the latest mode version, used to move modes between bots
+type ModeBundle struct {
+	Version    int        `json:"version"`
+	ExportedAt time.Time  `json:"exported_at"`
+	Type       string     `json:"type"`
+	Name       string     `json:"name"`
+	Grade      string     `json:"grade,omitempty"`
+	Config     ModeConfig `json:"config"`
+}
+
+// ModeBundleChange describes a single field that differs between the stored mode and an imported bundle
+type ModeBundleChange struct {
+	Field  string
+	Before string
+	After  string
+}
+
+func (x *ModeBundle) JSON() ([]byte, error) {
+	return json.MarshalIndent(x, "", "  ")
+}
+
+// ParseModeBundle decodes the bundle and validates everything except the mode type format, which is checked by the caller
+func ParseModeBundle(data []byte) (*ModeBundle, error) {
+	var bundle ModeBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrModeBundleMalformed, err)
+	}
+
+	if bundle.Version <= 0 || bundle.Version > ModeBundleVersion {
+		return nil, ErrModeBundleVersion
+	}
+
+	bundle.Type = strings.TrimSpace(bundle.Type)
+	bundle.Name = strings.TrimSpace(bundle.Name)
+	bundle.Config.Prompt = strings.TrimSpace(bundle.Config.Prompt)
+
+	if len(bundle.Name) < 2 || len(bundle.Name) > 100 {
+		return nil, ErrModeBundleInvalidName
+	}
+
+	switch bundle.Grade {
+	case "", platform.GradeBronze, platform.GradeSilver, platform.GradeGold:
+	default:
+		return nil, ErrModeBundleInvalidGrade
+	}
+
+	if bundle.Config.Prompt == "" {
+		return nil, ErrModeBundleEmptyPrompt
+	}
+
+	if bundle.Config.Params != nil {
+		if err := bundle.Config.Params.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	if bundle.Config.Policy != nil {
+		if err := bundle.Config.Policy.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &bundle, nil
+}
+
+func (x *ModesRepository) ExportModeBundle(logger *tracing.Logger, modeType string) (*ModeBundle, error) {
+	defer tracing.ProfilePoint(logger, "Modes export bundle completed", "repository.modes.export.bundle", "mode_type", modeType)()
+
+	mode, err := x.GetModeByTypeIncludingDisabled(logger, modeType)
+	if err != nil {
+		return nil, err
+	}
+
+	config := x.ParseModeConfig(mode, logger)
+	config.Final = platform.BoolValue(mode.Final, config.Final)
+
+	return &ModeBundle{
+		Version:    ModeBundleVersion,
+		ExportedAt: time.Now().UTC(),
+		Type:       mode.Type,
+		Name:       mode.Name,
+		Grade:      platform.StringValue(mode.Grade, ""),
+		Config:     *config,
+	}, nil
+}
+
+// ModeBundleChanges lists the fields the bundle would change in the stored mode, empty if they are identical
+func (x *ModesRepository) ModeBundleChanges(logger *tracing.Logger, mode *entities.Mode, bundle *ModeBundle) []ModeBundleChange {
+	config := x.ParseModeConfig(mode, logger)
+	final := platform.BoolValue(mode.Final, config.Final)
+	grade := platform.StringValue(mode.Grade, "")
+
+	var changes []ModeBundleChange
+	if mode.Name != bundle.Name {
+		changes = append(changes, ModeBundleChange{Field: "name", Before: mode.Name, After: bundle.Name})
+	}
+	if grade != bundle.Grade {
+		changes = append(changes, ModeBundleChange{Field: "grade", Before: grade, After: bundle.Grade})
+	}
+	if final != bundle.Config.Final {
+		changes = append(changes, ModeBundleChange{Field: "final", Before: fmt.Sprint(final), After: fmt.Sprint(bundle.Config.Final)})
+	}
+	if before, after := formatModeJSON(config.Params), formatModeJSON(bundle.Config.Params); before != after {
+		changes = append(changes, ModeBundleChange{Field: "params", Before: before, After: after})
+	}
+	if before, after := formatModeJSON(config.Policy), formatModeJSON(bundle.Config.Policy); before != after {
+		changes = append(changes, ModeBundleChange{Field: "policy", Before: before, After: after})
+	}
+	if strings.TrimSpace(config.Prompt) != bundle.Config.Prompt {
+		changes = append(changes, ModeBundleChange{Field: "prompt", Before: config.Prompt, After: bundle.Config.Prompt})
+	}
+
+	return changes
+}
+
+// formatModeJSON renders an optional config section as compact JSON, unset sections are shown as "{}"
+func formatModeJSON(value any) string {
+	data, err := json.Marshal(value)
+	if err != nil || string(data) == "null" {
+		return "{}"
+	}
+	return string(data)
+}
+
+// ImportModeBundle creates the mode if the type is new, otherwise stores the bundle as the next version of the existing mode
+func (x *ModesRepository) ImportModeBundle(logger *tracing.Logger, bundle *ModeBundle, editorEUID int64) (*entities.Mode, bool, error) {
+	defer tracing.ProfilePoint(logger, "Modes import bundle completed", "repository.modes.import.bundle", "mode_type", bundle.Type)()
+
+	config := bundle.Config
+
+	existing, err := x.GetModeByTypeIncludingDisabled(logger, bundle.Type)
+	if errors.Is(err, ErrModeNotFound) {
+		mode, err := x.CreateMode(logger, bundle.Type, bundle.Name, &config, bundle.Grade, editorEUID)
+		return mode, true, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	configJSON, err := x.SerializeModeConfig(&config)
+	if err != nil {
+		logger.E("Failed to serialize mode config", tracing.InnerError, err)
+		return nil, false, err
+	}
+
+	var gradePtr *string
+	if bundle.Grade != "" {
+		gradePtr = &bundle.Grade
+	}
+
+	mode, err := x.createModeVersion(logger, existing.ID, editorEUID, func(mode *entities.Mode) {
+		mode.Name = bundle.Name
+		mode.Config = &configJSON
+		mode.Grade = gradePtr
+		mode.Final = platform.BoolPtr(config.Final)
+	})
+	return mode, false, err
+}
@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"ximanager/sources/persistence/entities"
+	"ximanager/sources/persistence/gormdao/query"
+	"ximanager/sources/platform"
+	"ximanager/sources/tracing"
+
+	"gorm.io/gorm"
+)
+
+var ErrModeDraftNotFound = errors.New("mode draft not found")
+
+// SaveModeDraft stores the edited prompt as the draft of the mode type, a mode has at most one draft
+func (x *ModesRepository) SaveModeDraft(logger *tracing.Logger, modeType string, prompt string, baseVersion int, editorEUID int64) (*entities.ModeDraft, error) {
+	defer tracing.ProfilePoint(logger, "Modes save draft completed", "repository.modes.save.draft", "mode_type", modeType)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	editor, err := x.users.GetUserByEid(logger, editorEUID)
+	if err != nil {
+		return nil, err
+	}
+
+	md := query.Q.ModeDraft
+	draft, err := md.WithContext(ctx).Where(md.ModeType.Eq(modeType)).First()
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.E("Failed to check existing mode draft", tracing.InnerError, err)
+		return nil, err
+	}
+
+	if draft == nil {
+		draft = &entities.ModeDraft{ModeType: modeType}
+	}
+	draft.Prompt = prompt
+	draft.BaseVersion = baseVersion
+	draft.CreatedBy = &editor.ID
+	draft.UpdatedAt = time.Now()
+
+	if err := md.WithContext(ctx).Save(draft); err != nil {
+		logger.E("Failed to save mode draft", tracing.InnerError, err)
+		return nil, err
+	}
+
+	logger.I("Saved mode draft", "mode_type", modeType, "base_version", baseVersion)
+	return draft, nil
+}
+
+func (x *ModesRepository) GetModeDraft(logger *tracing.Logger, modeType string) (*entities.ModeDraft, error) {
+	defer tracing.ProfilePoint(logger, "Modes get draft completed", "repository.modes.get.draft", "mode_type", modeType)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	md := query.Q.ModeDraft
+	draft, err := md.WithContext(ctx).Preload(md.Creator).Where(md.ModeType.Eq(modeType)).First()
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrModeDraftNotFound
+		}
+		logger.E("Failed to get mode draft", tracing.InnerError, err)
+		return nil, err
+	}
+
+	return draft, nil
+}
+
+func (x *ModesRepository) DeleteModeDraft(logger *tracing.Logger, modeType string) error {
+	defer tracing.ProfilePoint(logger, "Modes delete draft completed", "repository.modes.delete.draft", "mode_type", modeType)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	md := query.Q.ModeDraft
+	result, err := md.WithContext(ctx).Where(md.ModeType.Eq(modeType)).Delete()
+	if err != nil {
+		logger.E("Failed to delete mode draft", tracing.InnerError, err)
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrModeDraftNotFound
+	}
+
+	logger.I("Deleted mode draft", "mode_type", modeType)
+	return nil
+}
+
+// DraftMode builds an unsaved copy of the latest mode version with the draft prompt, version 0 marks it as unpublished
+func (x *ModesRepository) DraftMode(logger *tracing.Logger, draft *entities.ModeDraft) (*entities.Mode, error) {
+	latest, err := x.GetModeByTypeIncludingDisabled(logger, draft.ModeType)
+	if err != nil {
+		return nil, err
+	}
+
+	config := x.ParseModeConfig(latest, logger)
+	config.Prompt = draft.Prompt
+
+	configJSON, err := x.SerializeModeConfig(config)
+	if err != nil {
+		logger.E("Failed to serialize draft mode config", tracing.InnerError, err)
+		return nil, err
+	}
+
+	mode := *latest
+	mode.Config = &configJSON
+	mode.Version = 0
+	return &mode, nil
+}
+
+// PublishModeDraft applies the draft prompt as a new version on top of the latest one and removes the draft,
+// other settings changed since the draft was made are kept
+func (x *ModesRepository) PublishModeDraft(logger *tracing.Logger, modeType string, editorEUID int64) (*entities.Mode, error) {
+	defer tracing.ProfilePoint(logger, "Modes publish draft completed", "repository.modes.publish.draft", "mode_type", modeType)()
+
+	draft, err := x.GetModeDraft(logger, modeType)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := x.GetModeByTypeIncludingDisabled(logger, modeType)
+	if err != nil {
+		return nil, err
+	}
+
+	config := x.ParseModeConfig(latest, logger)
+	config.Prompt = draft.Prompt
+
+	configJSON, err := x.SerializeModeConfig(config)
+	if err != nil {
+		logger.E("Failed to serialize mode config", tracing.InnerError, err)
+		return nil, err
+	}
+
+	mode, err := x.createModeVersion(logger, latest.ID, editorEUID, func(mode *entities.Mode) {
+		mode.Config = &configJSON
+	})
+	if err != nil {
+		logger.E("Failed to publish mode draft", tracing.InnerError, err)
+		return nil, err
+	}
+
+	if err := x.DeleteModeDraft(logger, modeType); err != nil && !errors.Is(err, ErrModeDraftNotFound) {
+		logger.W("Failed to remove published mode draft", tracing.InnerError, err)
+	}
+
+	logger.I("Published mode draft", "mode_type", modeType, "version", mode.Version, "base_version", draft.BaseVersion)
+	return mode, nil
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+	"ximanager/sources/persistence/entities"
+	"ximanager/sources/persistence/gormdao/query"
+	"ximanager/sources/platform"
+	"ximanager/sources/tracing"
+
+	"gorm.io/gorm"
+)
+
+type ModelPreferencesRepository struct{}
+
+func NewModelPreferencesRepository() *ModelPreferencesRepository {
+	return &ModelPreferencesRepository{}
+}
+
+// GetModel returns the model chosen by the user for the chat, or an empty string if there is no choice
+func (x *ModelPreferencesRepository) GetModel(logger *tracing.Logger, user *entities.User, chatID int64) (string, error) {
+	defer tracing.ProfilePoint(logger, "Model preferences get completed", "repository.model_preferences.get", "user_id", user.ID, "chat_id", chatID)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	mp := query.Q.ModelPreference
+	preference, err := mp.WithContext(ctx).Where(mp.UserID.Eq(user.ID), mp.ChatID.Eq(chatID)).First()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		logger.E("Failed to get model preference", tracing.InnerError, err)
+		return "", err
+	}
+
+	return preference.Model, nil
+}
+
+func (x *ModelPreferencesRepository) SetModel(logger *tracing.Logger, user *entities.User, chatID int64, model string) error {
+	defer tracing.ProfilePoint(logger, "Model preferences set completed", "repository.model_preferences.set", "user_id", user.ID, "chat_id", chatID, "model", model)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	mp := query.Q.ModelPreference
+	existing, err := mp.WithContext(ctx).Where(mp.UserID.Eq(user.ID), mp.ChatID.Eq(chatID)).First()
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		logger.E("Failed to check existing model preference", tracing.InnerError, err)
+		return err
+	}
+
+	if existing != nil {
+		existing.Model = model
+		existing.UpdatedAt = time.Now()
+		if err := mp.WithContext(ctx).Save(existing); err != nil {
+			logger.E("Failed to update model preference", tracing.InnerError, err)
+			return err
+		}
+		logger.I("Updated model preference", "model", model)
+		return nil
+	}
+
+	preference := &entities.ModelPreference{
+		UserID:    user.ID,
+		ChatID:    chatID,
+		Model:     model,
+		UpdatedAt: time.Now(),
+	}
+
+	if err := mp.WithContext(ctx).Create(preference); err != nil {
+		logger.E("Failed to create model preference", tracing.InnerError, err)
+		return err
+	}
+
+	logger.I("Created model preference", "model", model)
+	return nil
+}
+
+func (x *ModelPreferencesRepository) ResetModel(logger *tracing.Logger, user *entities.User, chatID int64) error {
+	defer tracing.ProfilePoint(logger, "Model preferences reset completed", "repository.model_preferences.reset", "user_id", user.ID, "chat_id", chatID)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	mp := query.Q.ModelPreference
+	if _, err := mp.WithContext(ctx).Where(mp.UserID.Eq(user.ID), mp.ChatID.Eq(chatID)).Delete(); err != nil {
+		logger.E("Failed to reset model preference", tracing.InnerError, err)
+		return err
+	}
+
+	logger.I("Reset model preference")
+	return nil
+}
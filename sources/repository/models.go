@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"ximanager/sources/persistence/entities"
+	"ximanager/sources/persistence/gormdao/query"
+	"ximanager/sources/platform"
+	"ximanager/sources/tracing"
+
+	"gorm.io/gorm/clause"
+)
+
+type ModelsRepository struct{}
+
+func NewModelsRepository() *ModelsRepository {
+	return &ModelsRepository{}
+}
+
+func (x *ModelsRepository) GetAllModels(logger *tracing.Logger) ([]*entities.CatalogModel, error) {
+	defer tracing.ProfilePoint(logger, "Models get all completed", "repository.models.get.all")()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	m := query.Q.CatalogModel
+	models, err := m.WithContext(ctx).Order(m.ID).Find()
+	if err != nil {
+		logger.E("Failed to get models", tracing.InnerError, err)
+		return nil, err
+	}
+
+	return models, nil
+}
+
+// ReplaceModels upserts the synced models and removes the ones the provider does not list anymore
+func (x *ModelsRepository) ReplaceModels(logger *tracing.Logger, models []*entities.CatalogModel, syncedAt time.Time) (int64, error) {
+	defer tracing.ProfilePoint(logger, "Models replace completed", "repository.models.replace", "count", len(models))()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 60*time.Second)
+	defer cancel()
+
+	var removed int64
+	err := query.Q.Transaction(func(tx *query.Query) error {
+		m := tx.CatalogModel
+		if err := m.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(models, 200); err != nil {
+			return err
+		}
+
+		result, err := m.WithContext(ctx).Where(m.SyncedAt.Lt(syncedAt)).Delete()
+		if err != nil {
+			return err
+		}
+
+		removed = result.RowsAffected
+		return nil
+	})
+
+	if err != nil {
+		logger.E("Failed to replace models", tracing.InnerError, err)
+		return 0, err
+	}
+
+	logger.I("Models replaced", "upserted", len(models), "removed", removed)
+	return removed, nil
+}
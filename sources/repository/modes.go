@@ -2,8 +2,11 @@ package repository
 
 import (
 	"context"
+	"database/sql/driver"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"slices"
 	"strings"
 	"time"
 	"ximanager/sources/persistence/entities"
@@ -23,12 +26,19 @@ var (
 	ErrModeInUse    = errors.New("mode is currently in use and cannot be deleted")
 	ErrModeNotFound = errors.New("mode not found")
 	ErrInvalidMode  = errors.New("invalid mode values")
+
+	ErrModeVersionNotFound = errors.New("mode version not found")
+	ErrModeVersionIsLatest = errors.New("mode version is already the latest")
+
+	ErrModeParamsOutOfRange = errors.New("mode params are out of range")
+	ErrModePolicyInvalid    = errors.New("mode policy is invalid")
 )
 
 type ModeConfig struct {
-	Prompt string    `json:"prompt"`
-	Params *AIParams `json:"params,omitempty"`
-	Final  bool      `json:"final,omitempty"`
+	Prompt string      `json:"prompt"`
+	Params *AIParams   `json:"params,omitempty"`
+	Final  bool        `json:"final,omitempty"`
+	Policy *ModePolicy `json:"policy,omitempty"`
 }
 
 type AIParams struct {
@@ -48,6 +58,99 @@ type AIParams struct {
 	Temperature *float32 `json:"temperature,omitempty"`
 }
 
+// Validate checks that every set parameter stays within the documented range
+func (p *AIParams) Validate() error {
+	checkFloat := func(name string, value *float32, low float32, high float32) error {
+		if value != nil && (*value < low || *value > high) {
+			return fmt.Errorf("%w: %s must be within %.1f-%.1f", ErrModeParamsOutOfRange, name, low, high)
+		}
+		return nil
+	}
+
+	if err := checkFloat("top_p", p.TopP, 0.1, 1.0); err != nil {
+		return err
+	}
+	if p.TopK != nil && (*p.TopK < 1 || *p.TopK > 100) {
+		return fmt.Errorf("%w: top_k must be within 1-100", ErrModeParamsOutOfRange)
+	}
+	if err := checkFloat("presence_penalty", p.PresencePenalty, 0, 2); err != nil {
+		return err
+	}
+	if err := checkFloat("frequency_penalty", p.FrequencyPenalty, 0, 2); err != nil {
+		return err
+	}
+	return checkFloat("temperature", p.Temperature, 0, 2)
+}
+
+const (
+	ModeToolWebSearch    = "web_search"
+	ModeToolTemporaryBan = "temporary_ban"
+
+	modePolicyMaxOutputTokens = 200_000
+)
+
+var ModeTools = []string{ModeToolWebSearch, ModeToolTemporaryBan}
+
+// ModePolicy limits what a mode may use, a nil policy or unset fields keep the default behaviour
+type ModePolicy struct {
+	// Разрешённые инструменты (web_search, temporary_ban), null - все инструменты, [] - ни одного
+	AllowedTools []string `json:"allowed_tools"`
+
+	// Модель режима, заменяет модель тарифа и выбор пользователя
+	Model string `json:"model,omitempty"`
+
+	// Минимальный тариф (bronze, silver, gold), модели которого использует режим
+	MinGrade string `json:"min_grade,omitempty"`
+
+	// Ограничение длины ответа в токенах, 0 - без ограничения
+	MaxOutputTokens int `json:"max_output_tokens,omitempty"`
+
+	// Запускать ли агента выбора усилий рассуждения
+	EffortAgent *bool `json:"effort_agent,omitempty"`
+
+	// Запускать ли агента определения длины ответа
+	ResponseLengthAgent *bool `json:"response_length_agent,omitempty"`
+
+	// Подмешивать ли персонализацию пользователя в промпт
+	Personalization *bool `json:"personalization,omitempty"`
+}
+
+func (p *ModePolicy) Validate() error {
+	for _, tool := range p.AllowedTools {
+		if !slices.Contains(ModeTools, tool) {
+			return fmt.Errorf("%w: unknown tool %q", ErrModePolicyInvalid, tool)
+		}
+	}
+
+	switch p.MinGrade {
+	case "", platform.GradeBronze, platform.GradeSilver, platform.GradeGold:
+	default:
+		return fmt.Errorf("%w: min_grade must be bronze, silver or gold", ErrModePolicyInvalid)
+	}
+
+	if p.MaxOutputTokens < 0 || p.MaxOutputTokens > modePolicyMaxOutputTokens {
+		return fmt.Errorf("%w: max_output_tokens must be within 0-%d", ErrModePolicyInvalid, modePolicyMaxOutputTokens)
+	}
+
+	return nil
+}
+
+func (p *ModePolicy) AllowsTool(tool string) bool {
+	return p == nil || p.AllowedTools == nil || slices.Contains(p.AllowedTools, tool)
+}
+
+func (p *ModePolicy) EffortAgentEnabled() bool {
+	return p == nil || platform.BoolValue(p.EffortAgent, true)
+}
+
+func (p *ModePolicy) ResponseLengthAgentEnabled() bool {
+	return p == nil || platform.BoolValue(p.ResponseLengthAgent, true)
+}
+
+func (p *ModePolicy) PersonalizationEnabled() bool {
+	return p == nil || platform.BoolValue(p.Personalization, true)
+}
+
 func DefaultModeConfig(prompt string) *ModeConfig {
 	if strings.TrimSpace(prompt) == "" {
 		prompt = fallbackPrompt
@@ -85,7 +188,7 @@ func (x *ModesRepository) GetAllModes(logger *tracing.Logger) ([]*entities.Mode,
 	// Get all modes, then filter to get latest by type
 	modes, err := q.Mode.
 		Where(query.Mode.IsEnabled.Is(true)).
-		Order(query.Mode.CreatedAt.Desc()).
+		Order(query.Mode.Version.Desc()).
 		Find()
 
 	if err != nil {
@@ -118,7 +221,7 @@ func (x *ModesRepository) GetAllModesIncludingDisabled(logger *tracing.Logger) (
 	q := query.Q.WithContext(ctx)
 
 	modes, err := q.Mode.
-		Order(query.Mode.CreatedAt.Desc()).
+		Order(query.Mode.Version.Desc()).
 		Find()
 
 	if err != nil {
@@ -161,7 +264,7 @@ func (x *ModesRepository) GetModesForUser(logger *tracing.Logger, user *entities
 	modes, err := q.Mode.Where(
 		query.Mode.IsEnabled.Is(true),
 		q.Mode.Or(query.Mode.Grade.In(allowedGrades...), query.Mode.Grade.IsNull()),
-	).Order(query.Mode.CreatedAt.Desc()).Find()
+	).Order(query.Mode.Version.Desc()).Find()
 
 	if err != nil {
 		logger.E("Failed to get modes for user", tracing.InnerError, err)
@@ -261,7 +364,7 @@ func (x *ModesRepository) getModeByType(logger *tracing.Logger, modeType string,
 		modeQuery = modeQuery.Where(query.Mode.IsEnabled.Is(true))
 	}
 
-	mode, err := modeQuery.Order(query.Mode.CreatedAt.Desc()).First()
+	mode, err := modeQuery.Order(query.Mode.Version.Desc()).First()
 
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -298,8 +401,9 @@ func (x *ModesRepository) GetModeByID(logger *tracing.Logger, modeID uuid.UUID)
 	return mode, nil
 }
 
-func (x *ModesRepository) SetModeForChat(logger *tracing.Logger, chatID int64, modeID uuid.UUID, userID uuid.UUID) error {
-	defer tracing.ProfilePoint(logger, "Modes set for chat completed", "repository.modes.set.for.chat", "chat_id", chatID, "mode_id", modeID)()
+// SetModeForChat selects the mode for the forum topic threadID, zero selects it for the whole chat
+func (x *ModesRepository) SetModeForChat(logger *tracing.Logger, chatID int64, threadID int, modeID uuid.UUID, userID uuid.UUID) error {
+	defer tracing.ProfilePoint(logger, "Modes set for chat completed", "repository.modes.set.for.chat", "chat_id", chatID, "thread_id", threadID, "mode_id", modeID)()
 	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
 	defer cancel()
 
@@ -307,6 +411,7 @@ func (x *ModesRepository) SetModeForChat(logger *tracing.Logger, chatID int64, m
 
 	selectedMode := &entities.SelectedMode{
 		ChatID:     chatID,
+		ThreadID:   threadID,
 		ModeID:     modeID,
 		SwitchedBy: userID,
 	}
@@ -317,30 +422,42 @@ func (x *ModesRepository) SetModeForChat(logger *tracing.Logger, chatID int64, m
 		return err
 	}
 
-	logger.I("Mode set for chat successfully", "chat_id", chatID, "mode_id", modeID)
+	logger.I("Mode set for chat successfully", "chat_id", chatID, "thread_id", threadID, "mode_id", modeID)
 	return nil
 }
 
-func (x *ModesRepository) GetCurrentModeForChat(logger *tracing.Logger, chatID int64) (*entities.Mode, error) {
-	defer tracing.ProfilePoint(logger, "Modes get current for chat completed", "repository.modes.get.current.for.chat", "chat_id", chatID)()
+// GetCurrentModeForChat resolves the mode of the forum topic threadID, a topic without its own selection follows the whole chat
+func (x *ModesRepository) GetCurrentModeForChat(logger *tracing.Logger, chatID int64, threadID int) (*entities.Mode, error) {
+	defer tracing.ProfilePoint(logger, "Modes get current for chat completed", "repository.modes.get.current.for.chat", "chat_id", chatID, "thread_id", threadID)()
 	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
 	defer cancel()
 
 	q := query.Q.WithContext(ctx)
 
 	selectedMode, err := q.SelectedMode.
-		Where(query.SelectedMode.ChatID.Eq(chatID)).
-		Order(query.SelectedMode.SwitchedAt.Desc()).
+		Where(
+			query.SelectedMode.ChatID.Eq(chatID),
+			query.SelectedMode.ThreadID.In(0, threadID),
+		).
+		Order(query.SelectedMode.ThreadID.Desc(), query.SelectedMode.SwitchedAt.Desc()).
 		First()
 
 	if err == nil {
+		// The selection points to the version that was current at switch time, the chat always gets the latest one
 		mode, err := q.Mode.
-			Where(
-				query.Mode.ID.Eq(selectedMode.ModeID),
-				query.Mode.IsEnabled.Is(true),
-			).
+			Where(query.Mode.ID.Eq(selectedMode.ModeID)).
 			First()
 
+		if err == nil {
+			mode, err = q.Mode.
+				Where(
+					query.Mode.Type.Eq(mode.Type),
+					query.Mode.IsEnabled.Is(true),
+				).
+				Order(query.Mode.Version.Desc()).
+				First()
+		}
+
 		if err == nil {
 			logger.I("Gathered selected mode", tracing.ModeId, mode.ID, tracing.ModeName, mode.Name)
 			return mode, nil
@@ -424,6 +541,12 @@ func (x *ModesRepository) CreateMode(logger *tracing.Logger, modeType string, na
 		gradePtr = &grade
 	}
 
+	version, err := x.nextModeVersion(ctx, modeType)
+	if err != nil {
+		logger.E("Failed to get next mode version", tracing.InnerError, err)
+		return nil, err
+	}
+
 	newMode := &entities.Mode{
 		Type:      modeType,
 		Name:      name,
@@ -431,6 +554,7 @@ func (x *ModesRepository) CreateMode(logger *tracing.Logger, modeType string, na
 		Grade:     gradePtr,
 		Final:     platform.BoolPtr(config.Final),
 		IsEnabled: platform.BoolPtr(true),
+		Version:   version,
 		CreatedBy: &user.ID,
 	}
 
@@ -440,10 +564,142 @@ func (x *ModesRepository) CreateMode(logger *tracing.Logger, modeType string, na
 		return nil, err
 	}
 
-	logger.I("Created new mode", tracing.ModeId, newMode.ID, tracing.ModeName, newMode.Name, "grade", grade)
+	logger.I("Created new mode", tracing.ModeId, newMode.ID, tracing.ModeName, newMode.Name, "grade", grade, "version", version)
 	return newMode, nil
 }
 
+func (x *ModesRepository) nextModeVersion(ctx context.Context, modeType string) (int, error) {
+	latest, err := query.Q.WithContext(ctx).Mode.
+		Where(query.Mode.Type.Eq(modeType)).
+		Order(query.Mode.Version.Desc()).
+		First()
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return latest.Version + 1, nil
+}
+
+// createModeVersion appends a new version of the mode type built from the latest one, edits never touch existing rows
+func (x *ModesRepository) createModeVersion(logger *tracing.Logger, modeID uuid.UUID, editorEUID int64, apply func(mode *entities.Mode)) (*entities.Mode, error) {
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 30*time.Second)
+	defer cancel()
+
+	editor, err := x.users.GetUserByEid(logger, editorEUID)
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := x.GetModeByID(logger, modeID)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := x.GetModeByTypeIncludingDisabled(logger, base.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	newMode := &entities.Mode{
+		Type:      latest.Type,
+		Name:      latest.Name,
+		Config:    latest.Config,
+		Grade:     latest.Grade,
+		Final:     latest.Final,
+		IsEnabled: latest.IsEnabled,
+		Version:   latest.Version + 1,
+		CreatedBy: &editor.ID,
+	}
+	apply(newMode)
+
+	if err := query.Q.WithContext(ctx).Mode.Create(newMode); err != nil {
+		logger.E("Failed to create mode version", tracing.InnerError, err)
+		return nil, err
+	}
+
+	logger.I("Created mode version", tracing.ModeId, newMode.ID, "mode_type", newMode.Type, "version", newMode.Version)
+	return newMode, nil
+}
+
+// GetModeVersions returns all versions of the mode type with their authors, newest first
+func (x *ModesRepository) GetModeVersions(logger *tracing.Logger, modeType string) ([]*entities.Mode, error) {
+	defer tracing.ProfilePoint(logger, "Modes get versions completed", "repository.modes.get.versions", "mode_type", modeType)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	q := query.Q.WithContext(ctx)
+
+	versions, err := q.Mode.
+		Preload(query.Mode.Creator).
+		Where(query.Mode.Type.Eq(modeType)).
+		Order(query.Mode.Version.Desc()).
+		Find()
+
+	if err != nil {
+		logger.E("Failed to get mode versions", tracing.InnerError, err)
+		return nil, err
+	}
+
+	if len(versions) == 0 {
+		return nil, ErrModeNotFound
+	}
+
+	return versions, nil
+}
+
+func (x *ModesRepository) GetModeVersion(logger *tracing.Logger, modeType string, version int) (*entities.Mode, error) {
+	defer tracing.ProfilePoint(logger, "Modes get version completed", "repository.modes.get.version", "mode_type", modeType, "version", version)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	q := query.Q.WithContext(ctx)
+
+	mode, err := q.Mode.
+		Preload(query.Mode.Creator).
+		Where(query.Mode.Type.Eq(modeType), query.Mode.Version.Eq(version)).
+		First()
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrModeVersionNotFound
+		}
+		logger.E("Failed to get mode version", tracing.InnerError, err)
+		return nil, err
+	}
+
+	return mode, nil
+}
+
+// RollbackMode restores the name, grade and config of an older version as a new latest version
+func (x *ModesRepository) RollbackMode(logger *tracing.Logger, modeType string, version int, editorEUID int64) (*entities.Mode, error) {
+	defer tracing.ProfilePoint(logger, "Modes rollback completed", "repository.modes.rollback", "mode_type", modeType, "version", version)()
+
+	target, err := x.GetModeVersion(logger, modeType, version)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := x.GetModeByTypeIncludingDisabled(logger, modeType)
+	if err != nil {
+		return nil, err
+	}
+
+	if latest.Version == target.Version {
+		return nil, ErrModeVersionIsLatest
+	}
+
+	return x.createModeVersion(logger, latest.ID, editorEUID, func(mode *entities.Mode) {
+		mode.Name = target.Name
+		mode.Config = target.Config
+		mode.Grade = target.Grade
+		mode.Final = target.Final
+	})
+}
+
 func (x *ModesRepository) UpdateMode(logger *tracing.Logger, mode *entities.Mode) (*entities.Mode, error) {
 	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
 	defer cancel()
@@ -465,6 +721,23 @@ func (x *ModesRepository) UpdateMode(logger *tracing.Logger, mode *entities.Mode
 	return mode, nil
 }
 
+// SetModeEnabled toggles every version of the mode type, so a disabled mode never falls back to an older version
+func (x *ModesRepository) SetModeEnabled(logger *tracing.Logger, modeType string, enabled bool) error {
+	defer tracing.ProfilePoint(logger, "Modes set enabled completed", "repository.modes.set.enabled", "mode_type", modeType, "enabled", enabled)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	q := query.Q.WithContext(ctx)
+
+	if _, err := q.Mode.Where(query.Mode.Type.Eq(modeType)).Update(query.Mode.IsEnabled, enabled); err != nil {
+		logger.E("Failed to set mode enabled", tracing.InnerError, err)
+		return err
+	}
+
+	logger.I("Mode enabled state updated", "mode_type", modeType, "enabled", enabled)
+	return nil
+}
+
 func (x *ModesRepository) DeleteMode(logger *tracing.Logger, mode *entities.Mode) error {
 	defer tracing.ProfilePoint(logger, "Modes delete mode completed", "repository.modes.delete.mode", "mode_id", mode.ID, "mode_name", mode.Name)()
 	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
@@ -472,8 +745,20 @@ func (x *ModesRepository) DeleteMode(logger *tracing.Logger, mode *entities.Mode
 
 	q := query.Q.WithContext(ctx)
 
+	// Deleting a mode removes all of its versions, otherwise an older version would take its place
+	versions, err := q.Mode.Where(query.Mode.Type.Eq(mode.Type)).Find()
+	if err != nil {
+		logger.E("Failed to get mode versions for deletion", tracing.InnerError, err)
+		return err
+	}
+
+	versionIDs := make([]driver.Valuer, 0, len(versions))
+	for _, version := range versions {
+		versionIDs = append(versionIDs, version.ID)
+	}
+
 	// Cascade delete: remove all selected_modes references first
-	deletedCount, err := q.SelectedMode.Where(query.SelectedMode.ModeID.Eq(mode.ID)).Delete()
+	deletedCount, err := q.SelectedMode.Where(query.SelectedMode.ModeID.In(versionIDs...)).Delete()
 	if err != nil {
 		logger.E("Failed to delete selected modes references", tracing.InnerError, err)
 		return err
@@ -483,12 +768,16 @@ func (x *ModesRepository) DeleteMode(logger *tracing.Logger, mode *entities.Mode
 	}
 
 	// Delete the mode itself
-	_, err = q.Mode.Where(query.Mode.ID.Eq(mode.ID)).Delete(&entities.Mode{})
+	_, err = q.Mode.Where(query.Mode.ID.In(versionIDs...)).Delete(&entities.Mode{})
 	if err != nil {
 		logger.E("Failed to delete mode", tracing.InnerError, err)
 		return err
 	}
 
+	if _, err := q.ModeDraft.Where(query.ModeDraft.ModeType.Eq(mode.Type)).Delete(); err != nil {
+		logger.W("Failed to delete mode draft", tracing.InnerError, err)
+	}
+
 	logger.I("Deleted mode", tracing.ModeId, mode.ID, tracing.ModeName, mode.Name)
 	return nil
 }
@@ -522,9 +811,9 @@ func (x *ModesRepository) SerializeModeConfig(config *ModeConfig) (string, error
 	return string(data), nil
 }
 
-func (x *ModesRepository) GetModeConfigForChat(logger *tracing.Logger, chatID int64) (*ModeConfig, error) {
-	defer tracing.ProfilePoint(logger, "Modes get mode config for chat completed", "repository.modes.get.mode.config.for.chat", "chat_id", chatID)()
-	mode, err := x.GetCurrentModeForChat(logger, chatID)
+func (x *ModesRepository) GetModeConfigForChat(logger *tracing.Logger, chatID int64, threadID int) (*ModeConfig, error) {
+	defer tracing.ProfilePoint(logger, "Modes get mode config for chat completed", "repository.modes.get.mode.config.for.chat", "chat_id", chatID, "thread_id", threadID)()
+	mode, err := x.GetCurrentModeForChat(logger, chatID, threadID)
 	if err != nil {
 		return nil, err
 	}
@@ -535,10 +824,8 @@ func (x *ModesRepository) GetModeConfigForChat(logger *tracing.Logger, chatID in
 	return x.ParseModeConfig(mode, logger), nil
 }
 
-func (x *ModesRepository) UpdateModeConfig(logger *tracing.Logger, modeID uuid.UUID, config *ModeConfig) error {
+func (x *ModesRepository) UpdateModeConfig(logger *tracing.Logger, modeID uuid.UUID, config *ModeConfig, editorEUID int64) error {
 	defer tracing.ProfilePoint(logger, "Modes update mode config completed", "repository.modes.update.mode.config", "mode_id", modeID)()
-	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 30*time.Second)
-	defer cancel()
 
 	configJSON, err := x.SerializeModeConfig(config)
 	if err != nil {
@@ -546,18 +833,20 @@ func (x *ModesRepository) UpdateModeConfig(logger *tracing.Logger, modeID uuid.U
 		return err
 	}
 
-	q := query.Q.WithContext(ctx)
-	_, err = q.Mode.Where(query.Mode.ID.Eq(modeID)).Updates(map[string]interface{}{"config": configJSON, "final": config.Final})
+	mode, err := x.createModeVersion(logger, modeID, editorEUID, func(mode *entities.Mode) {
+		mode.Config = &configJSON
+		mode.Final = platform.BoolPtr(config.Final)
+	})
 	if err != nil {
 		logger.E("Failed to update mode config", tracing.InnerError, err)
 		return err
 	}
 
-	logger.I("Mode config updated", "mode_id", modeID)
+	logger.I("Mode config updated", "mode_id", mode.ID, "version", mode.Version)
 	return nil
 }
 
-func (x *ModesRepository) UpdateModePrompt(logger *tracing.Logger, modeID uuid.UUID, prompt string) error {
+func (x *ModesRepository) UpdateModePrompt(logger *tracing.Logger, modeID uuid.UUID, prompt string, editorEUID int64) error {
 	defer tracing.ProfilePoint(logger, "Modes update mode prompt completed", "repository.modes.update.mode.prompt", "mode_id", modeID)()
 
 	mode, err := x.GetModeByID(logger, modeID)
@@ -568,7 +857,7 @@ func (x *ModesRepository) UpdateModePrompt(logger *tracing.Logger, modeID uuid.U
 	config := x.ParseModeConfig(mode, logger)
 	config.Prompt = prompt
 
-	return x.UpdateModeConfig(logger, modeID, config)
+	return x.UpdateModeConfig(logger, modeID, config, editorEUID)
 }
 
 // GetAISettingsForMode merges mode-specific settings with global settings
@@ -601,18 +890,17 @@ func (x *ModesRepository) GetAISettingsForMode(config *ModeConfig, globalSetting
 	return result
 }
 
-func (x *ModesRepository) UpdateModeName(logger *tracing.Logger, modeID uuid.UUID, name string) error {
+func (x *ModesRepository) UpdateModeName(logger *tracing.Logger, modeID uuid.UUID, name string, editorEUID int64) error {
 	defer tracing.ProfilePoint(logger, "Modes update mode name completed", "repository.modes.update.mode.name", "mode_id", modeID)()
-	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
-	defer cancel()
 
-	q := query.Q.WithContext(ctx)
-	_, err := q.Mode.Where(query.Mode.ID.Eq(modeID)).Updates(map[string]interface{}{"name": name})
+	mode, err := x.createModeVersion(logger, modeID, editorEUID, func(mode *entities.Mode) {
+		mode.Name = name
+	})
 	if err != nil {
 		logger.E("Failed to update mode name", tracing.InnerError, err)
 		return err
 	}
 
-	logger.I("Mode name updated", "mode_id", modeID, "new_name", name)
+	logger.I("Mode name updated", "mode_id", mode.ID, "new_name", name, "version", mode.Version)
 	return nil
 }
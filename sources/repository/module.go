@@ -17,5 +17,13 @@ var Module = fx.Module("repository",
 		NewBroadcastRepository,
 		NewFeedbacksRepository,
 		NewChatStateRepository,
+		NewModelPreferencesRepository,
+		NewModelsRepository,
+		NewChatVariablesRepository,
+		NewChatInstructionsRepository,
+		NewChatSettingsRepository,
+		NewChatMigrationRepository,
+		NewTopicsRepository,
+		NewExperimentsRepository,
 	),
 )
\ No newline at end of file
@@ -90,6 +90,8 @@ type TariffConfig struct {
 	SpendingMonthlyLimit string `json:"spending_monthly_limit"`
 
 	Price int `json:"price"`
+
+	ChatInstructionsMaxLength int `json:"chat_instructions_max_length"`
 }
 
 func (x *TariffsRepository) CreateTariff(log *tracing.Logger, key string, config *TariffConfig) (*entities.Tariff, error) {
@@ -113,7 +115,8 @@ func (x *TariffsRepository) CreateTariff(log *tracing.Logger, key string, config
 
 	// Validate non-negative limits
 	if config.RequestsPerDay < 0 || config.RequestsPerMonth < 0 ||
-		config.TokensPerDay < 0 || config.TokensPerMonth < 0 || config.Price < 0 {
+		config.TokensPerDay < 0 || config.TokensPerMonth < 0 || config.Price < 0 ||
+		config.ChatInstructionsMaxLength < 0 {
 		return nil, ErrTariffInvalidLimit
 	}
 
@@ -147,6 +150,8 @@ func (x *TariffsRepository) CreateTariff(log *tracing.Logger, key string, config
 		SpendingDailyLimit:   dailyLimit,
 		SpendingMonthlyLimit: monthlyLimit,
 		Price:                config.Price,
+
+		ChatInstructionsMaxLength: config.ChatInstructionsMaxLength,
 	}
 
 	t := query.Q.Tariff
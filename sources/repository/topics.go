@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"ximanager/sources/platform"
+	"ximanager/sources/tracing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// long enough for keyboards and replies of a usual conversation, older messages fall back to the whole chat
+	topicThreadTTL = 7 * 24 * time.Hour
+)
+
+// TopicsRepository remembers forum topics of messages. The Telegram library drops message_thread_id while decoding,
+// so threads are recorded from raw updates and resolved here by the chat and message ID.
+type TopicsRepository struct {
+	redis *redis.Client
+	log   *tracing.Logger
+}
+
+func NewTopicsRepository(redis *redis.Client, log *tracing.Logger) *TopicsRepository {
+	return &TopicsRepository{
+		redis: redis,
+		log:   log,
+	}
+}
+
+func (r *TopicsRepository) getThreadKey(chatID int64, messageID int) string {
+	return fmt.Sprintf("chat_topic:%d:%d", chatID, messageID)
+}
+
+func (r *TopicsRepository) RememberThread(logger *tracing.Logger, chatID int64, messageID int, threadID int) {
+	if threadID == 0 {
+		return
+	}
+
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 5*time.Second)
+	defer cancel()
+
+	key := r.getThreadKey(chatID, messageID)
+	if err := r.redis.Set(ctx, key, threadID, topicThreadTTL).Err(); err != nil {
+		logger.W("Failed to remember message topic", "key", key, tracing.InnerError, err)
+	}
+}
+
+// ThreadOf returns the forum topic the message was sent to, zero for private chats, plain groups and the General topic
+func (r *TopicsRepository) ThreadOf(logger *tracing.Logger, msg *tgbotapi.Message) int {
+	if msg == nil || msg.Chat == nil || !msg.Chat.IsSuperGroup() {
+		return 0
+	}
+
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 5*time.Second)
+	defer cancel()
+
+	key := r.getThreadKey(msg.Chat.ID, msg.MessageID)
+	threadID, err := r.redis.Get(ctx, key).Int()
+	if err == redis.Nil {
+		return 0
+	}
+	if err != nil {
+		logger.W("Failed to get message topic, using the whole chat", "key", key, tracing.InnerError, err)
+		return 0
+	}
+
+	return threadID
+}
+
+// Topic is the chat scope of the message, see platform.ChatTopic
+func (r *TopicsRepository) Topic(logger *tracing.Logger, msg *tgbotapi.Message) platform.ChatTopic {
+	return platform.ChatTopic{ChatID: platform.ChatID(msg.Chat.ID), ThreadID: r.ThreadOf(logger, msg)}
+}
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"time"
 	"ximanager/sources/persistence/entities"
 	"ximanager/sources/persistence/gormdao/query"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
+	"gorm.io/gorm"
 )
 
 type UsageRepository struct{}
@@ -18,7 +20,25 @@ func NewUsageRepository() *UsageRepository {
 	return &UsageRepository{}
 }
 
-func (x *UsageRepository) SaveUsage(logger *tracing.Logger, userID uuid.UUID, chatID int64, cost decimal.Decimal, tokens int, cacheReadTokens int, cacheWriteTokens int, anotherCost decimal.Decimal, anotherTokens int) error {
+// UsageSource tells where an answer was asked for, stats of chat answers should not mix with sandbox tests
+type UsageSource string
+
+const (
+	UsageSourceChat    UsageSource = "chat"
+	UsageSourceSandbox UsageSource = "sandbox"
+	UsageSourceInline  UsageSource = "inline"
+)
+
+// UsageResponse describes how the answer was produced, it lets feedback and experiments refer to the response
+type UsageResponse struct {
+	Model      string
+	Mode       *entities.Mode
+	Latency    time.Duration
+	Assignment *ExperimentAssignment
+	Source     UsageSource
+}
+
+func (x *UsageRepository) SaveUsage(logger *tracing.Logger, userID uuid.UUID, chatID int64, cost decimal.Decimal, tokens int, cacheReadTokens int, cacheWriteTokens int, anotherCost decimal.Decimal, anotherTokens int, incognito bool, response UsageResponse) (*entities.Usage, error) {
 	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
 	defer cancel()
 
@@ -29,6 +49,12 @@ func (x *UsageRepository) SaveUsage(logger *tracing.Logger, userID uuid.UUID, ch
 		Tokens:           tokens,
 		CacheReadTokens:  cacheReadTokens,
 		CacheWriteTokens: cacheWriteTokens,
+		IsIncognito:      incognito,
+		Source:           string(UsageSourceChat),
+	}
+
+	if response.Source != "" {
+		usage.Source = string(response.Source)
 	}
 
 	if !anotherCost.IsZero() {
@@ -39,17 +65,69 @@ func (x *UsageRepository) SaveUsage(logger *tracing.Logger, userID uuid.UUID, ch
 		usage.AnotherTokens = &anotherTokens
 	}
 
+	if response.Model != "" {
+		usage.Model = &response.Model
+	}
+
+	if response.Mode != nil {
+		usage.ModeType = &response.Mode.Type
+		usage.ModeVersion = &response.Mode.Version
+	}
+
+	if response.Latency > 0 {
+		latencyMs := response.Latency.Milliseconds()
+		usage.LatencyMs = &latencyMs
+	}
+
+	if response.Assignment != nil {
+		usage.ExperimentID = &response.Assignment.ExperimentID
+		usage.Variant = &response.Assignment.Variant.Key
+	}
+
 	q := query.Q.WithContext(ctx)
 	err := q.Usage.Create(usage)
 	if err != nil {
 		logger.E("Failed to save usage", tracing.InnerError, err)
+		return nil, err
+	}
+
+	logger.I("Usage saved", "usage_id", usage.ID, "cost", cost, "tokens", tokens, "cache_read", cacheReadTokens, "cache_write", cacheWriteTokens, "another_cost", anotherCost, "another_tokens", anotherTokens, "incognito", incognito, "source", usage.Source, "model", response.Model, "latency", response.Latency)
+	return usage, nil
+}
+
+// BindResponseMessage remembers the Telegram message that carries the answer, feedback buttons are attached to it
+func (x *UsageRepository) BindResponseMessage(logger *tracing.Logger, usageID uuid.UUID, messageID int) error {
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	u := query.Usage
+	if _, err := u.WithContext(ctx).Where(u.ID.Eq(usageID)).UpdateSimple(u.ResponseMessageID.Value(messageID)); err != nil {
+		logger.E("Failed to bind usage to response message", "usage_id", usageID, tracing.InnerError, err)
 		return err
 	}
 
-	logger.I("Usage saved", "cost", cost, "tokens", tokens, "cache_read", cacheReadTokens, "cache_write", cacheWriteTokens, "another_cost", anotherCost, "another_tokens", anotherTokens)
 	return nil
 }
 
+// GetUsageByResponse finds the usage row of the answer sent as the message, nil if the message is not bound
+func (x *UsageRepository) GetUsageByResponse(logger *tracing.Logger, chatID int64, messageID int) (*entities.Usage, error) {
+	defer tracing.ProfilePoint(logger, "Usage get by response completed", "repository.usage.get.by.response", "chat_id", chatID, "message_id", messageID)()
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
+	defer cancel()
+
+	u := query.Usage
+	usage, err := u.WithContext(ctx).Where(u.ChatID.Eq(chatID), u.ResponseMessageID.Eq(messageID)).First()
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		logger.E("Failed to get usage by response", tracing.InnerError, err)
+		return nil, err
+	}
+
+	return usage, nil
+}
+
 func (x *UsageRepository) GetTotalCost(logger *tracing.Logger) (decimal.Decimal, error) {
 	defer tracing.ProfilePoint(logger, "Usage get total cost completed", "repository.usage.get.total.cost")()
 	ctx, cancel := platform.ContextTimeoutVal(context.Background(), 20*time.Second)
@@ -13,13 +13,18 @@ const (
 )
 
 func NewBotAPI(log *tracing.Logger, config *configuration.Config) *tgbotapi.BotAPI {
-	bot, err := tgbotapi.NewBotAPI(config.Telegram.BotToken)
+	endpoint := config.Telegram.APIEndpoint
+	if endpoint == "" {
+		endpoint = DefaultAPIEndpoint
+	}
+
+	// the endpoint is set before the getMe call of the constructor, so a local fake Telegram server works from the start
+	bot, err := tgbotapi.NewBotAPIWithAPIEndpoint(config.Telegram.BotToken, endpoint)
 	if err != nil {
 		log.F("Failed to initialize telegram bot", tracing.InnerError, err)
 	}
 
 	if config.Telegram.APIEndpoint != "" {
-		bot.SetAPIEndpoint(config.Telegram.APIEndpoint)
 		log.I("Telegram bot initialized with custom API endpoint", "api_endpoint", config.Telegram.APIEndpoint)
 	} else {
 		log.I("Telegram bot initialized with default API endpoint")
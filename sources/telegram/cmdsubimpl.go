@@ -7,20 +7,53 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"regexp"
 	"runtime"
 	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"ximanager/sources/artificial"
 	"ximanager/sources/persistence/entities"
 	"ximanager/sources/platform"
 	"ximanager/sources/repository"
+	"ximanager/sources/texting/diff"
 	"ximanager/sources/texting/format"
+	"ximanager/sources/texting/indices"
+	"ximanager/sources/texting/transform"
 	"ximanager/sources/tracing"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/google/uuid"
 )
 
+const (
+	contextImportMaxFileSize = 2 * 1024 * 1024
+	contextViewPageSize      = 8
+	contextViewPreviewLength = 160
+
+	modeHistoryLimit         = 20
+	modeHistoryButtonsPerRow = 5
+	modeHistoryDiffContext   = 2
+	modeHistoryDiffMaxLength = 3000
+	modeImportMaxFileSize    = 256 * 1024
+	modePreviewMaxLength     = 3500
+
+	chatVariableMaxValueLength = 1000
+
+	thisInstructionsPreviewLength = 300
+
+	experimentSignificanceLevel = 0.05
+
+	feedbackReportDefaultDays    = 30
+	feedbackReportMaxDays        = 365
+	feedbackReportGroupLimit     = 10
+	feedbackCommentPreviewLength = 200
+)
+
+var chatVariableNamePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,49}$`)
+
 // =========================  /xi command handlers  =========================
 
 func (x *TelegramHandler) XiCommandText(log *tracing.Logger, msg *tgbotapi.Message) {
@@ -32,12 +65,12 @@ func (x *TelegramHandler) XiCommandText(log *tracing.Logger, msg *tgbotapi.Messa
 		return
 	}
 
-	x.diplomat.StartTyping(msg.Chat.ID)
-	defer x.diplomat.StopTyping(msg.Chat.ID)
+	x.diplomat.StartTyping(msg)
+	defer x.diplomat.StopTyping(msg)
 
 	persona := msg.From.FirstName + " " + msg.From.LastName + " (@" + msg.From.UserName + ")"
 
-	result, err := x.dialer.Dial(log, msg, req, "", persona, true)
+	result, err := x.dialer.Dial(log, msg, req, artificial.DialOptions{Persona: persona, Stackful: true, Incognito: x.IsIncognitoRequest(msg)})
 	if err != nil {
 		errorMsg := x.localization.LocalizeBy(msg, "MsgErrorResponse")
 		x.diplomat.Reply(log, msg, errorMsg)
@@ -55,26 +88,95 @@ func (x *TelegramHandler) XiCommandText(log *tracing.Logger, msg *tgbotapi.Messa
 		x.notifySummarization(log, msg)
 	}
 
-	x.diplomat.Reply(log, msg, x.personality.Xiify(msg, result.Text))
+	x.replyDialed(log, msg, result, x.personality.Xiify(msg, result.Text))
+}
+
+// XiCommandEdited regenerates the answer to an edited request, the old turns are rewound and the original reply is edited
+func (x *TelegramHandler) XiCommandEdited(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, replyIDs []int) {
+	defer tracing.ProfilePoint(log, "Xi command edited completed", "telegram.command.xi.edited", "chat_id", msg.Chat.ID)()
+
+	if !x.throttler.IsAllowed(msg.From.ID) {
+		log.W("User exceeded rate throttler, edited message is not re-answered")
+		return
+	}
+
+	if _, _, err := x.bans.GetActiveBanWithExpiry(log, user.ID); err == nil {
+		log.W("User is banned, edited message is not re-answered", "user_id", user.ID)
+		return
+	}
+
+	if _, ok := x.DryRunRequest(msg); ok {
+		log.I("Edited message became a dry run request, ignoring")
+		return
+	}
+
+	req := x.GetRequestText(msg)
+	if req == "" {
+		return
+	}
+
+	x.diplomat.StartTyping(msg)
+	defer x.diplomat.StopTyping(msg)
+
+	// the old turn is put back unless the edited one is stored, a failed or limited answer must not cost the history
+	restore, err := x.contextManager.Rewind(log, x.contextManager.Chat(log, msg), msg.MessageID)
+	if err != nil {
+		log.W("Edited message is answered without rewinding context", tracing.InnerError, err)
+	}
+
+	persona := msg.From.FirstName + " " + msg.From.LastName + " (@" + msg.From.UserName + ")"
+
+	result, err := x.dialer.Dial(log, msg, req, artificial.DialOptions{Persona: persona, Stackful: true, Incognito: x.IsIncognitoRequest(msg)})
+	if err != nil {
+		restore()
+		x.diplomat.EditTracked(log, msg, replyIDs, x.localization.LocalizeBy(msg, "MsgErrorResponse"))
+		return
+	}
+
+	if !result.IsStored {
+		restore()
+	}
+
+	// the old answer is back in the history (e.g. a limit notice came instead of an answer), so it is kept
+	// and the notice is sent apart
+	kept := !result.IsStored && !result.IsStateless
+
+	if strings.TrimSpace(result.Text) == "" {
+		log.W("Empty response from AI orchestrator", "response", result.Text)
+		if kept {
+			x.diplomat.Reply(log, msg, x.localization.LocalizeBy(msg, "MsgErrorResponse"))
+			return
+		}
+		x.diplomat.EditTracked(log, msg, replyIDs, x.localization.LocalizeBy(msg, "MsgErrorResponse"))
+		return
+	}
+
+	if kept {
+		x.diplomat.Reply(log, msg, x.personality.Xiify(msg, result.Text))
+		return
+	}
+
+	if result.IsSummarized {
+		x.notifySummarization(log, msg)
+	}
+
+	x.editDialed(log, msg, replyIDs, result, x.personality.Xiify(msg, result.Text))
 }
 
 func (x *TelegramHandler) XiCommandPhoto(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
 	defer tracing.ProfilePoint(log, "Xi command photo completed", "telegram.command.xi.photo", "chat_id", msg.Chat.ID)()
-	x.diplomat.StartTyping(msg.Chat.ID)
-	defer x.diplomat.StopTyping(msg.Chat.ID)
+	x.diplomat.StartTyping(msg)
+	defer x.diplomat.StopTyping(msg)
 
 	photo := msg.Photo[len(msg.Photo)-1]
 
-	fileConfig := tgbotapi.FileConfig{FileID: photo.FileID}
-	file, err := x.diplomat.bot.GetFile(fileConfig)
+	iurl, err := x.diplomat.FileURL(photo.FileID)
 	if err != nil {
 		log.E("Error getting file", tracing.InnerError, err)
 		x.diplomat.Reply(log, msg, x.localization.LocalizeBy(msg, "MsgErrorResponse"))
 		return
 	}
 
-	iurl := fmt.Sprintf(GetFileAPIEndpoint(x.diplomat.config), x.diplomat.bot.Token, file.FilePath)
-
 	req := ""
 
 	if msg.IsCommand() {
@@ -87,7 +189,7 @@ func (x *TelegramHandler) XiCommandPhoto(log *tracing.Logger, user *entities.Use
 
 	persona := msg.From.FirstName + " " + msg.From.LastName + " (@" + msg.From.UserName + ")"
 
-	result, err := x.dialer.Dial(log, msg, req, iurl, persona, true)
+	result, err := x.dialer.Dial(log, msg, req, artificial.DialOptions{ImageURL: iurl, Persona: persona, Stackful: true, Incognito: x.IsIncognitoRequest(msg)})
 	if err != nil {
 		x.diplomat.Reply(log, msg, x.localization.LocalizeBy(msg, "MsgErrorResponse"))
 		return
@@ -97,31 +199,28 @@ func (x *TelegramHandler) XiCommandPhoto(log *tracing.Logger, user *entities.Use
 		x.notifySummarization(log, msg)
 	}
 
-	x.diplomat.Reply(log, msg, x.personality.Xiify(msg, result.Text))
+	x.replyDialed(log, msg, result, x.personality.Xiify(msg, result.Text))
 }
 
 func (x *TelegramHandler) XiCommandPhotoFromReply(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, replyMsg *tgbotapi.Message) {
 	defer tracing.ProfilePoint(log, "Xi command photo from reply completed", "telegram.command.xi.photo_reply", "chat_id", msg.Chat.ID)()
-	x.diplomat.StartTyping(msg.Chat.ID)
-	defer x.diplomat.StopTyping(msg.Chat.ID)
+	x.diplomat.StartTyping(msg)
+	defer x.diplomat.StopTyping(msg)
 
 	photo := replyMsg.Photo[len(replyMsg.Photo)-1]
 
-	fileConfig := tgbotapi.FileConfig{FileID: photo.FileID}
-	file, err := x.diplomat.bot.GetFile(fileConfig)
+	iurl, err := x.diplomat.FileURL(photo.FileID)
 	if err != nil {
 		log.E("Error getting file", tracing.InnerError, err)
 		x.diplomat.Reply(log, msg, x.localization.LocalizeBy(msg, "MsgErrorResponse"))
 		return
 	}
 
-	iurl := fmt.Sprintf(GetFileAPIEndpoint(x.diplomat.config), x.diplomat.bot.Token, file.FilePath)
-
 	req := strings.TrimSpace(msg.CommandArguments())
 
 	persona := msg.From.FirstName + " " + msg.From.LastName + " (@" + msg.From.UserName + ")"
 
-	result, err := x.dialer.Dial(log, msg, req, iurl, persona, true)
+	result, err := x.dialer.Dial(log, msg, req, artificial.DialOptions{ImageURL: iurl, Persona: persona, Stackful: true, Incognito: x.IsIncognitoRequest(msg)})
 	if err != nil {
 		x.diplomat.Reply(log, msg, x.localization.LocalizeBy(msg, "MsgErrorResponse"))
 		return
@@ -131,13 +230,13 @@ func (x *TelegramHandler) XiCommandPhotoFromReply(log *tracing.Logger, user *ent
 		x.notifySummarization(log, msg)
 	}
 
-	x.diplomat.Reply(log, msg, x.personality.Xiify(msg, result.Text))
+	x.replyDialed(log, msg, result, x.personality.Xiify(msg, result.Text))
 }
 
 func (x *TelegramHandler) XiCommandAudio(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, replyMsg *tgbotapi.Message) {
 	defer tracing.ProfilePoint(log, "Xi command audio completed", "telegram.command.xi.audio", "chat_id", msg.Chat.ID)()
-	x.diplomat.StartTyping(msg.Chat.ID)
-	defer x.diplomat.StopTyping(msg.Chat.ID)
+	x.diplomat.StartTyping(msg)
+	defer x.diplomat.StopTyping(msg)
 
 	var fileID string
 	var fileExt string
@@ -160,16 +259,13 @@ func (x *TelegramHandler) XiCommandAudio(log *tracing.Logger, user *entities.Use
 		return
 	}
 
-	fileConfig := tgbotapi.FileConfig{FileID: fileID}
-	file, err := x.diplomat.bot.GetFile(fileConfig)
+	fileURL, err := x.diplomat.FileURL(fileID)
 	if err != nil {
 		log.E("Error getting file", tracing.InnerError, err)
 		x.diplomat.Reply(log, msg, x.localization.LocalizeBy(msg, "MsgAudioError"))
 		return
 	}
 
-	fileURL := fmt.Sprintf(GetFileAPIEndpoint(x.diplomat.config), x.diplomat.bot.Token, file.FilePath)
-
 	tempFile, err := x.downloadAudioFile(log, fileURL, fileExt)
 	if err != nil {
 		log.E("Error downloading audio file", tracing.InnerError, err)
@@ -189,7 +285,7 @@ func (x *TelegramHandler) XiCommandAudio(log *tracing.Logger, user *entities.Use
 
 	if userPrompt != "" {
 		persona := msg.From.FirstName + " " + msg.From.LastName + " (@" + msg.From.UserName + ")"
-		result, err := x.dialer.Dial(log, msg, transcriptedText, "", persona, false)
+		result, err := x.dialer.Dial(log, msg, transcriptedText, artificial.DialOptions{Persona: persona, Incognito: x.IsIncognitoRequest(msg)})
 		if err != nil {
 			log.E("Error processing with lightweight model", tracing.InnerError, err)
 			x.diplomat.Reply(log, msg, x.localization.LocalizeBy(msg, "MsgAudioError"))
@@ -198,7 +294,7 @@ func (x *TelegramHandler) XiCommandAudio(log *tracing.Logger, user *entities.Use
 		if result.IsSummarized {
 			x.notifySummarization(log, msg)
 		}
-		x.diplomat.Reply(log, msg, x.personality.XiifyAudio(msg, result.Text))
+		x.replyDialed(log, msg, result, x.personality.XiifyAudio(msg, result.Text))
 	} else {
 		x.diplomat.ReplyAudio(log, msg, x.personality.XiifyAudio(msg, transcriptedText))
 	}
@@ -247,7 +343,7 @@ func (x *TelegramHandler) ModeCommandShowList(log *tracing.Logger, user *entitie
 		return
 	}
 
-	currentMode, _ := x.modes.GetCurrentModeForChat(log, msg.Chat.ID)
+	currentMode, _ := x.modes.GetCurrentModeForChat(log, msg.Chat.ID, x.topics.ThreadOf(log, msg))
 
 	// Build message
 	message := x.localization.LocalizeBy(msg, "MsgModeListTitle")
@@ -337,6 +433,10 @@ func (x *TelegramHandler) ModeCommandEditStart(log *tracing.Logger, user *entiti
 		x.localization.LocalizeBy(msg, "MsgModeEditConfigBtn"),
 		"mode_edit_config_"+mode.Type,
 	)
+	policyBtn := tgbotapi.NewInlineKeyboardButtonData(
+		x.localization.LocalizeBy(msg, "MsgModeEditPolicyBtn"),
+		"mode_edit_policy_"+mode.Type,
+	)
 
 	var toggleBtn tgbotapi.InlineKeyboardButton
 	if platform.BoolValue(mode.IsEnabled, true) {
@@ -359,7 +459,7 @@ func (x *TelegramHandler) ModeCommandEditStart(log *tracing.Logger, user *entiti
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(
 		tgbotapi.NewInlineKeyboardRow(nameBtn, promptBtn),
 		tgbotapi.NewInlineKeyboardRow(configBtn, toggleBtn),
-		tgbotapi.NewInlineKeyboardRow(deleteBtn),
+		tgbotapi.NewInlineKeyboardRow(policyBtn, deleteBtn),
 	)
 
 	x.diplomat.ReplyWithKeyboard(log, msg, x.personality.XiifyManual(msg, editTitle), keyboard)
@@ -423,6 +523,9 @@ func (x *TelegramHandler) handleChatStateMessage(log *tracing.Logger, user *enti
 	case repository.ChatStateAwaitingConfig:
 		x.handleConfigInput(log, user, msg, state)
 		return true
+	case repository.ChatStateAwaitingPolicy:
+		x.handlePolicyInput(log, user, msg, state)
+		return true
 	case repository.ChatStateAwaitingNewName:
 		x.handleNewNameInput(log, user, msg, state)
 		return true
@@ -438,6 +541,24 @@ func (x *TelegramHandler) handleChatStateMessage(log *tracing.Logger, user *enti
 	case repository.ChatStateAwaitingTariffConfig:
 		x.handleTariffConfigInput(log, user, msg, state)
 		return true
+	case repository.ChatStateAwaitingContextImport:
+		x.handleContextImportInput(log, user, msg)
+		return true
+	case repository.ChatStateAwaitingModeImport:
+		x.handleModeImportInput(log, user, msg)
+		return true
+	case repository.ChatStateAwaitingFeedbackComment:
+		x.handleFeedbackCommentInput(log, user, msg, state)
+		return true
+	case repository.ChatStateAwaitingDraftTest:
+		x.handleDraftTestInput(log, user, msg, state, false)
+		return true
+	case repository.ChatStateAwaitingDraftCompare:
+		x.handleDraftTestInput(log, user, msg, state, true)
+		return true
+	case repository.ChatStateAwaitingChatInstructions:
+		x.handleChatInstructionsInput(log, user, msg)
+		return true
 	}
 
 	return false
@@ -537,7 +658,7 @@ func (x *TelegramHandler) handlePromptInput(log *tracing.Logger, user *entities.
 		return // Too short, ignore
 	}
 
-	// If editing existing mode
+	// If editing existing mode, the new prompt lands as a draft until it is published
 	if state.ModeID != "" {
 		modeID, err := uuid.Parse(state.ModeID)
 		if err != nil {
@@ -545,30 +666,47 @@ func (x *TelegramHandler) handlePromptInput(log *tracing.Logger, user *entities.
 			return
 		}
 
-		err = x.modes.UpdateModePrompt(log, modeID, prompt)
+		existing, err := x.modes.GetModeByID(log, modeID)
 		if err != nil {
 			errorMsg := x.localization.LocalizeBy(msg, "MsgModeErrorEdit")
-		x.diplomat.Reply(log, msg, errorMsg)
-		return
-	}
+			x.diplomat.Reply(log, msg, errorMsg)
+			return
+		}
+
+		live, err := x.modes.GetModeByTypeIncludingDisabled(log, existing.Type)
+		if err != nil {
+			errorMsg := x.localization.LocalizeBy(msg, "MsgModeErrorEdit")
+			x.diplomat.Reply(log, msg, errorMsg)
+			return
+		}
+
+		if !x.validateModePrompt(log, msg, platform.StringValue(live.Grade, ""), prompt) {
+			return
+		}
 
-		mode, _ := x.modes.GetModeByID(log, modeID)
-		modeName := state.ModeName
-		if mode != nil {
-			modeName = mode.Name
+		draft, err := x.modes.SaveModeDraft(log, live.Type, prompt, live.Version, msg.From.ID)
+		if err != nil {
+			errorMsg := x.localization.LocalizeBy(msg, "MsgModeErrorEdit")
+			x.diplomat.Reply(log, msg, errorMsg)
+			return
 		}
 
 		// Clear state
 		x.chatState.ClearState(log, msg.Chat.ID, msg.From.ID)
 
-		successMsg := x.localization.LocalizeByTd(msg, "MsgModePromptUpdated", map[string]interface{}{
-			"Name": modeName,
+		savedMsg := x.localization.LocalizeByTd(msg, "MsgModeDraftSaved", map[string]interface{}{
+			"Name": live.Name,
 		})
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, successMsg))
+		card := x.modeDraftCard(log, msg, draft, live)
+		x.diplomat.ReplyWithKeyboard(log, msg, x.personality.XiifyManual(msg, savedMsg+card), x.modeDraftKeyboard(msg, live.Type))
 		return
 	}
 
 	// Creating new mode
+	if !x.validateModePrompt(log, msg, state.ModeGrade, prompt) {
+		return
+	}
+
 	config := repository.DefaultModeConfig(prompt)
 
 	newMode, err := x.modes.CreateMode(log, state.ModeType, state.ModeName, config, state.ModeGrade, msg.From.ID)
@@ -589,6 +727,35 @@ func (x *TelegramHandler) handlePromptInput(log *tracing.Logger, user *entities.
 	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, successMsg))
 }
 
+// validateModePrompt replies with an error and returns false if the prompt is a broken template or leaves no room for history in the grade models
+func (x *TelegramHandler) validateModePrompt(log *tracing.Logger, msg *tgbotapi.Message, grade string, prompt string) bool {
+	if err := artificial.ValidatePromptTemplate(prompt); err != nil {
+		log.W("Invalid mode prompt template", tracing.InnerError, err)
+		errorMsg := x.localization.LocalizeByTd(msg, "MsgModePromptTemplateInvalid", map[string]interface{}{
+			"Error": err.Error(),
+		})
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return false
+	}
+
+	userGrade := platform.UserGrade(grade)
+	if grade == "" {
+		userGrade = platform.GradeBronze
+	}
+
+	tokens, limit, err := x.catalog.ValidatePrompt(log, userGrade, prompt)
+	if err == nil {
+		return true
+	}
+
+	errorMsg := x.localization.LocalizeByTd(msg, "MsgModePromptTooLarge", map[string]interface{}{
+		"Tokens": format.Numberify(int64(tokens)),
+		"Limit":  format.Numberify(int64(limit)),
+	})
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+	return false
+}
+
 func (x *TelegramHandler) handleConfigInput(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, state *repository.ChatStateData) {
 	configJSON := strings.TrimSpace(msg.Text)
 
@@ -621,7 +788,7 @@ func (x *TelegramHandler) handleConfigInput(log *tracing.Logger, user *entities.
 	config := x.modes.ParseModeConfig(mode, log)
 	config.Params = &params
 
-	err = x.modes.UpdateModeConfig(log, modeID, config)
+	err = x.modes.UpdateModeConfig(log, modeID, config, msg.From.ID)
 	if err != nil {
 		errorMsg := x.localization.LocalizeBy(msg, "MsgModeErrorEdit")
 		x.diplomat.Reply(log, msg, errorMsg)
@@ -637,6 +804,67 @@ func (x *TelegramHandler) handleConfigInput(log *tracing.Logger, user *entities.
 	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, successMsg))
 }
 
+func (x *TelegramHandler) handlePolicyInput(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, state *repository.ChatStateData) {
+	if state.ModeID == "" {
+		return
+	}
+
+	modeID, err := uuid.Parse(state.ModeID)
+	if err != nil {
+		log.E("Failed to parse mode ID", tracing.InnerError, err)
+		return
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(strings.TrimSpace(msg.Text)))
+	decoder.DisallowUnknownFields()
+
+	var policy repository.ModePolicy
+	if err := decoder.Decode(&policy); err != nil {
+		errorMsg := x.localization.LocalizeBy(msg, "MsgModeErrorPolicyParse")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	if err := policy.Validate(); err != nil {
+		errorMsg := x.localization.LocalizeByTd(msg, "MsgModePolicyInvalid", map[string]interface{}{
+			"Error": err.Error(),
+		})
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	if policy.Model != "" && x.catalog.Validate(policy.Model, false) != nil {
+		errorMsg := x.localization.LocalizeByTd(msg, "MsgModePolicyUnknownModel", map[string]interface{}{
+			"Model": policy.Model,
+		})
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	mode, err := x.modes.GetModeByID(log, modeID)
+	if err != nil {
+		errorMsg := x.localization.LocalizeBy(msg, "MsgModeErrorEdit")
+		x.diplomat.Reply(log, msg, errorMsg)
+		return
+	}
+
+	config := x.modes.ParseModeConfig(mode, log)
+	config.Policy = &policy
+
+	if err := x.modes.UpdateModeConfig(log, modeID, config, msg.From.ID); err != nil {
+		errorMsg := x.localization.LocalizeBy(msg, "MsgModeErrorEdit")
+		x.diplomat.Reply(log, msg, errorMsg)
+		return
+	}
+
+	x.chatState.ClearState(log, msg.Chat.ID, msg.From.ID)
+
+	successMsg := x.localization.LocalizeByTd(msg, "MsgModePolicyUpdated", map[string]interface{}{
+		"Name": mode.Name,
+	})
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, successMsg))
+}
+
 func (x *TelegramHandler) handleNewNameInput(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, state *repository.ChatStateData) {
 	newName := strings.TrimSpace(msg.Text)
 
@@ -664,7 +892,7 @@ func (x *TelegramHandler) handleNewNameInput(log *tracing.Logger, user *entities
 	}
 
 	oldName := mode.Name
-	err = x.modes.UpdateModeName(log, modeID, newName)
+	err = x.modes.UpdateModeName(log, modeID, newName, msg.From.ID)
 	if err != nil {
 		errorMsg := x.localization.LocalizeBy(msg, "MsgModeErrorEdit")
 		x.diplomat.Reply(log, msg, errorMsg)
@@ -689,7 +917,7 @@ func (x *TelegramHandler) handleModeSelectCallback(log *tracing.Logger, query *t
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeByTd(query.Message, "MsgModeNotFound", map[string]interface{}{
 			"Type": modeType,
 		}))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
@@ -697,7 +925,7 @@ func (x *TelegramHandler) handleModeSelectCallback(log *tracing.Logger, query *t
 	available, _, _, err := x.modes.GetAllModesWithAvailability(log, user)
 	if err != nil {
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, "MsgModeErrorSwitching"))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
@@ -715,23 +943,23 @@ func (x *TelegramHandler) handleModeSelectCallback(log *tracing.Logger, query *t
 			"Name":          mode.Name,
 			"RequiredGrade": gradeName,
 		}))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
 	// Check if already selected
-	currentMode, _ := x.modes.GetCurrentModeForChat(log, query.Message.Chat.ID)
+	currentMode, _ := x.modes.GetCurrentModeForChat(log, query.Message.Chat.ID, x.topics.ThreadOf(log, query.Message))
 	if currentMode != nil && currentMode.Type == modeType {
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, "MsgModeAlreadySelected"))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
 	// Set the mode
-	err = x.modes.SetModeForChat(log, query.Message.Chat.ID, mode.ID, user.ID)
+	err = x.modes.SetModeForChat(log, query.Message.Chat.ID, x.topics.ThreadOf(log, query.Message), mode.ID, user.ID)
 	if err != nil {
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, "MsgModeErrorSwitching"))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
@@ -739,21 +967,21 @@ func (x *TelegramHandler) handleModeSelectCallback(log *tracing.Logger, query *t
 	callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeByTd(query.Message, "MsgModeChangedCallback", map[string]interface{}{
 		"Name": mode.Name,
 	}))
-	x.diplomat.bot.Request(callback)
+	x.diplomat.Request(log, callback)
 
 	// Send message
 	successMsg := x.localization.LocalizeByTd(query.Message, "MsgModeChanged", map[string]interface{}{
 		"Name": mode.Name,
 		"Type": mode.Type,
 	})
-	x.diplomat.SendMessage(log, query.Message.Chat.ID, successMsg)
+	x.diplomat.SendMessage(log, query.Message, successMsg)
 }
 
 func (x *TelegramHandler) handleModeEditCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, user *entities.User) {
 	// Check permissions
 	if !x.rights.IsUserHasRight(log, user, "edit_mode") {
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, "MsgModeModifyNoAccess"))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
@@ -771,7 +999,7 @@ func (x *TelegramHandler) handleModeEditCallback(log *tracing.Logger, query *tgb
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeByTd(query.Message, "MsgModeNotFound", map[string]interface{}{
 			"Type": modeType,
 		}))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
@@ -785,12 +1013,12 @@ func (x *TelegramHandler) handleModeEditCallback(log *tracing.Logger, query *tgb
 		}
 
 		callback := tgbotapi.NewCallback(query.ID, "")
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 
 		nameMsg := x.localization.LocalizeByTd(query.Message, "MsgModeAwaitingName", map[string]interface{}{
 		"Name": mode.Name,
 		})
-		x.diplomat.SendMessage(log, query.Message.Chat.ID, x.personality.XiifyManualPlain(nameMsg))
+		x.diplomat.SendMessage(log, query.Message, x.personality.XiifyManualPlain(nameMsg))
 
 	case "prompt":
 		// Start prompt edit wizard
@@ -801,12 +1029,12 @@ func (x *TelegramHandler) handleModeEditCallback(log *tracing.Logger, query *tgb
 		}
 
 		callback := tgbotapi.NewCallback(query.ID, "")
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 
 		promptMsg := x.localization.LocalizeByTd(query.Message, "MsgModeAwaitingPrompt", map[string]interface{}{
 			"Name": mode.Name,
 		})
-		x.diplomat.SendMessage(log, query.Message.Chat.ID, x.personality.XiifyManualPlain(promptMsg))
+		x.diplomat.SendMessage(log, query.Message, x.personality.XiifyManualPlain(promptMsg))
 
 	case "config":
 		// Start config edit wizard
@@ -817,19 +1045,34 @@ func (x *TelegramHandler) handleModeEditCallback(log *tracing.Logger, query *tgb
 	}
 
 		callback := tgbotapi.NewCallback(query.ID, "")
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 
 		configMsg := x.localization.LocalizeByTd(query.Message, "MsgModeAwaitingConfig", map[string]interface{}{
 			"Name": mode.Name,
 		})
-		x.diplomat.SendMessage(log, query.Message.Chat.ID, x.personality.XiifyManualPlain(configMsg))
+		x.diplomat.SendMessage(log, query.Message, x.personality.XiifyManualPlain(configMsg))
+
+	case "policy":
+		err = x.chatState.InitPolicyEdit(log, query.Message.Chat.ID, query.From.ID, mode.ID)
+		if err != nil {
+			log.E("Failed to init policy edit state", tracing.InnerError, err)
+			return
+		}
+
+		callback := tgbotapi.NewCallback(query.ID, "")
+		x.diplomat.Request(log, callback)
+
+		policyMsg := x.localization.LocalizeByTd(query.Message, "MsgModeAwaitingPolicy", map[string]interface{}{
+			"Name":  mode.Name,
+			"Tools": strings.Join(repository.ModeTools, ", "),
+		})
+		x.diplomat.SendMessage(log, query.Message, x.personality.XiifyManualPlain(policyMsg))
 
 	case "disable":
-		mode.IsEnabled = platform.BoolPtr(false)
-		_, err = x.modes.UpdateMode(log, mode)
+		err = x.modes.SetModeEnabled(log, mode.Type, false)
 	if err != nil {
 			callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, "MsgModeErrorDisable"))
-			x.diplomat.bot.Request(callback)
+			x.diplomat.Request(log, callback)
 		return
 	}
 
@@ -837,7 +1080,7 @@ func (x *TelegramHandler) handleModeEditCallback(log *tracing.Logger, query *tgb
 			"Name": mode.Name,
 			"Type": mode.Type,
 		}))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 
 		successMsg := x.localization.LocalizeByTd(query.Message, "MsgModeDisabled", map[string]interface{}{
 		"Name": mode.Name,
@@ -848,14 +1091,13 @@ func (x *TelegramHandler) handleModeEditCallback(log *tracing.Logger, query *tgb
 			"mode_edit_enable_"+mode.Type,
 		)
 		keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(enableBtn))
-		x.diplomat.SendMessageWithKeyboard(log, query.Message.Chat.ID, successMsg, keyboard)
+		x.diplomat.SendMessageWithKeyboard(log, query.Message, successMsg, keyboard)
 
 	case "enable":
-		mode.IsEnabled = platform.BoolPtr(true)
-		_, err = x.modes.UpdateMode(log, mode)
+		err = x.modes.SetModeEnabled(log, mode.Type, true)
 		if err != nil {
 			callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, "MsgModeErrorEnable"))
-			x.diplomat.bot.Request(callback)
+			x.diplomat.Request(log, callback)
 			return
 		}
 
@@ -863,7 +1105,7 @@ func (x *TelegramHandler) handleModeEditCallback(log *tracing.Logger, query *tgb
 			"Name": mode.Name,
 			"Type": mode.Type,
 		}))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 
 		successMsg := x.localization.LocalizeByTd(query.Message, "MsgModeEnabled", map[string]interface{}{
 			"Name": mode.Name,
@@ -874,11 +1116,11 @@ func (x *TelegramHandler) handleModeEditCallback(log *tracing.Logger, query *tgb
 			"mode_edit_disable_"+mode.Type,
 		)
 		keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(disableBtn))
-		x.diplomat.SendMessageWithKeyboard(log, query.Message.Chat.ID, successMsg, keyboard)
+		x.diplomat.SendMessageWithKeyboard(log, query.Message, successMsg, keyboard)
 
 	case "delete":
 		callback := tgbotapi.NewCallback(query.ID, "")
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 
 		confirmMsg := x.localization.LocalizeByTd(query.Message, "MsgModeDeleteConfirm", map[string]interface{}{
 			"Name": mode.Name,
@@ -894,14 +1136,14 @@ func (x *TelegramHandler) handleModeEditCallback(log *tracing.Logger, query *tgb
 		)
 		keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(cancelBtn, confirmBtn))
 
-		x.diplomat.SendMessageWithKeyboard(log, query.Message.Chat.ID, x.personality.XiifyManualPlain(confirmMsg), keyboard)
+		x.diplomat.SendMessageWithKeyboard(log, query.Message, x.personality.XiifyManualPlain(confirmMsg), keyboard)
 	}
 }
 
 func (x *TelegramHandler) handleModeDeleteCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, user *entities.User) {
 	if !x.rights.IsUserHasRight(log, user, "edit_mode") {
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, "MsgModeModifyNoAccess"))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
@@ -919,7 +1161,7 @@ func (x *TelegramHandler) handleModeDeleteCallback(log *tracing.Logger, query *t
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeByTd(query.Message, "MsgModeNotFound", map[string]interface{}{
 			"Type": modeType,
 		}))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
@@ -928,21 +1170,21 @@ func (x *TelegramHandler) handleModeDeleteCallback(log *tracing.Logger, query *t
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeByTd(query.Message, "MsgModeDeleteCancelled", map[string]interface{}{
 			"Name": mode.Name,
 		}))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 
 		cancelMsg := x.localization.LocalizeByTd(query.Message, "MsgModeDeleteCancelled", map[string]interface{}{
 			"Name": mode.Name,
 		})
-		x.diplomat.SendMessage(log, query.Message.Chat.ID, cancelMsg)
+		x.diplomat.SendMessage(log, query.Message, cancelMsg)
 
 		deleteMsg := tgbotapi.NewDeleteMessage(query.Message.Chat.ID, query.Message.MessageID)
-		x.diplomat.bot.Request(deleteMsg)
+		x.diplomat.Request(log, deleteMsg)
 
 	case "confirm":
 		err = x.modes.DeleteMode(log, mode)
 	if err != nil {
 			callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, "MsgModeErrorDelete"))
-			x.diplomat.bot.Request(callback)
+			x.diplomat.Request(log, callback)
 		return
 	}
 
@@ -950,23 +1192,23 @@ func (x *TelegramHandler) handleModeDeleteCallback(log *tracing.Logger, query *t
 			"Name": mode.Name,
 			"Type": mode.Type,
 		}))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 
 		successMsg := x.localization.LocalizeByTd(query.Message, "MsgModeDeleted", map[string]interface{}{
 		"Name": mode.Name,
 		"Type": mode.Type,
 	})
-		x.diplomat.SendMessage(log, query.Message.Chat.ID, successMsg)
+		x.diplomat.SendMessage(log, query.Message, successMsg)
 
 		deleteMsg := tgbotapi.NewDeleteMessage(query.Message.Chat.ID, query.Message.MessageID)
-		x.diplomat.bot.Request(deleteMsg)
+		x.diplomat.Request(log, deleteMsg)
 	}
 }
 
 func (x *TelegramHandler) handleModeInfoCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, user *entities.User) {
 	if !x.rights.IsUserHasRight(log, user, "edit_mode") {
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, "MsgModeModifyNoAccess"))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
@@ -978,7 +1220,7 @@ func (x *TelegramHandler) handleModeInfoCallback(log *tracing.Logger, query *tgb
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeByTd(query.Message, "MsgModeNotFound", map[string]interface{}{
 			"Type": modeType,
 		}))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
@@ -1020,6 +1262,38 @@ func (x *TelegramHandler) handleModeInfoCallback(log *tracing.Logger, query *tgb
 		final = "true"
 	}
 
+	enabledText := x.localization.LocalizeBy(query.Message, "MsgModeInfoPolicyOn")
+	disabledText := x.localization.LocalizeBy(query.Message, "MsgModeInfoPolicyOff")
+	onOff := func(enabled bool) string {
+		if enabled {
+			return enabledText
+		}
+		return disabledText
+	}
+
+	policy := config.Policy
+	tools := x.localization.LocalizeBy(query.Message, "MsgModeInfoPolicyAllTools")
+	model := x.localization.LocalizeBy(query.Message, "MsgModeInfoPolicyTariffModel")
+	minGrade := notSet
+	maxOutputTokens := notSet
+	if policy != nil {
+		if policy.AllowedTools != nil {
+			tools = disabledText
+			if len(policy.AllowedTools) > 0 {
+				tools = strings.Join(policy.AllowedTools, ", ")
+			}
+		}
+		if policy.Model != "" {
+			model = policy.Model
+		}
+		if policy.MinGrade != "" {
+			minGrade = x.getGradeDisplayName(query.Message, &policy.MinGrade)
+		}
+		if policy.MaxOutputTokens > 0 {
+			maxOutputTokens = format.Numberify(int64(policy.MaxOutputTokens))
+		}
+	}
+
 	infoMsg := x.localization.LocalizeByTd(query.Message, "MsgModeInfo", map[string]interface{}{
 		"Type":             mode.Type,
 		"Name":             mode.Name,
@@ -1031,1180 +1305,3940 @@ func (x *TelegramHandler) handleModeInfoCallback(log *tracing.Logger, query *tgb
 		"PresencePenalty":  presencePenalty,
 		"FrequencyPenalty": frequencyPenalty,
 		"Final":            final,
+		"Tools":            tools,
+		"Model":            model,
+		"MinGrade":         minGrade,
+		"MaxOutputTokens":  maxOutputTokens,
+		"EffortAgent":      onOff(policy.EffortAgentEnabled()),
+		"LengthAgent":      onOff(policy.ResponseLengthAgentEnabled()),
+		"Personalization":  onOff(policy.PersonalizationEnabled()),
 		"CreatedAt":        x.dateTimeFormatter.Dateify(query.Message, mode.CreatedAt),
 	})
 
 	callback := tgbotapi.NewCallback(query.ID, "")
-	x.diplomat.bot.Request(callback)
+	x.diplomat.Request(log, callback)
 
-	x.diplomat.SendMessage(log, query.Message.Chat.ID, x.personality.XiifyManualPlain(infoMsg))
+	x.diplomat.SendMessage(log, query.Message, x.personality.XiifyManualPlain(infoMsg))
 }
 
-func (x *TelegramHandler) getGradeDisplayName(msg *tgbotapi.Message, grade *string) string {
-	if grade == nil || *grade == "" {
-		return x.localization.LocalizeBy(msg, "MsgGradeAll")
-	}
-	switch *grade {
-	case platform.GradeGold:
-		return x.localization.LocalizeBy(msg, "MsgGradeGold")
-	case platform.GradeSilver:
-		return x.localization.LocalizeBy(msg, "MsgGradeSilver")
-	case platform.GradeBronze:
-		return x.localization.LocalizeBy(msg, "MsgGradeBronze")
-	default:
-		return x.localization.LocalizeBy(msg, "MsgGradeAll")
-	}
-}
+func (x *TelegramHandler) ModeCommandHistory(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, modeType string) {
+	defer tracing.ProfilePoint(log, "Mode command history completed", "telegram.command.mode.history", "chat_id", msg.Chat.ID, "mode_type", modeType)()
 
-func isValidModeType(modeType string) bool {
-	if len(modeType) < 2 || len(modeType) > 50 {
-		return false
-	}
-	for _, r := range modeType {
-		if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_') {
-			return false
+	versions, err := x.modes.GetModeVersions(log, modeType)
+	if err != nil {
+		if errors.Is(err, repository.ErrModeNotFound) {
+			errorMsg := x.localization.LocalizeByTd(msg, "MsgModeNotFound", map[string]interface{}{
+				"Type": modeType,
+			})
+			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+			return
 		}
-	}
-	return true
-}
-
-// =========================  /users command handlers  =========================
-
-func (x *TelegramHandler) UsersCommandInfo(log *tracing.Logger, msg *tgbotapi.Message, username string) {
-	user := x.retrieveUserByName(log, msg, username)
-	if user == nil {
+		x.diplomat.Reply(log, msg, x.localization.LocalizeBy(msg, "MsgModeHistoryError"))
 		return
 	}
 
-	status := x.localization.LocalizeBy(msg, "MsgUsersStatusActive")
-	if !platform.BoolValue(user.IsActive, true) {
-		status = x.localization.LocalizeBy(msg, "MsgUsersStatusBlocked")
+	if len(versions) > modeHistoryLimit {
+		versions = versions[:modeHistoryLimit]
 	}
 
-	rightsStr := x.localization.LocalizeBy(msg, "MsgUsersNoRights")
-	if len(user.Rights) > 0 {
-		rightsStr = strings.Join(user.Rights, ", ")
-	}
+	var builder strings.Builder
+	builder.WriteString(x.localization.LocalizeByTd(msg, "MsgModeHistoryTitle", map[string]interface{}{
+		"Name": versions[0].Name,
+		"Type": modeType,
+	}))
 
-	infoMsg := x.localization.LocalizeByTd(msg, "MsgUsersInfo", map[string]interface{}{
-		"Username": *user.Username,
-		"Status":   status,
-		"Rights":   rightsStr,
-	})
+	var buttons []tgbotapi.InlineKeyboardButton
+	for idx, version := range versions {
+		entryKey := "MsgModeHistoryEntry"
+		if idx == 0 {
+			entryKey = "MsgModeHistoryEntryLatest"
+		}
 
-	var rows [][]tgbotapi.InlineKeyboardButton
+		builder.WriteString(x.localization.LocalizeByTd(msg, entryKey, map[string]interface{}{
+			"Version": version.Version,
+			"Name":    version.Name,
+			"Author":  x.modeVersionAuthor(msg, version),
+			"Date":    x.dateTimeFormatter.Dateify(msg, version.CreatedAt),
+		}))
 
-	if platform.BoolValue(user.IsActive, true) {
-		disableBtn := tgbotapi.NewInlineKeyboardButtonData(
-			x.localization.LocalizeBy(msg, "MsgUsersDisableBtn"),
-			"user_disable_"+*user.Username,
-		)
-		rows = append(rows, tgbotapi.NewInlineKeyboardRow(disableBtn))
-	} else {
-		enableBtn := tgbotapi.NewInlineKeyboardButtonData(
-			x.localization.LocalizeBy(msg, "MsgUsersEnableBtn"),
-			"user_enable_"+*user.Username,
-		)
-		rows = append(rows, tgbotapi.NewInlineKeyboardRow(enableBtn))
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(
+			fmt.Sprintf("v%d", version.Version),
+			fmt.Sprintf("mode_ver_%d_%s", version.Version, modeType),
+		))
 	}
 
-	deleteBtn := tgbotapi.NewInlineKeyboardButtonData(
-		x.localization.LocalizeBy(msg, "MsgUsersDeleteBtn"),
-		"user_delete_"+*user.Username,
-	)
-	rightsBtn := tgbotapi.NewInlineKeyboardButtonData(
-		x.localization.LocalizeBy(msg, "MsgUsersRightsBtn"),
-		"user_rights_"+*user.Username,
-	)
-	rows = append(rows, tgbotapi.NewInlineKeyboardRow(deleteBtn, rightsBtn))
+	builder.WriteString(x.localization.LocalizeBy(msg, "MsgModeHistoryHint"))
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for start := 0; start < len(buttons); start += modeHistoryButtonsPerRow {
+		end := min(start+modeHistoryButtonsPerRow, len(buttons))
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(buttons[start:end]...))
+	}
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
-	x.diplomat.ReplyWithKeyboard(log, msg, x.personality.XiifyManual(msg, infoMsg), keyboard)
+	x.diplomat.ReplyWithKeyboard(log, msg, x.personality.XiifyManual(msg, builder.String()), keyboard)
 }
 
-func (x *TelegramHandler) handleUserActionCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, currentUser *entities.User) {
-	msg := query.Message
-
-	if !x.rights.IsUserHasRight(log, currentUser, "manage_users") {
-		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersNoAccess"))
-		x.diplomat.bot.Request(callback)
-		return
+func (x *TelegramHandler) modeVersionAuthor(msg *tgbotapi.Message, mode *entities.Mode) string {
+	if mode.Creator != nil && mode.Creator.Username != nil && *mode.Creator.Username != "" {
+		return "@" + *mode.Creator.Username
 	}
+	return x.localization.LocalizeBy(msg, "MsgModeHistoryUnknownAuthor")
+}
 
-	data := query.Data
-
-	if strings.HasPrefix(data, "user_enable_") {
-		username := strings.TrimPrefix(data, "user_enable_")
-		x.handleUserEnableCallback(log, query, username)
-		return
+// modeVersionSnapshot renders the editable part of a mode version as plain lines, so versions can be diffed line by line
+func (x *TelegramHandler) modeVersionSnapshot(log *tracing.Logger, mode *entities.Mode) string {
+	if mode == nil {
+		return ""
 	}
 
-	if strings.HasPrefix(data, "user_disable_") {
-		username := strings.TrimPrefix(data, "user_disable_")
-		x.handleUserDisableCallback(log, query, username)
-		return
+	config := x.modes.ParseModeConfig(mode, log)
+
+	lines := []string{
+		"name: " + mode.Name,
+		"grade: " + platform.StringValue(mode.Grade, "all"),
+		fmt.Sprintf("final: %t", config.Final),
 	}
 
-	if strings.HasPrefix(data, "user_delete_") {
-		username := strings.TrimPrefix(data, "user_delete_")
-		x.handleUserDeleteCallback(log, query, username)
-		return
+	if config.Params != nil {
+		if config.Params.Temperature != nil {
+			lines = append(lines, fmt.Sprintf("temperature: %.2f", *config.Params.Temperature))
+		}
+		if config.Params.TopP != nil {
+			lines = append(lines, fmt.Sprintf("top_p: %.2f", *config.Params.TopP))
+		}
+		if config.Params.TopK != nil {
+			lines = append(lines, fmt.Sprintf("top_k: %d", *config.Params.TopK))
+		}
+		if config.Params.PresencePenalty != nil {
+			lines = append(lines, fmt.Sprintf("presence_penalty: %.2f", *config.Params.PresencePenalty))
+		}
+		if config.Params.FrequencyPenalty != nil {
+			lines = append(lines, fmt.Sprintf("frequency_penalty: %.2f", *config.Params.FrequencyPenalty))
+		}
 	}
 
-	if strings.HasPrefix(data, "user_rights_") {
-		username := strings.TrimPrefix(data, "user_rights_")
-		x.handleUserRightsCallback(log, query, username)
-		return
+	if config.Policy != nil {
+		if policy, err := json.Marshal(config.Policy); err == nil {
+			lines = append(lines, "policy: "+string(policy))
+		}
 	}
+
+	lines = append(lines, "prompt:", config.Prompt)
+	return strings.Join(lines, "\n")
 }
 
-func (x *TelegramHandler) handleUserEnableCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, username string) {
-	msg := query.Message
+// parseModeVersionCallback extracts the version and the mode type from {prefix}{version}_{modeType}
+func parseModeVersionCallback(data string, prefix string) (int, string, bool) {
+	rawVersion, modeType, found := strings.Cut(strings.TrimPrefix(data, prefix), "_")
+	if !found || !isValidModeType(modeType) {
+		return 0, "", false
+	}
 
-	user, err := x.users.GetUserByName(log, username)
-	if err != nil {
-		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUserNotFound"))
-		x.diplomat.bot.Request(callback)
+	version, err := strconv.Atoi(rawVersion)
+	if err != nil || version <= 0 {
+		return 0, "", false
+	}
+
+	return version, modeType, true
+}
+
+func (x *TelegramHandler) handleModeVersionCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, user *entities.User) {
+	if !x.rights.IsUserHasRight(log, user, "edit_mode") {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, "MsgModeModifyNoAccess"))
+		x.diplomat.Request(log, callback)
 		return
 	}
 
-	user.IsActive = platform.BoolPtr(true)
-	_, err = x.users.UpdateUser(log, user)
+	version, modeType, ok := parseModeVersionCallback(query.Data, "mode_ver_")
+	if !ok {
+		log.W("Invalid mode version callback data", "data", query.Data)
+		return
+	}
+
+	versions, err := x.modes.GetModeVersions(log, modeType)
 	if err != nil {
-		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersErrorEnable"))
-		x.diplomat.bot.Request(callback)
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, "MsgModeHistoryError"))
+		x.diplomat.Request(log, callback)
 		return
 	}
 
-	callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersEnabledCallback"))
-	x.diplomat.bot.Request(callback)
+	var target, previous *entities.Mode
+	for idx, candidate := range versions {
+		if candidate.Version == version {
+			target = candidate
+			if idx+1 < len(versions) {
+				previous = versions[idx+1]
+			}
+			break
+		}
+	}
 
-	successMsg := x.localization.LocalizeByTd(msg, "MsgUsersEnabled", map[string]interface{}{
-		"Username": username,
-	})
-	x.diplomat.SendMessage(log, msg.Chat.ID, successMsg)
+	if target == nil {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, "MsgModeVersionNotFound"))
+		x.diplomat.Request(log, callback)
+		return
+	}
 
-	x.updateUserActionKeyboard(log, msg, user)
-}
+	previousVersion := 0
+	if previous != nil {
+		previousVersion = previous.Version
+	}
 
-func (x *TelegramHandler) handleUserDisableCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, username string) {
-	msg := query.Message
+	lines := diff.Lines(x.modeVersionSnapshot(log, previous), x.modeVersionSnapshot(log, target))
 
-	callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersDisableConfirmCallback"))
-	x.diplomat.bot.Request(callback)
+	var text string
+	if diff.HasChanges(lines) {
+		text = x.localization.LocalizeByTd(query.Message, "MsgModeVersionDiff", map[string]interface{}{
+			"Version":  target.Version,
+			"Previous": previousVersion,
+			"Author":   x.modeVersionAuthor(query.Message, target),
+			"Date":     x.dateTimeFormatter.Dateify(query.Message, target.CreatedAt),
+			"Diff":     transform.SmartTruncate(diff.Unified(lines, modeHistoryDiffContext), modeHistoryDiffMaxLength),
+		})
+	} else {
+		text = x.localization.LocalizeByTd(query.Message, "MsgModeVersionNoChanges", map[string]interface{}{
+			"Version":  target.Version,
+			"Previous": previousVersion,
+		})
+	}
 
-	confirmMsg := x.localization.LocalizeByTd(msg, "MsgUsersDisableConfirm", map[string]interface{}{
-		"Username": username,
-	})
+	callback := tgbotapi.NewCallback(query.ID, "")
+	x.diplomat.Request(log, callback)
 
-	cancelBtn := tgbotapi.NewInlineKeyboardButtonData(
-		x.localization.LocalizeBy(msg, "MsgUsersCancelBtn"),
-		"user_disable_cancel_"+username,
-	)
-	confirmBtn := tgbotapi.NewInlineKeyboardButtonData(
-		x.localization.LocalizeBy(msg, "MsgUsersConfirmDisableBtn"),
-		"user_disable_confirm_"+username,
-	)
+	if target.Version == versions[0].Version {
+		x.diplomat.SendMessage(log, query.Message, x.personality.XiifyManualPlain(text))
+		return
+	}
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(cancelBtn, confirmBtn),
+	rollbackBtn := tgbotapi.NewInlineKeyboardButtonData(
+		x.localization.LocalizeByTd(query.Message, "MsgModeRollbackBtn", map[string]interface{}{
+			"Version": target.Version,
+		}),
+		fmt.Sprintf("mode_rb_%d_%s", target.Version, modeType),
 	)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(rollbackBtn))
 
-	x.diplomat.SendMessageWithKeyboard(log, msg.Chat.ID, x.personality.XiifyManualPlain(confirmMsg), keyboard)
+	x.diplomat.SendMessageWithKeyboard(log, query.Message, x.personality.XiifyManualPlain(text), keyboard)
 }
 
-func (x *TelegramHandler) handleUserDisableConfirmCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, currentUser *entities.User) {
-	msg := query.Message
-
-	if !x.rights.IsUserHasRight(log, currentUser, "manage_users") {
-		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersNoAccess"))
-		x.diplomat.bot.Request(callback)
+func (x *TelegramHandler) handleModeRollbackCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, user *entities.User) {
+	if !x.rights.IsUserHasRight(log, user, "edit_mode") {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, "MsgModeModifyNoAccess"))
+		x.diplomat.Request(log, callback)
 		return
 	}
 
-	data := query.Data
-
-	if strings.HasPrefix(data, "user_disable_cancel_") {
-		username := strings.TrimPrefix(data, "user_disable_cancel_")
-
-		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersDisableCancelledCallback"))
-		x.diplomat.bot.Request(callback)
-
-		cancelMsg := x.localization.LocalizeByTd(msg, "MsgUsersDisableCancelled", map[string]interface{}{
-			"Username": username,
-		})
-		x.diplomat.SendMessage(log, msg.Chat.ID, cancelMsg)
+	version, modeType, ok := parseModeVersionCallback(query.Data, "mode_rb_")
+	if !ok {
+		log.W("Invalid mode rollback callback data", "data", query.Data)
+		return
+	}
 
-		deleteMsg := tgbotapi.NewDeleteMessage(msg.Chat.ID, msg.MessageID)
-		x.diplomat.bot.Request(deleteMsg)
+	mode, err := x.modes.RollbackMode(log, modeType, version, query.From.ID)
+	if err != nil {
+		errorKey := "MsgModeRollbackError"
+		switch {
+		case errors.Is(err, repository.ErrModeVersionIsLatest):
+			errorKey = "MsgModeRollbackIsLatest"
+		case errors.Is(err, repository.ErrModeVersionNotFound):
+			errorKey = "MsgModeVersionNotFound"
+		}
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, errorKey))
+		x.diplomat.Request(log, callback)
 		return
 	}
 
-	if strings.HasPrefix(data, "user_disable_confirm_") {
-		username := strings.TrimPrefix(data, "user_disable_confirm_")
+	callback := tgbotapi.NewCallback(query.ID, "")
+	x.diplomat.Request(log, callback)
+
+	x.diplomat.EditMessageWithKeyboard(log, query.Message.Chat.ID, query.Message.MessageID, x.personality.XiifyManualPlain(
+		x.localization.LocalizeByTd(query.Message, "MsgModeRolledBack", map[string]interface{}{
+			"Name":       mode.Name,
+			"Version":    version,
+			"NewVersion": mode.Version,
+		}),
+	), tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}})
+}
 
-		user, err := x.users.GetUserByName(log, username)
-		if err != nil {
-			callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUserNotFound"))
-			x.diplomat.bot.Request(callback)
-			return
-		}
+func (x *TelegramHandler) ModeCommandExport(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, modeType string) {
+	defer tracing.ProfilePoint(log, "Mode command export completed", "telegram.command.mode.export", "chat_id", msg.Chat.ID, "mode_type", modeType)()
 
-		user.IsActive = platform.BoolPtr(false)
-		_, err = x.users.UpdateUser(log, user)
-		if err != nil {
-			callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersErrorDisable"))
-			x.diplomat.bot.Request(callback)
+	bundle, err := x.modes.ExportModeBundle(log, modeType)
+	if err != nil {
+		if errors.Is(err, repository.ErrModeNotFound) {
+			errorMsg := x.localization.LocalizeByTd(msg, "MsgModeNotFound", map[string]interface{}{
+				"Type": modeType,
+			})
+			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
 			return
 		}
+		errorMsg := x.localization.LocalizeBy(msg, "MsgModeExportError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
 
-		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersDisabledCallback"))
-		x.diplomat.bot.Request(callback)
+	jsonData, err := bundle.JSON()
+	if err != nil {
+		log.E("Failed to marshal mode bundle", tracing.InnerError, err)
+		errorMsg := x.localization.LocalizeBy(msg, "MsgModeExportError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
 
-		successMsg := x.localization.LocalizeByTd(msg, "MsgUsersDisabled", map[string]interface{}{
-			"Username": username,
-		})
-		x.diplomat.SendMessage(log, msg.Chat.ID, successMsg)
+	fileName := fmt.Sprintf("xi-mode-%s-%s.json", bundle.Type, bundle.ExportedAt.Format("20060102-150405"))
+	caption := x.localization.LocalizeByTd(msg, "MsgModeExportCaption", map[string]interface{}{
+		"Name": bundle.Name,
+		"Type": bundle.Type,
+	})
 
-		deleteMsg := tgbotapi.NewDeleteMessage(msg.Chat.ID, msg.MessageID)
-		x.diplomat.bot.Request(deleteMsg)
+	if err := x.diplomat.ReplyDocument(log, msg, fileName, jsonData, caption); err != nil {
+		errorMsg := x.localization.LocalizeBy(msg, "MsgModeExportError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
 	}
+
+	log.I("Mode exported", "mode_type", bundle.Type)
 }
 
-func (x *TelegramHandler) handleUserDeleteCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, username string) {
-	msg := query.Message
+func (x *TelegramHandler) ModeCommandImportStart(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	if err := x.chatState.InitModeImport(log, msg.Chat.ID, msg.From.ID); err != nil {
+		log.E("Failed to init mode import state", tracing.InnerError, err)
+		errorMsg := x.localization.LocalizeBy(msg, "MsgModeImportError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
 
-	callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersDeleteConfirmCallback"))
-	x.diplomat.bot.Request(callback)
+	promptMsg := x.localization.LocalizeBy(msg, "MsgModeImportPrompt")
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, promptMsg))
+}
 
-	confirmMsg := x.localization.LocalizeByTd(msg, "MsgUsersDeleteConfirm", map[string]interface{}{
-		"Username": username,
-	})
+func (x *TelegramHandler) handleModeImportInput(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	defer tracing.ProfilePoint(log, "Mode import input completed", "telegram.command.mode.import.input", "chat_id", msg.Chat.ID)()
 
-	cancelBtn := tgbotapi.NewInlineKeyboardButtonData(
-		x.localization.LocalizeBy(msg, "MsgUsersCancelBtn"),
-		"user_delete_cancel_"+username,
-	)
-	confirmBtn := tgbotapi.NewInlineKeyboardButtonData(
-		x.localization.LocalizeBy(msg, "MsgUsersConfirmDeleteBtn"),
-		"user_delete_confirm_"+username,
-	)
+	if msg.Document == nil {
+		notDocumentMsg := x.localization.LocalizeBy(msg, "MsgModeImportNotDocument")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, notDocumentMsg))
+		return
+	}
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(cancelBtn, confirmBtn),
-	)
+	if msg.Document.FileSize > modeImportMaxFileSize {
+		tooLargeMsg := x.localization.LocalizeBy(msg, "MsgModeImportTooLarge")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, tooLargeMsg))
+		return
+	}
 
-	x.diplomat.SendMessageWithKeyboard(log, msg.Chat.ID, x.personality.XiifyManualPlain(confirmMsg), keyboard)
-}
+	data, err := x.downloadDocument(log, msg.Document.FileID, modeImportMaxFileSize)
+	if err != nil {
+		log.E("Failed to download mode file", tracing.InnerError, err)
+		errorMsg := x.localization.LocalizeBy(msg, "MsgModeImportError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
 
-func (x *TelegramHandler) handleUserDeleteConfirmCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, currentUser *entities.User) {
-	msg := query.Message
+	bundle, err := repository.ParseModeBundle(data)
+	if err == nil && !isValidModeType(bundle.Type) {
+		err = fmt.Errorf("mode type %q is invalid", bundle.Type)
+	}
+	if err != nil {
+		log.W("Invalid mode file", tracing.InnerError, err)
+		invalidMsg := x.localization.LocalizeByTd(msg, "MsgModeImportInvalid", map[string]interface{}{
+			"Error": err.Error(),
+		})
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, invalidMsg))
+		return
+	}
 
-	if !x.rights.IsUserHasRight(log, currentUser, "manage_users") {
-		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersNoAccess"))
-		x.diplomat.bot.Request(callback)
+	if !x.validateModePrompt(log, msg, bundle.Grade, bundle.Config.Prompt) {
 		return
 	}
 
-	data := query.Data
+	existing, err := x.modes.GetModeByTypeIncludingDisabled(log, bundle.Type)
+	if err != nil && !errors.Is(err, repository.ErrModeNotFound) {
+		errorMsg := x.localization.LocalizeBy(msg, "MsgModeImportError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
 
-	if strings.HasPrefix(data, "user_delete_cancel_") {
-		username := strings.TrimPrefix(data, "user_delete_cancel_")
+	if existing == nil {
+		x.applyModeImport(log, msg, msg.From.ID, bundle)
+		return
+	}
 
-		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersDeleteCancelledCallback"))
-		x.diplomat.bot.Request(callback)
+	changes := x.modes.ModeBundleChanges(log, existing, bundle)
+	if len(changes) == 0 {
+		if err := x.chatState.ClearState(log, msg.Chat.ID, msg.From.ID); err != nil {
+			log.E("Failed to clear chat state", tracing.InnerError, err)
+		}
 
-		cancelMsg := x.localization.LocalizeByTd(msg, "MsgUsersDeleteCancelled", map[string]interface{}{
-			"Username": username,
+		unchangedMsg := x.localization.LocalizeByTd(msg, "MsgModeImportUnchanged", map[string]interface{}{
+			"Name": existing.Name,
+			"Type": existing.Type,
 		})
-		x.diplomat.SendMessage(log, msg.Chat.ID, cancelMsg)
-
-		deleteMsg := tgbotapi.NewDeleteMessage(msg.Chat.ID, msg.MessageID)
-		x.diplomat.bot.Request(deleteMsg)
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, unchangedMsg))
 		return
 	}
 
-	if strings.HasPrefix(data, "user_delete_confirm_") {
-		username := strings.TrimPrefix(data, "user_delete_confirm_")
+	// The mode already exists, so the admin has to see the changes before they replace the current version
+	bundleData, err := json.Marshal(bundle)
+	if err != nil {
+		log.E("Failed to marshal mode bundle", tracing.InnerError, err)
+		return
+	}
 
-		err := x.users.DeleteUserByName(log, username)
-		if err != nil {
-			callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersErrorRemove"))
-			x.diplomat.bot.Request(callback)
-			return
-		}
+	if err := x.chatState.InitModeImportConfirmation(log, msg.Chat.ID, msg.From.ID, bundleData); err != nil {
+		log.E("Failed to init mode import confirmation", tracing.InnerError, err)
+		errorMsg := x.localization.LocalizeBy(msg, "MsgModeImportError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
 
-		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersDeletedCallback"))
-		x.diplomat.bot.Request(callback)
+	conflictMsg := x.localization.LocalizeByTd(msg, "MsgModeImportConflict", map[string]interface{}{
+		"Name":    existing.Name,
+		"Type":    existing.Type,
+		"Version": existing.Version,
+		"Changes": x.formatModeBundleChanges(msg, changes),
+	})
 
-		successMsg := x.localization.LocalizeByTd(msg, "MsgUsersRemoved", map[string]interface{}{
-			"Username": username,
-		})
-		x.diplomat.SendMessage(log, msg.Chat.ID, successMsg)
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(x.localization.LocalizeBy(msg, "MsgModeImportConfirmBtn"), "mode_import_confirm"),
+			tgbotapi.NewInlineKeyboardButtonData(x.localization.LocalizeBy(msg, "MsgModeImportCancelBtn"), "mode_import_cancel"),
+		),
+	)
 
-		deleteMsg := tgbotapi.NewDeleteMessage(msg.Chat.ID, msg.MessageID)
-		x.diplomat.bot.Request(deleteMsg)
-	}
+	x.diplomat.ReplyWithKeyboard(log, msg, x.personality.XiifyManual(msg, conflictMsg), keyboard)
 }
 
-func (x *TelegramHandler) handleUserRightsCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, username string) {
+func (x *TelegramHandler) handleModeImportCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, user *entities.User) {
 	msg := query.Message
 
-	user, err := x.users.GetUserByName(log, username)
-	if err != nil {
-		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUserNotFound"))
-		x.diplomat.bot.Request(callback)
+	state, err := x.chatState.GetState(log, msg.Chat.ID, query.From.ID)
+	if err != nil || state == nil || state.Status != repository.ChatStateConfirmModeImport {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgModeImportExpired"))
+		x.diplomat.Request(log, callback)
 		return
 	}
 
 	callback := tgbotapi.NewCallback(query.ID, "")
-	x.diplomat.bot.Request(callback)
+	x.diplomat.Request(log, callback)
 
-	x.sendUserRightsMessage(log, msg.Chat.ID, user)
-}
+	editMarkup := tgbotapi.NewEditMessageReplyMarkup(msg.Chat.ID, msg.MessageID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}})
+	if _, err := x.diplomat.Request(log, editMarkup); err != nil {
+		log.E("Failed to remove mode import keyboard", tracing.InnerError, err)
+	}
 
-func (x *TelegramHandler) handleUserRightsToggleCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, currentUser *entities.User) {
-	msg := query.Message
+	if query.Data == "mode_import_cancel" {
+		if err := x.chatState.ClearState(log, msg.Chat.ID, query.From.ID); err != nil {
+			log.E("Failed to clear chat state", tracing.InnerError, err)
+		}
 
-	if !x.rights.IsUserHasRight(log, currentUser, "manage_users") {
-		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersNoAccess"))
-		x.diplomat.bot.Request(callback)
+		cancelledMsg := x.localization.LocalizeBy(msg, "MsgModeImportCancelled")
+		x.diplomat.SendMessage(log, msg, x.personality.XiifyManualPlain(cancelledMsg))
 		return
 	}
 
-	parts := strings.SplitN(strings.TrimPrefix(query.Data, "user_right_"), "_", 2)
-	if len(parts) != 2 {
+	var bundle repository.ModeBundle
+	if err := json.Unmarshal([]byte(state.ModeBundle), &bundle); err != nil {
+		log.E("Failed to unmarshal mode bundle from chat state", tracing.InnerError, err)
 		return
 	}
 
-	right := parts[0]
-	username := parts[1]
-
-	user, err := x.users.GetUserByName(log, username)
-	if err != nil {
-		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUserNotFound"))
-		x.diplomat.bot.Request(callback)
-		return
-	}
+	x.applyModeImport(log, msg, query.From.ID, &bundle)
+}
 
-	hasRight := false
-	for _, r := range user.Rights {
-		if r == right {
-			hasRight = true
-			break
-		}
+// applyModeImport stores the bundle and reports the result, changes are listed only when an existing mode was updated
+func (x *TelegramHandler) applyModeImport(log *tracing.Logger, msg *tgbotapi.Message, editorEUID int64, bundle *repository.ModeBundle) {
+	if err := x.chatState.ClearState(log, msg.Chat.ID, editorEUID); err != nil {
+		log.E("Failed to clear chat state", tracing.InnerError, err)
 	}
 
-	if hasRight {
-		newRights := []string{}
-		for _, r := range user.Rights {
-			if r != right {
-				newRights = append(newRights, r)
-			}
-		}
-		user.Rights = newRights
-	} else {
-		user.Rights = append(user.Rights, right)
+	var changes []repository.ModeBundleChange
+	if existing, err := x.modes.GetModeByTypeIncludingDisabled(log, bundle.Type); err == nil {
+		changes = x.modes.ModeBundleChanges(log, existing, bundle)
 	}
 
-	_, err = x.users.UpdateUser(log, user)
+	mode, created, err := x.modes.ImportModeBundle(log, bundle, editorEUID)
 	if err != nil {
-		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersErrorEdit"))
-		x.diplomat.bot.Request(callback)
+		log.E("Failed to import mode", tracing.InnerError, err)
+		errorMsg := x.localization.LocalizeBy(msg, "MsgModeImportError")
+		x.diplomat.SendMessage(log, msg, x.personality.XiifyManualPlain(errorMsg))
 		return
 	}
 
-	action := x.localization.LocalizeBy(msg, "MsgUsersRightAdded")
-	if hasRight {
-		action = x.localization.LocalizeBy(msg, "MsgUsersRightRemoved")
+	resultKey := "MsgModeImportUpdated"
+	if created {
+		resultKey = "MsgModeImportCreated"
 	}
 
-	callback := tgbotapi.NewCallback(query.ID, action)
-	x.diplomat.bot.Request(callback)
+	resultMsg := x.localization.LocalizeByTd(msg, resultKey, map[string]interface{}{
+		"Name":    mode.Name,
+		"Type":    mode.Type,
+		"Version": mode.Version,
+		"Changes": x.formatModeBundleChanges(msg, changes),
+	})
 
-	x.updateUserRightsKeyboard(log, msg, user)
+	log.I("Mode imported", "mode_type", mode.Type, "version", mode.Version, "created", created)
+	x.diplomat.SendMessage(log, msg, x.personality.XiifyManualPlain(resultMsg))
 }
 
-func (x *TelegramHandler) sendUserRightsMessage(log *tracing.Logger, chatID int64, user *entities.User) {
-	allRights := []struct {
-		Key  string
-		Desc string
-	}{
-		{"switch_mode", "управление режимами в чатах"},
-		{"edit_mode", "редактирование режимов"},
+func (x *TelegramHandler) formatModeBundleChanges(msg *tgbotapi.Message, changes []repository.ModeBundleChange) string {
+	var builder strings.Builder
+
+	for _, change := range changes {
+		if change.Field == "prompt" {
+			added, removed := 0, 0
+			for _, line := range diff.Lines(change.Before, change.After) {
+				switch line.Op {
+				case diff.Insert:
+					added++
+				case diff.Delete:
+					removed++
+				}
+			}
+
+			builder.WriteString(x.localization.LocalizeByTd(msg, "MsgModeImportPromptChange", map[string]interface{}{
+				"Added":   added,
+				"Removed": removed,
+			}))
+			continue
+		}
+
+		before, after := change.Before, change.After
+		if change.Field == "grade" {
+			before = x.getGradeDisplayName(msg, &before)
+			after = x.getGradeDisplayName(msg, &after)
+		}
+
+		builder.WriteString(x.localization.LocalizeByTd(msg, "MsgModeImportFieldChange", map[string]interface{}{
+			"Field":  change.Field,
+			"Before": before,
+			"After":  after,
+		}))
+	}
+
+	return builder.String()
+}
+
+func (x *TelegramHandler) ModeCommandPreview(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, modeType string) {
+	defer tracing.ProfilePoint(log, "Mode command preview completed", "telegram.command.mode.preview", "chat_id", msg.Chat.ID, "mode_type", modeType)()
+
+	var mode *entities.Mode
+	var err error
+	if modeType == "" {
+		mode, err = x.modes.GetCurrentModeForChat(log, msg.Chat.ID, x.topics.ThreadOf(log, msg))
+		if err == nil && mode == nil {
+			err = repository.ErrModeNotFound
+		}
+	} else {
+		mode, err = x.modes.GetModeByTypeIncludingDisabled(log, modeType)
+	}
+
+	if err != nil {
+		errorMsg := x.localization.LocalizeByTd(msg, "MsgModeNotFound", map[string]interface{}{
+			"Type": modeType,
+		})
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	grade, err := x.donations.GetUserGrade(log, user)
+	if err != nil {
+		log.W("Failed to get user grade, using bronze", tracing.InnerError, err)
+		grade = platform.GradeBronze
+	}
+
+	personalization := ""
+	if !platform.BoolValue(user.IsIncognito, false) {
+		if existing, err := x.personalizations.GetPersonalizationByUser(log, user); err == nil && existing != nil {
+			personalization = existing.Prompt
+		}
+	}
+
+	config := x.modes.ParseModeConfig(mode, log)
+	rendered, err := x.dialer.RenderModePrompt(log, msg, config.Prompt, grade, personalization)
+	if err != nil {
+		errorMsg := x.localization.LocalizeByTd(msg, "MsgModePromptTemplateInvalid", map[string]interface{}{
+			"Error": err.Error(),
+		})
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	previewMsg := x.localization.LocalizeByTd(msg, "MsgModePreview", map[string]interface{}{
+		"Name":   mode.Name,
+		"Type":   mode.Type,
+		"Prompt": transform.SmartTruncate(rendered, modePreviewMaxLength),
+	})
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, previewMsg))
+}
+
+func (x *TelegramHandler) ModeCommandVars(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	defer tracing.ProfilePoint(log, "Mode command vars completed", "telegram.command.mode.vars", "chat_id", msg.Chat.ID)()
+
+	vars, err := x.chatVariables.GetVariables(log, msg.Chat.ID)
+	if err != nil {
+		errorMsg := x.localization.LocalizeBy(msg, "MsgModeVarsError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	if len(vars) == 0 {
+		emptyMsg := x.localization.LocalizeBy(msg, "MsgModeVarsEmpty")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, emptyMsg))
+		return
+	}
+
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	var builder strings.Builder
+	builder.WriteString(x.localization.LocalizeBy(msg, "MsgModeVarsTitle"))
+	for _, name := range names {
+		builder.WriteString(x.localization.LocalizeByTd(msg, "MsgModeVarsEntry", map[string]interface{}{
+			"Name":  name,
+			"Value": vars[name],
+		}))
+	}
+
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, builder.String()))
+}
+
+func (x *TelegramHandler) ModeCommandVarsSet(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, name string, value string) {
+	defer tracing.ProfilePoint(log, "Mode command vars set completed", "telegram.command.mode.vars.set", "chat_id", msg.Chat.ID, "name", name)()
+
+	if !chatVariableNamePattern.MatchString(name) {
+		errorMsg := x.localization.LocalizeBy(msg, "MsgModeVarsInvalidName")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	value = strings.TrimSpace(value)
+	if value == "" || len([]rune(value)) > chatVariableMaxValueLength {
+		errorMsg := x.localization.LocalizeByTd(msg, "MsgModeVarsInvalidValue", map[string]interface{}{
+			"Max": chatVariableMaxValueLength,
+		})
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	if err := x.chatVariables.SetVariable(log, msg.Chat.ID, name, value); err != nil {
+		errorMsg := x.localization.LocalizeBy(msg, "MsgModeVarsError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	successMsg := x.localization.LocalizeByTd(msg, "MsgModeVarsSet", map[string]interface{}{
+		"Name": name,
+	})
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, successMsg))
+}
+
+func (x *TelegramHandler) ModeCommandVarsUnset(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, name string) {
+	defer tracing.ProfilePoint(log, "Mode command vars unset completed", "telegram.command.mode.vars.unset", "chat_id", msg.Chat.ID, "name", name)()
+
+	if err := x.chatVariables.DeleteVariable(log, msg.Chat.ID, name); err != nil {
+		errorKey := "MsgModeVarsError"
+		if errors.Is(err, repository.ErrChatVariableNotFound) {
+			errorKey = "MsgModeVarsNotFound"
+		}
+		errorMsg := x.localization.LocalizeByTd(msg, errorKey, map[string]interface{}{
+			"Name": name,
+		})
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	successMsg := x.localization.LocalizeByTd(msg, "MsgModeVarsUnset", map[string]interface{}{
+		"Name": name,
+	})
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, successMsg))
+}
+
+func (x *TelegramHandler) getGradeDisplayName(msg *tgbotapi.Message, grade *string) string {
+	if grade == nil || *grade == "" {
+		return x.localization.LocalizeBy(msg, "MsgGradeAll")
+	}
+	switch *grade {
+	case platform.GradeGold:
+		return x.localization.LocalizeBy(msg, "MsgGradeGold")
+	case platform.GradeSilver:
+		return x.localization.LocalizeBy(msg, "MsgGradeSilver")
+	case platform.GradeBronze:
+		return x.localization.LocalizeBy(msg, "MsgGradeBronze")
+	default:
+		return x.localization.LocalizeBy(msg, "MsgGradeAll")
+	}
+}
+
+func (x *TelegramHandler) modeDraftKeyboard(msg *tgbotapi.Message, modeType string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(x.localization.LocalizeBy(msg, "MsgModeDraftTestBtn"), "mode_dr_test_"+modeType),
+			tgbotapi.NewInlineKeyboardButtonData(x.localization.LocalizeBy(msg, "MsgModeDraftCompareBtn"), "mode_dr_cmp_"+modeType),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(x.localization.LocalizeBy(msg, "MsgModeDraftPublishBtn"), "mode_dr_pub_"+modeType),
+			tgbotapi.NewInlineKeyboardButtonData(x.localization.LocalizeBy(msg, "MsgModeDraftDiscardBtn"), "mode_dr_del_"+modeType),
+		),
+	)
+}
+
+// modeDraftCard describes the draft against the live version of the mode, with the prompt diff
+func (x *TelegramHandler) modeDraftCard(log *tracing.Logger, msg *tgbotapi.Message, draft *entities.ModeDraft, live *entities.Mode) string {
+	author := x.localization.LocalizeBy(msg, "MsgModeHistoryUnknownAuthor")
+	if draft.Creator != nil && draft.Creator.Username != nil && *draft.Creator.Username != "" {
+		author = "@" + *draft.Creator.Username
+	}
+
+	lines := diff.Lines(x.modes.ParseModeConfig(live, log).Prompt, draft.Prompt)
+	changes := x.localization.LocalizeBy(msg, "MsgModeDraftNoChanges")
+	if diff.HasChanges(lines) {
+		changes = transform.SmartTruncate(diff.Unified(lines, modeHistoryDiffContext), modeHistoryDiffMaxLength)
+	}
+
+	card := x.localization.LocalizeByTd(msg, "MsgModeDraftCard", map[string]interface{}{
+		"Name":        live.Name,
+		"Type":        live.Type,
+		"BaseVersion": draft.BaseVersion,
+		"LiveVersion": live.Version,
+		"Author":      author,
+		"Date":        x.dateTimeFormatter.Dateify(msg, draft.UpdatedAt),
+		"Diff":        changes,
+	})
+
+	if live.Version != draft.BaseVersion {
+		card += x.localization.LocalizeByTd(msg, "MsgModeDraftOutdated", map[string]interface{}{
+			"BaseVersion": draft.BaseVersion,
+			"LiveVersion": live.Version,
+		})
+	}
+
+	return card
+}
+
+func (x *TelegramHandler) ModeCommandDraft(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, modeType string) {
+	defer tracing.ProfilePoint(log, "Mode command draft completed", "telegram.command.mode.draft", "chat_id", msg.Chat.ID, "mode_type", modeType)()
+
+	live, err := x.modes.GetModeByTypeIncludingDisabled(log, modeType)
+	if err != nil {
+		errorMsg := x.localization.LocalizeByTd(msg, "MsgModeNotFound", map[string]interface{}{
+			"Type": modeType,
+		})
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	draft, err := x.modes.GetModeDraft(log, modeType)
+	if err != nil {
+		errorKey := "MsgModeDraftError"
+		if errors.Is(err, repository.ErrModeDraftNotFound) {
+			errorKey = "MsgModeDraftNotFound"
+		}
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, errorKey)))
+		return
+	}
+
+	card := x.modeDraftCard(log, msg, draft, live)
+	x.diplomat.ReplyWithKeyboard(log, msg, x.personality.XiifyManual(msg, card), x.modeDraftKeyboard(msg, modeType))
+}
+
+func (x *TelegramHandler) handleModeDraftCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, user *entities.User) {
+	if !x.rights.IsUserHasRight(log, user, "edit_mode") {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, "MsgModeModifyNoAccess"))
+		x.diplomat.Request(log, callback)
+		return
+	}
+
+	// Parse callback data: mode_dr_{test|cmp|pub|del}_{modeType}
+	action, modeType, found := strings.Cut(strings.TrimPrefix(query.Data, "mode_dr_"), "_")
+	if !found || modeType == "" {
+		log.W("Invalid mode draft callback data", "data", query.Data)
+		return
+	}
+
+	msg := query.Message
+	clearKeyboard := func() {
+		editMarkup := tgbotapi.NewEditMessageReplyMarkup(msg.Chat.ID, msg.MessageID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}})
+		if _, err := x.diplomat.Request(log, editMarkup); err != nil {
+			log.E("Failed to remove mode draft keyboard", tracing.InnerError, err)
+		}
+	}
+
+	switch action {
+	case "test", "cmp":
+		if _, err := x.modes.GetModeDraft(log, modeType); err != nil {
+			x.diplomat.Request(log, tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgModeDraftNotFound")))
+			return
+		}
+
+		if err := x.chatState.InitDraftTest(log, msg.Chat.ID, query.From.ID, modeType, action == "cmp"); err != nil {
+			log.E("Failed to init draft test state", tracing.InnerError, err)
+			return
+		}
+
+		x.diplomat.Request(log, tgbotapi.NewCallback(query.ID, ""))
+
+		awaitKey := "MsgModeDraftAwaitingTest"
+		if action == "cmp" {
+			awaitKey = "MsgModeDraftAwaitingCompare"
+		}
+		x.diplomat.SendMessage(log, msg, x.personality.XiifyManualPlain(x.localization.LocalizeBy(msg, awaitKey)))
+
+	case "pub":
+		mode, err := x.modes.PublishModeDraft(log, modeType, query.From.ID)
+		if err != nil {
+			errorKey := "MsgModeDraftError"
+			if errors.Is(err, repository.ErrModeDraftNotFound) {
+				errorKey = "MsgModeDraftNotFound"
+			}
+			x.diplomat.Request(log, tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, errorKey)))
+			return
+		}
+
+		x.diplomat.Request(log, tgbotapi.NewCallback(query.ID, ""))
+		clearKeyboard()
+
+		publishedMsg := x.localization.LocalizeByTd(msg, "MsgModeDraftPublished", map[string]interface{}{
+			"Name":    mode.Name,
+			"Version": mode.Version,
+		})
+		x.diplomat.SendMessage(log, msg, x.personality.XiifyManualPlain(publishedMsg))
+
+	case "del":
+		if err := x.modes.DeleteModeDraft(log, modeType); err != nil {
+			errorKey := "MsgModeDraftError"
+			if errors.Is(err, repository.ErrModeDraftNotFound) {
+				errorKey = "MsgModeDraftNotFound"
+			}
+			x.diplomat.Request(log, tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, errorKey)))
+			return
+		}
+
+		x.diplomat.Request(log, tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgModeDraftDiscarded")))
+		clearKeyboard()
+
+	default:
+		log.W("Unknown mode draft action", "action", action)
+	}
+}
+
+// handleDraftTestInput answers the question with the draft, and with the live version as well when comparing.
+// Answers are isolated from the chat history and carry no feedback buttons
+func (x *TelegramHandler) handleDraftTestInput(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, state *repository.ChatStateData, compare bool) {
+	question := strings.TrimSpace(x.GetRequestText(msg))
+	if question == "" {
+		errorMsg := x.localization.LocalizeBy(msg, "MsgModeDraftQuestionEmpty")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	if err := x.chatState.ClearState(log, msg.Chat.ID, msg.From.ID); err != nil {
+		log.E("Failed to clear chat state", tracing.InnerError, err)
+	}
+
+	draft, err := x.modes.GetModeDraft(log, state.ModeType)
+	if err != nil {
+		errorKey := "MsgModeDraftError"
+		if errors.Is(err, repository.ErrModeDraftNotFound) {
+			errorKey = "MsgModeDraftNotFound"
+		}
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, errorKey)))
+		return
+	}
+
+	draftMode, err := x.modes.DraftMode(log, draft)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, "MsgModeDraftError")))
+		return
+	}
+
+	var live *entities.Mode
+	if compare {
+		live, err = x.modes.GetModeByTypeIncludingDisabled(log, state.ModeType)
+		if err != nil {
+			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, "MsgModeDraftError")))
+			return
+		}
+	}
+
+	x.diplomat.StartTyping(msg)
+	defer x.diplomat.StopTyping(msg)
+
+	persona := msg.From.FirstName + " " + msg.From.LastName + " (@" + msg.From.UserName + ")"
+
+	// both versions answer at the same time, so the comparison does not take twice as long
+	var liveResult, draftResult *artificial.DialResult
+	var liveErr, draftErr error
+	var wg sync.WaitGroup
+	if live != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			liveResult, liveErr = x.dialer.DialSandbox(log, msg, question, persona, live)
+		}()
+	}
+	draftResult, draftErr = x.dialer.DialSandbox(log, msg, question, persona, draftMode)
+	wg.Wait()
+
+	if live != nil {
+		if liveErr != nil || strings.TrimSpace(liveResult.Text) == "" {
+			x.diplomat.Reply(log, msg, x.localization.LocalizeBy(msg, "MsgErrorResponse"))
+		} else {
+			header := x.localization.LocalizeByTd(msg, "MsgModeDraftLiveAnswer", map[string]interface{}{
+				"Version": live.Version,
+			})
+			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, header+liveResult.Text))
+		}
+	}
+
+	if draftErr != nil || strings.TrimSpace(draftResult.Text) == "" {
+		x.diplomat.Reply(log, msg, x.localization.LocalizeBy(msg, "MsgErrorResponse"))
+	} else {
+		header := x.localization.LocalizeByTd(msg, "MsgModeDraftAnswer", map[string]interface{}{
+			"Name": draftMode.Name,
+		})
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, header+draftResult.Text))
+	}
+
+	doneMsg := x.localization.LocalizeBy(msg, "MsgModeDraftTestDone")
+	x.diplomat.ReplyWithKeyboard(log, msg, x.personality.XiifyManual(msg, doneMsg), x.modeDraftKeyboard(msg, state.ModeType))
+}
+
+func isValidModeType(modeType string) bool {
+	if len(modeType) < 2 || len(modeType) > 50 {
+		return false
+	}
+	for _, r := range modeType {
+		if !((r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// =========================  /users command handlers  =========================
+
+func (x *TelegramHandler) UsersCommandInfo(log *tracing.Logger, msg *tgbotapi.Message, username string) {
+	user := x.retrieveUserByName(log, msg, username)
+	if user == nil {
+		return
+	}
+
+	status := x.localization.LocalizeBy(msg, "MsgUsersStatusActive")
+	if !platform.BoolValue(user.IsActive, true) {
+		status = x.localization.LocalizeBy(msg, "MsgUsersStatusBlocked")
+	}
+
+	rightsStr := x.localization.LocalizeBy(msg, "MsgUsersNoRights")
+	if len(user.Rights) > 0 {
+		rightsStr = strings.Join(user.Rights, ", ")
+	}
+
+	infoMsg := x.localization.LocalizeByTd(msg, "MsgUsersInfo", map[string]interface{}{
+		"Username": *user.Username,
+		"Status":   status,
+		"Rights":   rightsStr,
+	})
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+
+	if platform.BoolValue(user.IsActive, true) {
+		disableBtn := tgbotapi.NewInlineKeyboardButtonData(
+			x.localization.LocalizeBy(msg, "MsgUsersDisableBtn"),
+			"user_disable_"+*user.Username,
+		)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(disableBtn))
+	} else {
+		enableBtn := tgbotapi.NewInlineKeyboardButtonData(
+			x.localization.LocalizeBy(msg, "MsgUsersEnableBtn"),
+			"user_enable_"+*user.Username,
+		)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(enableBtn))
+	}
+
+	deleteBtn := tgbotapi.NewInlineKeyboardButtonData(
+		x.localization.LocalizeBy(msg, "MsgUsersDeleteBtn"),
+		"user_delete_"+*user.Username,
+	)
+	rightsBtn := tgbotapi.NewInlineKeyboardButtonData(
+		x.localization.LocalizeBy(msg, "MsgUsersRightsBtn"),
+		"user_rights_"+*user.Username,
+	)
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(deleteBtn, rightsBtn))
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	x.diplomat.ReplyWithKeyboard(log, msg, x.personality.XiifyManual(msg, infoMsg), keyboard)
+}
+
+func (x *TelegramHandler) handleUserActionCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, currentUser *entities.User) {
+	msg := query.Message
+
+	if !x.rights.IsUserHasRight(log, currentUser, "manage_users") {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersNoAccess"))
+		x.diplomat.Request(log, callback)
+		return
+	}
+
+	data := query.Data
+
+	if strings.HasPrefix(data, "user_enable_") {
+		username := strings.TrimPrefix(data, "user_enable_")
+		x.handleUserEnableCallback(log, query, username)
+		return
+	}
+
+	if strings.HasPrefix(data, "user_disable_") {
+		username := strings.TrimPrefix(data, "user_disable_")
+		x.handleUserDisableCallback(log, query, username)
+		return
+	}
+
+	if strings.HasPrefix(data, "user_delete_") {
+		username := strings.TrimPrefix(data, "user_delete_")
+		x.handleUserDeleteCallback(log, query, username)
+		return
+	}
+
+	if strings.HasPrefix(data, "user_rights_") {
+		username := strings.TrimPrefix(data, "user_rights_")
+		x.handleUserRightsCallback(log, query, username)
+		return
+	}
+}
+
+func (x *TelegramHandler) handleUserEnableCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, username string) {
+	msg := query.Message
+
+	user, err := x.users.GetUserByName(log, username)
+	if err != nil {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUserNotFound"))
+		x.diplomat.Request(log, callback)
+		return
+	}
+
+	user.IsActive = platform.BoolPtr(true)
+	_, err = x.users.UpdateUser(log, user)
+	if err != nil {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersErrorEnable"))
+		x.diplomat.Request(log, callback)
+		return
+	}
+
+	callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersEnabledCallback"))
+	x.diplomat.Request(log, callback)
+
+	successMsg := x.localization.LocalizeByTd(msg, "MsgUsersEnabled", map[string]interface{}{
+		"Username": username,
+	})
+	x.diplomat.SendMessage(log, msg, successMsg)
+
+	x.updateUserActionKeyboard(log, msg, user)
+}
+
+func (x *TelegramHandler) handleUserDisableCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, username string) {
+	msg := query.Message
+
+	callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersDisableConfirmCallback"))
+	x.diplomat.Request(log, callback)
+
+	confirmMsg := x.localization.LocalizeByTd(msg, "MsgUsersDisableConfirm", map[string]interface{}{
+		"Username": username,
+	})
+
+	cancelBtn := tgbotapi.NewInlineKeyboardButtonData(
+		x.localization.LocalizeBy(msg, "MsgUsersCancelBtn"),
+		"user_disable_cancel_"+username,
+	)
+	confirmBtn := tgbotapi.NewInlineKeyboardButtonData(
+		x.localization.LocalizeBy(msg, "MsgUsersConfirmDisableBtn"),
+		"user_disable_confirm_"+username,
+	)
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(cancelBtn, confirmBtn),
+	)
+
+	x.diplomat.SendMessageWithKeyboard(log, msg, x.personality.XiifyManualPlain(confirmMsg), keyboard)
+}
+
+func (x *TelegramHandler) handleUserDisableConfirmCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, currentUser *entities.User) {
+	msg := query.Message
+
+	if !x.rights.IsUserHasRight(log, currentUser, "manage_users") {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersNoAccess"))
+		x.diplomat.Request(log, callback)
+		return
+	}
+
+	data := query.Data
+
+	if strings.HasPrefix(data, "user_disable_cancel_") {
+		username := strings.TrimPrefix(data, "user_disable_cancel_")
+
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersDisableCancelledCallback"))
+		x.diplomat.Request(log, callback)
+
+		cancelMsg := x.localization.LocalizeByTd(msg, "MsgUsersDisableCancelled", map[string]interface{}{
+			"Username": username,
+		})
+		x.diplomat.SendMessage(log, msg, cancelMsg)
+
+		deleteMsg := tgbotapi.NewDeleteMessage(msg.Chat.ID, msg.MessageID)
+		x.diplomat.Request(log, deleteMsg)
+		return
+	}
+
+	if strings.HasPrefix(data, "user_disable_confirm_") {
+		username := strings.TrimPrefix(data, "user_disable_confirm_")
+
+		user, err := x.users.GetUserByName(log, username)
+		if err != nil {
+			callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUserNotFound"))
+			x.diplomat.Request(log, callback)
+			return
+		}
+
+		user.IsActive = platform.BoolPtr(false)
+		_, err = x.users.UpdateUser(log, user)
+		if err != nil {
+			callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersErrorDisable"))
+			x.diplomat.Request(log, callback)
+			return
+		}
+
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersDisabledCallback"))
+		x.diplomat.Request(log, callback)
+
+		successMsg := x.localization.LocalizeByTd(msg, "MsgUsersDisabled", map[string]interface{}{
+			"Username": username,
+		})
+		x.diplomat.SendMessage(log, msg, successMsg)
+
+		deleteMsg := tgbotapi.NewDeleteMessage(msg.Chat.ID, msg.MessageID)
+		x.diplomat.Request(log, deleteMsg)
+	}
+}
+
+func (x *TelegramHandler) handleUserDeleteCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, username string) {
+	msg := query.Message
+
+	callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersDeleteConfirmCallback"))
+	x.diplomat.Request(log, callback)
+
+	confirmMsg := x.localization.LocalizeByTd(msg, "MsgUsersDeleteConfirm", map[string]interface{}{
+		"Username": username,
+	})
+
+	cancelBtn := tgbotapi.NewInlineKeyboardButtonData(
+		x.localization.LocalizeBy(msg, "MsgUsersCancelBtn"),
+		"user_delete_cancel_"+username,
+	)
+	confirmBtn := tgbotapi.NewInlineKeyboardButtonData(
+		x.localization.LocalizeBy(msg, "MsgUsersConfirmDeleteBtn"),
+		"user_delete_confirm_"+username,
+	)
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(cancelBtn, confirmBtn),
+	)
+
+	x.diplomat.SendMessageWithKeyboard(log, msg, x.personality.XiifyManualPlain(confirmMsg), keyboard)
+}
+
+func (x *TelegramHandler) handleUserDeleteConfirmCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, currentUser *entities.User) {
+	msg := query.Message
+
+	if !x.rights.IsUserHasRight(log, currentUser, "manage_users") {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersNoAccess"))
+		x.diplomat.Request(log, callback)
+		return
+	}
+
+	data := query.Data
+
+	if strings.HasPrefix(data, "user_delete_cancel_") {
+		username := strings.TrimPrefix(data, "user_delete_cancel_")
+
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersDeleteCancelledCallback"))
+		x.diplomat.Request(log, callback)
+
+		cancelMsg := x.localization.LocalizeByTd(msg, "MsgUsersDeleteCancelled", map[string]interface{}{
+			"Username": username,
+		})
+		x.diplomat.SendMessage(log, msg, cancelMsg)
+
+		deleteMsg := tgbotapi.NewDeleteMessage(msg.Chat.ID, msg.MessageID)
+		x.diplomat.Request(log, deleteMsg)
+		return
+	}
+
+	if strings.HasPrefix(data, "user_delete_confirm_") {
+		username := strings.TrimPrefix(data, "user_delete_confirm_")
+
+		err := x.users.DeleteUserByName(log, username)
+		if err != nil {
+			callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersErrorRemove"))
+			x.diplomat.Request(log, callback)
+			return
+		}
+
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersDeletedCallback"))
+		x.diplomat.Request(log, callback)
+
+		successMsg := x.localization.LocalizeByTd(msg, "MsgUsersRemoved", map[string]interface{}{
+			"Username": username,
+		})
+		x.diplomat.SendMessage(log, msg, successMsg)
+
+		deleteMsg := tgbotapi.NewDeleteMessage(msg.Chat.ID, msg.MessageID)
+		x.diplomat.Request(log, deleteMsg)
+	}
+}
+
+func (x *TelegramHandler) handleUserRightsCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, username string) {
+	msg := query.Message
+
+	user, err := x.users.GetUserByName(log, username)
+	if err != nil {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUserNotFound"))
+		x.diplomat.Request(log, callback)
+		return
+	}
+
+	callback := tgbotapi.NewCallback(query.ID, "")
+	x.diplomat.Request(log, callback)
+
+	x.sendUserRightsMessage(log, msg, user)
+}
+
+func (x *TelegramHandler) handleUserRightsToggleCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, currentUser *entities.User) {
+	msg := query.Message
+
+	if !x.rights.IsUserHasRight(log, currentUser, "manage_users") {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersNoAccess"))
+		x.diplomat.Request(log, callback)
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(query.Data, "user_right_"), "_", 2)
+	if len(parts) != 2 {
+		return
+	}
+
+	right := parts[0]
+	username := parts[1]
+
+	user, err := x.users.GetUserByName(log, username)
+	if err != nil {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUserNotFound"))
+		x.diplomat.Request(log, callback)
+		return
+	}
+
+	hasRight := false
+	for _, r := range user.Rights {
+		if r == right {
+			hasRight = true
+			break
+		}
+	}
+
+	if hasRight {
+		newRights := []string{}
+		for _, r := range user.Rights {
+			if r != right {
+				newRights = append(newRights, r)
+			}
+		}
+		user.Rights = newRights
+	} else {
+		user.Rights = append(user.Rights, right)
+	}
+
+	_, err = x.users.UpdateUser(log, user)
+	if err != nil {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersErrorEdit"))
+		x.diplomat.Request(log, callback)
+		return
+	}
+
+	action := x.localization.LocalizeBy(msg, "MsgUsersRightAdded")
+	if hasRight {
+		action = x.localization.LocalizeBy(msg, "MsgUsersRightRemoved")
+	}
+
+	callback := tgbotapi.NewCallback(query.ID, action)
+	x.diplomat.Request(log, callback)
+
+	x.updateUserRightsKeyboard(log, msg, user)
+}
+
+func (x *TelegramHandler) sendUserRightsMessage(log *tracing.Logger, msg *tgbotapi.Message, user *entities.User) {
+	allRights := []struct {
+		Key  string
+		Desc string
+	}{
+		{"switch_mode", "управление режимами в чатах"},
+		{"edit_mode", "редактирование режимов"},
 		{"manage_users", "управление пользователями"},
 		{"manage_context", "управление контекстом"},
 		{"broadcast", "отправка рассылок"},
 		{"manage_tariffs", "управление тарифами"},
 	}
 
-	var rightsInfo strings.Builder
-	rightsInfo.WriteString("📋 **Права пользователя @" + *user.Username + "**\n\n")
+	var rightsInfo strings.Builder
+	rightsInfo.WriteString("📋 **Права пользователя @" + *user.Username + "**\n\n")
+
+	for _, r := range allRights {
+		hasRight := false
+		for _, ur := range user.Rights {
+			if ur == r.Key {
+				hasRight = true
+				break
+			}
+		}
+
+		icon := "❌"
+		if hasRight {
+			icon = "✅"
+		}
+
+		displayName := x.formatRightName(r.Key)
+		rightsInfo.WriteString(fmt.Sprintf("%s **%s** — %s\n", icon, displayName, r.Desc))
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, r := range allRights {
+		hasRight := false
+		for _, ur := range user.Rights {
+			if ur == r.Key {
+				hasRight = true
+				break
+			}
+		}
+
+		icon := "❌"
+		if hasRight {
+			icon = "✅"
+		}
+
+		displayName := x.formatRightName(r.Key)
+		btn := tgbotapi.NewInlineKeyboardButtonData(
+			icon+" "+displayName,
+			"user_right_"+r.Key+"_"+*user.Username,
+		)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(btn))
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	sendMsg := tgbotapi.NewMessage(msg.Chat.ID, rightsInfo.String())
+	sendMsg.ParseMode = "Markdown"
+	sendMsg.ReplyMarkup = keyboard
+	x.diplomat.send(log, msg, sendMsg)
+}
+
+func (x *TelegramHandler) updateUserRightsKeyboard(log *tracing.Logger, msg *tgbotapi.Message, user *entities.User) {
+	allRights := []string{"switch_mode", "edit_mode", "manage_users", "manage_context", "broadcast", "manage_tariffs"}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, r := range allRights {
+		hasRight := false
+		for _, ur := range user.Rights {
+			if ur == r {
+				hasRight = true
+				break
+			}
+		}
+
+		icon := "❌"
+		if hasRight {
+			icon = "✅"
+		}
+
+		displayName := x.formatRightName(r)
+		btn := tgbotapi.NewInlineKeyboardButtonData(
+			icon+" "+displayName,
+			"user_right_"+r+"_"+*user.Username,
+		)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(btn))
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	editMarkup := tgbotapi.NewEditMessageReplyMarkup(msg.Chat.ID, msg.MessageID, keyboard)
+	x.diplomat.Request(log, editMarkup)
+}
+
+func (x *TelegramHandler) updateUserActionKeyboard(log *tracing.Logger, msg *tgbotapi.Message, user *entities.User) {
+	var rows [][]tgbotapi.InlineKeyboardButton
+
+	if platform.BoolValue(user.IsActive, true) {
+		disableBtn := tgbotapi.NewInlineKeyboardButtonData(
+			x.localization.LocalizeBy(msg, "MsgUsersDisableBtn"),
+			"user_disable_"+*user.Username,
+		)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(disableBtn))
+	} else {
+		enableBtn := tgbotapi.NewInlineKeyboardButtonData(
+			x.localization.LocalizeBy(msg, "MsgUsersEnableBtn"),
+			"user_enable_"+*user.Username,
+		)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(enableBtn))
+	}
+
+	deleteBtn := tgbotapi.NewInlineKeyboardButtonData(
+		x.localization.LocalizeBy(msg, "MsgUsersDeleteBtn"),
+		"user_delete_"+*user.Username,
+	)
+	rightsBtn := tgbotapi.NewInlineKeyboardButtonData(
+		x.localization.LocalizeBy(msg, "MsgUsersRightsBtn"),
+		"user_rights_"+*user.Username,
+	)
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(deleteBtn, rightsBtn))
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+
+	editMarkup := tgbotapi.NewEditMessageReplyMarkup(msg.Chat.ID, msg.MessageID, keyboard)
+	x.diplomat.Request(log, editMarkup)
+}
+
+func (x *TelegramHandler) formatRightName(right string) string {
+	parts := strings.Split(right, "_")
+	for i, p := range parts {
+		if len(p) > 0 {
+			parts[i] = strings.ToUpper(string(p[0])) + p[1:]
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (x *TelegramHandler) retrieveUserByName(log *tracing.Logger, msg *tgbotapi.Message, username string) *entities.User {
+	username = strings.TrimPrefix(username, "@")
+	if username == "" {
+		x.diplomat.Reply(log, msg, x.localization.LocalizeBy(msg, "MsgUserNotSpecified"))
+		return nil
+	}
+
+	user, err := x.users.GetUserByName(log, username)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.localization.LocalizeByTd(msg, "MsgUserNotFound", map[string]interface{}{
+			"Username": username,
+		}))
+		return nil
+	}
+
+	return user
+}
+
+func (x *TelegramHandler) treat(rights []string) []string {
+	var treated []string
+	for _, right := range rights {
+		right = strings.ToLower(strings.TrimSpace(right))
+		if slices.Contains(repository.AvailableRights, right) {
+			treated = append(treated, right)
+		}
+	}
+	return treated
+}
+
+// =========================  /stats command handlers  =========================
+
+func (x *TelegramHandler) StatsCommand(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	defer tracing.ProfilePoint(log, "Stats command completed", "telegram.command.stats", "chat_id", msg.Chat.ID)()
+	statsErrorMsg := x.localization.LocalizeBy(msg, "MsgStatsError")
+
+	totalQuestions, err := x.messages.GetTotalUserQuestionsCount(log)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	chatQuestions, err := x.messages.GetUserQuestionsInChatCount(log, msg.Chat.ID)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	userQuestions, err := x.messages.GetUserPersonalQuestionsCount(log, user)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	userChatQuestions, err := x.messages.GetUserPersonalQuestionsInChatCount(log, user, msg.Chat.ID)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	totalUsers, err := x.users.GetTotalUsersCount(log)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	totalChats, err := x.messages.GetUniqueChatCount(log)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	totalCost, err := x.usage.GetTotalCost(log)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	totalCostLastMonth, err := x.usage.GetTotalCostLastMonth(log)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	avgDailyCost, err := x.usage.GetAverageDailyCost(log)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	totalTokens, err := x.usage.GetTotalTokens(log)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	totalTokensLastMonth, err := x.usage.GetTotalTokensLastMonth(log)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	anotherTotalCost, err := x.usage.GetTotalAnotherCost(log)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	anotherTotalCostLastMonth, err := x.usage.GetTotalAnotherCostLastMonth(log)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	anotherTotalTokens, err := x.usage.GetTotalAnotherTokens(log)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	anotherTotalTokensLastMonth, err := x.usage.GetTotalAnotherTokensLastMonth(log)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	userCost, err := x.usage.GetUserCost(log, user)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	userCostLastMonth, err := x.usage.GetUserCostLastMonth(log, user)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	userAvgDailyCost, err := x.usage.GetUserAverageDailyCost(log, user)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	userTokens, err := x.usage.GetUserTokens(log, user)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	userTokensLastMonth, err := x.usage.GetUserTokensLastMonth(log, user)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	userAnotherCost, err := x.usage.GetUserAnotherCost(log, user)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	userAnotherCostLastMonth, err := x.usage.GetUserAnotherCostLastMonth(log, user)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	userAnotherTokens, err := x.usage.GetUserAnotherTokens(log, user)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	userAnotherTokensLastMonth, err := x.usage.GetUserAnotherTokensLastMonth(log, user)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		return
+	}
+
+	title := x.localization.LocalizeBy(msg, "MsgStatsTitle")
+
+	generalStats := x.localization.LocalizeByTd(msg, "MsgStatsGeneral", map[string]interface{}{
+		"TotalQuestions":           format.Numberify(totalQuestions),
+		"ChatQuestions":            format.Numberify(chatQuestions),
+		"TotalCost":                totalCost.String(),
+		"MonthlyCost":              totalCostLastMonth.String(),
+		"DailyCost":                format.CurrencifyDecimal(avgDailyCost),
+		"TotalTokens":              format.Numberify(totalTokens),
+		"MonthlyTokens":            format.Numberify(totalTokensLastMonth),
+		"AnotherTotalCost":         anotherTotalCost.String(),
+		"AnotherMonthlyCost":       anotherTotalCostLastMonth.String(),
+		"AnotherTotalTokens":       format.Numberify(anotherTotalTokens),
+		"AnotherMonthlyTokens":     format.Numberify(anotherTotalTokensLastMonth),
+	})
+
+	personalStats := x.localization.LocalizeByTd(msg, "MsgStatsPersonal", map[string]interface{}{
+		"TotalQuestions":           format.Numberify(userQuestions),
+		"ChatQuestions":            format.Numberify(userChatQuestions),
+		"TotalCost":                format.CurrencifyDecimal(userCost),
+		"MonthlyCost":              format.CurrencifyDecimal(userCostLastMonth),
+		"DailyCost":                format.CurrencifyDecimal(userAvgDailyCost),
+		"TotalTokens":              format.Numberify(userTokens),
+		"MonthlyTokens":            format.Numberify(userTokensLastMonth),
+		"AnotherTotalCost":         format.CurrencifyDecimal(userAnotherCost),
+		"AnotherMonthlyCost":       format.CurrencifyDecimal(userAnotherCostLastMonth),
+		"AnotherTotalTokens":       format.Numberify(userAnotherTokens),
+		"AnotherMonthlyTokens":     format.Numberify(userAnotherTokensLastMonth),
+	})
+
+	usersStats := x.localization.LocalizeByTd(msg, "MsgStatsUsers", map[string]interface{}{
+		"Users": format.Numberify(totalUsers),
+		"Chats": format.Numberify(totalChats),
+	})
+
+	response := title + generalStats + personalStats + usersStats
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, response))
+}
+
+func (x *TelegramHandler) PersonalizationCommandInfo(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	infoMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationInfo")
+
+	addBtn := tgbotapi.NewInlineKeyboardButtonData(
+		x.localization.LocalizeBy(msg, "MsgPersonalizationAddBtn"),
+		"personalization_add",
+	)
+	removeBtn := tgbotapi.NewInlineKeyboardButtonData(
+		x.localization.LocalizeBy(msg, "MsgPersonalizationRemoveBtn"),
+		"personalization_remove",
+	)
+	printBtn := tgbotapi.NewInlineKeyboardButtonData(
+		x.localization.LocalizeBy(msg, "MsgPersonalizationPrintBtn"),
+		"personalization_print",
+	)
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(addBtn, removeBtn),
+		tgbotapi.NewInlineKeyboardRow(printBtn),
+	)
+
+	x.diplomat.ReplyWithKeyboard(log, msg, x.personality.XiifyManual(msg, infoMsg), keyboard)
+}
+
+func (x *TelegramHandler) handlePersonalizationCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, user *entities.User) {
+	msg := query.Message
+
+	switch query.Data {
+	case "personalization_add":
+		err := x.chatState.InitPersonalizationEdit(log, msg.Chat.ID, query.From.ID)
+		if err != nil {
+			log.E("Failed to init personalization state", tracing.InnerError, err)
+			return
+		}
+
+		callback := tgbotapi.NewCallback(query.ID, "")
+		x.diplomat.Request(log, callback)
+
+		awaitingMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationAwaitingInput")
+		x.diplomat.SendMessage(log, msg, x.personality.XiifyManualPlain(awaitingMsg))
+
+	case "personalization_remove":
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgPersonalizationDeleteConfirmCallback"))
+		x.diplomat.Request(log, callback)
+
+		confirmMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationDeleteConfirm")
+
+		cancelBtn := tgbotapi.NewInlineKeyboardButtonData(
+			x.localization.LocalizeBy(msg, "MsgPersonalizationDeleteCancelBtn"),
+			"personalization_delete_cancel",
+		)
+		confirmBtn := tgbotapi.NewInlineKeyboardButtonData(
+			x.localization.LocalizeBy(msg, "MsgPersonalizationDeleteConfirmBtn"),
+			"personalization_delete_confirm",
+		)
+
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(
+			tgbotapi.NewInlineKeyboardRow(cancelBtn, confirmBtn),
+		)
+
+		x.diplomat.SendMessageWithKeyboard(log, msg, x.personality.XiifyManualPlain(confirmMsg), keyboard)
+
+	case "personalization_print":
+		personalization, err := x.personalizations.GetPersonalizationByUser(log, user)
+		if err != nil {
+			if errors.Is(err, repository.ErrPersonalizationNotFound) {
+				callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgPersonalizationNotFound"))
+				x.diplomat.Request(log, callback)
+				return
+			}
+
+			log.E("Failed to get personalization", tracing.InnerError, err)
+			callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgPersonalizationErrorPrint"))
+			x.diplomat.Request(log, callback)
+			return
+		}
+
+		callback := tgbotapi.NewCallback(query.ID, "")
+		x.diplomat.Request(log, callback)
+
+		response := x.localization.LocalizeByTd(msg, "MsgPersonalizationPrint", map[string]interface{}{
+			"Info": personalization.Prompt,
+		})
+		x.diplomat.SendMessage(log, msg, x.personality.XiifyManual(msg, response))
+	}
+}
+
+func (x *TelegramHandler) handlePersonalizationDeleteCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, user *entities.User) {
+	msg := query.Message
+
+	if query.Data == "personalization_delete_cancel" {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgPersonalizationDeleteCancelledCallback"))
+		x.diplomat.Request(log, callback)
+
+		cancelMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationDeleteCancelled")
+		x.diplomat.SendMessage(log, msg, x.personality.XiifyManual(msg, cancelMsg))
+
+		deleteMsg := tgbotapi.NewDeleteMessage(msg.Chat.ID, msg.MessageID)
+		x.diplomat.Request(log, deleteMsg)
+		return
+	}
+
+	err := x.personalizations.DeletePersonalization(log, user)
+	if err != nil {
+		if errors.Is(err, repository.ErrPersonalizationNotFound) {
+			callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgPersonalizationNotFound"))
+			x.diplomat.Request(log, callback)
+
+			deleteMsg := tgbotapi.NewDeleteMessage(msg.Chat.ID, msg.MessageID)
+			x.diplomat.Request(log, deleteMsg)
+			return
+		}
+
+		log.E("Failed to delete personalization", tracing.InnerError, err)
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgPersonalizationErrorRemove"))
+		x.diplomat.Request(log, callback)
+		return
+	}
+
+	callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgPersonalizationDeletedCallback"))
+	x.diplomat.Request(log, callback)
+
+	successMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationRemoved")
+	x.diplomat.SendMessage(log, msg, x.personality.XiifyManual(msg, successMsg))
+
+	deleteMsg := tgbotapi.NewDeleteMessage(msg.Chat.ID, msg.MessageID)
+	x.diplomat.Request(log, deleteMsg)
+}
+
+func (x *TelegramHandler) handlePersonalizationInput(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	prompt := strings.TrimSpace(msg.Text)
+
+	x.chatState.ClearState(log, msg.Chat.ID, msg.From.ID)
+
+	promptRunes := []rune(prompt)
+	if len(promptRunes) < 12 {
+		errorMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationTooShort")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	if len(promptRunes) > 1024 {
+		errorMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationTooLong")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	validation, err := x.agents.ValidatePersonalization(log, prompt)
+	if err != nil {
+		log.E("Failed to validate personalization with agent", tracing.InnerError, err)
+		errorMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationValidationError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	if validation.Confidence <= 0.68 {
+		log.I("Personalization validation failed", "confidence", validation.Confidence)
+		errorMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationValidationFailed")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	_, err = x.personalizations.CreateOrUpdatePersonalization(log, user, prompt)
+	if err != nil {
+		if errors.Is(err, repository.ErrPersonalizationTooShort) {
+			errorMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationTooShort")
+			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+			return
+		}
+
+		if errors.Is(err, repository.ErrPersonalizationTooLong) {
+			errorMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationTooLong")
+			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+			return
+		}
+
+		log.E("Failed to create personalization", tracing.InnerError, err)
+		errorMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationErrorAdd")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	log.I("Personalization set successfully", "confidence", validation.Confidence)
+	successMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationAdded")
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, successMsg))
+}
+
+// =========================  /context command handlers  =========================
+
+func (x *TelegramHandler) ContextCommandRefresh(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	err := x.contextManager.Clear(log, x.contextManager.Chat(log, msg))
+	if err != nil {
+		log.E("Failed to clear context", tracing.InnerError, err)
+		errorMsg := x.localization.LocalizeBy(msg, "MsgContextRefreshError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	successMsg := x.localization.LocalizeBy(msg, "MsgContextRefreshed")
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, successMsg))
+}
+
+func (x *TelegramHandler) ContextCommandInfo(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	grade, err := x.donations.GetUserGrade(log, user)
+	if err != nil {
+		log.W("Failed to get user grade, using bronze", tracing.InnerError, err)
+		grade = platform.GradeBronze
+	}
+
+	model, _ := x.dialer.EffectiveModel(log, user, msg.Chat.ID, grade)
+	stats, err := x.contextManager.GetStats(log, x.contextManager.Chat(log, msg), grade, model)
+	if err != nil {
+		log.E("Failed to get context stats", tracing.InnerError, err)
+		errorMsg := x.localization.LocalizeBy(msg, "MsgContextInfoError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	statusText := x.localization.LocalizeBy(msg, "MsgContextStatusEnabled")
+	if !stats.Enabled {
+		statusText = x.localization.LocalizeBy(msg, "MsgContextStatusDisabled")
+	}
+
+	estimate := x.localization.LocalizeBy(msg, "MsgContextEstimateUnknown")
+	if stats.IsCostEstimated {
+		estimate = "$" + stats.EstimatedCost.StringFixed(4)
+	}
+
+	infoMsg := x.localization.LocalizeByTd(msg, "MsgContextInfo", map[string]interface{}{
+		"Status":          statusText,
+		"Branch":          stats.Branch,
+		"CurrentMessages": format.Numberify(int64(stats.CurrentMessages)),
+		"MaxMessages":     format.Numberify(int64(stats.MaxMessages)),
+		"CurrentTokens":   format.Numberify(int64(stats.CurrentTokens)),
+		"MaxTokens":       format.Numberify(int64(stats.MaxTokens)),
+		"Model":           stats.Model,
+		"Estimate":        estimate,
+	})
+
+	canManage := msg.Chat.Type == "private" || x.rights.IsUserHasRight(log, user, "manage_context")
+
+	if !canManage {
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, infoMsg))
+		return
+	}
+
+	keyboard := x.contextKeyboard(msg, stats.Enabled)
+	x.diplomat.ReplyWithKeyboard(log, msg, x.personality.XiifyManual(msg, infoMsg), keyboard)
+}
+
+func (x *TelegramHandler) contextKeyboard(msg *tgbotapi.Message, enabled bool) tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+
+	clearBtn := tgbotapi.NewInlineKeyboardButtonData(
+		x.localization.LocalizeBy(msg, "MsgContextClearBtn"),
+		"context_clear",
+	)
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(clearBtn))
+
+	if enabled {
+		disableBtn := tgbotapi.NewInlineKeyboardButtonData(
+			x.localization.LocalizeBy(msg, "MsgContextDisableBtn"),
+			"context_disable",
+		)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(disableBtn))
+	} else {
+		enableBtn := tgbotapi.NewInlineKeyboardButtonData(
+			x.localization.LocalizeBy(msg, "MsgContextEnableBtn"),
+			"context_enable",
+		)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(enableBtn))
+	}
+
+	exportBtn := tgbotapi.NewInlineKeyboardButtonData(
+		x.localization.LocalizeBy(msg, "MsgContextExportBtn"),
+		"context_export",
+	)
+	importBtn := tgbotapi.NewInlineKeyboardButtonData(
+		x.localization.LocalizeBy(msg, "MsgContextImportBtn"),
+		"context_import",
+	)
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(exportBtn, importBtn))
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func (x *TelegramHandler) handleContextToggleCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, user *entities.User) {
+	msg := query.Message
+
+	if msg.Chat.Type != "private" && !x.rights.IsUserHasRight(log, user, "manage_context") {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextNoAccess"))
+		if _, err := x.diplomat.Request(log, callback); err != nil {
+			log.E("Failed to answer callback", tracing.InnerError, err)
+		}
+		return
+	}
+
+	var enable bool
+	var successMsgKey string
+	var errorMsgKey string
+	var callbackMsgKey string
+
+	if query.Data == "context_enable" {
+		enable = true
+		successMsgKey = "MsgContextEnabled"
+		errorMsgKey = "MsgContextEnableError"
+		callbackMsgKey = "MsgContextEnabledCallback"
+	} else {
+		enable = false
+		successMsgKey = "MsgContextDisabled"
+		errorMsgKey = "MsgContextDisableError"
+		callbackMsgKey = "MsgContextDisabledCallback"
+	}
+
+	err := x.contextManager.SetEnabled(log, platform.ChatID(msg.Chat.ID), enable)
+	if err != nil {
+		log.E("Failed to toggle context", tracing.InnerError, err)
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, errorMsgKey))
+		if _, err := x.diplomat.Request(log, callback); err != nil {
+			log.E("Failed to answer callback", tracing.InnerError, err)
+		}
+		return
+	}
+
+	callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, callbackMsgKey))
+	if _, err := x.diplomat.Request(log, callback); err != nil {
+		log.E("Failed to answer callback", tracing.InnerError, err)
+	}
+
+	successMsg := x.localization.LocalizeBy(msg, successMsgKey)
+	x.diplomat.SendMessage(log, msg, x.personality.XiifyManual(msg, successMsg))
+
+	newKeyboard := x.contextKeyboard(msg, enable)
+
+	editMsg := tgbotapi.NewEditMessageReplyMarkup(msg.Chat.ID, msg.MessageID, newKeyboard)
+	if _, err := x.diplomat.Request(log, editMsg); err != nil {
+		log.E("Failed to edit message keyboard", tracing.InnerError, err)
+	}
+}
+
+func (x *TelegramHandler) handleContextClearCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, user *entities.User) {
+	msg := query.Message
+
+	if msg.Chat.Type != "private" && !x.rights.IsUserHasRight(log, user, "manage_context") {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextNoAccess"))
+		if _, err := x.diplomat.Request(log, callback); err != nil {
+			log.E("Failed to answer callback", tracing.InnerError, err)
+		}
+		return
+	}
+
+	callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextClearConfirmCallback"))
+	if _, err := x.diplomat.Request(log, callback); err != nil {
+		log.E("Failed to answer callback", tracing.InnerError, err)
+	}
+
+	confirmMsg := x.localization.LocalizeBy(msg, "MsgContextClearConfirm")
+
+	cancelBtn := tgbotapi.NewInlineKeyboardButtonData(
+		x.localization.LocalizeBy(msg, "MsgContextClearCancelBtn"),
+		"context_clear_cancel",
+	)
+	confirmBtn := tgbotapi.NewInlineKeyboardButtonData(
+		x.localization.LocalizeBy(msg, "MsgContextClearConfirmBtn"),
+		"context_clear_confirm",
+	)
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(cancelBtn, confirmBtn),
+	)
+
+	x.diplomat.SendMessageWithKeyboard(log, msg, x.personality.XiifyManual(msg, confirmMsg), keyboard)
+}
+
+func (x *TelegramHandler) handleContextClearConfirmCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, user *entities.User) {
+	msg := query.Message
+
+	if msg.Chat.Type != "private" && !x.rights.IsUserHasRight(log, user, "manage_context") {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextNoAccess"))
+		if _, err := x.diplomat.Request(log, callback); err != nil {
+			log.E("Failed to answer callback", tracing.InnerError, err)
+		}
+		return
+	}
+
+	if query.Data == "context_clear_cancel" {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextClearCancelledCallback"))
+		if _, err := x.diplomat.Request(log, callback); err != nil {
+			log.E("Failed to answer callback", tracing.InnerError, err)
+		}
+
+		cancelMsg := x.localization.LocalizeBy(msg, "MsgContextClearCancelled")
+		x.diplomat.SendMessage(log, msg, x.personality.XiifyManual(msg, cancelMsg))
+
+		deleteMsg := tgbotapi.NewDeleteMessage(msg.Chat.ID, msg.MessageID)
+		if _, err := x.diplomat.Request(log, deleteMsg); err != nil {
+			log.E("Failed to delete confirmation message", tracing.InnerError, err)
+		}
+		return
+	}
+
+	err := x.contextManager.Clear(log, x.contextManager.Chat(log, msg))
+	if err != nil {
+		log.E("Failed to clear context", tracing.InnerError, err)
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextRefreshError"))
+		if _, err := x.diplomat.Request(log, callback); err != nil {
+			log.E("Failed to answer callback", tracing.InnerError, err)
+		}
+		return
+	}
+
+	callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextClearedCallback"))
+	if _, err := x.diplomat.Request(log, callback); err != nil {
+		log.E("Failed to answer callback", tracing.InnerError, err)
+	}
+
+	successMsg := x.localization.LocalizeBy(msg, "MsgContextRefreshed")
+	x.diplomat.SendMessage(log, msg, x.personality.XiifyManual(msg, successMsg))
+
+	deleteMsg := tgbotapi.NewDeleteMessage(msg.Chat.ID, msg.MessageID)
+	if _, err := x.diplomat.Request(log, deleteMsg); err != nil {
+		log.E("Failed to delete confirmation message", tracing.InnerError, err)
+	}
+}
+
+func (x *TelegramHandler) ContextCommandExport(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	defer tracing.ProfilePoint(log, "Context command export completed", "telegram.command.context.export", "chat_id", msg.Chat.ID)()
+
+	bundle, err := x.contextManager.Export(log, x.contextManager.Chat(log, msg))
+	if err != nil {
+		log.E("Failed to export context", tracing.InnerError, err)
+		errorMsg := x.localization.LocalizeBy(msg, "MsgContextExportError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	if len(bundle.Messages) == 0 {
+		emptyMsg := x.localization.LocalizeBy(msg, "MsgContextExportEmpty")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, emptyMsg))
+		return
+	}
+
+	jsonData, err := bundle.JSON()
+	if err != nil {
+		log.E("Failed to marshal context bundle", tracing.InnerError, err)
+		errorMsg := x.localization.LocalizeBy(msg, "MsgContextExportError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	baseName := fmt.Sprintf("xi-context-%d-%s", msg.Chat.ID, bundle.ExportedAt.Format("20060102-150405"))
+	caption := x.localization.LocalizeByTd(msg, "MsgContextExportCaption", map[string]interface{}{
+		"Count": len(bundle.Messages),
+	})
+
+	if err := x.diplomat.ReplyDocument(log, msg, baseName+".md", bundle.Markdown(), ""); err != nil {
+		errorMsg := x.localization.LocalizeBy(msg, "MsgContextExportError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	if err := x.diplomat.ReplyDocument(log, msg, baseName+".json", jsonData, caption); err != nil {
+		errorMsg := x.localization.LocalizeBy(msg, "MsgContextExportError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	log.I("Context exported", "message_count", len(bundle.Messages))
+}
+
+func (x *TelegramHandler) ContextCommandImportStart(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	if err := x.chatState.InitContextImport(log, msg.Chat.ID, msg.From.ID); err != nil {
+		log.E("Failed to init context import state", tracing.InnerError, err)
+		errorMsg := x.localization.LocalizeBy(msg, "MsgContextImportError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	promptMsg := x.localization.LocalizeBy(msg, "MsgContextImportPrompt")
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, promptMsg))
+}
+
+func (x *TelegramHandler) handleContextImportInput(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	defer tracing.ProfilePoint(log, "Context import input completed", "telegram.command.context.import.input", "chat_id", msg.Chat.ID)()
+
+	if msg.Document == nil {
+		notDocumentMsg := x.localization.LocalizeBy(msg, "MsgContextImportNotDocument")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, notDocumentMsg))
+		return
+	}
+
+	if msg.Document.FileSize > contextImportMaxFileSize {
+		tooLargeMsg := x.localization.LocalizeBy(msg, "MsgContextImportTooLarge")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, tooLargeMsg))
+		return
+	}
+
+	data, err := x.downloadDocument(log, msg.Document.FileID, contextImportMaxFileSize)
+	if err != nil {
+		log.E("Failed to download context file", tracing.InnerError, err)
+		errorMsg := x.localization.LocalizeBy(msg, "MsgContextImportError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	bundle, err := artificial.ParseContextBundle(data)
+	if err != nil {
+		log.W("Invalid context file", tracing.InnerError, err)
+		invalidMsg := x.localization.LocalizeByTd(msg, "MsgContextImportInvalid", map[string]interface{}{
+			"Error": err.Error(),
+		})
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, invalidMsg))
+		return
+	}
+
+	grade, err := x.donations.GetUserGrade(log, user)
+	if err != nil {
+		log.W("Failed to get user grade, using bronze", tracing.InnerError, err)
+		grade = platform.GradeBronze
+	}
+
+	if err := x.contextManager.Import(log, x.contextManager.Chat(log, msg), grade, bundle); err != nil {
+		log.E("Failed to import context", tracing.InnerError, err)
+		errorMsg := x.localization.LocalizeBy(msg, "MsgContextImportError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	if err := x.chatState.ClearState(log, msg.Chat.ID, msg.From.ID); err != nil {
+		log.E("Failed to clear chat state", tracing.InnerError, err)
+	}
+
+	successMsg := x.localization.LocalizeByTd(msg, "MsgContextImported", map[string]interface{}{
+		"Count": len(bundle.Messages),
+	})
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, successMsg))
+}
+
+func (x *TelegramHandler) handleContextTransferCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, user *entities.User) {
+	msg := query.Message
+
+	if msg.Chat.Type != "private" && !x.rights.IsUserHasRight(log, user, "manage_context") {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextNoAccess"))
+		if _, err := x.diplomat.Request(log, callback); err != nil {
+			log.E("Failed to answer callback", tracing.InnerError, err)
+		}
+		return
+	}
+
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := x.diplomat.Request(log, callback); err != nil {
+		log.E("Failed to answer callback", tracing.InnerError, err)
+	}
+
+	// The callback message belongs to the bot, so act on behalf of the user who pressed the button
+	origin := *msg
+	origin.From = query.From
+
+	if query.Data == "context_export" {
+		x.ContextCommandExport(log, user, &origin)
+		return
+	}
+
+	x.ContextCommandImportStart(log, user, &origin)
+}
+
+func (x *TelegramHandler) downloadDocument(log *tracing.Logger, fileID string, maxSize int64) ([]byte, error) {
+	fileURL, err := x.diplomat.FileURL(fileID)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.Get(fileURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d while downloading document", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("document exceeds %d bytes", maxSize)
+	}
+
+	log.I("Document downloaded", "file_size", len(data))
+	return data, nil
+}
+
+func (x *TelegramHandler) ContextCommandView(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, page int) {
+	defer tracing.ProfilePoint(log, "Context command view completed", "telegram.command.context.view", "chat_id", msg.Chat.ID, "page", page)()
+
+	history, err := x.contextManager.History(log, x.contextManager.Chat(log, msg))
+	if err != nil {
+		log.E("Failed to get context history", tracing.InnerError, err)
+		errorMsg := x.localization.LocalizeBy(msg, "MsgContextInfoError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	if len(history) == 0 {
+		emptyMsg := x.localization.LocalizeBy(msg, "MsgContextViewEmpty")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, emptyMsg))
+		return
+	}
+
+	text, keyboard := x.renderContextPage(msg, history, page)
+	x.diplomat.ReplyWithKeyboard(log, msg, x.personality.XiifyManual(msg, text), keyboard)
+}
+
+func (x *TelegramHandler) handleContextViewCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, user *entities.User) {
+	msg := query.Message
+
+	if msg.Chat.Type != "private" && !x.rights.IsUserHasRight(log, user, "manage_context") {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextNoAccess"))
+		if _, err := x.diplomat.Request(log, callback); err != nil {
+			log.E("Failed to answer callback", tracing.InnerError, err)
+		}
+		return
+	}
+
+	page, err := strconv.Atoi(strings.TrimPrefix(query.Data, "context_view_"))
+	if err != nil {
+		log.E("Invalid context view callback data", "data", query.Data, tracing.InnerError, err)
+		return
+	}
+
+	history, err := x.contextManager.History(log, x.contextManager.Chat(log, msg))
+	if err != nil {
+		log.E("Failed to get context history", tracing.InnerError, err)
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextInfoError"))
+		if _, err := x.diplomat.Request(log, callback); err != nil {
+			log.E("Failed to answer callback", tracing.InnerError, err)
+		}
+		return
+	}
+
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := x.diplomat.Request(log, callback); err != nil {
+		log.E("Failed to answer callback", tracing.InnerError, err)
+	}
+
+	if len(history) == 0 {
+		emptyMsg := x.localization.LocalizeBy(msg, "MsgContextViewEmpty")
+		x.diplomat.EditMessageWithKeyboard(log, msg.Chat.ID, msg.MessageID, x.personality.XiifyManual(msg, emptyMsg), tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}})
+		return
+	}
+
+	text, keyboard := x.renderContextPage(msg, history, page)
+	x.diplomat.EditMessageWithKeyboard(log, msg.Chat.ID, msg.MessageID, x.personality.XiifyManual(msg, text), keyboard)
+}
+
+func (x *TelegramHandler) renderContextPage(msg *tgbotapi.Message, history []platform.RedisMessage, page int) (string, tgbotapi.InlineKeyboardMarkup) {
+	totalPages := (len(history) + contextViewPageSize - 1) / contextViewPageSize
+	if page < 1 {
+		page = 1
+	}
+	if page > totalPages {
+		page = totalPages
+	}
+
+	var builder strings.Builder
+	builder.WriteString(x.localization.LocalizeByTd(msg, "MsgContextViewHeader", map[string]interface{}{
+		"Page":  page,
+		"Pages": totalPages,
+		"Total": len(history),
+	}))
+
+	for idx, entry := range history {
+		if entry.IsCompressed {
+			builder.WriteString(x.localization.LocalizeByTd(msg, "MsgContextViewSummary", map[string]interface{}{
+				"Index":   idx + 1,
+				"Content": contextPreview(entry.Content, contextViewPreviewLength*2),
+			}))
+		}
+	}
+
+	start := (page - 1) * contextViewPageSize
+	end := min(start+contextViewPageSize, len(history))
+
+	for idx := start; idx < end; idx++ {
+		entry := history[idx]
+		if entry.IsCompressed {
+			continue
+		}
+
+		roleKey := "MsgContextViewRoleUser"
+		if entry.Role == platform.MessageRoleAssistant {
+			roleKey = "MsgContextViewRoleAssistant"
+		}
+
+		builder.WriteString(x.localization.LocalizeByTd(msg, "MsgContextViewEntry", map[string]interface{}{
+			"Index":   idx + 1,
+			"Role":    x.localization.LocalizeBy(msg, roleKey),
+			"Content": contextPreview(entry.Content, contextViewPreviewLength),
+		}))
+	}
+
+	builder.WriteString(x.localization.LocalizeBy(msg, "MsgContextViewFooter"))
+
+	var buttons []tgbotapi.InlineKeyboardButton
+	if page > 1 {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(
+			x.localization.LocalizeBy(msg, "MsgContextViewPrevBtn"),
+			fmt.Sprintf("context_view_%d", page-1),
+		))
+	}
+	if page < totalPages {
+		buttons = append(buttons, tgbotapi.NewInlineKeyboardButtonData(
+			x.localization.LocalizeBy(msg, "MsgContextViewNextBtn"),
+			fmt.Sprintf("context_view_%d", page+1),
+		))
+	}
+
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}
+	if len(buttons) > 0 {
+		keyboard = tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(buttons...))
+	}
+
+	return builder.String(), keyboard
+}
+
+func contextPreview(content string, limit int) string {
+	content = strings.Join(strings.Fields(content), " ")
+	runes := []rune(content)
+	if len(runes) <= limit {
+		return content
+	}
+	return string(runes[:limit]) + "…"
+}
+
+func (x *TelegramHandler) ContextCommandDrop(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, spec string) {
+	defer tracing.ProfilePoint(log, "Context command drop completed", "telegram.command.context.drop", "chat_id", msg.Chat.ID, "spec", spec)()
+
+	history, err := x.contextManager.History(log, x.contextManager.Chat(log, msg))
+	if err != nil {
+		log.E("Failed to get context history", tracing.InnerError, err)
+		errorMsg := x.localization.LocalizeBy(msg, "MsgContextInfoError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	if len(history) == 0 {
+		emptyMsg := x.localization.LocalizeBy(msg, "MsgContextViewEmpty")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, emptyMsg))
+		return
+	}
+
+	// Positions are 1-based, so index 0 produced by Expand is meaningless here
+	positions := slices.DeleteFunc(indices.Expand(log, strings.Split(spec, ","), len(history)), func(position int) bool {
+		return position == 0
+	})
+	slices.Sort(positions)
+
+	if len(positions) == 0 {
+		invalidMsg := x.localization.LocalizeByTd(msg, "MsgContextDropInvalid", map[string]interface{}{
+			"Total": len(history),
+		})
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, invalidMsg))
+		return
+	}
+
+	if err := x.chatState.InitContextDropConfirmation(log, msg.Chat.ID, msg.From.ID, positions); err != nil {
+		log.E("Failed to init context drop confirmation", tracing.InnerError, err)
+		errorMsg := x.localization.LocalizeBy(msg, "MsgContextDropError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	var preview strings.Builder
+	for _, position := range positions {
+		entry := history[position-1]
+		roleKey := "MsgContextViewRoleUser"
+		switch {
+		case entry.IsCompressed:
+			roleKey = "MsgContextViewRoleSummary"
+		case entry.Role == platform.MessageRoleAssistant:
+			roleKey = "MsgContextViewRoleAssistant"
+		}
+
+		preview.WriteString(x.localization.LocalizeByTd(msg, "MsgContextViewEntry", map[string]interface{}{
+			"Index":   position,
+			"Role":    x.localization.LocalizeBy(msg, roleKey),
+			"Content": contextPreview(entry.Content, contextViewPreviewLength/2),
+		}))
+	}
+
+	confirmMsg := x.localization.LocalizeByTd(msg, "MsgContextDropConfirm", map[string]interface{}{
+		"Count":   len(positions),
+		"Preview": preview.String(),
+	})
+
+	cancelBtn := tgbotapi.NewInlineKeyboardButtonData(
+		x.localization.LocalizeBy(msg, "MsgContextClearCancelBtn"),
+		"context_drop_cancel",
+	)
+	confirmBtn := tgbotapi.NewInlineKeyboardButtonData(
+		x.localization.LocalizeBy(msg, "MsgContextDropConfirmBtn"),
+		"context_drop_confirm",
+	)
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(cancelBtn, confirmBtn),
+	)
+
+	x.diplomat.ReplyWithKeyboard(log, msg, x.personality.XiifyManual(msg, confirmMsg), keyboard)
+}
+
+func (x *TelegramHandler) handleContextDropConfirmCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, user *entities.User) {
+	msg := query.Message
+
+	if msg.Chat.Type != "private" && !x.rights.IsUserHasRight(log, user, "manage_context") {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextNoAccess"))
+		if _, err := x.diplomat.Request(log, callback); err != nil {
+			log.E("Failed to answer callback", tracing.InnerError, err)
+		}
+		return
+	}
+
+	state, err := x.chatState.GetState(log, msg.Chat.ID, query.From.ID)
+	if err != nil || state == nil || state.Status != repository.ChatStateConfirmContextDrop {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextDropExpired"))
+		if _, err := x.diplomat.Request(log, callback); err != nil {
+			log.E("Failed to answer callback", tracing.InnerError, err)
+		}
+		return
+	}
+
+	if err := x.chatState.ClearState(log, msg.Chat.ID, query.From.ID); err != nil {
+		log.E("Failed to clear chat state", tracing.InnerError, err)
+	}
+
+	deleteMsg := tgbotapi.NewDeleteMessage(msg.Chat.ID, msg.MessageID)
+
+	if query.Data == "context_drop_cancel" {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextDropCancelledCallback"))
+		if _, err := x.diplomat.Request(log, callback); err != nil {
+			log.E("Failed to answer callback", tracing.InnerError, err)
+		}
+
+		if _, err := x.diplomat.Request(log, deleteMsg); err != nil {
+			log.E("Failed to delete confirmation message", tracing.InnerError, err)
+		}
+		return
+	}
+
+	dropped, err := x.contextManager.Drop(log, x.contextManager.Chat(log, msg), state.ContextDrop)
+	if err != nil {
+		log.E("Failed to drop context messages", tracing.InnerError, err)
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextDropError"))
+		if _, err := x.diplomat.Request(log, callback); err != nil {
+			log.E("Failed to answer callback", tracing.InnerError, err)
+		}
+		return
+	}
+
+	callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextDroppedCallback"))
+	if _, err := x.diplomat.Request(log, callback); err != nil {
+		log.E("Failed to answer callback", tracing.InnerError, err)
+	}
+
+	successMsg := x.localization.LocalizeByTd(msg, "MsgContextDropped", map[string]interface{}{
+		"Count": dropped,
+	})
+	x.diplomat.SendMessage(log, msg, x.personality.XiifyManual(msg, successMsg))
+
+	if _, err := x.diplomat.Request(log, deleteMsg); err != nil {
+		log.E("Failed to delete confirmation message", tracing.InnerError, err)
+	}
+}
+
+func (x *TelegramHandler) ContextCommandBranches(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	defer tracing.ProfilePoint(log, "Context command branches completed", "telegram.command.context.branches", "chat_id", msg.Chat.ID)()
+
+	branches, err := x.contextManager.Branches(log, x.contextManager.Chat(log, msg))
+	if err != nil {
+		errorMsg := x.localization.LocalizeBy(msg, "MsgContextBranchError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	text, keyboard := x.renderContextBranches(msg, branches)
+	x.diplomat.ReplyWithKeyboard(log, msg, x.personality.XiifyManual(msg, text), keyboard)
+}
+
+func (x *TelegramHandler) renderContextBranches(msg *tgbotapi.Message, branches []artificial.ContextBranch) (string, tgbotapi.InlineKeyboardMarkup) {
+	var builder strings.Builder
+	builder.WriteString(x.localization.LocalizeBy(msg, "MsgContextBranchesHeader"))
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, branch := range branches {
+		key := "MsgContextBranchesItem"
+		if branch.Active {
+			key = "MsgContextBranchesItemActive"
+		}
+
+		builder.WriteString(x.localization.LocalizeByTd(msg, key, map[string]interface{}{
+			"Name":     branch.Name,
+			"Messages": branch.Messages,
+		}))
+
+		if !branch.Active {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+				x.localization.LocalizeByTd(msg, "MsgContextBranchSwitchBtn", map[string]interface{}{"Name": branch.Name}),
+				"context_branch_"+branch.Name,
+			)))
+		}
+	}
+
+	builder.WriteString(x.localization.LocalizeBy(msg, "MsgContextBranchesFooter"))
+
+	keyboard := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}
+	if len(rows) > 0 {
+		keyboard = tgbotapi.NewInlineKeyboardMarkup(rows...)
+	}
+
+	return builder.String(), keyboard
+}
+
+func (x *TelegramHandler) ContextCommandFork(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, name string) {
+	defer tracing.ProfilePoint(log, "Context command fork completed", "telegram.command.context.fork", "chat_id", msg.Chat.ID, "branch", name)()
+
+	// Forking from a reply to an older answer keeps only the conversation up to that answer
+	replyTo := 0
+	if msg.ReplyToMessage != nil && msg.ReplyToMessage.From != nil && msg.ReplyToMessage.From.ID == x.diplomat.Self().ID {
+		replyTo = msg.ReplyToMessage.MessageID
+	}
+
+	count, err := x.contextManager.Fork(log, x.contextManager.Chat(log, msg), name, replyTo)
+	if err != nil {
+		x.replyContextBranchError(log, msg, name, err)
+		return
+	}
+
+	successMsg := x.localization.LocalizeByTd(msg, "MsgContextBranchForked", map[string]interface{}{
+		"Name":  name,
+		"Count": count,
+	})
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, successMsg))
+}
+
+func (x *TelegramHandler) ContextCommandSwitch(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, name string) {
+	defer tracing.ProfilePoint(log, "Context command switch completed", "telegram.command.context.switch", "chat_id", msg.Chat.ID, "branch", name)()
+
+	if err := x.contextManager.SwitchBranch(log, x.contextManager.Chat(log, msg), name); err != nil {
+		x.replyContextBranchError(log, msg, name, err)
+		return
+	}
+
+	successMsg := x.localization.LocalizeByTd(msg, "MsgContextBranchSwitched", map[string]interface{}{
+		"Name": name,
+	})
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, successMsg))
+}
+
+func (x *TelegramHandler) ContextCommandPrune(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, name string) {
+	defer tracing.ProfilePoint(log, "Context command prune completed", "telegram.command.context.prune", "chat_id", msg.Chat.ID, "branch", name)()
+
+	if err := x.contextManager.DeleteBranch(log, x.contextManager.Chat(log, msg), name); err != nil {
+		x.replyContextBranchError(log, msg, name, err)
+		return
+	}
+
+	successMsg := x.localization.LocalizeByTd(msg, "MsgContextBranchPruned", map[string]interface{}{
+		"Name": name,
+	})
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, successMsg))
+}
+
+// ContextCommandTopics shows or switches keeping a separate history in every forum topic of the chat
+func (x *TelegramHandler) ContextCommandTopics(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, state string) {
+	defer tracing.ProfilePoint(log, "Context command topics completed", "telegram.command.context.topics", "chat_id", msg.Chat.ID, "state", state)()
+
+	if !msg.Chat.IsSuperGroup() {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, "MsgContextTopicsOnlyForums")))
+		return
+	}
+
+	chatID := platform.ChatID(msg.Chat.ID)
+
+	var perTopic bool
+	switch state {
+	case "":
+		key := "MsgContextTopicsShared"
+		if x.contextManager.IsPerTopic(log, chatID) {
+			key = "MsgContextTopicsSeparate"
+		}
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, key)))
+		return
+	case "on":
+		perTopic = true
+	case "off":
+		perTopic = false
+	default:
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, "MsgContextHelpText")))
+		return
+	}
+
+	if err := x.contextManager.SetPerTopic(log, chatID, perTopic); err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, "MsgContextTopicsError")))
+		return
+	}
+
+	key := "MsgContextTopicsSharedSet"
+	if perTopic {
+		key = "MsgContextTopicsSeparateSet"
+	}
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, key)))
+}
+
+func (x *TelegramHandler) replyContextBranchError(log *tracing.Logger, msg *tgbotapi.Message, name string, err error) {
+	key := "MsgContextBranchError"
+	switch {
+	case errors.Is(err, artificial.ErrContextBranchInvalidName):
+		key = "MsgContextBranchInvalidName"
+	case errors.Is(err, artificial.ErrContextBranchExists):
+		key = "MsgContextBranchExists"
+	case errors.Is(err, artificial.ErrContextBranchNotFound):
+		key = "MsgContextBranchNotFound"
+	case errors.Is(err, artificial.ErrContextBranchMain):
+		key = "MsgContextBranchMain"
+	case errors.Is(err, artificial.ErrContextAnchorNotFound):
+		key = "MsgContextBranchAnchorNotFound"
+	default:
+		log.E("Context branch operation failed", "branch", name, tracing.InnerError, err)
+	}
+
+	errorMsg := x.localization.LocalizeByTd(msg, key, map[string]interface{}{
+		"Name": name,
+	})
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+}
+
+func (x *TelegramHandler) handleContextBranchCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, user *entities.User) {
+	msg := query.Message
+
+	if msg.Chat.Type != "private" && !x.rights.IsUserHasRight(log, user, "manage_context") {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextNoAccess"))
+		if _, err := x.diplomat.Request(log, callback); err != nil {
+			log.E("Failed to answer callback", tracing.InnerError, err)
+		}
+		return
+	}
+
+	name := strings.TrimPrefix(query.Data, "context_branch_")
+	chat := x.contextManager.Chat(log, msg)
+
+	if err := x.contextManager.SwitchBranch(log, chat, name); err != nil {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeByTd(msg, "MsgContextBranchNotFound", map[string]interface{}{
+			"Name": name,
+		}))
+		if _, err := x.diplomat.Request(log, callback); err != nil {
+			log.E("Failed to answer callback", tracing.InnerError, err)
+		}
+		return
+	}
+
+	callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeByTd(msg, "MsgContextBranchSwitchedCallback", map[string]interface{}{
+		"Name": name,
+	}))
+	if _, err := x.diplomat.Request(log, callback); err != nil {
+		log.E("Failed to answer callback", tracing.InnerError, err)
+	}
+
+	branches, err := x.contextManager.Branches(log, chat)
+	if err != nil {
+		return
+	}
+
+	text, keyboard := x.renderContextBranches(msg, branches)
+	x.diplomat.EditMessageWithKeyboard(log, msg.Chat.ID, msg.MessageID, x.personality.XiifyManual(msg, text), keyboard)
+}
+
+// =========================  /incognito command handlers  =========================
+
+func (x *TelegramHandler) IncognitoCommandInfo(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	enabled := platform.BoolValue(user.IsIncognito, false)
+	x.diplomat.ReplyWithKeyboard(log, msg, x.personality.XiifyManual(msg, x.incognitoInfoText(msg, enabled)), x.incognitoKeyboard(msg, enabled))
+}
+
+func (x *TelegramHandler) IncognitoCommandSet(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, enabled bool) {
+	defer tracing.ProfilePoint(log, "Incognito command set completed", "telegram.command.incognito.set", "enabled", enabled)()
+
+	user.IsIncognito = platform.BoolPtr(enabled)
+	if _, err := x.users.UpdateUser(log, user); err != nil {
+		errorMsg := x.localization.LocalizeBy(msg, "MsgIncognitoError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
+
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.incognitoInfoText(msg, enabled)))
+}
+
+func (x *TelegramHandler) incognitoInfoText(msg *tgbotapi.Message, enabled bool) string {
+	key := "MsgIncognitoDisabled"
+	if enabled {
+		key = "MsgIncognitoEnabled"
+	}
+	return x.localization.LocalizeBy(msg, key)
+}
+
+func (x *TelegramHandler) incognitoKeyboard(msg *tgbotapi.Message, enabled bool) tgbotapi.InlineKeyboardMarkup {
+	button := tgbotapi.NewInlineKeyboardButtonData(x.localization.LocalizeBy(msg, "MsgIncognitoEnableBtn"), "incognito_enable")
+	if enabled {
+		button = tgbotapi.NewInlineKeyboardButtonData(x.localization.LocalizeBy(msg, "MsgIncognitoDisableBtn"), "incognito_disable")
+	}
+	return tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(button))
+}
+
+func (x *TelegramHandler) handleIncognitoCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery) {
+	msg := query.Message
+	enabled := query.Data == "incognito_enable"
+
+	// The toggle is personal, so it applies to whoever pressed the button
+	user, err := x.users.GetUserByEid(log, query.From.ID)
+	if err == nil {
+		user.IsIncognito = platform.BoolPtr(enabled)
+		_, err = x.users.UpdateUser(log, user)
+	}
+
+	if err != nil {
+		log.E("Failed to toggle incognito", tracing.InnerError, err)
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgIncognitoError"))
+		if _, err := x.diplomat.Request(log, callback); err != nil {
+			log.E("Failed to answer callback", tracing.InnerError, err)
+		}
+		return
+	}
+
+	callback := tgbotapi.NewCallback(query.ID, "")
+	if _, err := x.diplomat.Request(log, callback); err != nil {
+		log.E("Failed to answer callback", tracing.InnerError, err)
+	}
 
-	for _, r := range allRights {
-		hasRight := false
-		for _, ur := range user.Rights {
-			if ur == r.Key {
-				hasRight = true
-				break
-			}
-		}
+	x.diplomat.EditMessageWithKeyboard(log, msg.Chat.ID, msg.MessageID, x.personality.XiifyManual(msg, x.incognitoInfoText(msg, enabled)), x.incognitoKeyboard(msg, enabled))
+}
 
-		icon := "❌"
-		if hasRight {
-			icon = "✅"
-		}
+// =========================  /model command handlers  =========================
 
-		displayName := x.formatRightName(r.Key)
-		rightsInfo.WriteString(fmt.Sprintf("%s **%s** — %s\n", icon, displayName, r.Desc))
+func (x *TelegramHandler) ModelCommandInfo(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	grade, err := x.donations.GetUserGrade(log, user)
+	if err != nil {
+		log.W("Failed to get user grade, using bronze", tracing.InnerError, err)
+		grade = platform.GradeBronze
+	}
+
+	current, _ := x.dialer.EffectiveModel(log, user, msg.Chat.ID, grade)
+	text := x.localization.LocalizeByTd(msg, "MsgModelSelect", map[string]interface{}{"Model": current})
+	x.diplomat.ReplyWithKeyboard(log, msg, x.personality.XiifyManual(msg, text), x.modelKeyboard(msg, grade, current))
+}
+
+func (x *TelegramHandler) ModelCommandReset(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	defer tracing.ProfilePoint(log, "Model command reset completed", "telegram.command.model.reset")()
+
+	if err := x.dialer.ResetPreferredModel(log, user, msg.Chat.ID); err != nil {
+		errorMsg := x.localization.LocalizeBy(msg, "MsgModelError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
 	}
 
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, "MsgModelReset")))
+}
+
+func (x *TelegramHandler) modelKeyboard(msg *tgbotapi.Message, grade platform.UserGrade, current string) tgbotapi.InlineKeyboardMarkup {
 	var rows [][]tgbotapi.InlineKeyboardButton
-	for _, r := range allRights {
-		hasRight := false
-		for _, ur := range user.Rights {
-			if ur == r.Key {
-				hasRight = true
-				break
-			}
+
+	// Model identifiers may exceed the callback data limit, so buttons refer to models by position
+	for idx, selectable := range x.dialer.SelectableModels(grade) {
+		title := selectable.Title
+		if selectable.PriceHint != "" {
+			title = fmt.Sprintf("%s · %s", title, selectable.PriceHint)
+		}
+		if selectable.Model == current {
+			title = "✅ " + title
 		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(title, fmt.Sprintf("model_pick_%d", idx)),
+		))
+	}
 
-		icon := "❌"
-		if hasRight {
-			icon = "✅"
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(x.localization.LocalizeBy(msg, "MsgModelResetBtn"), "model_reset"),
+	))
+
+	return tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
+
+func (x *TelegramHandler) handleModelCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery) {
+	msg := query.Message
+
+	// The choice is personal, so it applies to whoever pressed the button
+	user, err := x.users.GetUserByEid(log, query.From.ID)
+	if err != nil {
+		log.E("Failed to get user for model callback", tracing.InnerError, err)
+		x.answerModelCallback(log, query, x.localization.LocalizeBy(msg, "MsgModelError"))
+		return
+	}
+
+	grade, err := x.donations.GetUserGrade(log, user)
+	if err != nil {
+		log.W("Failed to get user grade, using bronze", tracing.InnerError, err)
+		grade = platform.GradeBronze
+	}
+
+	if query.Data == "model_reset" {
+		err = x.dialer.ResetPreferredModel(log, user, msg.Chat.ID)
+	} else {
+		models := x.dialer.SelectableModels(grade)
+		idx, convErr := strconv.Atoi(strings.TrimPrefix(query.Data, "model_pick_"))
+		if convErr != nil || idx < 0 || idx >= len(models) {
+			x.answerModelCallback(log, query, x.localization.LocalizeBy(msg, "MsgModelNotAllowed"))
+			return
 		}
+		err = x.dialer.SetPreferredModel(log, user, msg.Chat.ID, models[idx].Model)
+	}
 
-		displayName := x.formatRightName(r.Key)
-		btn := tgbotapi.NewInlineKeyboardButtonData(
-			icon+" "+displayName,
-			"user_right_"+r.Key+"_"+*user.Username,
-		)
-		rows = append(rows, tgbotapi.NewInlineKeyboardRow(btn))
+	if err != nil {
+		log.E("Failed to update model preference", tracing.InnerError, err)
+		x.answerModelCallback(log, query, x.localization.LocalizeBy(msg, "MsgModelError"))
+		return
 	}
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	x.answerModelCallback(log, query, "")
 
-	sendMsg := tgbotapi.NewMessage(chatID, rightsInfo.String())
-	sendMsg.ParseMode = "Markdown"
-	sendMsg.ReplyMarkup = keyboard
-	x.diplomat.bot.Send(sendMsg)
+	current, _ := x.dialer.EffectiveModel(log, user, msg.Chat.ID, grade)
+	text := x.localization.LocalizeByTd(msg, "MsgModelSelect", map[string]interface{}{"Model": current})
+	x.diplomat.EditMessageWithKeyboard(log, msg.Chat.ID, msg.MessageID, x.personality.XiifyManual(msg, text), x.modelKeyboard(msg, grade, current))
 }
 
-func (x *TelegramHandler) updateUserRightsKeyboard(log *tracing.Logger, msg *tgbotapi.Message, user *entities.User) {
-	allRights := []string{"switch_mode", "edit_mode", "manage_users", "manage_context", "broadcast", "manage_tariffs"}
+func (x *TelegramHandler) answerModelCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, text string) {
+	callback := tgbotapi.NewCallback(query.ID, text)
+	if _, err := x.diplomat.Request(log, callback); err != nil {
+		log.E("Failed to answer callback", tracing.InnerError, err)
+	}
+}
 
-	var rows [][]tgbotapi.InlineKeyboardButton
-	for _, r := range allRights {
-		hasRight := false
-		for _, ur := range user.Rights {
-			if ur == r {
-				hasRight = true
-				break
+// =========================  /models command handlers  =========================
+
+func (x *TelegramHandler) ModelsCommandOverview(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	defer tracing.ProfilePoint(log, "Models command overview completed", "telegram.command.models.overview")()
+
+	syncedAt := x.localization.LocalizeBy(msg, "MsgModelsNeverSynced")
+	if !x.catalog.SyncedAt().IsZero() {
+		syncedAt = x.catalog.SyncedAt().Format("2006-01-02 15:04 UTC")
+	}
+
+	message := x.localization.LocalizeByTd(msg, "MsgModelsOverview", map[string]interface{}{
+		"Count":    format.Numberify(int64(x.catalog.Size())),
+		"SyncedAt": syncedAt,
+	})
+
+	seen := map[string]bool{}
+	for _, grade := range []platform.UserGrade{platform.GradeBronze, platform.GradeSilver, platform.GradeGold} {
+		for _, selectable := range x.dialer.SelectableModels(grade) {
+			if seen[selectable.Model] {
+				continue
 			}
+			seen[selectable.Model] = true
+			message += x.modelsCatalogLine(msg, selectable.Model)
 		}
+	}
 
-		icon := "❌"
-		if hasRight {
-			icon = "✅"
-		}
+	message += x.localization.LocalizeBy(msg, "MsgModelsOverviewFooter")
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, message))
+}
 
-		displayName := x.formatRightName(r)
-		btn := tgbotapi.NewInlineKeyboardButtonData(
-			icon+" "+displayName,
-			"user_right_"+r+"_"+*user.Username,
-		)
-		rows = append(rows, tgbotapi.NewInlineKeyboardRow(btn))
+func (x *TelegramHandler) modelsCatalogLine(msg *tgbotapi.Message, model string) string {
+	entry, ok := x.catalog.Lookup(model)
+	if !ok {
+		return x.localization.LocalizeByTd(msg, "MsgModelsLineUnknown", map[string]interface{}{"Model": model})
 	}
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return x.localization.LocalizeByTd(msg, "MsgModelsLine", map[string]interface{}{
+		"Model":        model,
+		"Context":      format.Numberify(entry.ContextLength),
+		"Input":        artificial.FormatPricePerMillion(entry.InputPrice),
+		"Output":       artificial.FormatPricePerMillion(entry.OutputPrice),
+		"Capabilities": modelCapabilities(entry),
+	})
+}
 
-	editMarkup := tgbotapi.NewEditMessageReplyMarkup(msg.Chat.ID, msg.MessageID, keyboard)
-	x.diplomat.bot.Request(editMarkup)
+func modelCapabilities(entry *entities.CatalogModel) string {
+	capabilities := ""
+	if entry.SupportsImages {
+		capabilities += "🖼"
+	}
+	if entry.SupportsTools {
+		capabilities += "🛠"
+	}
+	if entry.SupportsReasoning {
+		capabilities += "🧠"
+	}
+	if capabilities == "" {
+		capabilities = "—"
+	}
+	return capabilities
 }
 
-func (x *TelegramHandler) updateUserActionKeyboard(log *tracing.Logger, msg *tgbotapi.Message, user *entities.User) {
-	var rows [][]tgbotapi.InlineKeyboardButton
+func (x *TelegramHandler) ModelsCommandInfo(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, model string) {
+	entry, ok := x.catalog.Lookup(model)
+	if !ok {
+		notFoundMsg := x.localization.LocalizeByTd(msg, "MsgModelsNotFound", map[string]interface{}{"Model": model})
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, notFoundMsg))
+		return
+	}
+
+	infoMsg := x.localization.LocalizeByTd(msg, "MsgModelsInfo", map[string]interface{}{
+		"Model":         entry.ID,
+		"Name":          entry.Name,
+		"Context":       format.Numberify(entry.ContextLength),
+		"MaxCompletion": format.Numberify(entry.MaxCompletionTokens),
+		"Input":         artificial.FormatPricePerMillion(entry.InputPrice),
+		"Output":        artificial.FormatPricePerMillion(entry.OutputPrice),
+		"CacheRead":     artificial.FormatPricePerMillion(entry.CacheReadPrice),
+		"CacheWrite":    artificial.FormatPricePerMillion(entry.CacheWritePrice),
+		"Capabilities":  modelCapabilities(entry),
+		"SyncedAt":      entry.SyncedAt.Format("2006-01-02 15:04 UTC"),
+	})
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, infoMsg))
+}
 
-	if platform.BoolValue(user.IsActive, true) {
-		disableBtn := tgbotapi.NewInlineKeyboardButtonData(
-			x.localization.LocalizeBy(msg, "MsgUsersDisableBtn"),
-			"user_disable_"+*user.Username,
-		)
-		rows = append(rows, tgbotapi.NewInlineKeyboardRow(disableBtn))
-	} else {
-		enableBtn := tgbotapi.NewInlineKeyboardButtonData(
-			x.localization.LocalizeBy(msg, "MsgUsersEnableBtn"),
-			"user_enable_"+*user.Username,
-		)
-		rows = append(rows, tgbotapi.NewInlineKeyboardRow(enableBtn))
+func (x *TelegramHandler) ModelsCommandSync(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	count, err := x.catalog.Sync(log)
+	if err != nil {
+		log.E("Failed to sync model catalog", tracing.InnerError, err)
+		errorMsg := x.localization.LocalizeBy(msg, "MsgModelsSyncError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
 	}
 
-	deleteBtn := tgbotapi.NewInlineKeyboardButtonData(
-		x.localization.LocalizeBy(msg, "MsgUsersDeleteBtn"),
-		"user_delete_"+*user.Username,
-	)
-	rightsBtn := tgbotapi.NewInlineKeyboardButtonData(
-		x.localization.LocalizeBy(msg, "MsgUsersRightsBtn"),
-		"user_rights_"+*user.Username,
-	)
-	rows = append(rows, tgbotapi.NewInlineKeyboardRow(deleteBtn, rightsBtn))
+	successMsg := x.localization.LocalizeByTd(msg, "MsgModelsSynced", map[string]interface{}{
+		"Count": format.Numberify(int64(count)),
+	})
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, successMsg))
+}
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+func (x *TelegramHandler) ModelsCommandCheck(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	issues := x.catalog.TariffIssues()
+	if len(issues) == 0 {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, "MsgModelsCheckPassed")))
+		return
+	}
 
-	editMarkup := tgbotapi.NewEditMessageReplyMarkup(msg.Chat.ID, msg.MessageID, keyboard)
-	x.diplomat.bot.Request(editMarkup)
+	message := x.localization.LocalizeBy(msg, "MsgModelsCheckFailed")
+	for _, issue := range issues {
+		key := "MsgModelsIssueUnknown"
+		if errors.Is(issue.Err, artificial.ErrCatalogModelNoImages) {
+			key = "MsgModelsIssueNoImages"
+		}
+		message += x.localization.LocalizeByTd(msg, key, map[string]interface{}{
+			"Scope": issue.Scope,
+			"Model": issue.Model,
+		})
+	}
+
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, message))
 }
 
-func (x *TelegramHandler) formatRightName(right string) string {
-	parts := strings.Split(right, "_")
-	for i, p := range parts {
-		if len(p) > 0 {
-			parts[i] = strings.ToUpper(string(p[0])) + p[1:]
+// =========================  /experiment command handlers  =========================
+
+func (x *TelegramHandler) ExperimentCommandList(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	defer tracing.ProfilePoint(log, "Experiment command list completed", "telegram.command.experiment.list")()
+
+	experiments, err := x.experiments.GetExperiments(log)
+	if err != nil {
+		log.E("Failed to get experiments", tracing.InnerError, err)
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, "MsgExperimentError")))
+		return
+	}
+
+	if len(experiments) == 0 {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, "MsgExperimentListEmpty")))
+		return
+	}
+
+	message := x.localization.LocalizeBy(msg, "MsgExperimentList")
+	for _, experiment := range experiments {
+		key := "MsgExperimentLineStopped"
+		if platform.BoolValue(experiment.IsActive, false) {
+			key = "MsgExperimentLineActive"
+		}
+
+		variants, err := repository.ExperimentVariants(experiment)
+		if err != nil {
+			log.W("Failed to parse experiment variants", "key", experiment.Key, tracing.InnerError, err)
 		}
+
+		message += x.localization.LocalizeByTd(msg, key, map[string]interface{}{
+			"Key":       experiment.Key,
+			"Mode":      experiment.ModeType,
+			"Unit":      experiment.Unit,
+			"Variants":  formatExperimentVariants(variants),
+			"CreatedAt": experiment.CreatedAt.Format("2006-01-02"),
+		})
 	}
-	return strings.Join(parts, " ")
+
+	message += x.localization.LocalizeBy(msg, "MsgExperimentListFooter")
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, message))
 }
 
-func (x *TelegramHandler) retrieveUserByName(log *tracing.Logger, msg *tgbotapi.Message, username string) *entities.User {
-	username = strings.TrimPrefix(username, "@")
-	if username == "" {
-		x.diplomat.Reply(log, msg, x.localization.LocalizeBy(msg, "MsgUserNotSpecified"))
-		return nil
+func formatExperimentVariants(variants []repository.ExperimentVariant) string {
+	parts := make([]string, 0, len(variants))
+	for _, variant := range variants {
+		parts = append(parts, fmt.Sprintf("`%s=%s`", variant.Key, variant))
 	}
+	return strings.Join(parts, ", ")
+}
 
-	user, err := x.users.GetUserByName(log, username)
+func (x *TelegramHandler) ExperimentCommandCreate(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, key string, modeType string, unitArg string, spec string) {
+	unit, err := repository.ParseExperimentUnit(unitArg)
 	if err != nil {
-		x.diplomat.Reply(log, msg, x.localization.LocalizeByTd(msg, "MsgUserNotFound", map[string]interface{}{
-			"Username": username,
-		}))
-		return nil
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, "MsgExperimentInvalidUnit")))
+		return
 	}
 
-	return user
-}
+	variants, err := repository.ParseExperimentVariants(spec)
+	if err != nil {
+		invalidMsg := x.localization.LocalizeByTd(msg, "MsgExperimentInvalidVariants", map[string]interface{}{"Error": err.Error()})
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, invalidMsg))
+		return
+	}
 
-func (x *TelegramHandler) treat(rights []string) []string {
-	var treated []string
-	for _, right := range rights {
-		right = strings.ToLower(strings.TrimSpace(right))
-		if slices.Contains(repository.AvailableRights, right) {
-			treated = append(treated, right)
+	if _, err := x.modes.GetModeByTypeIncludingDisabled(log, modeType); err != nil {
+		notFoundMsg := x.localization.LocalizeByTd(msg, "MsgExperimentModeNotFound", map[string]interface{}{"Mode": modeType})
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, notFoundMsg))
+		return
+	}
+
+	for _, variant := range variants {
+		if variant.ModeVersion > 0 {
+			if _, err := x.modes.GetModeVersion(log, modeType, variant.ModeVersion); err != nil {
+				notFoundMsg := x.localization.LocalizeByTd(msg, "MsgExperimentVersionNotFound", map[string]interface{}{
+					"Variant": variant.Key,
+					"Version": variant.ModeVersion,
+				})
+				x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, notFoundMsg))
+				return
+			}
+		}
+
+		if variant.Model != "" {
+			if err := x.catalog.Validate(variant.Model, false); err != nil {
+				unknownMsg := x.localization.LocalizeByTd(msg, "MsgExperimentUnknownModel", map[string]interface{}{
+					"Variant": variant.Key,
+					"Model":   variant.Model,
+				})
+				x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, unknownMsg))
+				return
+			}
 		}
 	}
-	return treated
-}
 
-// =========================  /stats command handlers  =========================
+	if _, err := x.experiments.CreateExperiment(log, key, modeType, unit, variants, user.ID); err != nil {
+		var errorMsg string
+		switch {
+		case errors.Is(err, repository.ErrExperimentInvalidKey):
+			errorMsg = x.localization.LocalizeBy(msg, "MsgExperimentInvalidKey")
+		case errors.Is(err, repository.ErrExperimentExists):
+			errorMsg = x.localization.LocalizeByTd(msg, "MsgExperimentExists", map[string]interface{}{"Key": key})
+		case errors.Is(err, repository.ErrExperimentModeBusy):
+			errorMsg = x.localization.LocalizeByTd(msg, "MsgExperimentModeBusy", map[string]interface{}{"Mode": modeType})
+		default:
+			log.E("Failed to create experiment", tracing.InnerError, err)
+			errorMsg = x.localization.LocalizeBy(msg, "MsgExperimentError")
+		}
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
+	}
 
-func (x *TelegramHandler) StatsCommand(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
-	defer tracing.ProfilePoint(log, "Stats command completed", "telegram.command.stats", "chat_id", msg.Chat.ID)()
-	statsErrorMsg := x.localization.LocalizeBy(msg, "MsgStatsError")
+	createdMsg := x.localization.LocalizeByTd(msg, "MsgExperimentCreated", map[string]interface{}{
+		"Key":      key,
+		"Mode":     modeType,
+		"Unit":     string(unit),
+		"Variants": formatExperimentVariants(variants),
+	})
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, createdMsg))
+}
 
-	totalQuestions, err := x.messages.GetTotalUserQuestionsCount(log)
-	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+func (x *TelegramHandler) ExperimentCommandStop(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, key string) {
+	if err := x.experiments.StopExperiment(log, key); err != nil {
+		var errorMsg string
+		switch {
+		case errors.Is(err, repository.ErrExperimentNotFound):
+			errorMsg = x.localization.LocalizeByTd(msg, "MsgExperimentNotFound", map[string]interface{}{"Key": key})
+		case errors.Is(err, repository.ErrExperimentNotActive):
+			errorMsg = x.localization.LocalizeByTd(msg, "MsgExperimentAlreadyStopped", map[string]interface{}{"Key": key})
+		default:
+			log.E("Failed to stop experiment", tracing.InnerError, err)
+			errorMsg = x.localization.LocalizeBy(msg, "MsgExperimentError")
+		}
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
 		return
 	}
 
-	chatQuestions, err := x.messages.GetUserQuestionsInChatCount(log, msg.Chat.ID)
+	stoppedMsg := x.localization.LocalizeByTd(msg, "MsgExperimentStopped", map[string]interface{}{"Key": key})
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, stoppedMsg))
+}
+
+func (x *TelegramHandler) ExperimentCommandReport(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, key string) {
+	defer tracing.ProfilePoint(log, "Experiment command report completed", "telegram.command.experiment.report", "key", key)()
+
+	experiment, err := x.experiments.GetExperimentByKey(log, key)
 	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		var errorMsg string
+		if errors.Is(err, repository.ErrExperimentNotFound) {
+			errorMsg = x.localization.LocalizeByTd(msg, "MsgExperimentNotFound", map[string]interface{}{"Key": key})
+		} else {
+			errorMsg = x.localization.LocalizeBy(msg, "MsgExperimentError")
+		}
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
 		return
 	}
 
-	userQuestions, err := x.messages.GetUserPersonalQuestionsCount(log, user)
+	stats, err := x.experiments.GetExperimentReport(log, experiment)
 	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		log.E("Failed to build experiment report", tracing.InnerError, err)
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, "MsgExperimentError")))
 		return
 	}
 
-	userChatQuestions, err := x.messages.GetUserPersonalQuestionsInChatCount(log, user, msg.Chat.ID)
-	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
-		return
+	status := x.localization.LocalizeBy(msg, "MsgExperimentStatusStopped")
+	if platform.BoolValue(experiment.IsActive, false) {
+		status = x.localization.LocalizeBy(msg, "MsgExperimentStatusActive")
+	}
+
+	message := x.localization.LocalizeByTd(msg, "MsgExperimentReport", map[string]interface{}{
+		"Key":    experiment.Key,
+		"Mode":   experiment.ModeType,
+		"Unit":   experiment.Unit,
+		"Status": status,
+		"Since":  experiment.CreatedAt.Format("2006-01-02 15:04 UTC"),
+	})
+
+	for i, variantStats := range stats {
+		message += x.localization.LocalizeByTd(msg, "MsgExperimentReportVariant", map[string]interface{}{
+			"Variant":      variantStats.Variant.Key,
+			"Target":       variantStats.Variant.String(),
+			"Responses":    format.Numberify(variantStats.Responses),
+			"Likes":        format.Numberify(variantStats.Likes),
+			"Dislikes":     format.Numberify(variantStats.Dislikes),
+			"LikeRate":     fmt.Sprintf("%.1f", variantStats.LikeRate()*100),
+			"Cost":         variantStats.Cost.StringFixed(4),
+			"AvgCost":      variantStats.AvgCost().StringFixed(6),
+			"Latency":      fmt.Sprintf("%.1f", variantStats.AvgLatency.Seconds()),
+			"Significance": x.experimentSignificance(msg, stats[0], variantStats, i == 0),
+		})
+	}
+
+	message += x.localization.LocalizeBy(msg, "MsgExperimentReportFooter")
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, message))
+}
+
+// experimentSignificance describes the like-rate difference of the variant against the first (control) variant
+func (x *TelegramHandler) experimentSignificance(msg *tgbotapi.Message, control repository.ExperimentVariantStats, candidate repository.ExperimentVariantStats, isControl bool) string {
+	if isControl {
+		return x.localization.LocalizeBy(msg, "MsgExperimentControl")
+	}
+
+	p, ok := repository.LikeRateSignificance(control, candidate)
+	if !ok {
+		return x.localization.LocalizeBy(msg, "MsgExperimentNoData")
+	}
+
+	key := "MsgExperimentNotSignificant"
+	if p < experimentSignificanceLevel {
+		key = "MsgExperimentSignificant"
 	}
+	return x.localization.LocalizeByTd(msg, key, map[string]interface{}{"P": fmt.Sprintf("%.3f", p)})
+}
 
-	totalUsers, err := x.users.GetTotalUsersCount(log)
-	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+// =========================  /feedback command handlers  =========================
+
+func (x *TelegramHandler) handleFeedbackCommentInput(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, state *repository.ChatStateData) {
+	comment := strings.TrimSpace(msg.Text)
+	if comment == "" {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, "MsgFeedbackCommentEmpty")))
 		return
 	}
 
-	totalChats, err := x.messages.GetUniqueChatCount(log)
+	x.chatState.ClearState(log, msg.Chat.ID, msg.From.ID)
+
+	feedbackID, err := uuid.Parse(state.FeedbackID)
 	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		log.E("Invalid feedback ID in chat state", tracing.InnerError, err)
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, "MsgFeedbackError")))
 		return
 	}
 
-	totalCost, err := x.usage.GetTotalCost(log)
-	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+	if err := x.feedbacks.SetFeedbackComment(log, feedbackID, comment); err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, "MsgFeedbackError")))
 		return
 	}
 
-	totalCostLastMonth, err := x.usage.GetTotalCostLastMonth(log)
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, "MsgFeedbackCommentSaved")))
+}
+
+func (x *TelegramHandler) FeedbackCommandReport(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, days int) {
+	defer tracing.ProfilePoint(log, "Feedback command report completed", "telegram.command.feedback.report", "days", days)()
+
+	report, err := x.feedbacks.GetFeedbackReport(log, time.Now().AddDate(0, 0, -days))
 	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, "MsgFeedbackReportError")))
 		return
 	}
 
-	avgDailyCost, err := x.usage.GetAverageDailyCost(log)
-	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+	if report.Total.Total() == 0 {
+		emptyMsg := x.localization.LocalizeByTd(msg, "MsgFeedbackReportEmpty", map[string]interface{}{"Days": days})
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, emptyMsg))
 		return
 	}
 
-	totalTokens, err := x.usage.GetTotalTokens(log)
-	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
-		return
+	message := x.localization.LocalizeByTd(msg, "MsgFeedbackReport", map[string]interface{}{
+		"Days":     days,
+		"Likes":    format.Numberify(report.Total.Likes),
+		"Dislikes": format.Numberify(report.Total.Dislikes),
+		"LikeRate": fmt.Sprintf("%.1f", report.Total.LikeRate()*100),
+		"Reasons":  x.feedbackReasonsLine(msg, &report.Total),
+	})
+
+	message += x.localization.LocalizeBy(msg, "MsgFeedbackReportByModel")
+	message += x.feedbackGroupLines(msg, report.ByModel)
+
+	message += x.localization.LocalizeBy(msg, "MsgFeedbackReportByMode")
+	message += x.feedbackGroupLines(msg, report.ByMode)
+
+	if len(report.Recent) > 0 {
+		message += x.localization.LocalizeBy(msg, "MsgFeedbackReportComments")
+		for _, feedback := range report.Recent {
+			message += x.localization.LocalizeByTd(msg, "MsgFeedbackReportComment", map[string]interface{}{
+				"User":    platform.StringValue(feedback.User.Username, platform.StringValue(feedback.User.Fullname, "?")),
+				"Model":   platform.StringValue(feedback.Model, "—"),
+				"Comment": contextPreview(platform.StringValue(feedback.Comment, ""), feedbackCommentPreviewLength),
+			})
+		}
 	}
 
-	totalTokensLastMonth, err := x.usage.GetTotalTokensLastMonth(log)
-	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
-		return
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, message))
+}
+
+func (x *TelegramHandler) feedbackGroupLines(msg *tgbotapi.Message, groups []*repository.FeedbackGroup) string {
+	lines := ""
+	for i, group := range groups {
+		if i == feedbackReportGroupLimit {
+			break
+		}
+
+		key := group.Key
+		if key == "" {
+			key = x.localization.LocalizeBy(msg, "MsgFeedbackReportUnlinked")
+		}
+
+		lines += x.localization.LocalizeByTd(msg, "MsgFeedbackReportLine", map[string]interface{}{
+			"Key":      key,
+			"Likes":    format.Numberify(group.Likes),
+			"Dislikes": format.Numberify(group.Dislikes),
+			"LikeRate": fmt.Sprintf("%.1f", group.LikeRate()*100),
+			"Reasons":  x.feedbackReasonsLine(msg, group),
+		})
 	}
+	return lines
+}
 
-	anotherTotalCost, err := x.usage.GetTotalAnotherCost(log)
-	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
-		return
+func (x *TelegramHandler) feedbackReasonsLine(msg *tgbotapi.Message, group *repository.FeedbackGroup) string {
+	labels := map[repository.FeedbackReason]string{
+		repository.FeedbackReasonWrong:   "MsgFeedbackReasonWrongBtn",
+		repository.FeedbackReasonTooLong: "MsgFeedbackReasonTooLongBtn",
+		repository.FeedbackReasonRefused: "MsgFeedbackReasonRefusedBtn",
+		repository.FeedbackReasonOther:   "MsgFeedbackReasonOtherBtn",
 	}
 
-	anotherTotalCostLastMonth, err := x.usage.GetTotalAnotherCostLastMonth(log)
-	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
-		return
+	parts := []string{}
+	for _, reason := range repository.FeedbackReasons {
+		if count := group.Reasons[reason]; count > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", x.localization.LocalizeBy(msg, labels[reason]), count))
+		}
 	}
 
-	anotherTotalTokens, err := x.usage.GetTotalAnotherTokens(log)
-	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
-		return
+	if len(parts) == 0 {
+		return "—"
 	}
+	return strings.Join(parts, " · ")
+}
 
-	anotherTotalTokensLastMonth, err := x.usage.GetTotalAnotherTokensLastMonth(log)
+// =========================  /instructions command handlers  =========================
+
+func (x *TelegramHandler) InstructionsCommandShow(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	defer tracing.ProfilePoint(log, "Instructions command show completed", "telegram.command.instructions.show", "chat_id", msg.Chat.ID)()
+
+	maxLength := x.chatInstructionsMaxLength(log, user)
+
+	instructions, err := x.chatInstructions.GetInstructions(log, msg.Chat.ID)
 	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+		errorKey := "MsgInstructionsError"
+		if errors.Is(err, repository.ErrChatInstructionsNotFound) {
+			errorKey = "MsgInstructionsEmpty"
+		}
+		errorMsg := x.localization.LocalizeByTd(msg, errorKey, map[string]interface{}{
+			"Max": maxLength,
+		})
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
 		return
 	}
 
-	userCost, err := x.usage.GetUserCost(log, user)
-	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
-		return
+	author := x.localization.LocalizeBy(msg, "MsgModeHistoryUnknownAuthor")
+	if instructions.Updater != nil && instructions.Updater.Username != nil && *instructions.Updater.Username != "" {
+		author = "@" + *instructions.Updater.Username
 	}
 
-	userCostLastMonth, err := x.usage.GetUserCostLastMonth(log, user)
-	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+	showMsg := x.localization.LocalizeByTd(msg, "MsgInstructionsShow", map[string]interface{}{
+		"Text":   instructions.Text,
+		"Length": len([]rune(instructions.Text)),
+		"Max":    maxLength,
+		"Author": author,
+		"Date":   x.dateTimeFormatter.Dateify(msg, instructions.UpdatedAt),
+	})
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, showMsg))
+}
+
+func (x *TelegramHandler) InstructionsCommandSet(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	maxLength := x.chatInstructionsMaxLength(log, user)
+	if maxLength == 0 {
+		unavailableMsg := x.localization.LocalizeBy(msg, "MsgInstructionsUnavailable")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, unavailableMsg))
 		return
 	}
 
-	userAvgDailyCost, err := x.usage.GetUserAverageDailyCost(log, user)
-	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+	if err := x.chatState.InitChatInstructionsEdit(log, msg.Chat.ID, msg.From.ID); err != nil {
+		log.E("Failed to init chat instructions state", tracing.InnerError, err)
+		errorMsg := x.localization.LocalizeBy(msg, "MsgInstructionsError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
 		return
 	}
 
-	userTokens, err := x.usage.GetUserTokens(log, user)
-	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+	awaitingMsg := x.localization.LocalizeByTd(msg, "MsgInstructionsAwaiting", map[string]interface{}{
+		"Max": maxLength,
+	})
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, awaitingMsg))
+}
+
+func (x *TelegramHandler) InstructionsCommandClear(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	defer tracing.ProfilePoint(log, "Instructions command clear completed", "telegram.command.instructions.clear", "chat_id", msg.Chat.ID)()
+
+	if err := x.chatInstructions.DeleteInstructions(log, msg.Chat.ID); err != nil {
+		errorKey := "MsgInstructionsError"
+		if errors.Is(err, repository.ErrChatInstructionsNotFound) {
+			errorKey = "MsgInstructionsNotSet"
+		}
+		errorMsg := x.localization.LocalizeBy(msg, errorKey)
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
 		return
 	}
 
-	userTokensLastMonth, err := x.usage.GetUserTokensLastMonth(log, user)
-	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+	successMsg := x.localization.LocalizeBy(msg, "MsgInstructionsCleared")
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, successMsg))
+}
+
+func (x *TelegramHandler) handleChatInstructionsInput(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	defer tracing.ProfilePoint(log, "Instructions input completed", "telegram.command.instructions.input", "chat_id", msg.Chat.ID)()
+
+	text := strings.TrimSpace(msg.Text)
+
+	x.chatState.ClearState(log, msg.Chat.ID, msg.From.ID)
+
+	if text == "" {
+		emptyMsg := x.localization.LocalizeBy(msg, "MsgInstructionsInputEmpty")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, emptyMsg))
 		return
 	}
 
-	userAnotherCost, err := x.usage.GetUserAnotherCost(log, user)
-	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+	// the tariff is checked again since it may have changed while the chat was waiting for the text
+	maxLength := x.chatInstructionsMaxLength(log, user)
+	if length := len([]rune(text)); length > maxLength {
+		tooLongMsg := x.localization.LocalizeByTd(msg, "MsgInstructionsTooLong", map[string]interface{}{
+			"Length": length,
+			"Max":    maxLength,
+		})
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, tooLongMsg))
 		return
 	}
 
-	userAnotherCostLastMonth, err := x.usage.GetUserAnotherCostLastMonth(log, user)
-	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
+	if err := x.chatInstructions.SetInstructions(log, msg.Chat.ID, text, user); err != nil {
+		errorMsg := x.localization.LocalizeBy(msg, "MsgInstructionsError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
 		return
 	}
 
-	userAnotherTokens, err := x.usage.GetUserAnotherTokens(log, user)
+	successMsg := x.localization.LocalizeBy(msg, "MsgInstructionsSaved")
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, successMsg))
+}
+
+// chatInstructionsMaxLength is the instructions cap of the tariff of the user setting them, 0 when the tariff has none
+func (x *TelegramHandler) chatInstructionsMaxLength(log *tracing.Logger, user *entities.User) int {
+	grade, err := x.donations.GetUserGrade(log, user)
 	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
-		return
+		log.W("Failed to get user grade, using bronze", tracing.InnerError, err)
+		grade = platform.GradeBronze
 	}
 
-	userAnotherTokensLastMonth, err := x.usage.GetUserAnotherTokensLastMonth(log, user)
+	tariff, err := x.tariffs.GetLatestByKey(log, string(grade))
+	if err != nil && grade != platform.GradeBronze {
+		tariff, err = x.tariffs.GetLatestByKey(log, string(platform.GradeBronze))
+	}
 	if err != nil {
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, statsErrorMsg))
-		return
+		log.E("Failed to get tariff for chat instructions", tracing.InnerError, err)
+		return 0
 	}
 
-	title := x.localization.LocalizeBy(msg, "MsgStatsTitle")
-
-	generalStats := x.localization.LocalizeByTd(msg, "MsgStatsGeneral", map[string]interface{}{
-		"TotalQuestions":           format.Numberify(totalQuestions),
-		"ChatQuestions":            format.Numberify(chatQuestions),
-		"TotalCost":                totalCost.String(),
-		"MonthlyCost":              totalCostLastMonth.String(),
-		"DailyCost":                format.CurrencifyDecimal(avgDailyCost),
-		"TotalTokens":              format.Numberify(totalTokens),
-		"MonthlyTokens":            format.Numberify(totalTokensLastMonth),
-		"AnotherTotalCost":         anotherTotalCost.String(),
-		"AnotherMonthlyCost":       anotherTotalCostLastMonth.String(),
-		"AnotherTotalTokens":       format.Numberify(anotherTotalTokens),
-		"AnotherMonthlyTokens":     format.Numberify(anotherTotalTokensLastMonth),
-	})
-
-	personalStats := x.localization.LocalizeByTd(msg, "MsgStatsPersonal", map[string]interface{}{
-		"TotalQuestions":           format.Numberify(userQuestions),
-		"ChatQuestions":            format.Numberify(userChatQuestions),
-		"TotalCost":                format.CurrencifyDecimal(userCost),
-		"MonthlyCost":              format.CurrencifyDecimal(userCostLastMonth),
-		"DailyCost":                format.CurrencifyDecimal(userAvgDailyCost),
-		"TotalTokens":              format.Numberify(userTokens),
-		"MonthlyTokens":            format.Numberify(userTokensLastMonth),
-		"AnotherTotalCost":         format.CurrencifyDecimal(userAnotherCost),
-		"AnotherMonthlyCost":       format.CurrencifyDecimal(userAnotherCostLastMonth),
-		"AnotherTotalTokens":       format.Numberify(userAnotherTokens),
-		"AnotherMonthlyTokens":     format.Numberify(userAnotherTokensLastMonth),
-	})
-
-	usersStats := x.localization.LocalizeByTd(msg, "MsgStatsUsers", map[string]interface{}{
-		"Users": format.Numberify(totalUsers),
-		"Chats": format.Numberify(totalChats),
-	})
-
-	response := title + generalStats + personalStats + usersStats
-	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, response))
+	return tariff.ChatInstructionsMaxLength
 }
 
-func (x *TelegramHandler) PersonalizationCommandInfo(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
-	infoMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationInfo")
-
-	addBtn := tgbotapi.NewInlineKeyboardButtonData(
-		x.localization.LocalizeBy(msg, "MsgPersonalizationAddBtn"),
-		"personalization_add",
-	)
-	removeBtn := tgbotapi.NewInlineKeyboardButtonData(
-		x.localization.LocalizeBy(msg, "MsgPersonalizationRemoveBtn"),
-		"personalization_remove",
-	)
-	printBtn := tgbotapi.NewInlineKeyboardButtonData(
-		x.localization.LocalizeBy(msg, "MsgPersonalizationPrintBtn"),
-		"personalization_print",
-	)
+// =========================  /settings command handlers  =========================
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(addBtn, removeBtn),
-		tgbotapi.NewInlineKeyboardRow(printBtn),
-	)
+const settingsMaxKeywords = 20
 
-	x.diplomat.ReplyWithKeyboard(log, msg, x.personality.XiifyManual(msg, infoMsg), keyboard)
+// settingsLanguageNames are shown in the native language, so a chat can find its own in any locale
+var settingsLanguageNames = map[string]string{
+	"en": "English",
+	"ru": "Русский",
+	"zh": "中文",
 }
 
-func (x *TelegramHandler) handlePersonalizationCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, user *entities.User) {
-	msg := query.Message
-
-	switch query.Data {
-	case "personalization_add":
-		err := x.chatState.InitPersonalizationEdit(log, msg.Chat.ID, query.From.ID)
-		if err != nil {
-			log.E("Failed to init personalization state", tracing.InnerError, err)
-			return
-		}
-
-		callback := tgbotapi.NewCallback(query.ID, "")
-		x.diplomat.bot.Request(callback)
+// XiJoinedChat greets a group the bot was just added to and points its administrators to the settings panel
+func (x *TelegramHandler) XiJoinedChat(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	defer tracing.ProfilePoint(log, "Xi joined chat completed", "telegram.command.xi.joined", "chat_id", msg.Chat.ID)()
 
-		awaitingMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationAwaitingInput")
-		x.diplomat.SendMessage(log, msg.Chat.ID, x.personality.XiifyManualPlain(awaitingMsg))
+	log.I("Bot was added to chat", "chat_title", msg.Chat.Title)
 
-	case "personalization_remove":
-		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgPersonalizationDeleteConfirmCallback"))
-		x.diplomat.bot.Request(callback)
+	welcomeMsg := x.localization.LocalizeBy(msg, "MsgSettingsWelcome")
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(x.localization.LocalizeBy(msg, "MsgSettingsOpenBtn"), "settings_open"),
+	))
+	x.diplomat.SendMessageWithKeyboard(log, msg, x.personality.XiifyManual(msg, welcomeMsg), keyboard)
+}
 
-		confirmMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationDeleteConfirm")
+func (x *TelegramHandler) SettingsCommandShow(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	defer tracing.ProfilePoint(log, "Settings command show completed", "telegram.command.settings.show", "chat_id", msg.Chat.ID)()
 
-		cancelBtn := tgbotapi.NewInlineKeyboardButtonData(
-			x.localization.LocalizeBy(msg, "MsgPersonalizationDeleteCancelBtn"),
-			"personalization_delete_cancel",
-		)
-		confirmBtn := tgbotapi.NewInlineKeyboardButtonData(
-			x.localization.LocalizeBy(msg, "MsgPersonalizationDeleteConfirmBtn"),
-			"personalization_delete_confirm",
-		)
+	text, keyboard := x.renderSettings(log, msg)
+	x.diplomat.ReplyWithKeyboard(log, msg, text, keyboard)
+}
 
-		keyboard := tgbotapi.NewInlineKeyboardMarkup(
-			tgbotapi.NewInlineKeyboardRow(cancelBtn, confirmBtn),
-		)
+// renderSettings builds the panel of the chat of msg, the mode is the one of the topic msg belongs to
+func (x *TelegramHandler) renderSettings(log *tracing.Logger, msg *tgbotapi.Message) (string, tgbotapi.InlineKeyboardMarkup) {
+	chatID := platform.ChatID(msg.Chat.ID)
+	settings := x.settingsOf(log, msg.Chat.ID)
 
-		x.diplomat.SendMessageWithKeyboard(log, msg.Chat.ID, x.personality.XiifyManualPlain(confirmMsg), keyboard)
+	modeName := "—"
+	if mode, err := x.modes.GetCurrentModeForChat(log, msg.Chat.ID, x.topics.ThreadOf(log, msg)); err == nil && mode != nil {
+		modeName = mode.Name
+	}
 
-	case "personalization_print":
-		personalization, err := x.personalizations.GetPersonalizationByUser(log, user)
-		if err != nil {
-			if errors.Is(err, repository.ErrPersonalizationNotFound) {
-				callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgPersonalizationNotFound"))
-				x.diplomat.bot.Request(callback)
-				return
-			}
+	contextEnabled := x.contextManager.IsEnabled(log, chatID)
+	contextKey := "MsgContextStatusEnabled"
+	if !contextEnabled {
+		contextKey = "MsgContextStatusDisabled"
+	}
 
-			log.E("Failed to get personalization", tracing.InnerError, err)
-			callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgPersonalizationErrorPrint"))
-			x.diplomat.bot.Request(callback)
-			return
+	language := x.localization.LocalizeBy(msg, "MsgSettingsLanguageAuto")
+	if settings.Language != "" {
+		language = settings.Language
+		if name, ok := settingsLanguageNames[settings.Language]; ok {
+			language = name
 		}
+	}
 
-		callback := tgbotapi.NewCallback(query.ID, "")
-		x.diplomat.bot.Request(callback)
-
-		response := x.localization.LocalizeByTd(msg, "MsgPersonalizationPrint", map[string]interface{}{
-			"Info": personalization.Prompt,
+	instructions := x.localization.LocalizeBy(msg, "MsgThisNoInstructions")
+	if ci, err := x.chatInstructions.GetInstructions(log, msg.Chat.ID); err == nil {
+		instructions = x.localization.LocalizeByTd(msg, "MsgSettingsInstructionsSet", map[string]interface{}{
+			"Length": len([]rune(ci.Text)),
 		})
-		x.diplomat.SendMessage(log, msg.Chat.ID, x.personality.XiifyManual(msg, response))
 	}
-}
-
-func (x *TelegramHandler) handlePersonalizationDeleteCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, user *entities.User) {
-	msg := query.Message
 
-	if query.Data == "personalization_delete_cancel" {
-		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgPersonalizationDeleteCancelledCallback"))
-		x.diplomat.bot.Request(callback)
+	message := x.localization.LocalizeBy(msg, "MsgSettingsTitle")
+	message += x.localization.LocalizeByTd(msg, "MsgSettingsModeLine", map[string]interface{}{"Mode": modeName})
+	message += x.localization.LocalizeByTd(msg, "MsgSettingsContextLine", map[string]interface{}{"Status": x.localization.LocalizeBy(msg, contextKey)})
 
-		cancelMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationDeleteCancelled")
-		x.diplomat.SendMessage(log, msg.Chat.ID, x.personality.XiifyManual(msg, cancelMsg))
+	var rows [][]tgbotapi.InlineKeyboardButton
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(x.localization.LocalizeBy(msg, "MsgSettingsModeBtn"), "settings_mode"),
+	))
+
+	contextBtn := "MsgSettingsContextOffBtn"
+	if contextEnabled {
+		contextBtn = "MsgSettingsContextOnBtn"
+	}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(x.localization.LocalizeBy(msg, contextBtn), "settings_context"),
+	))
+
+	// topics exist only in forum supergroups, other chats do not get the scope line at all
+	if msg.Chat.IsSuperGroup() {
+		scopeKey, scopeBtn := "MsgSettingsScopeShared", "MsgSettingsScopeSharedBtn"
+		if x.contextManager.IsPerTopic(log, chatID) {
+			scopeKey, scopeBtn = "MsgSettingsScopeTopics", "MsgSettingsScopeTopicsBtn"
+		}
+		message += x.localization.LocalizeByTd(msg, "MsgSettingsScopeLine", map[string]interface{}{"Scope": x.localization.LocalizeBy(msg, scopeKey)})
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(x.localization.LocalizeBy(msg, scopeBtn), "settings_topics"),
+		))
+	}
 
-		deleteMsg := tgbotapi.NewDeleteMessage(msg.Chat.ID, msg.MessageID)
-		x.diplomat.bot.Request(deleteMsg)
-		return
+	// trigger policies and quiet hours only apply to groups, in a private chat Xi answers every message
+	if !msg.Chat.IsPrivate() {
+		policy := x.localization.LocalizeBy(msg, settingsTriggerLabels[repository.TriggerPolicy(settings.TriggerPolicy)])
+		message += x.localization.LocalizeByTd(msg, "MsgSettingsTriggerLine", map[string]interface{}{"Policy": policy})
+		message += x.localization.LocalizeByTd(msg, "MsgSettingsQuietLine", map[string]interface{}{"Quiet": x.settingsQuietHours(log, msg, settings)})
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(x.localization.LocalizeByTd(msg, "MsgSettingsTriggerBtn", map[string]interface{}{"Policy": policy}), "settings_trigger"),
+		))
 	}
 
-	err := x.personalizations.DeletePersonalization(log, user)
-	if err != nil {
-		if errors.Is(err, repository.ErrPersonalizationNotFound) {
-			callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgPersonalizationNotFound"))
-			x.diplomat.bot.Request(callback)
+	message += x.localization.LocalizeByTd(msg, "MsgSettingsLanguageLine", map[string]interface{}{"Language": language})
+	message += x.localization.LocalizeByTd(msg, "MsgSettingsInstructionsLine", map[string]interface{}{"Instructions": instructions})
+	message += x.localization.LocalizeBy(msg, "MsgSettingsFooter")
 
-			deleteMsg := tgbotapi.NewDeleteMessage(msg.Chat.ID, msg.MessageID)
-			x.diplomat.bot.Request(deleteMsg)
-			return
-		}
+	rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(x.localization.LocalizeByTd(msg, "MsgSettingsLanguageBtn", map[string]interface{}{"Language": language}), "settings_lang"),
+		tgbotapi.NewInlineKeyboardButtonData(x.localization.LocalizeBy(msg, "MsgSettingsInstructionsBtn"), "settings_instructions"),
+	))
 
-		log.E("Failed to delete personalization", tracing.InnerError, err)
-		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgPersonalizationErrorRemove"))
-		x.diplomat.bot.Request(callback)
-		return
-	}
+	return x.personality.XiifyManual(msg, message), tgbotapi.NewInlineKeyboardMarkup(rows...)
+}
 
-	callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgPersonalizationDeletedCallback"))
-	x.diplomat.bot.Request(callback)
+// settingsTriggerLabels name trigger policies in the panel and in /settings replies
+var settingsTriggerLabels = map[repository.TriggerPolicy]string{
+	repository.TriggerPolicyAll:      "MsgTriggerPolicyAll",
+	repository.TriggerPolicyCommand:  "MsgTriggerPolicyCommand",
+	repository.TriggerPolicyReply:    "MsgTriggerPolicyReply",
+	repository.TriggerPolicyMention:  "MsgTriggerPolicyMention",
+	repository.TriggerPolicyKeywords: "MsgTriggerPolicyKeywords",
+	repository.TriggerPolicyLurker:   "MsgTriggerPolicyLurker",
+}
+
+// settingsQuietHours describes quiet hours of the chat with their time zone, or says there are none
+func (x *TelegramHandler) settingsQuietHours(log *tracing.Logger, msg *tgbotapi.Message, settings *entities.ChatSetting) string {
+	if settings.QuietFrom == nil || settings.QuietTo == nil {
+		return x.localization.LocalizeBy(msg, "MsgSettingsQuietOff")
+	}
 
-	successMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationRemoved")
-	x.diplomat.SendMessage(log, msg.Chat.ID, x.personality.XiifyManual(msg, successMsg))
+	return x.localization.LocalizeByTd(msg, "MsgSettingsQuietRange", map[string]interface{}{
+		"From":     formatClock(*settings.QuietFrom),
+		"To":       formatClock(*settings.QuietTo),
+		"TimeZone": x.chatSettings.Location(log, settings).String(),
+	})
+}
 
-	deleteMsg := tgbotapi.NewDeleteMessage(msg.Chat.ID, msg.MessageID)
-	x.diplomat.bot.Request(deleteMsg)
+// nextSettingsLanguage cycles automatic detection through the loaded locales and back
+func (x *TelegramHandler) nextSettingsLanguage(current string) string {
+	languages := x.localization.Languages()
+	index := slices.Index(languages, current)
+	if index == len(languages)-1 {
+		return ""
+	}
+	return languages[index+1]
 }
 
-func (x *TelegramHandler) handlePersonalizationInput(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
-	prompt := strings.TrimSpace(msg.Text)
+func (x *TelegramHandler) handleSettingsCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery) {
+	msg := query.Message
+	action := strings.TrimPrefix(query.Data, "settings_")
 
-	x.chatState.ClearState(log, msg.Chat.ID, msg.From.ID)
+	defer tracing.ProfilePoint(log, "Settings callback completed", "telegram.callback.settings", "chat_id", msg.Chat.ID, "action", action)()
 
-	promptRunes := []rune(prompt)
-	if len(promptRunes) < 12 {
-		errorMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationTooShort")
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
-		return
+	answer := func(key string) {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, key))
+		if _, err := x.diplomat.Request(log, callback); err != nil {
+			log.E("Failed to answer callback", tracing.InnerError, err)
+		}
 	}
 
-	if len(promptRunes) > 1024 {
-		errorMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationTooLong")
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+	if !x.CanManageChatByQuery(log, query) {
+		answer("MsgSettingsNoAccess")
 		return
 	}
 
-	validation, err := x.agents.ValidatePersonalization(log, prompt)
+	// the panel belongs to the bot, handlers shared with commands get it as if the pressing user sent it
+	origin := *msg
+	origin.From = query.From
+	origin.Text = ""
+
+	user, err := x.user(log, &origin)
 	if err != nil {
-		log.E("Failed to validate personalization with agent", tracing.InnerError, err)
-		errorMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationValidationError")
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		answer("MsgSettingsError")
 		return
 	}
 
-	if validation.Confidence <= 0.68 {
-		log.I("Personalization validation failed", "confidence", validation.Confidence)
-		errorMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationValidationFailed")
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
-		return
-	}
+	chatID := platform.ChatID(msg.Chat.ID)
 
-	_, err = x.personalizations.CreateOrUpdatePersonalization(log, user, prompt)
-	if err != nil {
-		if errors.Is(err, repository.ErrPersonalizationTooShort) {
-			errorMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationTooShort")
-			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+	switch action {
+	case "open":
+		answer("MsgSettingsOpenedCallback")
+		text, keyboard := x.renderSettings(log, &origin)
+		x.diplomat.SendMessageWithKeyboard(log, &origin, text, keyboard)
+		return
+	case "mode":
+		answer("MsgSettingsOpenedCallback")
+		x.ModeCommandShowList(log, user, &origin)
+		return
+	case "instructions":
+		answer("MsgSettingsOpenedCallback")
+		x.InstructionsCommandSet(log, user, &origin)
+		return
+	case "context":
+		err = x.contextManager.SetEnabled(log, chatID, !x.contextManager.IsEnabled(log, chatID))
+	case "topics":
+		if !msg.Chat.IsSuperGroup() {
+			answer("MsgContextTopicsOnlyForums")
 			return
 		}
-
-		if errors.Is(err, repository.ErrPersonalizationTooLong) {
-			errorMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationTooLong")
-			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		err = x.contextManager.SetPerTopic(log, chatID, !x.contextManager.IsPerTopic(log, chatID))
+	case "trigger":
+		if msg.Chat.IsPrivate() {
+			answer("MsgTriggerOnlyGroups")
 			return
 		}
-
-		log.E("Failed to create personalization", tracing.InnerError, err)
-		errorMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationErrorAdd")
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		settings := x.settingsOf(log, msg.Chat.ID)
+		index := slices.Index(repository.TriggerPolicies, repository.TriggerPolicy(settings.TriggerPolicy))
+		settings.TriggerPolicy = string(repository.TriggerPolicies[(index+1)%len(repository.TriggerPolicies)])
+		err = x.chatSettings.SaveSettings(log, settings, user)
+	case "lang":
+		settings := x.settingsOf(log, msg.Chat.ID)
+		settings.Language = x.nextSettingsLanguage(settings.Language)
+		if err = x.chatSettings.SaveSettings(log, settings, user); err == nil {
+			x.localization.SetChatLanguage(msg.Chat.ID, settings.Language)
+		}
+	default:
+		log.W("Unknown settings callback", "data", query.Data)
 		return
 	}
 
-	log.I("Personalization set successfully", "confidence", validation.Confidence)
-	successMsg := x.localization.LocalizeBy(msg, "MsgPersonalizationAdded")
-	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, successMsg))
-}
-
-// =========================  /context command handlers  =========================
-
-func (x *TelegramHandler) ContextCommandRefresh(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
-	err := x.contextManager.Clear(log, platform.ChatID(msg.Chat.ID))
 	if err != nil {
-		log.E("Failed to clear context", tracing.InnerError, err)
-		errorMsg := x.localization.LocalizeBy(msg, "MsgContextRefreshError")
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		log.E("Failed to change chat settings", "action", action, tracing.InnerError, err)
+		answer("MsgSettingsError")
 		return
 	}
 
-	successMsg := x.localization.LocalizeBy(msg, "MsgContextRefreshed")
-	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, successMsg))
+	answer("MsgSettingsSavedCallback")
+	text, keyboard := x.renderSettings(log, &origin)
+	x.diplomat.EditMessageWithKeyboard(log, msg.Chat.ID, msg.MessageID, text, keyboard)
 }
 
-func (x *TelegramHandler) ContextCommandInfo(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
-	grade, err := x.donations.GetUserGrade(log, user)
-	if err != nil {
-		log.W("Failed to get user grade, using bronze", tracing.InnerError, err)
-		grade = platform.GradeBronze
+// updateSettings applies change to the settings of the chat and reports the outcome, change returns the key
+// of the reply or an empty key when the input is invalid and the help should be shown instead
+func (x *TelegramHandler) updateSettings(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, change func(settings *entities.ChatSetting) (string, map[string]interface{})) {
+	if msg.Chat.IsPrivate() {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, "MsgTriggerOnlyGroups")))
+		return
 	}
 
-	stats, err := x.contextManager.GetStats(log, platform.ChatID(msg.Chat.ID), grade)
-	if err != nil {
-		log.E("Failed to get context stats", tracing.InnerError, err)
-		errorMsg := x.localization.LocalizeBy(msg, "MsgContextInfoError")
-		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+	settings := x.settingsOf(log, msg.Chat.ID)
+	key, data := change(settings)
+	if key == "" {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, "MsgSettingsHelpText")))
 		return
 	}
 
-	statusText := x.localization.LocalizeBy(msg, "MsgContextStatusEnabled")
-	if !stats.Enabled {
-		statusText = x.localization.LocalizeBy(msg, "MsgContextStatusDisabled")
+	if err := x.chatSettings.SaveSettings(log, settings, user); err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeBy(msg, "MsgSettingsError")))
+		return
 	}
 
-	infoMsg := x.localization.LocalizeByTd(msg, "MsgContextInfo", map[string]interface{}{
-		"Status":          statusText,
-		"CurrentMessages": format.Numberify(int64(stats.CurrentMessages)),
-		"MaxMessages":     format.Numberify(int64(stats.MaxMessages)),
-		"CurrentTokens":   format.Numberify(int64(stats.CurrentTokens)),
-		"MaxTokens":       format.Numberify(int64(stats.MaxTokens)),
-	})
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.localization.LocalizeByTd(msg, key, data)))
+}
 
-	canManage := msg.Chat.Type == "private" || x.rights.IsUserHasRight(log, user, "manage_context")
+func (x *TelegramHandler) SettingsCommandTrigger(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, policy string) {
+	defer tracing.ProfilePoint(log, "Settings command trigger completed", "telegram.command.settings.trigger", "chat_id", msg.Chat.ID, "policy", policy)()
 
-	if !canManage {
-	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, infoMsg))
-		return
-	}
+	x.updateSettings(log, user, msg, func(settings *entities.ChatSetting) (string, map[string]interface{}) {
+		label, ok := settingsTriggerLabels[repository.TriggerPolicy(policy)]
+		if !ok {
+			return "", nil
+		}
+		settings.TriggerPolicy = policy
+		return "MsgTriggerPolicySet", map[string]interface{}{"Policy": x.localization.LocalizeBy(msg, label)}
+	})
+}
 
-	var rows [][]tgbotapi.InlineKeyboardButton
+func (x *TelegramHandler) SettingsCommandKeywords(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, words string) {
+	defer tracing.ProfilePoint(log, "Settings command keywords completed", "telegram.command.settings.keywords", "chat_id", msg.Chat.ID)()
 
-	clearBtn := tgbotapi.NewInlineKeyboardButtonData(
-		x.localization.LocalizeBy(msg, "MsgContextClearBtn"),
-		"context_clear",
-	)
-	rows = append(rows, tgbotapi.NewInlineKeyboardRow(clearBtn))
+	x.updateSettings(log, user, msg, func(settings *entities.ChatSetting) (string, map[string]interface{}) {
+		var keywords []string
+		for _, keyword := range strings.Split(words, ",") {
+			if keyword = strings.ToLower(strings.TrimSpace(keyword)); keyword != "" && !slices.Contains(keywords, keyword) {
+				keywords = append(keywords, keyword)
+			}
+		}
+		if len(keywords) == 0 || len(keywords) > settingsMaxKeywords {
+			return "", nil
+		}
+		settings.TriggerKeywords = strings.Join(keywords, ",")
+		return "MsgTriggerKeywordsSet", map[string]interface{}{"Keywords": strings.Join(keywords, ", ")}
+	})
+}
 
-	if stats.Enabled {
-		disableBtn := tgbotapi.NewInlineKeyboardButtonData(
-			x.localization.LocalizeBy(msg, "MsgContextDisableBtn"),
-			"context_disable",
-		)
-		rows = append(rows, tgbotapi.NewInlineKeyboardRow(disableBtn))
-	} else {
-		enableBtn := tgbotapi.NewInlineKeyboardButtonData(
-			x.localization.LocalizeBy(msg, "MsgContextEnableBtn"),
-			"context_enable",
-		)
-		rows = append(rows, tgbotapi.NewInlineKeyboardRow(enableBtn))
-	}
+func (x *TelegramHandler) SettingsCommandChance(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, percent string) {
+	defer tracing.ProfilePoint(log, "Settings command chance completed", "telegram.command.settings.chance", "chat_id", msg.Chat.ID)()
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
-	x.diplomat.ReplyWithKeyboard(log, msg, x.personality.XiifyManual(msg, infoMsg), keyboard)
+	x.updateSettings(log, user, msg, func(settings *entities.ChatSetting) (string, map[string]interface{}) {
+		chance, err := strconv.Atoi(strings.TrimSuffix(percent, "%"))
+		if err != nil || chance < 1 || chance > 100 {
+			return "", nil
+		}
+		settings.LurkerChance = chance
+		return "MsgTriggerChanceSet", map[string]interface{}{"Chance": chance}
+	})
 }
 
-func (x *TelegramHandler) handleContextToggleCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, user *entities.User) {
-	msg := query.Message
+func (x *TelegramHandler) SettingsCommandQuiet(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, from string, to string) {
+	defer tracing.ProfilePoint(log, "Settings command quiet completed", "telegram.command.settings.quiet", "chat_id", msg.Chat.ID)()
 
-	if msg.Chat.Type != "private" && !x.rights.IsUserHasRight(log, user, "manage_context") {
-		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextNoAccess"))
-		if _, err := x.diplomat.bot.Request(callback); err != nil {
-			log.E("Failed to answer callback", tracing.InnerError, err)
+	x.updateSettings(log, user, msg, func(settings *entities.ChatSetting) (string, map[string]interface{}) {
+		if from == "" && to == "" {
+			settings.QuietFrom, settings.QuietTo = nil, nil
+			return "MsgTriggerQuietOff", nil
 		}
-		return
-	}
 
-	var enable bool
-	var successMsgKey string
-	var errorMsgKey string
-	var callbackMsgKey string
+		fromMinute, fromOk := parseClock(from)
+		toMinute, toOk := parseClock(to)
+		if !fromOk || !toOk || fromMinute == toMinute {
+			return "", nil
+		}
+		settings.QuietFrom, settings.QuietTo = &fromMinute, &toMinute
+		return "MsgTriggerQuietSet", map[string]interface{}{"Quiet": x.settingsQuietHours(log, msg, settings)}
+	})
+}
 
-	if query.Data == "context_enable" {
-		enable = true
-		successMsgKey = "MsgContextEnabled"
-		errorMsgKey = "MsgContextEnableError"
-		callbackMsgKey = "MsgContextEnabledCallback"
-	} else {
-		enable = false
-		successMsgKey = "MsgContextDisabled"
-		errorMsgKey = "MsgContextDisableError"
-		callbackMsgKey = "MsgContextDisabledCallback"
-	}
+func (x *TelegramHandler) SettingsCommandTimezone(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, zone string) {
+	defer tracing.ProfilePoint(log, "Settings command timezone completed", "telegram.command.settings.timezone", "chat_id", msg.Chat.ID, "zone", zone)()
 
-	err := x.contextManager.SetEnabled(log, platform.ChatID(msg.Chat.ID), enable)
-	if err != nil {
-		log.E("Failed to toggle context", tracing.InnerError, err)
-		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, errorMsgKey))
-		if _, err := x.diplomat.bot.Request(callback); err != nil {
-			log.E("Failed to answer callback", tracing.InnerError, err)
+	x.updateSettings(log, user, msg, func(settings *entities.ChatSetting) (string, map[string]interface{}) {
+		location, err := time.LoadLocation(zone)
+		if err != nil || zone == "" || strings.EqualFold(zone, "local") {
+			return "", nil
 		}
-		return
-	}
+		settings.TimeZone = location.String()
+		return "MsgTriggerTimezoneSet", map[string]interface{}{"TimeZone": settings.TimeZone}
+	})
+}
 
-	callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, callbackMsgKey))
-	if _, err := x.diplomat.bot.Request(callback); err != nil {
-		log.E("Failed to answer callback", tracing.InnerError, err)
+// parseClock reads "HH:MM" into minutes of the day
+func parseClock(value string) (int, bool) {
+	clock, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, false
 	}
+	return clock.Hour()*60 + clock.Minute(), true
+}
 
-	successMsg := x.localization.LocalizeBy(msg, successMsgKey)
-	x.diplomat.SendMessage(log, msg.Chat.ID, x.personality.XiifyManual(msg, successMsg))
+func formatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
 
-	var rows [][]tgbotapi.InlineKeyboardButton
+// =========================  /debug command handlers  =========================
 
-	clearBtn := tgbotapi.NewInlineKeyboardButtonData(
-		x.localization.LocalizeBy(msg, "MsgContextClearBtn"),
-		"context_clear",
-	)
-	rows = append(rows, tgbotapi.NewInlineKeyboardRow(clearBtn))
+func (x *TelegramHandler) XiCommandDryRun(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message, req string) {
+	defer tracing.ProfilePoint(log, "Xi command dry run completed", "telegram.command.xi.dry_run", "chat_id", msg.Chat.ID)()
+	if !x.rights.IsUserHasRight(log, user, "edit_mode") {
+		noAccessMsg := x.localization.LocalizeBy(msg, "MsgDebugNoAccess")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, noAccessMsg))
+		return
+	}
 
-	if enable {
-		disableBtn := tgbotapi.NewInlineKeyboardButtonData(
-			x.localization.LocalizeBy(msg, "MsgContextDisableBtn"),
-			"context_disable",
-		)
-		rows = append(rows, tgbotapi.NewInlineKeyboardRow(disableBtn))
-	} else {
-		enableBtn := tgbotapi.NewInlineKeyboardButtonData(
-			x.localization.LocalizeBy(msg, "MsgContextEnableBtn"),
-			"context_enable",
-		)
-		rows = append(rows, tgbotapi.NewInlineKeyboardRow(enableBtn))
+	if req == "" {
+		helpMsg := x.localization.LocalizeBy(msg, "MsgDebugHelpText")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+		return
 	}
 
-	newKeyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	x.diplomat.StartTyping(msg)
+	defer x.diplomat.StopTyping(msg)
 
-	editMsg := tgbotapi.NewEditMessageReplyMarkup(msg.Chat.ID, msg.MessageID, newKeyboard)
-	if _, err := x.diplomat.bot.Request(editMsg); err != nil {
-		log.E("Failed to edit message keyboard", tracing.InnerError, err)
+	persona := msg.From.FirstName + " " + msg.From.LastName + " (@" + msg.From.UserName + ")"
+
+	result, err := x.dialer.Dial(log, msg, req, artificial.DialOptions{Persona: persona, Stackful: true, Incognito: x.IsIncognitoRequest(msg), DryRun: true})
+	if err != nil || result.Trace == nil {
+		x.diplomat.Reply(log, msg, x.localization.LocalizeBy(msg, "MsgErrorResponse"))
+		return
 	}
-}
 
-func (x *TelegramHandler) handleContextClearCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, user *entities.User) {
-	msg := query.Message
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.formatDialTrace(msg, result.Trace)))
+}
 
-	if msg.Chat.Type != "private" && !x.rights.IsUserHasRight(log, user, "manage_context") {
-		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextNoAccess"))
-		if _, err := x.diplomat.bot.Request(callback); err != nil {
-			log.E("Failed to answer callback", tracing.InnerError, err)
+// DebugCommandShow shows the trace of the replied answer, or of the latest answer in the chat without a reply
+func (x *TelegramHandler) DebugCommandShow(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	var trace *artificial.DialTrace
+	var err error
+
+	if reply := msg.ReplyToMessage; reply != nil && reply.From != nil && reply.From.IsBot {
+		usage, usageErr := x.usage.GetUsageByResponse(log, msg.Chat.ID, reply.MessageID)
+		if usageErr != nil {
+			err = usageErr
+		} else if usage != nil {
+			trace, err = x.traces.Get(log, usage.ID)
 		}
-		return
+	} else {
+		trace, err = x.traces.Last(log, msg.Chat.ID)
 	}
 
-	callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextClearConfirmCallback"))
-	if _, err := x.diplomat.bot.Request(callback); err != nil {
-		log.E("Failed to answer callback", tracing.InnerError, err)
+	if err != nil {
+		errorMsg := x.localization.LocalizeBy(msg, "MsgDebugError")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, errorMsg))
+		return
 	}
 
-	confirmMsg := x.localization.LocalizeBy(msg, "MsgContextClearConfirm")
+	if trace == nil {
+		notFoundMsg := x.localization.LocalizeBy(msg, "MsgDebugNotFound")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, notFoundMsg))
+		return
+	}
 
-	cancelBtn := tgbotapi.NewInlineKeyboardButtonData(
-		x.localization.LocalizeBy(msg, "MsgContextClearCancelBtn"),
-		"context_clear_cancel",
-	)
-	confirmBtn := tgbotapi.NewInlineKeyboardButtonData(
-		x.localization.LocalizeBy(msg, "MsgContextClearConfirmBtn"),
-		"context_clear_confirm",
-	)
+	x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, x.formatDialTrace(msg, trace)))
+}
 
-	keyboard := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(cancelBtn, confirmBtn),
-	)
+func (x *TelegramHandler) formatDialTrace(msg *tgbotapi.Message, trace *artificial.DialTrace) string {
+	var builder strings.Builder
 
-	x.diplomat.SendMessageWithKeyboard(log, msg.Chat.ID, x.personality.XiifyManual(msg, confirmMsg), keyboard)
-}
+	line := func(key string, value any) {
+		fmt.Fprintf(&builder, "%-15s %v\n", key+":", value)
+	}
 
-func (x *TelegramHandler) handleContextClearConfirmCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, user *entities.User) {
-	msg := query.Message
+	mode := fmt.Sprintf("%s v%d", trace.ModeType, trace.ModeVersion)
+	if trace.Experiment != "" {
+		mode += fmt.Sprintf(" (%s/%s)", trace.Experiment, trace.Variant)
+	}
+	line("grade", trace.UserGrade)
+	line("mode", mode)
 
-	if msg.Chat.Type != "private" && !x.rights.IsUserHasRight(log, user, "manage_context") {
-		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextNoAccess"))
-		if _, err := x.diplomat.bot.Request(callback); err != nil {
-			log.E("Failed to answer callback", tracing.InnerError, err)
+	if trace.DryRun {
+		planned := "-"
+		if len(trace.PlannedAgents) > 0 {
+			planned = strings.Join(trace.PlannedAgents, ", ")
 		}
-		return
+		line("agents", planned)
+	} else if trace.EffortAgent != nil {
+		line("effort agent", fmt.Sprintf("%s, complexity %s, speed %t, quality %t, t=%.2f", trace.EffortAgent.ReasoningEffort, trace.EffortAgent.TaskComplexity, trace.EffortAgent.RequiresSpeed, trace.EffortAgent.RequiresQuality, trace.EffortAgent.Temperature))
+	} else {
+		line("effort agent", "-")
+	}
+	if trace.LengthAgent != nil {
+		line("length agent", fmt.Sprintf("%s (%.2f), guideline %t", trace.LengthAgent.Length, trace.LengthAgent.Confidence, trace.LengthGuide))
+	} else if !trace.DryRun {
+		line("length agent", "-")
 	}
 
-	if query.Data == "context_clear_cancel" {
-		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextClearCancelledCallback"))
-		if _, err := x.diplomat.bot.Request(callback); err != nil {
-			log.E("Failed to answer callback", tracing.InnerError, err)
-		}
+	line("model", fmt.Sprintf("%s (%s)", trace.Model, trace.ModelSource))
+	if trace.FallbackModel != "" {
+		line("fallback", trace.FallbackModel)
+	}
+	if override := trace.LimitOverride; override != nil {
+		line("limit override", fmt.Sprintf("%s, %s $%s / $%s", override.OriginalModel, override.LimitType, override.Spent, override.Limit))
+	}
 
-		cancelMsg := x.localization.LocalizeBy(msg, "MsgContextClearCancelled")
-		x.diplomat.SendMessage(log, msg.Chat.ID, x.personality.XiifyManual(msg, cancelMsg))
+	params := fmt.Sprintf("effort %s, t=%.2f, sort %s", trace.Effort, trace.Temperature, trace.ProviderSort)
+	if trace.MaxTokens > 0 {
+		params += fmt.Sprintf(", max %d", trace.MaxTokens)
+	}
+	line("params", params)
 
-		deleteMsg := tgbotapi.NewDeleteMessage(msg.Chat.ID, msg.MessageID)
-		if _, err := x.diplomat.bot.Request(deleteMsg); err != nil {
-			log.E("Failed to delete confirmation message", tracing.InnerError, err)
-		}
-		return
+	tools := "-"
+	if len(trace.Tools) > 0 {
+		tools = strings.Join(trace.Tools, ", ")
+	}
+	line("tools", tools)
+	line("personalized", trace.Personalized)
+	line("chat instructions", trace.Instructions)
+	line("prompt", fmt.Sprintf("%d tokens", trace.PromptTokens))
+	if trace.DryRun {
+		line("history", fmt.Sprintf("%d messages, %d / %d tokens, summarization due %t", trace.HistoryCount, trace.HistoryTokens, trace.ContextBudget, trace.Summarized))
+	} else {
+		line("history", fmt.Sprintf("%d messages, %d / %d tokens, summarized %t", trace.HistoryCount, trace.HistoryTokens, trace.ContextBudget, trace.Summarized))
 	}
 
-	err := x.contextManager.Clear(log, platform.ChatID(msg.Chat.ID))
-	if err != nil {
-		log.E("Failed to clear context", tracing.InnerError, err)
-		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextRefreshError"))
-		if _, err := x.diplomat.bot.Request(callback); err != nil {
-			log.E("Failed to answer callback", tracing.InnerError, err)
+	for idx, iteration := range trace.Iterations {
+		line(fmt.Sprintf("call %d", idx+1), fmt.Sprintf("%s, %d tokens, $%.6f, %s", iteration.Duration.Round(time.Millisecond), iteration.Tokens, iteration.Cost, iteration.FinishReason))
+	}
+	for _, call := range trace.ToolCalls {
+		value := fmt.Sprintf("%s %s", call.Duration.Round(time.Millisecond), call.Arguments)
+		if call.Error != "" {
+			value += " ! " + call.Error
 		}
-		return
+		line(call.Name, value)
 	}
 
-	callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgContextClearedCallback"))
-	if _, err := x.diplomat.bot.Request(callback); err != nil {
-		log.E("Failed to answer callback", tracing.InnerError, err)
+	if !trace.DryRun {
+		line("tokens", fmt.Sprintf("%d + agents %d", trace.Tokens, trace.AgentTokens))
+		line("cost", fmt.Sprintf("$%s + agents $%s", trace.Cost, trace.AgentCost))
+		line("latency", trace.Latency.Round(time.Millisecond))
 	}
 
-	successMsg := x.localization.LocalizeBy(msg, "MsgContextRefreshed")
-	x.diplomat.SendMessage(log, msg.Chat.ID, x.personality.XiifyManual(msg, successMsg))
-
-	deleteMsg := tgbotapi.NewDeleteMessage(msg.Chat.ID, msg.MessageID)
-	if _, err := x.diplomat.bot.Request(deleteMsg); err != nil {
-		log.E("Failed to delete confirmation message", tracing.InnerError, err)
+	key := "MsgDebugTrace"
+	if trace.DryRun {
+		key = "MsgDebugDryRun"
 	}
+
+	return x.localization.LocalizeByTd(msg, key, map[string]interface{}{
+		"CreatedAt": trace.CreatedAt.UTC().Format("2006-01-02 15:04:05 UTC"),
+		"Trace":     strings.TrimRight(builder.String(), "\n"),
+	})
 }
 
 // =========================  /ban and /pardon command handlers  =========================
@@ -2391,7 +5425,7 @@ func (x *TelegramHandler) HealthCommand(log *tracing.Logger, user *entities.User
 
 	// Telegram API check
 	telegramStatus := statusOk
-	if err := x.health.CheckTelegramHealth(log, x.diplomat.bot); err != nil {
+	if err := x.health.CheckTelegramHealth(log, x.diplomat); err != nil {
 		telegramStatus = statusFail
 	}
 
@@ -2483,19 +5517,27 @@ func (x *TelegramHandler) ThisCommand(log *tracing.Logger, user *entities.User,
 	gradeEmoji := getGradeEmoji(grade)
 	gradeName := getGradeNameRu(grade)
 	accountAge := x.dateTimeFormatter.Ageify(msg, user.CreatedAt)
+	model, _ := x.dialer.EffectiveModel(log, user, msg.Chat.ID, grade)
+
+	instructions := x.localization.LocalizeBy(msg, "MsgThisNoInstructions")
+	if existing, err := x.chatInstructions.GetInstructions(log, msg.Chat.ID); err == nil {
+		instructions = transform.SmartTruncate(existing.Text, thisInstructionsPreviewLength)
+	}
 
 	infoData := map[string]interface{}{
-		"Emoji":       gradeEmoji,
-		"Grade":       gradeName,
-		"AccountDate": accountAge,
-		"TelegramID":  user.UserID,
-		"Name":        *user.Fullname,
-		"Username":    *user.Username,
-		"InternalID":  user.ID,
-		"Rights":      user.Rights,
-		"ChatID":      msg.Chat.ID,
-		"ChatType":    msg.Chat.Type,
-		"ChatTitle":   msg.Chat.Title,
+		"Emoji":        gradeEmoji,
+		"Grade":        gradeName,
+		"AccountDate":  accountAge,
+		"TelegramID":   user.UserID,
+		"Name":         *user.Fullname,
+		"Username":     *user.Username,
+		"InternalID":   user.ID,
+		"Rights":       user.Rights,
+		"Model":        model,
+		"ChatID":       msg.Chat.ID,
+		"ChatType":     msg.Chat.Type,
+		"ChatTitle":    msg.Chat.Title,
+		"Instructions": instructions,
 	}
 
 	response := x.localization.LocalizeByTd(msg, "MsgThisInfo", infoData)
@@ -2535,7 +5577,7 @@ func (x *TelegramHandler) handlePardonCallback(log *tracing.Logger, query *tgbot
 
 	if !x.rights.IsUserHasRight(log, user, "manage_users") {
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUsersNoAccess"))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
@@ -2544,7 +5586,7 @@ func (x *TelegramHandler) handlePardonCallback(log *tracing.Logger, query *tgbot
 	if err != nil {
 		log.E("Failed to parse user ID from callback", tracing.InnerError, err)
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgPardonError"))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
@@ -2552,7 +5594,7 @@ func (x *TelegramHandler) handlePardonCallback(log *tracing.Logger, query *tgbot
 	if err != nil {
 		log.E("Failed to get user", tracing.InnerError, err)
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgUserNotFound"))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
@@ -2560,7 +5602,7 @@ func (x *TelegramHandler) handlePardonCallback(log *tracing.Logger, query *tgbot
 	if err != nil {
 		log.E("Failed to pardon user", tracing.InnerError, err)
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgBanErrorRemove"))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
@@ -2572,12 +5614,12 @@ func (x *TelegramHandler) handlePardonCallback(log *tracing.Logger, query *tgbot
 	callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeByTd(msg, "MsgPardonCallback", map[string]interface{}{
 		"Username": displayName,
 	}))
-	x.diplomat.bot.Request(callback)
+	x.diplomat.Request(log, callback)
 
 	successMsg := x.localization.LocalizeByTd(msg, "MsgBanPardon", map[string]interface{}{
 		"Username": displayName,
 	})
-	x.diplomat.SendMessage(log, msg.Chat.ID, x.personality.XiifyManual(msg, successMsg))
+	x.diplomat.SendMessage(log, msg, x.personality.XiifyManual(msg, successMsg))
 
 	const maxBannedUsers = 99
 	remainingBans, err := x.bans.GetAllActiveBans(log, maxBannedUsers)
@@ -2588,7 +5630,7 @@ func (x *TelegramHandler) handlePardonCallback(log *tracing.Logger, query *tgbot
 
 	if len(remainingBans) == 0 {
 		editMarkup := tgbotapi.NewEditMessageReplyMarkup(msg.Chat.ID, msg.MessageID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}})
-		x.diplomat.bot.Request(editMarkup)
+		x.diplomat.Request(log, editMarkup)
 		return
 	}
 
@@ -2619,7 +5661,7 @@ func (x *TelegramHandler) handlePardonCallback(log *tracing.Logger, query *tgbot
 
 	keyboard := tgbotapi.NewInlineKeyboardMarkup(buttons...)
 	editMarkup := tgbotapi.NewEditMessageReplyMarkup(msg.Chat.ID, msg.MessageID, keyboard)
-	if _, err := x.diplomat.bot.Request(editMarkup); err != nil {
+	if _, err := x.diplomat.Request(log, editMarkup); err != nil {
 		log.W("Failed to update pardon keyboard", tracing.InnerError, err)
 	}
 }
@@ -2774,7 +5816,7 @@ func (x *TelegramHandler) handleTariffAddCallback(log *tracing.Logger, query *tg
 
 	if !x.rights.IsUserHasRight(log, user, "manage_tariffs") {
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgTariffNoAccess"))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
@@ -2782,15 +5824,15 @@ func (x *TelegramHandler) handleTariffAddCallback(log *tracing.Logger, query *tg
 	if err != nil {
 		log.E("Failed to init tariff creation state", tracing.InnerError, err)
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgTariffErrorCreate"))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
 	callback := tgbotapi.NewCallback(query.ID, "")
-	x.diplomat.bot.Request(callback)
+	x.diplomat.Request(log, callback)
 
 	startMsg := x.localization.LocalizeBy(msg, "MsgTariffCreateStart")
-	x.diplomat.SendMessage(log, msg.Chat.ID, x.personality.XiifyManualPlain(startMsg))
+	x.diplomat.SendMessage(log, msg, x.personality.XiifyManualPlain(startMsg))
 }
 
 func (x *TelegramHandler) handleTariffInfoCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery, user *entities.User) {
@@ -2798,7 +5840,7 @@ func (x *TelegramHandler) handleTariffInfoCallback(log *tracing.Logger, query *t
 
 	if !x.rights.IsUserHasRight(log, user, "manage_tariffs") {
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgTariffNoAccess"))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
@@ -2810,7 +5852,7 @@ func (x *TelegramHandler) handleTariffInfoCallback(log *tracing.Logger, query *t
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeByTd(msg, "MsgTariffNotFound", map[string]interface{}{
 			"Key": tariffKey,
 		}))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
@@ -2827,15 +5869,16 @@ func (x *TelegramHandler) handleTariffInfoCallback(log *tracing.Logger, query *t
 		"SpendingDailyLimit":   tariff.SpendingDailyLimit.String(),
 		"SpendingMonthlyLimit": tariff.SpendingMonthlyLimit.String(),
 		"Price":                priceStr,
+		"InstructionsLength":   tariff.ChatInstructionsMaxLength,
 		"CreatedAt":            tariff.CreatedAt.Format("02.01.2006 15:04:05"),
 	}
 
 	infoMsg := x.localization.LocalizeByTd(msg, "MsgTariffInfo", data)
 
 	callback := tgbotapi.NewCallback(query.ID, "")
-	x.diplomat.bot.Request(callback)
+	x.diplomat.Request(log, callback)
 
-	x.diplomat.SendMessage(log, msg.Chat.ID, x.personality.XiifyManualPlain(infoMsg))
+	x.diplomat.SendMessage(log, msg, x.personality.XiifyManualPlain(infoMsg))
 }
 
 func (x *TelegramHandler) BroadcastCommandStart(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
@@ -2889,14 +5932,14 @@ func (x *TelegramHandler) handleBroadcastConfirmCallback(log *tracing.Logger, qu
 
 	if !x.rights.IsUserHasRight(log, user, "broadcast") {
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgBroadcastNoAccess"))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
 	state, err := x.chatState.GetState(log, msg.Chat.ID, query.From.ID)
 	if err != nil || state == nil || state.Status != repository.ChatStateConfirmBroadcast {
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgBroadcastErrorCreate"))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
@@ -2904,13 +5947,13 @@ func (x *TelegramHandler) handleBroadcastConfirmCallback(log *tracing.Logger, qu
 
 	if query.Data == "broadcast_cancel" {
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgBroadcastCancelledCallback"))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 
 		cancelMsg := x.localization.LocalizeBy(msg, "MsgBroadcastCancelled")
-		x.diplomat.SendMessage(log, msg.Chat.ID, x.personality.XiifyManual(msg, cancelMsg))
+		x.diplomat.SendMessage(log, msg, x.personality.XiifyManual(msg, cancelMsg))
 
 		deleteMsg := tgbotapi.NewDeleteMessage(msg.Chat.ID, msg.MessageID)
-		x.diplomat.bot.Request(deleteMsg)
+		x.diplomat.Request(log, deleteMsg)
 		return
 	}
 
@@ -2919,24 +5962,24 @@ func (x *TelegramHandler) handleBroadcastConfirmCallback(log *tracing.Logger, qu
 	_, err = x.broadcast.CreateBroadcast(log, user.ID, text)
 	if err != nil {
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgBroadcastErrorCreate"))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
 	chatIDs, err := x.messages.GetAllChatIDs(log)
 	if err != nil {
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgBroadcastErrorGetChats"))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
 	callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(msg, "MsgBroadcastSendingCallback"))
-	x.diplomat.bot.Request(callback)
+	x.diplomat.Request(log, callback)
 
 	deleteMsg := tgbotapi.NewDeleteMessage(msg.Chat.ID, msg.MessageID)
-	x.diplomat.bot.Request(deleteMsg)
+	x.diplomat.Request(log, deleteMsg)
 
-	x.diplomat.SendMessage(log, msg.Chat.ID, x.localization.LocalizeBy(msg, "MsgBroadcastStarted"))
+	x.diplomat.SendMessage(log, msg, x.localization.LocalizeBy(msg, "MsgBroadcastStarted"))
 
 	successCount := 0
 	failCount := 0
@@ -2954,8 +5997,6 @@ func (x *TelegramHandler) handleBroadcastConfirmCallback(log *tracing.Logger, qu
 		} else {
 			successCount++
 		}
-
-		time.Sleep(100 * time.Millisecond)
 	}
 
 	resultMsg := x.localization.LocalizeByTd(msg, "MsgBroadcastFinished", map[string]interface{}{
@@ -2963,5 +6004,5 @@ func (x *TelegramHandler) handleBroadcastConfirmCallback(log *tracing.Logger, qu
 		"Fail":    failCount,
 		"Total":   len(chatIDs),
 	})
-	x.diplomat.SendMessage(log, msg.Chat.ID, resultMsg)
+	x.diplomat.SendMessage(log, msg, resultMsg)
 }
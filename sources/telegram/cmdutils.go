@@ -4,6 +4,7 @@ import (
 	"errors"
 	"strings"
 	"ximanager/sources/framework/commands"
+	"ximanager/sources/persistence/entities"
 	"ximanager/sources/tracing"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -20,6 +21,65 @@ func (x *TelegramHandler) GetRequestText(msg *tgbotapi.Message) string {
 	return msg.Text
 }
 
+// IsIncognitoRequest reports whether the request uses the one-shot incognito form, e.g. "/xi! question"
+func (x *TelegramHandler) IsIncognitoRequest(msg *tgbotapi.Message) bool {
+	text := msg.Text
+	if text == "" {
+		text = msg.Caption
+	}
+
+	fields := strings.Fields(text)
+	return len(fields) > 0 && strings.HasPrefix(fields[0], "/") && strings.HasSuffix(fields[0], "!")
+}
+
+// DryRunRequest strips the dry-run flag of a command request, e.g. "/xi --dry-run question" -> "question"
+func (x *TelegramHandler) DryRunRequest(msg *tgbotapi.Message) (string, bool) {
+	if !msg.IsCommand() {
+		return "", false
+	}
+
+	req, found := strings.CutPrefix(strings.TrimSpace(msg.CommandArguments()), "--dry-run")
+	if !found || (req != "" && req[0] != ' ' && req[0] != '\n') {
+		return "", false
+	}
+
+	return strings.TrimSpace(req), true
+}
+
+// CanManageChat reports whether the sender may change settings of the whole chat: anyone in a private chat,
+// Telegram administrators of a group (including anonymous ones writing on behalf of the group) or users with the manage_context right
+func (x *TelegramHandler) CanManageChat(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) bool {
+	if msg.SenderChat != nil && msg.SenderChat.ID == msg.Chat.ID {
+		return true
+	}
+
+	return x.canManageChat(log, user, msg.Chat, msg.From.ID)
+}
+
+// CanManageChatByQuery checks the user who pressed the button, the message carrying the buttons belongs to the bot
+func (x *TelegramHandler) CanManageChatByQuery(log *tracing.Logger, query *tgbotapi.CallbackQuery) bool {
+	user, err := x.users.GetUserByEid(log, query.From.ID)
+	if err != nil {
+		user = nil
+	}
+
+	return x.canManageChat(log, user, query.Message.Chat, query.From.ID)
+}
+
+func (x *TelegramHandler) canManageChat(log *tracing.Logger, user *entities.User, chat *tgbotapi.Chat, userID int64) bool {
+	if chat.IsPrivate() || (user != nil && x.rights.IsUserHasRight(log, user, "manage_context")) {
+		return true
+	}
+
+	member, err := x.diplomat.ChatMember(chat.ID, userID)
+	if err != nil {
+		log.W("Failed to get chat member status", "chat_id", chat.ID, tracing.InnerError, err)
+		return false
+	}
+
+	return member.IsCreator() || member.IsAdministrator()
+}
+
 func (x *TelegramHandler) ParseCommand(log *tracing.Logger, msg *tgbotapi.Message, parser *commands.Parser) (*commands.ParseResult, error) {
 	args := msg.CommandArguments()
 	if args == "" {
@@ -0,0 +1,89 @@
+package telegram
+
+import (
+	"strings"
+	"time"
+	"ximanager/sources/repository"
+	"ximanager/sources/tracing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const coalesceDefaultMaxMessages = 10
+
+// coalesceFunc merges a burst of updates, next waits up to the timeout for the following update of the chat
+type coalesceFunc func(first tgbotapi.Update, next func(timeout time.Duration) (tgbotapi.Update, bool)) (tgbotapi.Update, *tgbotapi.Update)
+
+// coalesce debounces consecutive plain-text messages of one user and merges them into a single request.
+// Every merged message restarts the window, the first update that cannot be merged (e.g. a command) cancels it
+// and is returned as rest to be handled right after the merged one. The window holds up the whole chat queue,
+// so only messages Xi is going to answer open it, group chatter the trigger policy drops is handled at once.
+func (x *Poller) coalesce(first tgbotapi.Update, next func(timeout time.Duration) (tgbotapi.Update, bool)) (tgbotapi.Update, *tgbotapi.Update) {
+	window := x.config.Telegram.Coalescing.Window
+	if window <= 0 || !isCoalescible(first.Message) || x.hasActiveChatState(first.Message) || !x.handler.awaitsXi(x.log, first.Message) {
+		return first, nil
+	}
+
+	maxMessages := x.config.Telegram.Coalescing.MaxMessages
+	if maxMessages <= 0 {
+		maxMessages = coalesceDefaultMaxMessages
+	}
+
+	parts := []*tgbotapi.Message{first.Message}
+	var rest *tgbotapi.Update
+
+	for len(parts) < maxMessages {
+		update, ok := next(window)
+		if !ok {
+			break
+		}
+
+		// a message of anyone else ends the window as soon as it arrives
+		msg := update.Message
+		if !isCoalescible(msg) || msg.From.ID != first.Message.From.ID || msg.ReplyToMessage != nil {
+			rest = &update
+			break
+		}
+
+		parts = append(parts, msg)
+	}
+
+	if len(parts) == 1 {
+		return first, rest
+	}
+
+	x.log.I("Coalesced messages into one request", tracing.ChatId, first.Message.Chat.ID, "messages", len(parts))
+	x.metrics.RecordMessagesCoalesced(len(parts))
+
+	return mergeMessages(first, parts), rest
+}
+
+// hasActiveChatState keeps wizard inputs (prompts, configs, comments) apart, every message there is a separate answer
+func (x *Poller) hasActiveChatState(msg *tgbotapi.Message) bool {
+	state, err := x.handler.chatState.GetState(x.log, msg.Chat.ID, msg.From.ID)
+	if err != nil {
+		return true
+	}
+	return state != nil && state.Status != repository.ChatStateNone
+}
+
+// isCoalescible reports whether the message is plain text without a command or media, captions are never merged
+func isCoalescible(msg *tgbotapi.Message) bool {
+	return msg != nil && msg.From != nil && strings.TrimSpace(msg.Text) != "" && !msg.IsCommand()
+}
+
+// mergeMessages answers the last message of the burst with texts of all of them, the reply target is taken from the first one
+func mergeMessages(first tgbotapi.Update, parts []*tgbotapi.Message) tgbotapi.Update {
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		texts = append(texts, part.Text)
+	}
+
+	merged := *parts[len(parts)-1]
+	merged.Text = strings.Join(texts, "\n")
+	merged.Entities = nil
+	merged.ReplyToMessage = parts[0].ReplyToMessage
+
+	first.Message = &merged
+	return first
+}
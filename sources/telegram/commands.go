@@ -2,6 +2,7 @@ package telegram
 
 import (
 	"os"
+	"strconv"
 	"strings"
 	"ximanager/sources/framework/commands"
 	"ximanager/sources/persistence/entities"
@@ -12,12 +13,20 @@ import (
 )
 
 var (
-	modeParser = commands.NewParser().MustRegister("create", "edit {type}", "info", "help")
+	modeParser = commands.NewParser().MustRegister("create", "edit {type}", "info", "history {type}", "draft {type}", "export {type}", "import", "preview", "preview {type}", "vars", "vars set {name} {value}", "vars unset {name}", "help")
 	personalizationParser = commands.NewParser().MustRegister("help")
-	contextParser = commands.NewParser().MustRegister("help")
+	contextParser = commands.NewParser().MustRegister("help", "export", "import", "view", "view {page}", "drop {indices}", "branches", "fork {name}", "switch {name}", "prune {name}", "topics", "topics {state}")
 	banParser = commands.NewParser().MustRegister("{username} {reason} {duration}")
 	pardonParser = commands.NewParser().MustRegister("help")
 	tariffParser = commands.NewParser().MustRegister("help")
+	incognitoParser = commands.NewParser().MustRegister("help", "enable", "disable")
+	modelParser = commands.NewParser().MustRegister("help", "reset")
+	modelsParser = commands.NewParser().MustRegister("help", "sync", "check", "info {model}")
+	feedbackParser = commands.NewParser().MustRegister("help", "{days}")
+	debugParser = commands.NewParser().MustRegister("help")
+	instructionsParser = commands.NewParser().MustRegister("help", "set", "clear")
+	settingsParser = commands.NewParser().MustRegister("help", "trigger {policy}", "keywords {words}", "chance {percent}", "quiet off", "quiet {from} {to}", "timezone {zone}")
+	experimentParser = commands.NewParser().MustRegister("help", "create {key} {mode} {unit} {variants}", "stop {key}", "report {key}")
 )
 
 func (x *TelegramHandler) HandleXiCommand(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
@@ -45,6 +54,11 @@ func (x *TelegramHandler) HandleXiCommand(log *tracing.Logger, user *entities.Us
 		return
 	}
 
+	if req, ok := x.DryRunRequest(msg); ok {
+		x.XiCommandDryRun(log.With(tracing.CommandIssued, "xi/dry_run"), user, msg, req)
+		return
+	}
+
 	if msg.Photo != nil && len(msg.Photo) > 0 {
 		x.XiCommandPhoto(log, user, msg)
 		return
@@ -96,6 +110,55 @@ func (x *TelegramHandler) HandleModeCommand(log *tracing.Logger, user *entities.
 			return
 		}
 		x.ModeCommandInfoList(log, user, msg)
+	case "history {type}":
+		if !x.rights.IsUserHasRight(log, user, "edit_mode") {
+			noAccessMsg := x.localization.LocalizeBy(msg, "MsgModeModifyNoAccess")
+			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, noAccessMsg))
+			return
+		}
+		x.ModeCommandHistory(log, user, msg, result.Get("type"))
+	case "draft {type}":
+		if !x.rights.IsUserHasRight(log, user, "edit_mode") {
+			noAccessMsg := x.localization.LocalizeBy(msg, "MsgModeModifyNoAccess")
+			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, noAccessMsg))
+			return
+		}
+		x.ModeCommandDraft(log, user, msg, result.Get("type"))
+	case "export {type}":
+		if !x.rights.IsUserHasRight(log, user, "edit_mode") {
+			noAccessMsg := x.localization.LocalizeBy(msg, "MsgModeModifyNoAccess")
+			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, noAccessMsg))
+			return
+		}
+		x.ModeCommandExport(log, user, msg, result.Get("type"))
+	case "import":
+		if !x.rights.IsUserHasRight(log, user, "edit_mode") {
+			noAccessMsg := x.localization.LocalizeBy(msg, "MsgModeModifyNoAccess")
+			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, noAccessMsg))
+			return
+		}
+		x.ModeCommandImportStart(log, user, msg)
+	case "preview", "preview {type}":
+		if !x.rights.IsUserHasRight(log, user, "edit_mode") {
+			noAccessMsg := x.localization.LocalizeBy(msg, "MsgModeModifyNoAccess")
+			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, noAccessMsg))
+			return
+		}
+		x.ModeCommandPreview(log, user, msg, result.Get("type"))
+	case "vars", "vars set {name} {value}", "vars unset {name}":
+		if msg.Chat.Type != "private" && !x.rights.IsUserHasRight(log, user, "edit_mode") {
+			noAccessMsg := x.localization.LocalizeBy(msg, "MsgModeModifyNoAccess")
+			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, noAccessMsg))
+			return
+		}
+		switch result.Schema {
+		case "vars":
+			x.ModeCommandVars(log, user, msg)
+		case "vars set {name} {value}":
+			x.ModeCommandVarsSet(log, user, msg, result.Get("name"), result.Get("value"))
+		case "vars unset {name}":
+			x.ModeCommandVarsUnset(log, user, msg, result.Get("name"))
+		}
 	default:
 		log.W("Unknown mode subcommand", tracing.InternalCommand, result.Schema)
 		helpMsg := x.localization.LocalizeBy(msg, "MsgModeHelpText")
@@ -185,6 +248,274 @@ func (x *TelegramHandler) HandlePersonalizationCommand(log *tracing.Logger, user
 	}
 }
 
+func (x *TelegramHandler) HandleIncognitoCommand(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	helpMsg := x.localization.LocalizeBy(msg, "MsgIncognitoHelpText")
+
+	args := msg.CommandArguments()
+	if args == "" {
+		x.IncognitoCommandInfo(log, user, msg)
+		return
+	}
+
+	result, err := x.ParseCommand(log, msg, incognitoParser)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+		return
+	}
+
+	switch result.Schema {
+	case "help":
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+	case "enable", "disable":
+		x.IncognitoCommandSet(log, user, msg, x.ParseBooleanArgument(result.Schema))
+	default:
+		log.W("Unknown incognito subcommand", tracing.InternalCommand, result.Schema)
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+	}
+}
+
+func (x *TelegramHandler) HandleModelCommand(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	helpMsg := x.localization.LocalizeBy(msg, "MsgModelHelpText")
+
+	args := msg.CommandArguments()
+	if args == "" {
+		x.ModelCommandInfo(log, user, msg)
+		return
+	}
+
+	result, err := x.ParseCommand(log, msg, modelParser)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+		return
+	}
+
+	switch result.Schema {
+	case "help":
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+	case "reset":
+		x.ModelCommandReset(log, user, msg)
+	default:
+		log.W("Unknown model subcommand", tracing.InternalCommand, result.Schema)
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+	}
+}
+
+func (x *TelegramHandler) HandleModelsCommand(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	if !x.rights.IsUserHasRight(log, user, "manage_tariffs") {
+		noAccessMsg := x.localization.LocalizeBy(msg, "MsgModelsNoAccess")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, noAccessMsg))
+		return
+	}
+
+	helpMsg := x.localization.LocalizeBy(msg, "MsgModelsHelpText")
+
+	args := msg.CommandArguments()
+	if args == "" {
+		x.ModelsCommandOverview(log, user, msg)
+		return
+	}
+
+	result, err := x.ParseCommand(log, msg, modelsParser)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+		return
+	}
+
+	switch result.Schema {
+	case "help":
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+	case "sync":
+		x.ModelsCommandSync(log, user, msg)
+	case "check":
+		x.ModelsCommandCheck(log, user, msg)
+	case "info {model}":
+		x.ModelsCommandInfo(log, user, msg, result.Get("model"))
+	default:
+		log.W("Unknown models subcommand", tracing.InternalCommand, result.Schema)
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+	}
+}
+
+func (x *TelegramHandler) HandleExperimentCommand(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	if !x.rights.IsUserHasRight(log, user, "edit_mode") {
+		noAccessMsg := x.localization.LocalizeBy(msg, "MsgExperimentNoAccess")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, noAccessMsg))
+		return
+	}
+
+	helpMsg := x.localization.LocalizeBy(msg, "MsgExperimentHelpText")
+
+	args := msg.CommandArguments()
+	if args == "" {
+		x.ExperimentCommandList(log, user, msg)
+		return
+	}
+
+	result, err := x.ParseCommand(log, msg, experimentParser)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+		return
+	}
+
+	switch result.Schema {
+	case "help":
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+	case "create {key} {mode} {unit} {variants}":
+		x.ExperimentCommandCreate(log, user, msg, result.Get("key"), result.Get("mode"), result.Get("unit"), result.Get("variants"))
+	case "stop {key}":
+		x.ExperimentCommandStop(log, user, msg, result.Get("key"))
+	case "report {key}":
+		x.ExperimentCommandReport(log, user, msg, result.Get("key"))
+	default:
+		log.W("Unknown experiment subcommand", tracing.InternalCommand, result.Schema)
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+	}
+}
+
+func (x *TelegramHandler) HandleFeedbackCommand(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	if !x.rights.IsUserHasRight(log, user, "edit_mode") {
+		noAccessMsg := x.localization.LocalizeBy(msg, "MsgFeedbackReportNoAccess")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, noAccessMsg))
+		return
+	}
+
+	helpMsg := x.localization.LocalizeBy(msg, "MsgFeedbackHelpText")
+
+	args := msg.CommandArguments()
+	if args == "" {
+		x.FeedbackCommandReport(log, user, msg, feedbackReportDefaultDays)
+		return
+	}
+
+	result, err := x.ParseCommand(log, msg, feedbackParser)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+		return
+	}
+
+	switch result.Schema {
+	case "help":
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+	case "{days}":
+		days, err := strconv.Atoi(result.Get("days"))
+		if err != nil || days <= 0 || days > feedbackReportMaxDays {
+			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+			return
+		}
+		x.FeedbackCommandReport(log, user, msg, days)
+	default:
+		log.W("Unknown feedback subcommand", tracing.InternalCommand, result.Schema)
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+	}
+}
+
+func (x *TelegramHandler) HandleDebugCommand(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	if !x.rights.IsUserHasRight(log, user, "edit_mode") {
+		noAccessMsg := x.localization.LocalizeBy(msg, "MsgDebugNoAccess")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, noAccessMsg))
+		return
+	}
+
+	helpMsg := x.localization.LocalizeBy(msg, "MsgDebugHelpText")
+
+	args := msg.CommandArguments()
+	if args == "" {
+		x.DebugCommandShow(log, user, msg)
+		return
+	}
+
+	result, err := x.ParseCommand(log, msg, debugParser)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+		return
+	}
+
+	switch result.Schema {
+	case "help":
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+	default:
+		log.W("Unknown debug subcommand", tracing.InternalCommand, result.Schema)
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+	}
+}
+
+func (x *TelegramHandler) HandleInstructionsCommand(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	helpMsg := x.localization.LocalizeBy(msg, "MsgInstructionsHelpText")
+
+	args := msg.CommandArguments()
+	if args == "" {
+		x.InstructionsCommandShow(log, user, msg)
+		return
+	}
+
+	result, err := x.ParseCommand(log, msg, instructionsParser)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+		return
+	}
+
+	switch result.Schema {
+	case "help":
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+	case "set", "clear":
+		if !x.CanManageChat(log, user, msg) {
+			noAccessMsg := x.localization.LocalizeBy(msg, "MsgInstructionsNoAccess")
+			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, noAccessMsg))
+			return
+		}
+		if result.Schema == "set" {
+			x.InstructionsCommandSet(log, user, msg)
+		} else {
+			x.InstructionsCommandClear(log, user, msg)
+		}
+	default:
+		log.W("Unknown instructions subcommand", tracing.InternalCommand, result.Schema)
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+	}
+}
+
+func (x *TelegramHandler) HandleSettingsCommand(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
+	if !x.CanManageChat(log, user, msg) {
+		noAccessMsg := x.localization.LocalizeBy(msg, "MsgSettingsNoAccess")
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, noAccessMsg))
+		return
+	}
+
+	helpMsg := x.localization.LocalizeBy(msg, "MsgSettingsHelpText")
+
+	args := msg.CommandArguments()
+	if args == "" {
+		x.SettingsCommandShow(log, user, msg)
+		return
+	}
+
+	result, err := x.ParseCommand(log, msg, settingsParser)
+	if err != nil {
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+		return
+	}
+
+	switch result.Schema {
+	case "help":
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+	case "trigger {policy}":
+		x.SettingsCommandTrigger(log, user, msg, strings.ToLower(result.Get("policy")))
+	case "keywords {words}":
+		x.SettingsCommandKeywords(log, user, msg, result.Get("words"))
+	case "chance {percent}":
+		x.SettingsCommandChance(log, user, msg, result.Get("percent"))
+	case "quiet off":
+		x.SettingsCommandQuiet(log, user, msg, "", "")
+	case "quiet {from} {to}":
+		x.SettingsCommandQuiet(log, user, msg, result.Get("from"), result.Get("to"))
+	case "timezone {zone}":
+		x.SettingsCommandTimezone(log, user, msg, result.Get("zone"))
+	default:
+		log.W("Unknown settings subcommand", tracing.InternalCommand, result.Schema)
+		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+	}
+}
+
 func (x *TelegramHandler) HandleHelpCommand(log *tracing.Logger, user *entities.User, msg *tgbotapi.Message) {
 	x.diplomat.Reply(log, msg, x.localization.LocalizeBy(msg, "MsgHelpText"))
 }
@@ -211,6 +542,63 @@ func (x *TelegramHandler) HandleContextCommand(log *tracing.Logger, user *entiti
 	switch result.Schema {
 	case "help":
 		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
+	case "export":
+		if msg.Chat.Type != "private" && !x.rights.IsUserHasRight(log, user, "manage_context") {
+			noAccessMsg := x.localization.LocalizeBy(msg, "MsgContextNoAccess")
+			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, noAccessMsg))
+			return
+		}
+		x.ContextCommandExport(log, user, msg)
+	case "import":
+		if msg.Chat.Type != "private" && !x.rights.IsUserHasRight(log, user, "manage_context") {
+			noAccessMsg := x.localization.LocalizeBy(msg, "MsgContextNoAccess")
+			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, noAccessMsg))
+			return
+		}
+		x.ContextCommandImportStart(log, user, msg)
+	case "view", "view {page}":
+		if msg.Chat.Type != "private" && !x.rights.IsUserHasRight(log, user, "manage_context") {
+			noAccessMsg := x.localization.LocalizeBy(msg, "MsgContextNoAccess")
+			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, noAccessMsg))
+			return
+		}
+		page := 1
+		if result.Has("page") {
+			if parsed, err := strconv.Atoi(result.Get("page")); err == nil {
+				page = parsed
+			}
+		}
+		x.ContextCommandView(log, user, msg, page)
+	case "drop {indices}":
+		if msg.Chat.Type != "private" && !x.rights.IsUserHasRight(log, user, "manage_context") {
+			noAccessMsg := x.localization.LocalizeBy(msg, "MsgContextNoAccess")
+			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, noAccessMsg))
+			return
+		}
+		x.ContextCommandDrop(log, user, msg, result.Get("indices"))
+	case "branches", "fork {name}", "switch {name}", "prune {name}":
+		if msg.Chat.Type != "private" && !x.rights.IsUserHasRight(log, user, "manage_context") {
+			noAccessMsg := x.localization.LocalizeBy(msg, "MsgContextNoAccess")
+			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, noAccessMsg))
+			return
+		}
+		switch result.Schema {
+		case "branches":
+			x.ContextCommandBranches(log, user, msg)
+		case "fork {name}":
+			x.ContextCommandFork(log, user, msg, strings.ToLower(result.Get("name")))
+		case "switch {name}":
+			x.ContextCommandSwitch(log, user, msg, strings.ToLower(result.Get("name")))
+		case "prune {name}":
+			x.ContextCommandPrune(log, user, msg, strings.ToLower(result.Get("name")))
+		}
+	case "topics", "topics {state}":
+		if msg.Chat.Type != "private" && !x.rights.IsUserHasRight(log, user, "manage_context") {
+			noAccessMsg := x.localization.LocalizeBy(msg, "MsgContextNoAccess")
+			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, noAccessMsg))
+			return
+		}
+		x.ContextCommandTopics(log, user, msg, strings.ToLower(result.Get("state")))
 	default:
 		log.W("Unknown context subcommand", tracing.InternalCommand, result.Schema)
 		x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, helpMsg))
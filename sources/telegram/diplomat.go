@@ -1,6 +1,7 @@
 package telegram
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"ximanager/sources/configuration"
@@ -24,10 +25,15 @@ type Diplomat struct {
 	localization  *localization.LocalizationManager
 	metrics       *metrics.MetricsService
 	features      *features.FeatureManager
+	topics        *repository.TopicsRepository
 	typingManager *TypingManager
+	outbound      *Outbound
+	log           *tracing.Logger
 }
 
-func NewDiplomat(bot *tgbotapi.BotAPI, config *configuration.Config, users *repository.UsersRepository, donations *repository.DonationsRepository, localization *localization.LocalizationManager, metrics *metrics.MetricsService, fm *features.FeatureManager, log *tracing.Logger) *Diplomat {
+func NewDiplomat(bot *tgbotapi.BotAPI, config *configuration.Config, users *repository.UsersRepository, donations *repository.DonationsRepository, localization *localization.LocalizationManager, metrics *metrics.MetricsService, fm *features.FeatureManager, topics *repository.TopicsRepository, log *tracing.Logger) *Diplomat {
+	outbound := NewOutbound(config, metrics)
+
 	return &Diplomat{
 		bot:           bot,
 		config:        config,
@@ -36,13 +42,22 @@ func NewDiplomat(bot *tgbotapi.BotAPI, config *configuration.Config, users *repo
 		localization:  localization,
 		metrics:       metrics,
 		features:      fm,
-		typingManager: NewTypingManager(bot, log),
+		topics:        topics,
+		typingManager: NewTypingManager(bot, outbound, log),
+		outbound:      outbound,
+		log:           log,
 	}
 }
 
 func (x *Diplomat) Reply(logger *tracing.Logger, msg *tgbotapi.Message, text string) {
+	x.ReplyTracked(logger, msg, text)
+}
+
+// ReplyTracked works like Reply and returns IDs of all successfully sent chunks
+func (x *Diplomat) ReplyTracked(logger *tracing.Logger, msg *tgbotapi.Message, text string) []int {
 	defer tracing.ProfilePoint(logger, "Diplomat reply completed", "diplomat.reply")()
 
+	var sentIDs []int
 	chunks := transform.Chunks(text, x.config.Telegram.DiplomatChunkSize)
 	isXiResponse := strings.HasPrefix(text, x.localization.LocalizeBy(msg, "MsgXiResponse"))
 
@@ -56,57 +71,132 @@ func (x *Diplomat) Reply(logger *tracing.Logger, msg *tgbotapi.Message, text str
 		isLastChunk := i == len(chunks)-1
 
 		if isXiResponse && isLastChunk {
-			var rows [][]tgbotapi.InlineKeyboardButton
-
-			if x.features.IsEnabled(features.FeatureFeedbackButtons) {
-				likeData := fmt.Sprintf("feedback_like_dialer_%d", msg.From.ID)
-				dislikeData := fmt.Sprintf("feedback_dislike_dialer_%d", msg.From.ID)
-				rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-					tgbotapi.NewInlineKeyboardButtonData(x.localization.LocalizeBy(msg, "MsgFeedbackLikeEmoji"), likeData),
-					tgbotapi.NewInlineKeyboardButtonData(x.localization.LocalizeBy(msg, "MsgFeedbackDislikeEmoji"), dislikeData),
-				))
-			}
-
-			user, err := x.users.GetUserByEid(logger, msg.From.ID)
-			if err != nil {
-				logger.E("Failed to get user", tracing.InnerError, err)
-			} else {
-				grade, err := x.donations.GetUserGrade(logger, user)
-				if err != nil {
-					logger.E("Failed to get donations", tracing.InnerError, err)
-				} else {
-					if grade != platform.GradeGold && *user.Username != "mairwunnx" {
-						rows = append(rows, tgbotapi.NewInlineKeyboardRow(
-							tgbotapi.NewInlineKeyboardButtonURL(x.localization.LocalizeBy(msg, "MsgDonationsSupport"), "https://www.tbank.ru/cf/3uoCqIOiT8V"),
-						))
-					}
-				}
-			}
-
-			if len(rows) > 0 {
-				chattable.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
+			if keyboard := x.responseKeyboard(logger, msg); keyboard != nil {
+				chattable.ReplyMarkup = *keyboard
 			}
 		}
 
-		if _, err := x.bot.Send(chattable); err != nil {
+		sent, err := x.send(logger, msg, chattable)
+		if err != nil {
 			logger.E("Message chunk sending error", tracing.InnerError, err)
 			x.metrics.RecordMessageSent("error")
 			emsg := tgbotapi.NewMessage(msg.Chat.ID, markdown.EscapeMarkdownActor(x.localization.LocalizeBy(msg, "MsgXiError")))
 			emsg.ReplyToMessageID = msg.MessageID
 			emsg.ParseMode = tgbotapi.ModeMarkdownV2
 
-			if _, err := x.bot.Send(emsg); err != nil {
+			if _, err := x.send(logger, msg, emsg); err != nil {
 				logger.E("Failed to send fallback message", tracing.InnerError, err)
 			}
 			break
 		}
+		sentIDs = append(sentIDs, sent.MessageID)
+		x.metrics.RecordMessageSent("success")
+	}
+
+	return sentIDs
+}
+
+// responseKeyboard builds buttons attached to the last chunk of an answer, nil when there are none
+func (x *Diplomat) responseKeyboard(logger *tracing.Logger, msg *tgbotapi.Message) *tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+
+	if x.features.IsEnabled(features.FeatureFeedbackButtons) {
+		likeData := fmt.Sprintf("feedback_like_dialer_%d", msg.From.ID)
+		dislikeData := fmt.Sprintf("feedback_dislike_dialer_%d", msg.From.ID)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(x.localization.LocalizeBy(msg, "MsgFeedbackLikeEmoji"), likeData),
+			tgbotapi.NewInlineKeyboardButtonData(x.localization.LocalizeBy(msg, "MsgFeedbackDislikeEmoji"), dislikeData),
+		))
+	}
+
+	user, err := x.users.GetUserByEid(logger, msg.From.ID)
+	if err != nil {
+		logger.E("Failed to get user", tracing.InnerError, err)
+	} else {
+		grade, err := x.donations.GetUserGrade(logger, user)
+		if err != nil {
+			logger.E("Failed to get donations", tracing.InnerError, err)
+		} else {
+			if grade != platform.GradeGold && *user.Username != "mairwunnx" {
+				rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+					tgbotapi.NewInlineKeyboardButtonURL(x.localization.LocalizeBy(msg, "MsgDonationsSupport"), "https://www.tbank.ru/cf/3uoCqIOiT8V"),
+				))
+			}
+		}
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return &keyboard
+}
+
+// EditTracked rewrites a previously sent answer to msg in place: existing chunks are edited, missing ones are sent
+// as new messages and surplus ones are deleted. Returns IDs of all chunks now carrying the answer.
+func (x *Diplomat) EditTracked(logger *tracing.Logger, msg *tgbotapi.Message, replyIDs []int, text string) []int {
+	defer tracing.ProfilePoint(logger, "Diplomat edit reply completed", "diplomat.edit_reply")()
+
+	if len(replyIDs) == 0 {
+		return x.ReplyTracked(logger, msg, text)
+	}
+
+	var sentIDs []int
+	chunks := transform.Chunks(text, x.config.Telegram.DiplomatChunkSize)
+	isXiResponse := strings.HasPrefix(text, x.localization.LocalizeBy(msg, "MsgXiResponse"))
+
+	for i, chunk := range chunks {
+		var keyboard *tgbotapi.InlineKeyboardMarkup
+		if isXiResponse && i == len(chunks)-1 {
+			keyboard = x.responseKeyboard(logger, msg)
+		}
+
+		if i < len(replyIDs) {
+			chattable := tgbotapi.NewEditMessageText(msg.Chat.ID, replyIDs[i], markdown.EscapeMarkdownActor(chunk))
+			chattable.ParseMode = tgbotapi.ModeMarkdownV2
+			chattable.ReplyMarkup = keyboard
+
+			// "message is not modified" is fine here, the chunk still carries the answer
+			if _, err := x.sendPaced(logger, msg.Chat.ID, OutboundInteractive, chattable); err != nil && !strings.Contains(err.Error(), "message is not modified") {
+				logger.E("Message chunk edit error", "message_id", replyIDs[i], tracing.InnerError, err)
+				x.metrics.RecordMessageSent("error")
+				continue
+			}
+			sentIDs = append(sentIDs, replyIDs[i])
+			x.metrics.RecordMessageSent("success")
+			continue
+		}
+
+		chattable := tgbotapi.NewMessage(msg.Chat.ID, markdown.EscapeMarkdownActor(chunk))
+		chattable.ReplyToMessageID = msg.MessageID
+		chattable.ParseMode = tgbotapi.ModeMarkdownV2
+		if keyboard != nil {
+			chattable.ReplyMarkup = *keyboard
+		}
+
+		sent, err := x.send(logger, msg, chattable)
+		if err != nil {
+			logger.E("Message chunk sending error", tracing.InnerError, err)
+			x.metrics.RecordMessageSent("error")
+			break
+		}
+		sentIDs = append(sentIDs, sent.MessageID)
 		x.metrics.RecordMessageSent("success")
 	}
+
+	for _, replyID := range replyIDs[min(len(chunks), len(replyIDs)):] {
+		if _, err := x.Request(logger, tgbotapi.NewDeleteMessage(msg.Chat.ID, replyID)); err != nil {
+			logger.W("Failed to delete surplus answer chunk", "message_id", replyID, tracing.InnerError, err)
+		}
+	}
+
+	return sentIDs
 }
 
 func (x *Diplomat) SendTyping(logger *tracing.Logger, chatID int64) {
 	action := tgbotapi.NewChatAction(chatID, tgbotapi.ChatTyping)
-	if _, err := x.bot.Send(action); err != nil {
+	if _, err := x.Request(logger, action); err != nil {
 		logger.W("Failed to send typing action", tracing.InnerError, err)
 	}
 }
@@ -138,14 +228,14 @@ func (x *Diplomat) ReplyAudio(logger *tracing.Logger, msg *tgbotapi.Message, tex
 			chattable.ReplyMarkup = tgbotapi.NewInlineKeyboardMarkup(rows...)
 		}
 
-		if _, err := x.bot.Send(chattable); err != nil {
+		if _, err := x.send(logger, msg, chattable); err != nil {
 			logger.E("Audio message chunk sending error", tracing.InnerError, err)
 			x.metrics.RecordMessageSent("error")
 			emsg := tgbotapi.NewMessage(msg.Chat.ID, markdown.EscapeMarkdownActor(x.localization.LocalizeBy(msg, "MsgXiError")))
 			emsg.ReplyToMessageID = msg.MessageID
 			emsg.ParseMode = tgbotapi.ModeMarkdownV2
 
-			if _, err := x.bot.Send(emsg); err != nil {
+			if _, err := x.send(logger, msg, emsg); err != nil {
 				logger.E("Failed to send fallback message", tracing.InnerError, err)
 			}
 			break
@@ -154,12 +244,13 @@ func (x *Diplomat) ReplyAudio(logger *tracing.Logger, msg *tgbotapi.Message, tex
 	}
 }
 
-func (x *Diplomat) StartTyping(chatID int64) {
-	x.typingManager.Start(chatID)
+// StartTyping keeps the typing status in the chat (and forum topic) of msg until StopTyping
+func (x *Diplomat) StartTyping(msg *tgbotapi.Message) {
+	x.typingManager.Start(msg.Chat.ID, x.topics.ThreadOf(x.log, msg))
 }
 
-func (x *Diplomat) StopTyping(chatID int64) {
-	x.typingManager.Stop(chatID)
+func (x *Diplomat) StopTyping(msg *tgbotapi.Message) {
+	x.typingManager.Stop(msg.Chat.ID)
 }
 
 func (x *Diplomat) SendText(logger *tracing.Logger, chatID int64, text string) error {
@@ -169,7 +260,7 @@ func (x *Diplomat) SendText(logger *tracing.Logger, chatID int64, text string) e
 		msg := tgbotapi.NewMessage(chatID, markdown.EscapeMarkdownActor(chunk))
 		msg.ParseMode = tgbotapi.ModeMarkdownV2
 
-		if _, err := x.bot.Send(msg); err != nil {
+		if _, err := x.sendPaced(logger, chatID, OutboundInteractive, msg); err != nil {
 			logger.E("Message chunk sending error", tracing.InnerError, err)
 			x.metrics.RecordMessageSent("error")
 			return err
@@ -195,7 +286,7 @@ func (x *Diplomat) SendBroadcastMessage(logger *tracing.Logger, chatID int64, te
 			)
 		}
 
-		if _, err := x.bot.Send(msg); err != nil {
+		if _, err := x.sendPaced(logger, chatID, OutboundBroadcast, msg); err != nil {
 			logger.E("Broadcast message chunk sending error", tracing.InnerError, err)
 			x.metrics.RecordMessageSent("error")
 			return err
@@ -213,7 +304,7 @@ func (x *Diplomat) ReplyWithKeyboard(logger *tracing.Logger, msg *tgbotapi.Messa
 	chattable.ParseMode = tgbotapi.ModeMarkdownV2
 	chattable.ReplyMarkup = keyboard
 
-	if _, err := x.bot.Send(chattable); err != nil {
+	if _, err := x.send(logger, msg, chattable); err != nil {
 		logger.E("Message with keyboard sending error", tracing.InnerError, err)
 		x.metrics.RecordMessageSent("error")
 		return
@@ -221,13 +312,13 @@ func (x *Diplomat) ReplyWithKeyboard(logger *tracing.Logger, msg *tgbotapi.Messa
 	x.metrics.RecordMessageSent("success")
 }
 
-func (x *Diplomat) SendMessage(logger *tracing.Logger, chatID int64, text string) {
+func (x *Diplomat) SendMessage(logger *tracing.Logger, origin *tgbotapi.Message, text string) {
 	defer tracing.ProfilePoint(logger, "Diplomat send message completed", "diplomat.send_message")()
 
-	chattable := tgbotapi.NewMessage(chatID, markdown.EscapeMarkdownActor(text))
+	chattable := tgbotapi.NewMessage(origin.Chat.ID, markdown.EscapeMarkdownActor(text))
 	chattable.ParseMode = tgbotapi.ModeMarkdownV2
 
-	if _, err := x.bot.Send(chattable); err != nil {
+	if _, err := x.send(logger, origin, chattable); err != nil {
 		logger.E("Message sending error", tracing.InnerError, err)
 		x.metrics.RecordMessageSent("error")
 		return
@@ -235,17 +326,173 @@ func (x *Diplomat) SendMessage(logger *tracing.Logger, chatID int64, text string
 	x.metrics.RecordMessageSent("success")
 }
 
-func (x *Diplomat) SendMessageWithKeyboard(logger *tracing.Logger, chatID int64, text string, keyboard tgbotapi.InlineKeyboardMarkup) {
+func (x *Diplomat) SendMessageWithKeyboard(logger *tracing.Logger, origin *tgbotapi.Message, text string, keyboard tgbotapi.InlineKeyboardMarkup) {
 	defer tracing.ProfilePoint(logger, "Diplomat send message with keyboard completed", "diplomat.send_message_with_keyboard")()
 
-	chattable := tgbotapi.NewMessage(chatID, markdown.EscapeMarkdownActor(text))
+	chattable := tgbotapi.NewMessage(origin.Chat.ID, markdown.EscapeMarkdownActor(text))
 	chattable.ParseMode = tgbotapi.ModeMarkdownV2
 	chattable.ReplyMarkup = keyboard
 
-	if _, err := x.bot.Send(chattable); err != nil {
+	if _, err := x.send(logger, origin, chattable); err != nil {
 		logger.E("Message with keyboard sending error", tracing.InnerError, err)
 		x.metrics.RecordMessageSent("error")
 		return
 	}
 	x.metrics.RecordMessageSent("success")
 }
+
+func (x *Diplomat) ReplyDocument(logger *tracing.Logger, msg *tgbotapi.Message, fileName string, data []byte, caption string) error {
+	defer tracing.ProfilePoint(logger, "Diplomat reply document completed", "diplomat.reply_document", "file_name", fileName)()
+
+	document := tgbotapi.NewDocument(msg.Chat.ID, tgbotapi.FileBytes{Name: fileName, Bytes: data})
+	document.ReplyToMessageID = msg.MessageID
+	if caption != "" {
+		document.Caption = markdown.EscapeMarkdownActor(caption)
+		document.ParseMode = tgbotapi.ModeMarkdownV2
+	}
+
+	if _, err := x.sendPaced(logger, msg.Chat.ID, OutboundInteractive, document); err != nil {
+		logger.E("Document sending error", tracing.InnerError, err)
+		x.metrics.RecordMessageSent("error")
+		return err
+	}
+	x.metrics.RecordMessageSent("success")
+	return nil
+}
+
+func (x *Diplomat) EditMessageWithKeyboard(logger *tracing.Logger, chatID int64, messageID int, text string, keyboard tgbotapi.InlineKeyboardMarkup) {
+	defer tracing.ProfilePoint(logger, "Diplomat edit message with keyboard completed", "diplomat.edit_message_with_keyboard")()
+
+	chattable := tgbotapi.NewEditMessageTextAndMarkup(chatID, messageID, markdown.EscapeMarkdownActor(text), keyboard)
+	chattable.ParseMode = tgbotapi.ModeMarkdownV2
+
+	if _, err := x.sendPaced(logger, chatID, OutboundInteractive, chattable); err != nil {
+		logger.E("Message edit sending error", tracing.InnerError, err)
+		x.metrics.RecordMessageSent("error")
+		return
+	}
+	x.metrics.RecordMessageSent("success")
+}
+
+// send delivers the message into the forum topic of origin. Replies land in the topic of the replied message by themselves,
+// other messages need message_thread_id the library does not know, so they are sent with raw params
+func (x *Diplomat) send(logger *tracing.Logger, origin *tgbotapi.Message, chattable tgbotapi.MessageConfig) (tgbotapi.Message, error) {
+	threadID := 0
+	if chattable.ReplyToMessageID == 0 {
+		threadID = x.topics.ThreadOf(logger, origin)
+	}
+	if threadID == 0 {
+		return x.sendPaced(logger, chattable.ChatID, OutboundInteractive, chattable)
+	}
+
+	params, err := messageParams(chattable)
+	if err != nil {
+		return tgbotapi.Message{}, err
+	}
+	params.AddNonZero("message_thread_id", threadID)
+
+	var sent tgbotapi.Message
+	err = x.outbound.Do(logger, chattable.ChatID, OutboundInteractive, func() error {
+		resp, err := x.bot.MakeRequest("sendMessage", params)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(resp.Result, &sent)
+	})
+	return sent, err
+}
+
+// sendPaced sends chattable to chatID through the outbound limits
+func (x *Diplomat) sendPaced(logger *tracing.Logger, chatID int64, priority OutboundPriority, chattable tgbotapi.Chattable) (tgbotapi.Message, error) {
+	var sent tgbotapi.Message
+	err := x.outbound.Do(logger, chatID, priority, func() error {
+		var err error
+		sent, err = x.bot.Send(chattable)
+		return err
+	})
+	return sent, err
+}
+
+// Request makes a call that answers with no message (edits, deletes, callback and inline answers) through the outbound limits
+func (x *Diplomat) Request(logger *tracing.Logger, chattable tgbotapi.Chattable) (*tgbotapi.APIResponse, error) {
+	var resp *tgbotapi.APIResponse
+	err := x.outbound.Do(logger, chatOf(chattable), OutboundInteractive, func() error {
+		var err error
+		resp, err = x.bot.Request(chattable)
+		return err
+	})
+	return resp, err
+}
+
+// Self is the bot account
+func (x *Diplomat) Self() tgbotapi.User {
+	return x.bot.Self
+}
+
+// GetMe asks the Bot API for the bot account, used as a health probe
+func (x *Diplomat) GetMe() (tgbotapi.User, error) {
+	var me tgbotapi.User
+	err := x.outbound.Do(x.log, 0, OutboundInteractive, func() error {
+		var err error
+		me, err = x.bot.GetMe()
+		return err
+	})
+	return me, err
+}
+
+// FileURL resolves a file sent to the bot to its download URL
+func (x *Diplomat) FileURL(fileID string) (string, error) {
+	file, err := x.bot.GetFile(tgbotapi.FileConfig{FileID: fileID})
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(GetFileAPIEndpoint(x.config), x.bot.Token, file.FilePath), nil
+}
+
+func (x *Diplomat) ChatMember(chatID int64, userID int64) (tgbotapi.ChatMember, error) {
+	return x.bot.GetChatMember(tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{ChatID: chatID, UserID: userID},
+	})
+}
+
+// chatOf is the chat whose limits a call counts against, zero for calls not bound to a chat. Chat actions count
+// only against the global limit, typing must not hold back the answer it announces.
+func chatOf(chattable tgbotapi.Chattable) int64 {
+	switch config := chattable.(type) {
+	case tgbotapi.MessageConfig:
+		return config.ChatID
+	case tgbotapi.EditMessageTextConfig:
+		return config.ChatID
+	case tgbotapi.EditMessageReplyMarkupConfig:
+		return config.ChatID
+	case tgbotapi.EditMessageCaptionConfig:
+		return config.ChatID
+	case tgbotapi.DeleteMessageConfig:
+		return config.ChatID
+	case tgbotapi.DocumentConfig:
+		return config.ChatID
+	}
+	return 0
+}
+
+// messageParams mirrors the sendMessage params the library builds from MessageConfig
+func messageParams(config tgbotapi.MessageConfig) (tgbotapi.Params, error) {
+	params := tgbotapi.Params{}
+
+	params.AddFirstValid("chat_id", config.ChatID, config.ChannelUsername)
+	params.AddNonZero("reply_to_message_id", config.ReplyToMessageID)
+	params.AddBool("disable_notification", config.DisableNotification)
+	params.AddBool("allow_sending_without_reply", config.AllowSendingWithoutReply)
+	params.AddNonEmpty("text", config.Text)
+	params.AddNonEmpty("parse_mode", config.ParseMode)
+	params.AddBool("disable_web_page_preview", config.DisableWebPagePreview)
+
+	if err := params.AddInterface("reply_markup", config.ReplyMarkup); err != nil {
+		return params, err
+	}
+	if err := params.AddInterface("entities", config.Entities); err != nil {
+		return params, err
+	}
+
+	return params, nil
+}
@@ -2,6 +2,7 @@ package telegram
 
 import (
 	"errors"
+	"slices"
 	"strconv"
 	"strings"
 	"ximanager/sources/artificial"
@@ -17,6 +18,7 @@ import (
 	"ximanager/sources/tracing"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/google/uuid"
 )
 
 type TelegramHandler struct {
@@ -30,6 +32,8 @@ type TelegramHandler struct {
 	messages          *repository.MessagesRepository
 	personalizations  *repository.PersonalizationsRepository
 	agents            *artificial.AgentSystem
+	catalog           *artificial.ModelCatalog
+	traces            *artificial.TraceStore
 	usage             *repository.UsageRepository
 	throttler         *throttler.Throttler
 	contextManager    *artificial.ContextManager
@@ -39,6 +43,12 @@ type TelegramHandler struct {
 	feedbacks         *repository.FeedbacksRepository
 	tariffs           *repository.TariffsRepository
 	chatState         *repository.ChatStateRepository
+	chatVariables     *repository.ChatVariablesRepository
+	chatInstructions  *repository.ChatInstructionsRepository
+	chatSettings      *repository.ChatSettingsRepository
+	chatMigration     *repository.ChatMigrationRepository
+	topics            *repository.TopicsRepository
+	experiments       *repository.ExperimentsRepository
 	features          *features.FeatureManager
 	localization      *localization.LocalizationManager
 	personality       *personality.XiPersonality
@@ -46,7 +56,7 @@ type TelegramHandler struct {
 	metrics           *metrics.MetricsService
 }
 
-func NewTelegramHandler(diplomat *Diplomat, users *repository.UsersRepository, rights *repository.RightsRepository, dialer *artificial.Dialer, whisper *artificial.Whisper, modes *repository.ModesRepository, donations *repository.DonationsRepository, messages *repository.MessagesRepository, personalizations *repository.PersonalizationsRepository, usage *repository.UsageRepository, throttler *throttler.Throttler, contextManager *artificial.ContextManager, health *repository.HealthRepository, bans *repository.BansRepository, broadcast *repository.BroadcastRepository, feedbacks *repository.FeedbacksRepository, tariffs *repository.TariffsRepository, chatState *repository.ChatStateRepository, agents *artificial.AgentSystem, fm *features.FeatureManager, localization *localization.LocalizationManager, personality *personality.XiPersonality, dateTimeFormatter *format.DateTimeFormatter, metrics *metrics.MetricsService, log *tracing.Logger) *TelegramHandler {
+func NewTelegramHandler(diplomat *Diplomat, users *repository.UsersRepository, rights *repository.RightsRepository, dialer *artificial.Dialer, whisper *artificial.Whisper, modes *repository.ModesRepository, donations *repository.DonationsRepository, messages *repository.MessagesRepository, personalizations *repository.PersonalizationsRepository, usage *repository.UsageRepository, throttler *throttler.Throttler, contextManager *artificial.ContextManager, health *repository.HealthRepository, bans *repository.BansRepository, broadcast *repository.BroadcastRepository, feedbacks *repository.FeedbacksRepository, tariffs *repository.TariffsRepository, chatState *repository.ChatStateRepository, chatVariables *repository.ChatVariablesRepository, chatInstructions *repository.ChatInstructionsRepository, chatSettings *repository.ChatSettingsRepository, chatMigration *repository.ChatMigrationRepository, topics *repository.TopicsRepository, experiments *repository.ExperimentsRepository, agents *artificial.AgentSystem, catalog *artificial.ModelCatalog, traces *artificial.TraceStore, fm *features.FeatureManager, localization *localization.LocalizationManager, personality *personality.XiPersonality, dateTimeFormatter *format.DateTimeFormatter, metrics *metrics.MetricsService, log *tracing.Logger) *TelegramHandler {
 	handler := &TelegramHandler{
 		diplomat:          diplomat,
 		users:             users,
@@ -58,6 +68,8 @@ func NewTelegramHandler(diplomat *Diplomat, users *repository.UsersRepository, r
 		messages:          messages,
 		personalizations:  personalizations,
 		agents:            agents,
+		catalog:           catalog,
+		traces:            traces,
 		usage:             usage,
 		throttler:         throttler,
 		contextManager:    contextManager,
@@ -67,6 +79,12 @@ func NewTelegramHandler(diplomat *Diplomat, users *repository.UsersRepository, r
 		feedbacks:         feedbacks,
 		tariffs:           tariffs,
 		chatState:         chatState,
+		chatVariables:     chatVariables,
+		chatInstructions:  chatInstructions,
+		chatSettings:      chatSettings,
+		chatMigration:     chatMigration,
+		topics:            topics,
+		experiments:       experiments,
 		features:          fm,
 		localization:      localization,
 		personality:       personality,
@@ -79,13 +97,42 @@ func NewTelegramHandler(diplomat *Diplomat, users *repository.UsersRepository, r
 
 func (x *TelegramHandler) notifySummarization(log *tracing.Logger, msg *tgbotapi.Message) {
 	notification := x.localization.LocalizeBy(msg, "MsgContextSummarized")
-	x.diplomat.SendMessage(log, msg.Chat.ID, x.personality.XiifyManualPlain(notification))
+	x.diplomat.SendMessage(log, msg, x.personality.XiifyManualPlain(notification))
+}
+
+// replyDialed sends the dialer answer and links sent messages to the request, so replies to them can rewind the context,
+// the last message carries the feedback buttons and is linked to the usage row of the answer
+func (x *TelegramHandler) replyDialed(log *tracing.Logger, msg *tgbotapi.Message, result *artificial.DialResult, text string) {
+	sentIDs := x.diplomat.ReplyTracked(log, msg, text)
+	x.bindDialed(log, msg, result, sentIDs)
+}
+
+// editDialed rewrites the answer previously sent to msg with a regenerated one and rebinds its messages
+func (x *TelegramHandler) editDialed(log *tracing.Logger, msg *tgbotapi.Message, replyIDs []int, result *artificial.DialResult, text string) {
+	sentIDs := x.diplomat.EditTracked(log, msg, replyIDs, text)
+	x.bindDialed(log, msg, result, sentIDs)
+}
+
+func (x *TelegramHandler) bindDialed(log *tracing.Logger, msg *tgbotapi.Message, result *artificial.DialResult, sentIDs []int) {
+	if !result.IsStateless {
+		x.contextManager.BindReplies(log, x.contextManager.Chat(log, msg), msg.MessageID, sentIDs)
+		x.contextManager.RememberAnswer(log, x.contextManager.Chat(log, msg), msg.MessageID, sentIDs)
+	}
+	if result.UsageID != uuid.Nil && len(sentIDs) > 0 {
+		x.usage.BindResponseMessage(log, result.UsageID, sentIDs[len(sentIDs)-1])
+	}
 }
 
 func (x *TelegramHandler) HandleMessage(log *tracing.Logger, msg *tgbotapi.Message) error {
 	defer tracing.ProfilePoint(log, "Telegram handler message completed", "telegram.handler.message")()
 	log.I("Got message")
 
+	// the chat moves no matter who upgraded it, blocked users and chat states must not hold it back
+	if msg.MigrateToChatID != 0 {
+		x.migrateChat(log, msg)
+		return nil
+	}
+
 	user, err := x.user(log, msg)
 	if err != nil {
 		log.E("Error getting or creating user", tracing.InnerError, err)
@@ -102,6 +149,9 @@ func (x *TelegramHandler) HandleMessage(log *tracing.Logger, msg *tgbotapi.Messa
 		return nil
 	}
 
+	settings := x.settingsOf(log, msg.Chat.ID)
+	x.localization.SetChatLanguage(msg.Chat.ID, settings.Language)
+
 	if msg.Sticker != nil {
 		log.I("Ignoring sticker message")
 		x.metrics.RecordMessageIgnored("sticker")
@@ -109,11 +159,17 @@ func (x *TelegramHandler) HandleMessage(log *tracing.Logger, msg *tgbotapi.Messa
 	}
 
 	if msg.Photo != nil && len(msg.Photo) != 0 {
-		x.HandleXiCommand(log.With(tracing.CommandIssued, "xi/photo"), user, msg)
+		if x.admitXi(log, settings, msg, isExplicitXi(msg)) {
+			x.HandleXiCommand(log.With(tracing.CommandIssued, "xi/photo"), user, msg)
+		}
 		return nil
 	}
 
 	if msg.ReplyToMessage != nil && msg.IsCommand() && msg.Command() == "xi" {
+		if !x.admitXi(log, settings, msg, true) {
+			return nil
+		}
+
 		replyMsg := msg.ReplyToMessage
 		if replyMsg.Voice != nil || replyMsg.VideoNote != nil || replyMsg.Audio != nil || replyMsg.Video != nil {
 			x.XiCommandAudio(log.With(tracing.CommandIssued, "xi/audio"), user, msg, replyMsg)
@@ -136,7 +192,9 @@ func (x *TelegramHandler) HandleMessage(log *tracing.Logger, msg *tgbotapi.Messa
 		case "help":
 			x.HandleHelpCommand(log, user, msg)
 		case "xi":
-			x.HandleXiCommand(log, user, msg)
+			if x.admitXi(log, settings, msg, true) {
+				x.HandleXiCommand(log, user, msg)
+			}
 		case "mode":
 			x.HandleModeCommand(log, user, msg)
 		case "users":
@@ -161,6 +219,22 @@ func (x *TelegramHandler) HandleMessage(log *tracing.Logger, msg *tgbotapi.Messa
 			x.HandleTariffCommand(log, user, msg)
 		case "cancel":
 			x.HandleCancelCommand(log, user, msg)
+		case "incognito":
+			x.HandleIncognitoCommand(log, user, msg)
+		case "model":
+			x.HandleModelCommand(log, user, msg)
+		case "models":
+			x.HandleModelsCommand(log, user, msg)
+		case "experiment":
+			x.HandleExperimentCommand(log, user, msg)
+		case "feedback":
+			x.HandleFeedbackCommand(log, user, msg)
+		case "debug":
+			x.HandleDebugCommand(log, user, msg)
+		case "instructions":
+			x.HandleInstructionsCommand(log, user, msg)
+		case "settings":
+			x.HandleSettingsCommand(log, user, msg)
 		default:
 			x.diplomat.Reply(log, msg, x.localization.LocalizeBy(msg, "MsgUnknownCommand"))
 		}
@@ -168,8 +242,11 @@ func (x *TelegramHandler) HandleMessage(log *tracing.Logger, msg *tgbotapi.Messa
 		if handled := x.handleChatStateMessage(log, user, msg); handled {
 			return nil
 		}
-		if msg.GroupChatCreated || msg.SuperGroupChatCreated || msg.ChannelChatCreated ||
-			msg.MigrateToChatID != 0 || msg.MigrateFromChatID != 0 ||
+		if x.isBotJoined(msg) {
+			x.XiJoinedChat(log, user, msg)
+			return nil
+		}
+		if msg.GroupChatCreated || msg.SuperGroupChatCreated || msg.ChannelChatCreated || msg.MigrateFromChatID != 0 ||
 			msg.PinnedMessage != nil || msg.NewChatMembers != nil || msg.LeftChatMember != nil ||
 			msg.NewChatTitle != "" || msg.NewChatPhoto != nil || msg.DeleteChatPhoto ||
 			msg.VoiceChatParticipantsInvited != nil || msg.VoiceChatStarted != nil || msg.VoiceChatEnded != nil || msg.VoiceChatScheduled != nil {
@@ -178,13 +255,13 @@ func (x *TelegramHandler) HandleMessage(log *tracing.Logger, msg *tgbotapi.Messa
 			return nil
 		}
 
-		if msg.ReplyToMessage != nil && msg.ReplyToMessage.From.ID != x.diplomat.bot.Self.ID {
+		if msg.ReplyToMessage != nil && msg.ReplyToMessage.From.ID != x.diplomat.Self().ID {
 			log.W("Message is a reply to another user, ignoring")
 			x.metrics.RecordMessageIgnored("reply_to_other")
 			return nil
 		}
 
-		if msg.ReplyToMessage != nil && msg.ReplyToMessage.From.ID == x.diplomat.bot.Self.ID {
+		if msg.ReplyToMessage != nil && msg.ReplyToMessage.From.ID == x.diplomat.Self().ID {
 			msgText := strings.TrimSpace(msg.Text)
 			if strings.HasPrefix(msgText, "/noreply") || strings.HasPrefix(msgText, "!") || strings.HasPrefix(msgText, ">") || strings.HasPrefix(msgText, "^") {
 				log.I("Ignoring noreply/!/>/^ command")
@@ -193,17 +270,59 @@ func (x *TelegramHandler) HandleMessage(log *tracing.Logger, msg *tgbotapi.Messa
 			}
 		}
 
-		x.HandleXiCommand(log.With(tracing.CommandIssued, "xi/direct"), user, msg)
+		if x.admitXi(log, settings, msg, false) {
+			x.HandleXiCommand(log.With(tracing.CommandIssued, "xi/direct"), user, msg)
+		}
 	}
 
 	return nil
 }
 
+// HandleEditedMessage re-answers a text request edited within the edit window, edits of anything else are ignored
+func (x *TelegramHandler) HandleEditedMessage(log *tracing.Logger, msg *tgbotapi.Message) error {
+	defer tracing.ProfilePoint(log, "Telegram handler edited message completed", "telegram.handler.edited_message")()
+	log.I("Got edited message")
+
+	if msg.From == nil || strings.TrimSpace(msg.Text) == "" {
+		x.metrics.RecordMessageIgnored("edited_non_text")
+		return nil
+	}
+
+	replyIDs := x.contextManager.AnswerOf(log, x.contextManager.Chat(log, msg), msg.MessageID)
+	if len(replyIDs) == 0 {
+		log.I("Edited message has no recent answer, ignoring")
+		x.metrics.RecordMessageIgnored("edited_unanswered")
+		return nil
+	}
+
+	user, err := x.user(log, msg)
+	if err != nil {
+		log.E("Error getting or creating user", tracing.InnerError, err)
+		return err
+	}
+
+	if !platform.BoolValue(user.IsActive, true) {
+		log.I("Ignoring edited message of blocked user")
+		return nil
+	}
+
+	settings := x.settingsOf(log, msg.Chat.ID)
+	x.localization.SetChatLanguage(msg.Chat.ID, settings.Language)
+
+	if !x.admitXi(log, settings, msg, msg.IsCommand() && msg.Command() == "xi") {
+		return nil
+	}
+
+	x.XiCommandEdited(log.With(tracing.CommandIssued, "xi/edited"), user, msg, replyIDs)
+	return nil
+}
+
 func (x *TelegramHandler) HandleCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery) error {
 	defer tracing.ProfilePoint(log, "Telegram handler callback completed", "telegram.handler.callback")()
 	log.I("Got callback", "data", query.Data)
 
-	user, err := x.user(log, query.Message)
+	// the message of a callback is the bot's own one, rights and rows belong to the user who pressed the button
+	user, err := x.userOf(log, query.From)
 	if err != nil {
 		log.E("Error getting or creating user", tracing.InnerError, err)
 		return err
@@ -212,7 +331,7 @@ func (x *TelegramHandler) HandleCallback(log *tracing.Logger, query *tgbotapi.Ca
 	if query.Data == "unsubscribe_broadcast" {
 		if *user.IsUnsubscribed {
 			callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, "MsgBroadcastAlreadyUnsubscribed"))
-			if _, err := x.diplomat.bot.Request(callback); err != nil {
+			if _, err := x.diplomat.Request(log, callback); err != nil {
 				log.E("Failed to answer callback", tracing.InnerError, err)
 			}
 			return nil
@@ -222,14 +341,14 @@ func (x *TelegramHandler) HandleCallback(log *tracing.Logger, query *tgbotapi.Ca
 		if _, err := x.users.UpdateUser(log, user); err != nil {
 			log.E("Failed to update user", tracing.InnerError, err)
 			callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, "MsgBroadcastErrorUnsubscribe"))
-			if _, err := x.diplomat.bot.Request(callback); err != nil {
+			if _, err := x.diplomat.Request(log, callback); err != nil {
 				log.E("Failed to answer callback", tracing.InnerError, err)
 			}
 			return err
 		}
 
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, "MsgBroadcastUnsubscribed"))
-		if _, err := x.diplomat.bot.Request(callback); err != nil {
+		if _, err := x.diplomat.Request(log, callback); err != nil {
 			log.E("Failed to answer callback", tracing.InnerError, err)
 		}
 		return nil
@@ -240,6 +359,12 @@ func (x *TelegramHandler) HandleCallback(log *tracing.Logger, query *tgbotapi.Ca
 		return nil
 	}
 
+	// Feedback reason callbacks: feedback_reason_{reason|skip}_{feedbackID}
+	if strings.HasPrefix(query.Data, "feedback_reason_") {
+		x.handleFeedbackReasonCallback(log, query)
+		return nil
+	}
+
 	// Mode selection callbacks: mode_select_{modeType}
 	if strings.HasPrefix(query.Data, "mode_select_") {
 		x.handleModeSelectCallback(log, query, user)
@@ -264,6 +389,29 @@ func (x *TelegramHandler) HandleCallback(log *tracing.Logger, query *tgbotapi.Ca
 		return nil
 	}
 
+	// Mode history callbacks: mode_ver_{version}_{modeType}, mode_rb_{version}_{modeType}
+	if strings.HasPrefix(query.Data, "mode_ver_") {
+		x.handleModeVersionCallback(log, query, user)
+		return nil
+	}
+
+	if strings.HasPrefix(query.Data, "mode_rb_") {
+		x.handleModeRollbackCallback(log, query, user)
+		return nil
+	}
+
+	// Mode draft callbacks: mode_dr_{test|cmp|pub|del}_{modeType}
+	if strings.HasPrefix(query.Data, "mode_dr_") {
+		x.handleModeDraftCallback(log, query, user)
+		return nil
+	}
+
+	// Mode import confirmation callbacks: mode_import_{confirm|cancel}
+	if query.Data == "mode_import_confirm" || query.Data == "mode_import_cancel" {
+		x.handleModeImportCallback(log, query, user)
+		return nil
+	}
+
 	// Context toggle callbacks: context_enable, context_disable
 	if query.Data == "context_enable" || query.Data == "context_disable" {
 		x.handleContextToggleCallback(log, query, user)
@@ -282,6 +430,48 @@ func (x *TelegramHandler) HandleCallback(log *tracing.Logger, query *tgbotapi.Ca
 		return nil
 	}
 
+	// Context transfer callbacks: context_export, context_import
+	if query.Data == "context_export" || query.Data == "context_import" {
+		x.handleContextTransferCallback(log, query, user)
+		return nil
+	}
+
+	// Context view pagination callbacks: context_view_{page}
+	if strings.HasPrefix(query.Data, "context_view_") {
+		x.handleContextViewCallback(log, query, user)
+		return nil
+	}
+
+	// Context drop confirmation callbacks: context_drop_confirm, context_drop_cancel
+	if query.Data == "context_drop_confirm" || query.Data == "context_drop_cancel" {
+		x.handleContextDropConfirmCallback(log, query, user)
+		return nil
+	}
+
+	// Context branch callbacks: context_branch_{name}
+	if strings.HasPrefix(query.Data, "context_branch_") {
+		x.handleContextBranchCallback(log, query, user)
+		return nil
+	}
+
+	// Settings panel callbacks: settings_{open|mode|context|topics|lang|instructions}
+	if strings.HasPrefix(query.Data, "settings_") {
+		x.handleSettingsCallback(log, query)
+		return nil
+	}
+
+	// Incognito callbacks: incognito_enable, incognito_disable
+	if query.Data == "incognito_enable" || query.Data == "incognito_disable" {
+		x.handleIncognitoCallback(log, query)
+		return nil
+	}
+
+	// Model callbacks: model_pick_{index}, model_reset
+	if strings.HasPrefix(query.Data, "model_pick_") || query.Data == "model_reset" {
+		x.handleModelCallback(log, query)
+		return nil
+	}
+
 	// Personalization callbacks: personalization_add, personalization_remove, personalization_print
 	if query.Data == "personalization_add" || query.Data == "personalization_remove" || query.Data == "personalization_print" {
 		x.handlePersonalizationCallback(log, query, user)
@@ -354,7 +544,7 @@ func (x *TelegramHandler) handleFeedbackCallback(log *tracing.Logger, query *tgb
 	if len(parts) != 4 {
 		log.E("Invalid feedback callback data format", "data", query.Data)
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, "MsgFeedbackError"))
-		x.diplomat.bot.Request(callback)
+		x.diplomat.Request(log, callback)
 		return
 	}
 
@@ -366,7 +556,7 @@ func (x *TelegramHandler) handleFeedbackCallback(log *tracing.Logger, query *tgb
 	if err != nil {
 		log.E("Failed to parse target user ID from callback", tracing.InnerError, err)
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, "MsgFeedbackError"))
-		if _, err := x.diplomat.bot.Request(callback); err != nil {
+		if _, err := x.diplomat.Request(log, callback); err != nil {
 			log.E("Failed to answer callback", tracing.InnerError, err)
 		}
 		return
@@ -374,7 +564,7 @@ func (x *TelegramHandler) handleFeedbackCallback(log *tracing.Logger, query *tgb
 
 	if query.From.ID != targetUserID {
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, "MsgFeedbackNotYourMessage"))
-		if _, err := x.diplomat.bot.Request(callback); err != nil {
+		if _, err := x.diplomat.Request(log, callback); err != nil {
 			log.E("Failed to answer callback", tracing.InnerError, err)
 		}
 		return
@@ -385,11 +575,20 @@ func (x *TelegramHandler) handleFeedbackCallback(log *tracing.Logger, query *tgb
 		liked = 1
 	}
 
-	_, err = x.feedbacks.CreateFeedback(log, user.ID, liked, kind)
+	// the buttons live on the last message of the answer, it is bound to the usage row with model, mode and variant
+	var usage *entities.Usage
+	if kind == repository.FeedbackKindDialer {
+		usage, err = x.usage.GetUsageByResponse(log, query.Message.Chat.ID, query.Message.MessageID)
+		if err != nil {
+			log.W("Failed to find usage of the response, feedback stays unlinked", tracing.InnerError, err)
+		}
+	}
+
+	feedback, err := x.feedbacks.CreateFeedback(log, user.ID, liked, kind, query.Message.Chat.ID, query.Message.MessageID, usage)
 	if err != nil {
 		log.E("Failed to create feedback", tracing.InnerError, err)
 		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, "MsgFeedbackError"))
-		if _, err := x.diplomat.bot.Request(callback); err != nil {
+		if _, err := x.diplomat.Request(log, callback); err != nil {
 			log.E("Failed to answer callback", tracing.InnerError, err)
 		}
 		return
@@ -407,22 +606,124 @@ func (x *TelegramHandler) handleFeedbackCallback(log *tracing.Logger, query *tgb
 	}
 
 	callback := tgbotapi.NewCallback(query.ID, callbackText)
-	if _, err := x.diplomat.bot.Request(callback); err != nil {
+	if _, err := x.diplomat.Request(log, callback); err != nil {
 		log.E("Failed to answer callback", tracing.InnerError, err)
 	}
 
+	markup := tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}}
+	if !isLike && kind == repository.FeedbackKindDialer {
+		markup = x.feedbackReasonKeyboard(query.Message, feedback.ID)
+	}
+
+	editMarkup := tgbotapi.NewEditMessageReplyMarkup(query.Message.Chat.ID, query.Message.MessageID, markup)
+	if _, err := x.diplomat.Request(log, editMarkup); err != nil {
+		log.W("Failed to replace feedback buttons", tracing.InnerError, err)
+	}
+
+	log.I("Feedback recorded", "user_id", user.ID, "liked", liked, "kind", kind, "feedback_id", feedback.ID)
+}
+
+// feedbackReasonKeyboard asks for the reason of a dislike: feedback_reason_{reason|skip}_{feedbackID}
+func (x *TelegramHandler) feedbackReasonKeyboard(msg *tgbotapi.Message, feedbackID uuid.UUID) tgbotapi.InlineKeyboardMarkup {
+	button := func(key string, reason string) tgbotapi.InlineKeyboardButton {
+		return tgbotapi.NewInlineKeyboardButtonData(x.localization.LocalizeBy(msg, key), "feedback_reason_"+reason+"_"+feedbackID.String())
+	}
+
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			button("MsgFeedbackReasonWrongBtn", string(repository.FeedbackReasonWrong)),
+			button("MsgFeedbackReasonTooLongBtn", string(repository.FeedbackReasonTooLong)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			button("MsgFeedbackReasonRefusedBtn", string(repository.FeedbackReasonRefused)),
+			button("MsgFeedbackReasonOtherBtn", string(repository.FeedbackReasonOther)),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			button("MsgFeedbackReasonSkipBtn", "skip"),
+		),
+	)
+}
+
+func (x *TelegramHandler) handleFeedbackReasonCallback(log *tracing.Logger, query *tgbotapi.CallbackQuery) {
+	answer := func(key string) {
+		callback := tgbotapi.NewCallback(query.ID, x.localization.LocalizeBy(query.Message, key))
+		if _, err := x.diplomat.Request(log, callback); err != nil {
+			log.E("Failed to answer callback", tracing.InnerError, err)
+		}
+	}
+
+	payload := strings.TrimPrefix(query.Data, "feedback_reason_")
+	separator := strings.LastIndex(payload, "_")
+	if separator < 0 {
+		log.E("Invalid feedback reason callback data format", "data", query.Data)
+		answer("MsgFeedbackError")
+		return
+	}
+
+	reason := payload[:separator]
+	feedbackID, err := uuid.Parse(payload[separator+1:])
+	if err != nil {
+		log.E("Failed to parse feedback ID from callback", tracing.InnerError, err)
+		answer("MsgFeedbackError")
+		return
+	}
+
+	feedback, err := x.feedbacks.GetFeedbackByID(log, feedbackID)
+	if err != nil {
+		answer("MsgFeedbackError")
+		return
+	}
+
+	author, err := x.users.GetUserByEid(log, query.From.ID)
+	if err != nil || author.ID != feedback.UserID {
+		answer("MsgFeedbackNotYourMessage")
+		return
+	}
+
+	switch {
+	case reason == "skip":
+		answer("MsgFeedbackReasonSkipped")
+	case reason == string(repository.FeedbackReasonOther):
+		if err := x.feedbacks.SetFeedbackReason(log, feedback.ID, repository.FeedbackReasonOther); err != nil {
+			answer("MsgFeedbackError")
+			return
+		}
+		if err := x.chatState.InitFeedbackComment(log, query.Message.Chat.ID, query.From.ID, feedback.ID); err != nil {
+			log.E("Failed to init feedback comment state", tracing.InnerError, err)
+			answer("MsgFeedbackError")
+			return
+		}
+		answer("MsgFeedbackReasonSaved")
+		x.diplomat.SendMessage(log, query.Message, x.personality.XiifyManualPlain(x.localization.LocalizeBy(query.Message, "MsgFeedbackAwaitingComment")))
+	case slices.Contains(repository.FeedbackReasons, repository.FeedbackReason(reason)):
+		if err := x.feedbacks.SetFeedbackReason(log, feedback.ID, repository.FeedbackReason(reason)); err != nil {
+			answer("MsgFeedbackError")
+			return
+		}
+		answer("MsgFeedbackReasonSaved")
+	default:
+		log.E("Unknown feedback reason", "reason", reason)
+		answer("MsgFeedbackError")
+		return
+	}
+
 	editMarkup := tgbotapi.NewEditMessageReplyMarkup(query.Message.Chat.ID, query.Message.MessageID, tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}})
-	if _, err := x.diplomat.bot.Request(editMarkup); err != nil {
-		log.W("Failed to remove feedback buttons", tracing.InnerError, err)
+	if _, err := x.diplomat.Request(log, editMarkup); err != nil {
+		log.W("Failed to remove feedback reason buttons", tracing.InnerError, err)
 	}
 
-	log.I("Feedback recorded", "user_id", user.ID, "liked", liked, "kind", kind)
+	log.I("Feedback reason recorded", "feedback_id", feedback.ID, "reason", reason)
 }
 
 func (x *TelegramHandler) user(log *tracing.Logger, msg *tgbotapi.Message) (*entities.User, error) {
-	euid := msg.From.ID
-	uname := msg.From.UserName
-	fullname := msg.From.FirstName + " " + msg.From.LastName
+	return x.userOf(log, msg.From)
+}
+
+// userOf gets or creates the user of a Telegram account, callbacks pass query.From since their message belongs to the bot
+func (x *TelegramHandler) userOf(log *tracing.Logger, from *tgbotapi.User) (*entities.User, error) {
+	euid := from.ID
+	uname := from.UserName
+	fullname := from.FirstName + " " + from.LastName
 
 	user, err := x.users.GetUserByEid(log, euid)
 	if err != nil && !errors.Is(err, repository.ErrUserNotFound) {
@@ -441,3 +742,40 @@ func (x *TelegramHandler) user(log *tracing.Logger, msg *tgbotapi.Message) (*ent
 
 	return user, nil
 }
+
+// settingsOf returns the chat settings, falling back to the defaults so a database hiccup does not block the chat
+func (x *TelegramHandler) settingsOf(log *tracing.Logger, chatID int64) *entities.ChatSetting {
+	settings, err := x.chatSettings.GetSettings(log, chatID)
+	if err != nil {
+		log.W("Failed to get chat settings, using defaults", tracing.InnerError, err)
+		return repository.DefaultChatSettings(chatID)
+	}
+	return settings
+}
+
+// isBotJoined reports whether msg is the service message of the bot being added to a group or created with it
+func (x *TelegramHandler) isBotJoined(msg *tgbotapi.Message) bool {
+	if msg.GroupChatCreated || msg.SuperGroupChatCreated {
+		return true
+	}
+
+	return slices.ContainsFunc(msg.NewChatMembers, func(member tgbotapi.User) bool {
+		return member.ID == x.diplomat.Self().ID
+	})
+}
+
+// migrateChat moves the context, settings and statistics of a group upgraded to a supergroup to its new chat ID.
+// Telegram reports the upgrade in both chats, only the message in the old group carrying MigrateToChatID is handled.
+func (x *TelegramHandler) migrateChat(log *tracing.Logger, msg *tgbotapi.Message) {
+	fromChatID, toChatID := msg.Chat.ID, msg.MigrateToChatID
+	log.I("Group was upgraded to supergroup, migrating chat", "from_chat_id", fromChatID, "to_chat_id", toChatID)
+
+	if err := x.chatMigration.MigrateChat(log, fromChatID, toChatID); err != nil {
+		log.E("Failed to migrate chat", "from_chat_id", fromChatID, "to_chat_id", toChatID, tracing.InnerError, err)
+		return
+	}
+
+	x.localization.SetChatLanguage(toChatID, x.settingsOf(log, toChatID).Language)
+	x.localization.SetChatLanguage(fromChatID, "")
+	log.I("Chat migrated to supergroup", "from_chat_id", fromChatID, "to_chat_id", toChatID)
+}
@@ -0,0 +1,160 @@
+package telegram
+
+import (
+	"strings"
+	"time"
+	"ximanager/sources/platform"
+	"ximanager/sources/texting/markdown"
+	"ximanager/sources/texting/transform"
+	"ximanager/sources/tracing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	inlineDefaultDebounce = 700 * time.Millisecond
+	inlineDescriptionSize = 120
+	inlineAnswerSize      = 3000 // leaves room for MarkdownV2 escaping within the 4096 limit
+)
+
+// debounceInline schedules the inline query of a user, a newer query typed within the debounce window replaces it.
+// Inline queries have no chat and nothing to keep in order, so they bypass chat queues and the shared dispatcher.
+func (x *Poller) debounceInline(query *tgbotapi.InlineQuery) {
+	window := x.config.Telegram.Inline.Debounce
+	if window <= 0 {
+		window = inlineDefaultDebounce
+	}
+
+	userID := query.From.ID
+
+	x.inlineMux.Lock()
+	defer x.inlineMux.Unlock()
+
+	if pending, exists := x.inlineTimers[userID]; exists && pending.Stop() {
+		x.wg.Done()
+		x.metrics.RecordInlineQuery("debounced")
+	}
+
+	var timer *time.Timer
+	x.wg.Add(1)
+	timer = time.AfterFunc(window, func() {
+		defer x.wg.Done()
+
+		x.inlineMux.Lock()
+		if x.inlineTimers[userID] == timer {
+			delete(x.inlineTimers, userID)
+		}
+		x.inlineMux.Unlock()
+
+		if x.ctx.Err() != nil {
+			return
+		}
+		x.handleUpdate(tgbotapi.Update{InlineQuery: query})
+	})
+	x.inlineTimers[userID] = timer
+}
+
+// stopInline drops inline queries still waiting for their debounce window
+func (x *Poller) stopInline() {
+	x.inlineMux.Lock()
+	defer x.inlineMux.Unlock()
+
+	for userID, timer := range x.inlineTimers {
+		if timer.Stop() {
+			x.wg.Done()
+		}
+		delete(x.inlineTimers, userID)
+	}
+}
+
+// inlineMessage stands for the query in code written for messages, the query is treated as a private chat with its author
+func inlineMessage(query *tgbotapi.InlineQuery) *tgbotapi.Message {
+	return &tgbotapi.Message{
+		From: query.From,
+		Chat: &tgbotapi.Chat{ID: query.From.ID, Type: "private"},
+		Date: int(time.Now().Unix()),
+		Text: query.Query,
+	}
+}
+
+// HandleInlineQuery answers "@bot question" with a single article, denied users get an article explaining why
+func (x *TelegramHandler) HandleInlineQuery(log *tracing.Logger, query *tgbotapi.InlineQuery) error {
+	defer tracing.ProfilePoint(log, "Telegram handler inline query completed", "telegram.handler.inline_query")()
+	log.I("Got inline query")
+
+	req := strings.TrimSpace(query.Query)
+	if req == "" {
+		x.metrics.RecordInlineQuery("empty")
+		return nil
+	}
+
+	msg := inlineMessage(query)
+
+	user, err := x.user(log, msg)
+	if err != nil {
+		log.E("Error getting or creating user", tracing.InnerError, err)
+		x.metrics.RecordInlineQuery("error")
+		return err
+	}
+
+	deny := func(text string) {
+		x.answerInline(log, query, x.localization.LocalizeBy(msg, "MsgInlineDeniedTitle"), text, markdown.EscapeMarkdownActor(text))
+		x.metrics.RecordInlineQuery("denied")
+	}
+
+	if !platform.BoolValue(user.IsActive, true) {
+		deny(x.localization.LocalizeBy(msg, "MsgXiUserBlocked"))
+		return nil
+	}
+
+	if !x.throttler.IsAllowed(query.From.ID) {
+		log.W("User exceeded rate throttler")
+		deny(x.localization.LocalizeBy(msg, "MsgThrottleExceeded"))
+		return nil
+	}
+
+	if ban, expiresAt, err := x.bans.GetActiveBanWithExpiry(log, user.ID); err == nil {
+		log.W("User is banned", "user_id", user.ID, "expires_at", expiresAt, "reason", ban.Reason)
+		deny(x.localization.LocalizeByTd(msg, "MsgBanActive", map[string]interface{}{
+			"ExpiresAt": x.bans.FormatBanExpiry(msg, expiresAt),
+			"Reason":    ban.Reason,
+			"Remaining": x.bans.FormatRemainingTime(msg, x.bans.GetRemainingDuration(expiresAt)),
+		}))
+		return nil
+	}
+
+	persona := query.From.FirstName + " " + query.From.LastName + " (@" + query.From.UserName + ")"
+
+	result, err := x.dialer.DialInline(log, msg, req, persona)
+	if err != nil || strings.TrimSpace(result.Text) == "" {
+		errorMsg := x.localization.LocalizeBy(msg, "MsgErrorResponse")
+		x.answerInline(log, query, x.localization.LocalizeBy(msg, "MsgInlineErrorTitle"), errorMsg, markdown.EscapeMarkdownActor(errorMsg))
+		x.metrics.RecordInlineQuery("error")
+		return nil
+	}
+
+	answer := x.personality.Xiify(msg, transform.SmartTruncate(result.Text, inlineAnswerSize))
+	description := transform.SmartTruncate(result.Text, inlineDescriptionSize)
+	x.answerInline(log, query, x.localization.LocalizeBy(msg, "MsgInlineTitle"), description, markdown.EscapeMarkdownActor(answer))
+	x.metrics.RecordInlineQuery("answered")
+
+	return nil
+}
+
+// answerInline sends a single article result, the query is answered even when the user is denied so Telegram stops spinning
+func (x *TelegramHandler) answerInline(log *tracing.Logger, query *tgbotapi.InlineQuery, title string, description string, text string) {
+	article := tgbotapi.NewInlineQueryResultArticleMarkdownV2(query.ID, title, text)
+	article.Description = description
+
+	config := tgbotapi.InlineConfig{
+		InlineQueryID: query.ID,
+		Results:       []interface{}{article},
+		CacheTime:     x.diplomat.config.Telegram.Inline.CacheTime,
+		IsPersonal:    true,
+	}
+
+	if _, err := x.diplomat.Request(log, config); err != nil {
+		log.E("Failed to answer inline query", tracing.InnerError, err)
+		x.metrics.RecordInlineQuery("error")
+	}
+}
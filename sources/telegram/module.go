@@ -2,6 +2,9 @@ package telegram
 
 import (
 	"context"
+	"net/http"
+	"ximanager/sources/configuration"
+	"ximanager/sources/external"
 	"ximanager/sources/tracing"
 
 	"go.uber.org/fx"
@@ -12,14 +15,19 @@ var Module = fx.Module("telegram",
 		NewBotAPI,
 		NewDiplomat,
 		NewTelegramHandler,
+		NewStreamDispatcher,
 		NewPoller,
 	),
 
-	fx.Invoke(func(lc fx.Lifecycle, poller *Poller, log *tracing.Logger) {
+	fx.Invoke(func(lc fx.Lifecycle, poller *Poller, outsiders *external.Outsiders, config *configuration.Config, log *tracing.Logger) {
+		if config.Telegram.Mode == TelegramModeWebhook {
+			outsiders.Handle(poller.WebhookPath(), http.HandlerFunc(poller.ServeWebhook))
+		}
+
 		lc.Append(fx.Hook{
 			OnStart: func(ctx context.Context) error {
 				go poller.Start()
-				log.I("Telegram poller started")
+				log.I("Telegram poller started", "mode", config.Telegram.Mode)
 				return nil
 			},
 			OnStop: func(ctx context.Context) error {
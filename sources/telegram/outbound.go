@@ -0,0 +1,233 @@
+package telegram
+
+import (
+	"errors"
+	"sync"
+	"time"
+	"ximanager/sources/configuration"
+	"ximanager/sources/metrics"
+	"ximanager/sources/tracing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+type OutboundPriority string
+
+const (
+	OutboundInteractive OutboundPriority = "interactive"
+	OutboundBroadcast   OutboundPriority = "broadcast"
+)
+
+const (
+	// how long a broadcast steps aside while an interactive call waits only for the global limit
+	outboundYield = 50 * time.Millisecond
+	// limits of chats silent for this long are forgotten, a fresh bucket starts full anyway
+	outboundIdle = 10 * time.Minute
+)
+
+// tokenBucket allows rate calls per second with bursts up to burst, a non-positive rate never limits
+type tokenBucket struct {
+	rate    float64
+	burst   float64
+	tokens  float64
+	last    time.Time
+	blocked time.Time
+}
+
+func newTokenBucket(rate float64, burst float64, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: burst, tokens: burst, last: now}
+}
+
+// delay is how long to wait for a token, zero when one is available now
+func (b *tokenBucket) delay(now time.Time) time.Duration {
+	if now.Before(b.blocked) {
+		return b.blocked.Sub(now)
+	}
+	if b.rate <= 0 {
+		return 0
+	}
+
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *tokenBucket) take() {
+	if b.rate > 0 {
+		b.tokens--
+	}
+}
+
+type chatLimits struct {
+	second *tokenBucket
+	minute *tokenBucket
+	used   time.Time
+}
+
+// Outbound paces calls sending messages below Telegram flood limits: one bucket for the whole bot, one per chat
+// and one more per group, since groups get far fewer messages per minute. Interactive calls go first, broadcasts
+// yield to them whenever an interactive call is held back only by the global limit. A 429 answer blocks the chat
+// for retry_after and the call is repeated. Limits are kept per instance.
+type Outbound struct {
+	config  *configuration.Config
+	metrics *metrics.MetricsService
+
+	mux    sync.Mutex
+	global *tokenBucket
+	chats  map[int64]*chatLimits
+	ready  int
+	swept  time.Time
+}
+
+func NewOutbound(config *configuration.Config, metrics *metrics.MetricsService) *Outbound {
+	now := time.Now()
+	rate := config.Telegram.Outbound.GlobalRate
+
+	return &Outbound{
+		config:  config,
+		metrics: metrics,
+		global:  newTokenBucket(rate, rate, now),
+		chats:   make(map[int64]*chatLimits),
+		swept:   now,
+	}
+}
+
+// Do runs call once the limits of chatID allow it, repeating it after flood control answers up to max retries.
+// Calls not bound to a chat (callback and inline answers) pass zero and wait only for the global limit.
+func (x *Outbound) Do(logger *tracing.Logger, chatID int64, priority OutboundPriority, call func() error) error {
+	var waited time.Duration
+	defer func() { x.metrics.RecordOutboundLatency(string(priority), waited) }()
+
+	for attempt := 0; ; attempt++ {
+		waited += x.acquire(chatID, priority)
+
+		err := call()
+		retryAfter := floodRetryAfter(err)
+		if retryAfter == 0 || attempt >= x.config.Telegram.Outbound.MaxRetries {
+			return err
+		}
+
+		logger.W("Telegram flood control hit, retrying", "chat_id", chatID, "priority", priority, "retry_after", retryAfter, "attempt", attempt+1)
+		x.metrics.RecordOutboundFloodRetry(string(priority))
+		x.block(chatID, retryAfter)
+	}
+}
+
+// acquire waits for a token of every bucket of chatID and takes them at once, returns the time spent waiting
+func (x *Outbound) acquire(chatID int64, priority OutboundPriority) time.Duration {
+	start := time.Now()
+	ready := false
+
+	x.metrics.AddOutboundWaiting(string(priority), 1)
+	defer x.metrics.AddOutboundWaiting(string(priority), -1)
+
+	for {
+		x.mux.Lock()
+		now := time.Now()
+
+		var limits *chatLimits
+		var chatWait time.Duration
+		if chatID != 0 {
+			limits = x.limits(chatID, now)
+			chatWait = max(limits.second.delay(now), x.groupDelay(limits, now))
+		}
+		globalWait := x.global.delay(now)
+
+		wait := max(chatWait, globalWait)
+		if priority == OutboundBroadcast && x.ready > 0 {
+			wait = max(wait, outboundYield)
+		}
+
+		// an interactive call held back only by the global limit makes broadcasts step aside until it is sent
+		if priority == OutboundInteractive && ready != (chatWait == 0 && globalWait > 0) {
+			ready = !ready
+			if ready {
+				x.ready++
+			} else {
+				x.ready--
+			}
+		}
+
+		if wait == 0 {
+			x.global.take()
+			if limits != nil {
+				limits.second.take()
+				if limits.minute != nil {
+					limits.minute.take()
+				}
+				limits.used = now
+			}
+			x.mux.Unlock()
+			return time.Since(start)
+		}
+		x.mux.Unlock()
+
+		time.Sleep(wait)
+	}
+}
+
+func (x *Outbound) groupDelay(limits *chatLimits, now time.Time) time.Duration {
+	if limits.minute == nil {
+		return 0
+	}
+	return limits.minute.delay(now)
+}
+
+// limits returns the buckets of chatID creating them on first use, negative IDs are groups. Must hold mux.
+func (x *Outbound) limits(chatID int64, now time.Time) *chatLimits {
+	if now.Sub(x.swept) > outboundIdle {
+		for id, limits := range x.chats {
+			if now.Sub(limits.used) > outboundIdle {
+				delete(x.chats, id)
+			}
+		}
+		x.swept = now
+	}
+
+	limits, ok := x.chats[chatID]
+	if ok {
+		return limits
+	}
+
+	config := x.config.Telegram.Outbound
+	limits = &chatLimits{second: newTokenBucket(config.ChatRate, float64(max(config.ChatBurst, 1)), now), used: now}
+	if chatID < 0 && config.GroupRate > 0 {
+		limits.minute = newTokenBucket(config.GroupRate/60, config.GroupRate, now)
+	}
+
+	x.chats[chatID] = limits
+	return limits
+}
+
+// block holds back chatID for retryAfter, flood control of a call not bound to a chat holds back the whole bot
+func (x *Outbound) block(chatID int64, retryAfter time.Duration) {
+	x.mux.Lock()
+	defer x.mux.Unlock()
+
+	if chatID == 0 {
+		x.global.blocked = time.Now().Add(retryAfter)
+		return
+	}
+
+	limits := x.limits(chatID, time.Now())
+	limits.second.blocked = time.Now().Add(retryAfter)
+}
+
+// floodRetryAfter is retry_after of a 429 answer, zero for any other outcome
+func floodRetryAfter(err error) time.Duration {
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		return time.Duration(apiErr.RetryAfter) * time.Second
+	}
+
+	var valueErr tgbotapi.Error
+	if errors.As(err, &valueErr) && valueErr.RetryAfter > 0 {
+		return time.Duration(valueErr.RetryAfter) * time.Second
+	}
+
+	return 0
+}
@@ -7,6 +7,7 @@ import (
 	"ximanager/sources/configuration"
 	"ximanager/sources/localization"
 	"ximanager/sources/metrics"
+	"ximanager/sources/repository"
 	"ximanager/sources/tracing"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -25,15 +26,20 @@ type Poller struct {
 	handler      *TelegramHandler
 	localization *localization.LocalizationManager
 	metrics      *metrics.MetricsService
+	streams      *StreamDispatcher
+	topics       *repository.TopicsRepository
 
-	chatQueues map[int64]*chatQueue
-	queuesMux  sync.RWMutex
-	wg         sync.WaitGroup
-	ctx        context.Context
-	cancel     context.CancelFunc
+	chatQueues   map[int64]*chatQueue
+	queuesMux    sync.RWMutex
+	dispatchMux  sync.RWMutex
+	inlineTimers map[int64]*time.Timer
+	inlineMux    sync.Mutex
+	wg          sync.WaitGroup
+	ctx         context.Context
+	cancel      context.CancelFunc
 }
 
-func NewPoller(bot *tgbotapi.BotAPI, log *tracing.Logger, diplomat *Diplomat, config *configuration.Config, handler *TelegramHandler, localization *localization.LocalizationManager, metrics *metrics.MetricsService) *Poller {
+func NewPoller(bot *tgbotapi.BotAPI, log *tracing.Logger, diplomat *Diplomat, config *configuration.Config, handler *TelegramHandler, localization *localization.LocalizationManager, metrics *metrics.MetricsService, streams *StreamDispatcher, topics *repository.TopicsRepository) *Poller {
 	ctx, cancel := context.WithCancel(context.Background())
 	poller := &Poller{
 		bot:          bot,
@@ -43,7 +49,10 @@ func NewPoller(bot *tgbotapi.BotAPI, log *tracing.Logger, diplomat *Diplomat, co
 		handler:      handler,
 		localization: localization,
 		metrics:      metrics,
+		streams:      streams,
+		topics:       topics,
 		chatQueues:   make(map[int64]*chatQueue),
+		inlineTimers: make(map[int64]*time.Timer),
 		ctx:          ctx,
 		cancel:       cancel,
 	}
@@ -53,37 +62,68 @@ func NewPoller(bot *tgbotapi.BotAPI, log *tracing.Logger, diplomat *Diplomat, co
 }
 
 func (x *Poller) Start() {
+	if x.streams.Enabled() {
+		x.streams.Run(x.ctx, &x.wg, x.handleUpdate, x.coalesce)
+		if x.config.Telegram.Dispatcher.WorkerOnly {
+			x.log.I("Worker only instance, updates are received by other instances")
+			return
+		}
+	}
+
+	if x.config.Telegram.Mode == TelegramModeWebhook {
+		x.startWebhook()
+		return
+	}
+
 	update := tgbotapi.NewUpdate(0)
 	update.Timeout = x.config.Telegram.PollerTimeout
 	update.AllowedUpdates = x.config.Telegram.AllowedUpdates
 
+	// getUpdates is rejected by Telegram while a webhook is set, e.g. after switching back from webhook mode
+	if _, err := x.bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		x.log.W("Failed to delete webhook before polling", tracing.InnerError, err)
+	}
+
 	x.log.I("Starting poller with per-chat sequential processing")
 
-	for update := range x.bot.GetUpdatesChan(update) {
-		if msg := update.Message; msg != nil {
-			select {
-			case <-x.ctx.Done():
-				x.log.I("Context cancelled, stopping message processing")
-				return
-			default:
-			}
+	x.pollUpdates(update)
+}
 
-			chatID := msg.Chat.ID
-			x.enqueueMessage(chatID, update)
-		} else if cb := update.CallbackQuery; cb != nil {
-			select {
-			case <-x.ctx.Done():
-				x.log.I("Context cancelled, stopping callback processing")
-				return
-			default:
-			}
+// dispatch puts the update into the queue of its chat, local or shared through Redis.
+// False means the update was not accepted, because the poller is stopping or the shared queue is unavailable.
+func (x *Poller) dispatch(update tgbotapi.Update) bool {
+	x.dispatchMux.RLock()
+	defer x.dispatchMux.RUnlock()
 
-			if cb.Message != nil {
-				chatID := cb.Message.Chat.ID
-				x.enqueueMessage(chatID, update)
-			}
-		}
+	select {
+	case <-x.ctx.Done():
+		return false
+	default:
+	}
+
+	// the instance receiving an inline query answers it, there is no chat state it could race with
+	if query := update.InlineQuery; query != nil {
+		x.debounceInline(query)
+		return true
 	}
+
+	var chatID int64
+	if msg := update.Message; msg != nil {
+		chatID = msg.Chat.ID
+	} else if msg := update.EditedMessage; msg != nil {
+		chatID = msg.Chat.ID
+	} else if cb := update.CallbackQuery; cb != nil && cb.Message != nil {
+		chatID = cb.Message.Chat.ID
+	} else {
+		return true
+	}
+
+	if x.streams.Enabled() {
+		return x.streams.Append(x.log, chatID, update) == nil
+	}
+
+	x.enqueueMessage(chatID, update)
+	return true
 }
 
 func (x *Poller) enqueueMessage(chatID int64, update tgbotapi.Update) {
@@ -132,16 +172,39 @@ func (x *Poller) getOrCreateQueue(chatID int64) *chatQueue {
 func (x *Poller) processChatQueue(chatID int64, queue *chatQueue) {
 	defer x.wg.Done()
 	defer x.log.D("Chat queue processor stopped", "chatId", chatID)
-	
-	for {
+
+	next := func(timeout time.Duration) (tgbotapi.Update, bool) {
 		select {
 		case <-x.ctx.Done():
-			return
-		case update := <-queue.messages:
-			queue.lastUsed = time.Now()
-			x.handleUpdate(update)
+			return tgbotapi.Update{}, false
+		case update, ok := <-queue.messages:
+			return update, ok
+		case <-time.After(timeout):
+			return tgbotapi.Update{}, false
 		}
 	}
+
+	var rest *tgbotapi.Update
+	for {
+		var update tgbotapi.Update
+		if rest != nil {
+			update, rest = *rest, nil
+		} else {
+			select {
+			case <-x.ctx.Done():
+				return
+			case received, ok := <-queue.messages:
+				if !ok {
+					return
+				}
+				update = received
+			}
+		}
+
+		queue.lastUsed = time.Now()
+		update, rest = x.coalesce(update, next)
+		x.handleUpdate(update)
+	}
 }
 
 func (x *Poller) handleUpdate(update tgbotapi.Update) {
@@ -156,6 +219,11 @@ func (x *Poller) handleUpdate(update tgbotapi.Update) {
 		msgID = update.Message.MessageID
 		msgDate = update.Message.Date
 		chatType = update.Message.Chat.Type
+	} else if update.EditedMessage != nil {
+		chatID = update.EditedMessage.Chat.ID
+		msgID = update.EditedMessage.MessageID
+		msgDate = update.EditedMessage.EditDate
+		chatType = update.EditedMessage.Chat.Type
 	} else if update.CallbackQuery != nil && update.CallbackQuery.Message != nil {
 		chatID = update.CallbackQuery.Message.Chat.ID
 		msgID = update.CallbackQuery.Message.MessageID
@@ -182,10 +250,20 @@ func (x *Poller) handleUpdate(update tgbotapi.Update) {
 		} else {
 			x.metrics.RecordMessageHandled("success")
 		}
+	} else if update.EditedMessage != nil {
+		if err := x.handler.HandleEditedMessage(log, update.EditedMessage); err != nil {
+			x.metrics.RecordMessageHandled("error")
+		} else {
+			x.metrics.RecordMessageHandled("success")
+		}
 	} else if update.CallbackQuery != nil {
 		if err := x.handler.HandleCallback(log, update.CallbackQuery); err != nil {
 			x.log.E("Error handling callback", tracing.InnerError, err)
 		}
+	} else if update.InlineQuery != nil {
+		if err := x.handler.HandleInlineQuery(log, update.InlineQuery); err != nil {
+			x.log.E("Error handling inline query", tracing.InnerError, err)
+		}
 	}
 
 	x.metrics.RecordMessageProcessingDuration(time.Since(start))
@@ -229,9 +307,18 @@ func (x *Poller) performCleanup() {
 
 func (x *Poller) Stop() {
 	x.log.I("Stopping poller...")
+	// with the shared dispatcher other instances keep receiving updates through the same webhook
+	if x.config.Telegram.Mode == TelegramModeWebhook && !x.streams.Enabled() {
+		x.stopWebhook()
+	}
 	x.cancel()
-	x.bot.StopReceivingUpdates()
-	
+
+	// waits for webhook requests that are still dispatching, nothing may be enqueued into closed queues
+	x.dispatchMux.Lock()
+	defer x.dispatchMux.Unlock()
+
+	x.stopInline()
+
 	x.queuesMux.Lock()
 	for chatID, queue := range x.chatQueues {
 		close(queue.messages)
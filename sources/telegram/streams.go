@@ -0,0 +1,450 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"ximanager/sources/configuration"
+	"ximanager/sources/metrics"
+	"ximanager/sources/platform"
+	"ximanager/sources/tracing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DispatcherLocal = "local"
+	DispatcherRedis = "redis"
+
+	streamsGroup            = "workers"
+	streamsReadyKey         = "dispatch:ready"
+	streamsUpdateField      = "update"
+	streamsDefaultWorkers   = 8
+	streamsDefaultLease     = 30 * time.Second
+	streamsDefaultIdle      = 500 * time.Millisecond
+	streamsDefaultMaxLength = 1000
+	streamsReclaimBatch     = 100
+	streamsReadyCandidates  = 16
+	streamsOperationTimeout = 5 * time.Second
+)
+
+var (
+	// streamsRenewScript prolongs the chat lease only while it is still held by the same worker
+	streamsRenewScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	// streamsReleaseScript drops the chat lease only while it is still held by the same worker
+	streamsReleaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+	// streamsFinishScript removes a drained chat from the ready set, it is atomic with the append transaction,
+	// so an update appended right after the drain keeps the chat in the set
+	streamsFinishScript = redis.NewScript(`
+if redis.call("XLEN", KEYS[1]) == 0 then
+	redis.call("DEL", KEYS[1])
+	redis.call("SREM", KEYS[2], ARGV[1])
+	return 1
+end
+return 0`)
+)
+
+// StreamDispatcher spreads per-chat processing across bot instances through Redis Streams.
+// Every chat has its own stream, the ingress appends updates to it and marks the chat as ready,
+// workers of any instance take a leased lock of a ready chat and drain its stream sequentially.
+// Entries are acknowledged and deleted after handling, so the stream length is the queue depth of the chat.
+// Entries left pending by a crashed worker are claimed by the next lease holder before new ones, so the order is kept,
+// delivery is at least once: an update being handled during the crash is handled again.
+type StreamDispatcher struct {
+	redis    *redis.Client
+	config   *configuration.Config
+	metrics  *metrics.MetricsService
+	log      *tracing.Logger
+	consumer string
+}
+
+func NewStreamDispatcher(redis *redis.Client, config *configuration.Config, metrics *metrics.MetricsService, log *tracing.Logger) *StreamDispatcher {
+	hostname, _ := os.Hostname()
+	return &StreamDispatcher{
+		redis:    redis,
+		config:   config,
+		metrics:  metrics,
+		log:      log,
+		consumer: fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.NewString()[:8]),
+	}
+}
+
+func (x *StreamDispatcher) Enabled() bool {
+	return x.config.Telegram.Dispatcher.Kind == DispatcherRedis
+}
+
+func (x *StreamDispatcher) streamKey(chatID int64) string {
+	return fmt.Sprintf("dispatch:chat:%d", chatID)
+}
+
+func (x *StreamDispatcher) leaseKey(chatID int64) string {
+	return fmt.Sprintf("dispatch:lease:%d", chatID)
+}
+
+func (x *StreamDispatcher) lease() time.Duration {
+	if lease := x.config.Telegram.Dispatcher.Lease; lease > 0 {
+		return lease
+	}
+	return streamsDefaultLease
+}
+
+// Append puts the update into the stream of its chat and marks the chat as ready for workers
+func (x *StreamDispatcher) Append(log *tracing.Logger, chatID int64, update tgbotapi.Update) error {
+	data, err := json.Marshal(update)
+	if err != nil {
+		log.E("Failed to marshal update for dispatch", tracing.InnerError, err)
+		return err
+	}
+
+	maxLength := x.config.Telegram.Dispatcher.MaxQueueLength
+	if maxLength <= 0 {
+		maxLength = streamsDefaultMaxLength
+	}
+
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), streamsOperationTimeout)
+	defer cancel()
+
+	pipe := x.redis.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: x.streamKey(chatID),
+		MaxLen: maxLength,
+		Approx: true,
+		Values: map[string]interface{}{streamsUpdateField: data},
+	})
+	pipe.SAdd(ctx, streamsReadyKey, chatID)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.E("Failed to append update to chat stream", tracing.ChatId, chatID, tracing.InnerError, err)
+		return err
+	}
+
+	return nil
+}
+
+// Run starts the workers, they stop when the context is cancelled and are tracked by the wait group
+func (x *StreamDispatcher) Run(ctx context.Context, wg *sync.WaitGroup, handle func(tgbotapi.Update), coalesce coalesceFunc) {
+	workers := x.config.Telegram.Dispatcher.Workers
+	if workers <= 0 {
+		workers = streamsDefaultWorkers
+	}
+
+	x.log.I("Starting stream dispatcher workers", "workers", workers, "consumer", x.consumer, "lease", x.lease())
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			x.work(ctx, handle, coalesce)
+		}()
+	}
+}
+
+func (x *StreamDispatcher) work(ctx context.Context, handle func(tgbotapi.Update), coalesce coalesceFunc) {
+	idle := x.config.Telegram.Dispatcher.IdleInterval
+	if idle <= 0 {
+		idle = streamsDefaultIdle
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		chatID, ok := x.claim(ctx)
+		if !ok {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(idle):
+			}
+			continue
+		}
+
+		x.drain(ctx, chatID, handle, coalesce)
+	}
+}
+
+// claim takes the lease of a random ready chat which is not leased by another worker
+func (x *StreamDispatcher) claim(ctx context.Context) (int64, bool) {
+	opCtx, cancel := platform.ContextTimeoutVal(ctx, streamsOperationTimeout)
+	defer cancel()
+
+	candidates, err := x.redis.SRandMemberN(opCtx, streamsReadyKey, streamsReadyCandidates).Result()
+	if err != nil {
+		if ctx.Err() == nil {
+			x.log.W("Failed to get ready chats", tracing.InnerError, err)
+		}
+		return 0, false
+	}
+
+	for _, candidate := range candidates {
+		chatID, err := strconv.ParseInt(candidate, 10, 64)
+		if err != nil {
+			x.redis.SRem(opCtx, streamsReadyKey, candidate)
+			continue
+		}
+
+		acquired, err := x.redis.SetNX(opCtx, x.leaseKey(chatID), x.consumer, x.lease()).Result()
+		if err != nil {
+			x.log.W("Failed to acquire chat lease", tracing.ChatId, chatID, tracing.InnerError, err)
+			continue
+		}
+		if acquired {
+			return chatID, true
+		}
+	}
+
+	return 0, false
+}
+
+// drain handles updates of the leased chat one by one until its stream is empty or the lease is lost
+func (x *StreamDispatcher) drain(ctx context.Context, chatID int64, handle func(tgbotapi.Update), coalesce coalesceFunc) {
+	log := x.log.With(tracing.ChatId, chatID)
+	stream := x.streamKey(chatID)
+
+	leaseCtx, stopLease := context.WithCancel(ctx)
+	lost := x.keepLease(leaseCtx, log, chatID)
+	defer func() {
+		stopLease()
+		releaseCtx, cancel := platform.ContextTimeoutVal(context.Background(), streamsOperationTimeout)
+		defer cancel()
+		streamsReleaseScript.Run(releaseCtx, x.redis, []string{x.leaseKey(chatID)}, x.consumer)
+	}()
+
+	if err := x.redis.XGroupCreateMkStream(ctx, stream, streamsGroup, "0").Err(); err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		log.E("Failed to create chat stream group", tracing.InnerError, err)
+		return
+	}
+
+	pending := x.reclaim(ctx, log, stream)
+
+	// entries too fresh to reclaim may still be handled by the worker that lost the lease, new ones wait behind them
+	if summary, err := x.redis.XPending(ctx, stream, streamsGroup).Result(); err != nil || summary.Count > int64(len(pending)) {
+		if err != nil {
+			log.W("Failed to check pending chat stream entries", tracing.InnerError, err)
+		} else {
+			log.W("Chat stream has entries of another worker, leaving it for later", "pending", summary.Count)
+		}
+		return
+	}
+
+	// read returns the next entry of the chat, reclaimed ones first, a negative block does not wait
+	read := func(block time.Duration) (redis.XMessage, bool, error) {
+		if len(pending) > 0 {
+			message := pending[0]
+			pending = pending[1:]
+			return message, true, nil
+		}
+
+		streams, err := x.redis.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    streamsGroup,
+			Consumer: x.consumer,
+			Streams:  []string{stream, ">"},
+			Count:    1,
+			Block:    block,
+		}).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return redis.XMessage{}, false, err
+		}
+		if len(streams) == 0 || len(streams[0].Messages) == 0 {
+			return redis.XMessage{}, false, nil
+		}
+		return streams[0].Messages[0], true, nil
+	}
+
+	var rest *redis.XMessage
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-lost:
+			log.W("Chat lease lost, leaving the stream to another worker")
+			return
+		default:
+		}
+
+		var message redis.XMessage
+		if rest != nil {
+			message, rest = *rest, nil
+		} else {
+			received, ok, err := read(-1)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.E("Failed to read chat stream", tracing.InnerError, err)
+				}
+				return
+			}
+			if !ok {
+				x.finish(log, chatID)
+				return
+			}
+			message = received
+		}
+
+		// every entry read while coalescing is acknowledged with the merged update, except the one left for the next turn
+		consumed := []string{message.ID}
+		if update, ok := x.decode(log, message); ok {
+			var last redis.XMessage
+			next := func(timeout time.Duration) (tgbotapi.Update, bool) {
+				for {
+					received, ok, err := read(timeout)
+					if err != nil || !ok {
+						return tgbotapi.Update{}, false
+					}
+					consumed = append(consumed, received.ID)
+					if update, ok := x.decode(log, received); ok {
+						last = received
+						return update, true
+					}
+				}
+			}
+
+			merged, leftover := coalesce(update, next)
+			if leftover != nil {
+				consumed = consumed[:len(consumed)-1]
+				rest = &last
+			}
+			handle(merged)
+		}
+
+		opCtx, cancel := platform.ContextTimeoutVal(context.Background(), streamsOperationTimeout)
+		pipe := x.redis.TxPipeline()
+		pipe.XAck(opCtx, stream, streamsGroup, consumed...)
+		pipe.XDel(opCtx, stream, consumed...)
+		depth := pipe.XLen(opCtx, stream)
+		if _, err := pipe.Exec(opCtx); err != nil {
+			log.E("Failed to acknowledge chat stream entries", "entry_ids", consumed, tracing.InnerError, err)
+		} else {
+			x.metrics.SetChatQueueDepth(chatID, float64(depth.Val()))
+		}
+		cancel()
+	}
+}
+
+// reclaim takes over entries that were read but never acknowledged, only a worker that crashed or lost its lease leaves them.
+// Entries idle for less than the lease may still be handled by the previous holder, they are left to a later drain.
+func (x *StreamDispatcher) reclaim(ctx context.Context, log *tracing.Logger, stream string) []redis.XMessage {
+	var reclaimed []redis.XMessage
+
+	start := "0-0"
+	for {
+		messages, next, err := x.redis.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   stream,
+			Group:    streamsGroup,
+			Consumer: x.consumer,
+			MinIdle:  x.lease(),
+			Start:    start,
+			Count:    streamsReclaimBatch,
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.W("Failed to reclaim pending chat stream entries", tracing.InnerError, err)
+			}
+			break
+		}
+
+		reclaimed = append(reclaimed, messages...)
+		if next == "0-0" || len(messages) == 0 {
+			break
+		}
+		start = next
+	}
+
+	if len(reclaimed) > 0 {
+		log.W("Reclaimed pending chat stream entries", "count", len(reclaimed))
+		x.metrics.RecordDispatcherReclaimed(len(reclaimed))
+	}
+
+	return reclaimed
+}
+
+// decode restores the update of the entry, broken entries are skipped and acknowledged
+func (x *StreamDispatcher) decode(log *tracing.Logger, message redis.XMessage) (tgbotapi.Update, bool) {
+	var update tgbotapi.Update
+
+	data, ok := message.Values[streamsUpdateField].(string)
+	if !ok {
+		log.W("Chat stream entry without update, skipping", "entry_id", message.ID)
+		return update, false
+	}
+
+	if err := json.Unmarshal([]byte(data), &update); err != nil {
+		log.E("Failed to unmarshal chat stream entry, skipping", "entry_id", message.ID, tracing.InnerError, err)
+		return update, false
+	}
+
+	return update, true
+}
+
+// finish removes the drained chat from the ready set and its depth from metrics
+func (x *StreamDispatcher) finish(log *tracing.Logger, chatID int64) {
+	ctx, cancel := platform.ContextTimeoutVal(context.Background(), streamsOperationTimeout)
+	defer cancel()
+
+	if err := streamsFinishScript.Run(ctx, x.redis, []string{x.streamKey(chatID), streamsReadyKey}, chatID).Err(); err != nil {
+		log.W("Failed to finish chat stream", tracing.InnerError, err)
+		return
+	}
+
+	x.metrics.DeleteChatQueueDepth(chatID)
+}
+
+// keepLease renews the chat lease in the background while updates are handled, dialing may take longer than the lease itself.
+// Failed renewals are retried on the next tick until the lease could expire before it, then the lease counts as lost.
+func (x *StreamDispatcher) keepLease(ctx context.Context, log *tracing.Logger, chatID int64) <-chan struct{} {
+	lost := make(chan struct{})
+	lease := x.lease()
+	interval := lease / 3
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		renewedAt := time.Now()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				opCtx, cancel := platform.ContextTimeoutVal(ctx, streamsOperationTimeout)
+				renewed, err := streamsRenewScript.Run(opCtx, x.redis, []string{x.leaseKey(chatID)}, x.consumer, lease.Milliseconds()).Int()
+				cancel()
+				if err != nil {
+					log.W("Failed to renew chat lease", tracing.InnerError, err)
+					if time.Since(renewedAt)+interval >= lease {
+						close(lost)
+						return
+					}
+					continue
+				}
+				renewedAt = time.Now()
+				if renewed == 0 {
+					close(lost)
+					return
+				}
+			}
+		}
+	}()
+
+	return lost
+}
@@ -0,0 +1,110 @@
+package telegram
+
+import (
+	"encoding/json"
+	"time"
+	"ximanager/sources/tracing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const pollerRetryInterval = 3 * time.Second
+
+// topicUpdate picks forum fields from a raw update, the library drops them while decoding
+type topicUpdate struct {
+	UpdateID      int           `json:"update_id"`
+	Message       *topicMessage `json:"message"`
+	EditedMessage *topicMessage `json:"edited_message"`
+	CallbackQuery *struct {
+		Message *topicMessage `json:"message"`
+	} `json:"callback_query"`
+}
+
+type topicMessage struct {
+	MessageID       int  `json:"message_id"`
+	MessageThreadID int  `json:"message_thread_id"`
+	IsTopicMessage  bool `json:"is_topic_message"`
+	Chat            struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+}
+
+// decodeUpdate decodes a raw update and remembers the forum topic of its message, so answers can be sent back there.
+// A broken update still gets its update_id, polling has to move past it.
+func (x *Poller) decodeUpdate(data []byte) (tgbotapi.Update, error) {
+	var topic topicUpdate
+	topicErr := json.Unmarshal(data, &topic)
+
+	var update tgbotapi.Update
+	if err := json.Unmarshal(data, &update); err != nil {
+		update.UpdateID = topic.UpdateID
+		return update, err
+	}
+
+	if topicErr != nil {
+		x.log.W("Failed to decode forum fields of update", "update_id", update.UpdateID, tracing.InnerError, topicErr)
+		return update, nil
+	}
+
+	messages := []*topicMessage{topic.Message, topic.EditedMessage}
+	if topic.CallbackQuery != nil {
+		messages = append(messages, topic.CallbackQuery.Message)
+	}
+
+	// replies in plain supergroups carry message_thread_id of the reply thread too, only forum topics are remembered
+	for _, msg := range messages {
+		if msg != nil && msg.IsTopicMessage {
+			x.topics.RememberThread(x.log, msg.Chat.ID, msg.MessageID, msg.MessageThreadID)
+		}
+	}
+
+	return update, nil
+}
+
+// pollUpdates long polls getUpdates like the library does, but decodes updates itself through decodeUpdate
+func (x *Poller) pollUpdates(config tgbotapi.UpdateConfig) {
+	for x.ctx.Err() == nil {
+		raws, err := x.fetchUpdates(config)
+		if err != nil {
+			x.log.W("Failed to get updates, retrying", "retry_in", pollerRetryInterval, tracing.InnerError, err)
+			select {
+			case <-x.ctx.Done():
+				return
+			case <-time.After(pollerRetryInterval):
+			}
+			continue
+		}
+
+		for _, raw := range raws {
+			update, err := x.decodeUpdate(raw)
+			if update.UpdateID < config.Offset {
+				continue
+			}
+			config.Offset = update.UpdateID + 1
+
+			if err != nil {
+				x.log.E("Failed to decode update, skipping it", "update_id", update.UpdateID, tracing.InnerError, err)
+				continue
+			}
+
+			if !x.dispatch(update) && x.ctx.Err() != nil {
+				x.log.I("Context cancelled, stopping update processing")
+				return
+			}
+		}
+	}
+}
+
+func (x *Poller) fetchUpdates(config tgbotapi.UpdateConfig) ([]json.RawMessage, error) {
+	resp, err := x.bot.Request(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var raws []json.RawMessage
+	if err := json.Unmarshal(resp.Result, &raws); err != nil {
+		return nil, err
+	}
+
+	return raws, nil
+}
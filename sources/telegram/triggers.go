@@ -0,0 +1,107 @@
+package telegram
+
+import (
+	"math/rand/v2"
+	"strings"
+	"time"
+	"ximanager/sources/persistence/entities"
+	"ximanager/sources/repository"
+	"ximanager/sources/tracing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// admitXi is the single gate in front of HandleXiCommand: private chats always pass, groups are checked against
+// quiet hours and then, unless Xi was called explicitly with /xi, against the trigger policy of the chat
+func (x *TelegramHandler) admitXi(log *tracing.Logger, settings *entities.ChatSetting, msg *tgbotapi.Message, explicit bool) bool {
+	if msg.Chat.IsPrivate() {
+		return true
+	}
+
+	if until, quiet := x.chatSettings.QuietUntil(log, settings, time.Now()); quiet {
+		log.I("Ignoring message during quiet hours", "explicit", explicit)
+		x.metrics.RecordMessageIgnored("quiet_hours")
+		if explicit {
+			quietMsg := x.localization.LocalizeByTd(msg, "MsgTriggerQuiet", map[string]interface{}{
+				"Until": until.Format("15:04"),
+			})
+			x.diplomat.Reply(log, msg, x.personality.XiifyManual(msg, quietMsg))
+		}
+		return false
+	}
+
+	if explicit {
+		return true
+	}
+
+	policy := repository.TriggerPolicy(settings.TriggerPolicy)
+	if x.triggeredBy(settings, policy, msg, true) {
+		return true
+	}
+
+	log.I("Ignoring message by trigger policy", "policy", policy)
+	x.metrics.RecordMessageIgnored("trigger_policy")
+	return false
+}
+
+// awaitsXi reports without side effects whether a plain message is going to be answered, coalescing waits only for
+// those. Quiet hours and the policy are checked as in admitXi, unprompted lurker answers are not counted on.
+func (x *TelegramHandler) awaitsXi(log *tracing.Logger, msg *tgbotapi.Message) bool {
+	if msg.Chat.IsPrivate() {
+		return true
+	}
+
+	if msg.ReplyToMessage != nil && (msg.ReplyToMessage.From == nil || msg.ReplyToMessage.From.ID != x.diplomat.Self().ID) {
+		return false
+	}
+
+	settings := x.settingsOf(log, msg.Chat.ID)
+	if _, quiet := x.chatSettings.QuietUntil(log, settings, time.Now()); quiet {
+		return false
+	}
+
+	return x.triggeredBy(settings, repository.TriggerPolicy(settings.TriggerPolicy), msg, false)
+}
+
+// triggeredBy reports whether the policy answers a message that does not call Xi with /xi, lurk rolls the lurker dice
+func (x *TelegramHandler) triggeredBy(settings *entities.ChatSetting, policy repository.TriggerPolicy, msg *tgbotapi.Message, lurk bool) bool {
+	text := strings.ToLower(msg.Text + " " + msg.Caption)
+
+	replied := msg.ReplyToMessage != nil && msg.ReplyToMessage.From != nil && msg.ReplyToMessage.From.ID == x.diplomat.Self().ID
+	mentioned := x.diplomat.Self().UserName != "" && strings.Contains(text, "@"+strings.ToLower(x.diplomat.Self().UserName))
+
+	switch policy {
+	case repository.TriggerPolicyCommand:
+		return false
+	case repository.TriggerPolicyReply:
+		return replied
+	case repository.TriggerPolicyMention:
+		return replied || mentioned
+	case repository.TriggerPolicyKeywords:
+		return replied || mentioned || containsKeyword(text, settings.TriggerKeywords)
+	case repository.TriggerPolicyLurker:
+		return replied || mentioned || (lurk && rand.IntN(100) < x.chatSettings.LurkerChance(settings))
+	default:
+		return true
+	}
+}
+
+// containsKeyword matches the comma separated keywords of the chat against the lowercased text
+func containsKeyword(text string, keywords string) bool {
+	for _, keyword := range strings.Split(keywords, ",") {
+		if keyword = strings.ToLower(strings.TrimSpace(keyword)); keyword != "" && strings.Contains(text, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// isExplicitXi reports whether a photo calls Xi by its caption, photos without one are implicit like plain text
+func isExplicitXi(msg *tgbotapi.Message) bool {
+	fields := strings.Fields(msg.Caption)
+	if len(fields) == 0 {
+		return false
+	}
+	command := strings.TrimSuffix(strings.SplitN(fields[0], "@", 2)[0], "!")
+	return command == "/xi"
+}
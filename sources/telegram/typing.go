@@ -9,21 +9,24 @@ import (
 )
 
 type TypingManager struct {
-	bot     *tgbotapi.BotAPI
-	active  map[int64]chan struct{}
-	mu      sync.Mutex
-	log     *tracing.Logger
+	bot      *tgbotapi.BotAPI
+	outbound *Outbound
+	active   map[int64]chan struct{}
+	mu       sync.Mutex
+	log      *tracing.Logger
 }
 
-func NewTypingManager(bot *tgbotapi.BotAPI, log *tracing.Logger) *TypingManager {
+func NewTypingManager(bot *tgbotapi.BotAPI, outbound *Outbound, log *tracing.Logger) *TypingManager {
 	return &TypingManager{
-		bot:    bot,
-		active: make(map[int64]chan struct{}),
-		log:    log,
+		bot:      bot,
+		outbound: outbound,
+		active:   make(map[int64]chan struct{}),
+		log:      log,
 	}
 }
 
-func (tm *TypingManager) Start(chatID int64) {
+// Start shows typing in the chat, threadID narrows it to a forum topic (zero for the whole chat)
+func (tm *TypingManager) Start(chatID int64, threadID int) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
@@ -34,7 +37,7 @@ func (tm *TypingManager) Start(chatID int64) {
 	stopCh := make(chan struct{})
 	tm.active[chatID] = stopCh
 
-	go tm.typingLoop(chatID, stopCh)
+	go tm.typingLoop(chatID, threadID, stopCh)
 }
 
 func (tm *TypingManager) Stop(chatID int64) {
@@ -47,25 +50,39 @@ func (tm *TypingManager) Stop(chatID int64) {
 	}
 }
 
-func (tm *TypingManager) typingLoop(chatID int64, stopCh chan struct{}) {
+func (tm *TypingManager) typingLoop(chatID int64, threadID int, stopCh chan struct{}) {
 	ticker := time.NewTicker(5 * time.Second)
 	defer ticker.Stop()
 
-	tm.sendTyping(chatID)
+	tm.sendTyping(chatID, threadID)
 
 	for {
 		select {
 		case <-stopCh:
 			return
 		case <-ticker.C:
-			tm.sendTyping(chatID)
+			tm.sendTyping(chatID, threadID)
 		}
 	}
 }
 
-func (tm *TypingManager) sendTyping(chatID int64) {
-	action := tgbotapi.NewChatAction(chatID, tgbotapi.ChatTyping)
-	if _, err := tm.bot.Send(action); err != nil {
+func (tm *TypingManager) sendTyping(chatID int64, threadID int) {
+	// typing counts only against the global limit, see chatOf
+	err := tm.outbound.Do(tm.log, 0, OutboundInteractive, func() error {
+		if threadID == 0 {
+			_, err := tm.bot.Request(tgbotapi.NewChatAction(chatID, tgbotapi.ChatTyping))
+			return err
+		}
+
+		// the library has no message_thread_id in ChatActionConfig
+		params := tgbotapi.Params{}
+		params.AddNonZero64("chat_id", chatID)
+		params.AddNonZero("message_thread_id", threadID)
+		params["action"] = tgbotapi.ChatTyping
+		_, err := tm.bot.MakeRequest("sendChatAction", params)
+		return err
+	})
+	if err != nil {
 		tm.log.W("Failed to send typing action", tracing.InnerError, err, "chat_id", chatID)
 	}
 }
\ No newline at end of file
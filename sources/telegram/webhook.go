@@ -0,0 +1,101 @@
+package telegram
+
+import (
+	"crypto/subtle"
+	"io"
+	"net/http"
+	"ximanager/sources/tracing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	TelegramModePolling = "polling"
+	TelegramModeWebhook = "webhook"
+
+	webhookSecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+	webhookMaxBodySize  = 1024 * 1024
+	webhookDefaultPath  = "/telegram/webhook"
+)
+
+// WebhookPath is the path of the startup server receiving updates in webhook mode
+func (x *Poller) WebhookPath() string {
+	if x.config.Telegram.Webhook.Path != "" {
+		return x.config.Telegram.Webhook.Path
+	}
+	return webhookDefaultPath
+}
+
+// startWebhook registers the webhook in Telegram, updates are then pushed to ServeWebhook.
+// The library has no secret_token support in WebhookConfig, so setWebhook is called with raw params.
+func (x *Poller) startWebhook() {
+	webhook := x.config.Telegram.Webhook
+	if webhook.URL == "" || webhook.SecretToken == "" {
+		x.log.F("Webhook mode requires telegram.webhook.url and telegram.webhook.secret_token")
+		return
+	}
+
+	params := tgbotapi.Params{}
+	params["url"] = webhook.URL
+	params["secret_token"] = webhook.SecretToken
+	params.AddNonZero("max_connections", webhook.MaxConnections)
+	params.AddBool("drop_pending_updates", webhook.DropPendingUpdates)
+	if err := params.AddInterface("allowed_updates", x.config.Telegram.AllowedUpdates); err != nil {
+		x.log.F("Failed to encode webhook allowed updates", tracing.InnerError, err)
+		return
+	}
+
+	if _, err := x.bot.MakeRequest("setWebhook", params); err != nil {
+		x.log.F("Failed to register webhook", "url", webhook.URL, tracing.InnerError, err)
+		return
+	}
+
+	x.log.I("Webhook registered, waiting for updates with per-chat sequential processing", "url", webhook.URL, "path", x.WebhookPath())
+}
+
+// stopWebhook removes the webhook, pending updates stay in Telegram until the next start
+func (x *Poller) stopWebhook() {
+	if _, err := x.bot.Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		x.log.W("Failed to delete webhook", tracing.InnerError, err)
+		return
+	}
+
+	x.log.I("Webhook deleted")
+}
+
+// ServeWebhook accepts an update pushed by Telegram, a non 2xx answer makes Telegram redeliver it later
+func (x *Poller) ServeWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	secret := r.Header.Get(webhookSecretHeader)
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(x.config.Telegram.Webhook.SecretToken)) != 1 {
+		x.log.W("Webhook request rejected, secret token mismatch", "remote", r.RemoteAddr)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, webhookMaxBodySize))
+	if err != nil {
+		x.log.W("Failed to read webhook update", "remote", r.RemoteAddr, tracing.InnerError, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	update, err := x.decodeUpdate(body)
+	if err != nil {
+		x.log.W("Failed to decode webhook update", "remote", r.RemoteAddr, tracing.InnerError, err)
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if !x.dispatch(update) {
+		x.log.W("Webhook update refused, Telegram will redeliver it", "update_id", update.UpdateID)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,282 @@
+package telegram
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"ximanager/sources/configuration"
+	"ximanager/sources/tracing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	testBotToken    = "123:test"
+	testSecretToken = "webhook-secret"
+)
+
+// fakeBotAPI is a local Telegram Bot API recording called methods with their form params
+type fakeBotAPI struct {
+	server *httptest.Server
+
+	mu    sync.Mutex
+	calls []fakeBotCall
+}
+
+type fakeBotCall struct {
+	method string
+	params map[string]string
+}
+
+func newFakeBotAPI(t *testing.T) *fakeBotAPI {
+	fake := &fakeBotAPI{}
+	fake.server = httptest.NewServer(http.HandlerFunc(fake.serve))
+	t.Cleanup(fake.server.Close)
+	return fake
+}
+
+func (x *fakeBotAPI) serve(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	if !strings.HasPrefix(r.URL.Path, "/bot"+testBotToken+"/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	params := make(map[string]string)
+	for key := range r.PostForm {
+		params[key] = r.PostForm.Get(key)
+	}
+
+	x.mu.Lock()
+	x.calls = append(x.calls, fakeBotCall{method: method, params: params})
+	x.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch method {
+	case "getMe":
+		w.Write([]byte(`{"ok":true,"result":{"id":123,"is_bot":true,"first_name":"Xi","username":"xi_bot"}}`))
+	case "getUpdates":
+		// stands for a short long poll, so the poller does not spin
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte(`{"ok":true,"result":[]}`))
+	default:
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}
+}
+
+func (x *fakeBotAPI) endpoint() string {
+	return x.server.URL + "/bot%s/%s"
+}
+
+func (x *fakeBotAPI) methods() []string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	methods := make([]string, 0, len(x.calls))
+	for _, call := range x.calls {
+		methods = append(methods, call.method)
+	}
+	return methods
+}
+
+func (x *fakeBotAPI) call(method string) (fakeBotCall, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for _, call := range x.calls {
+		if call.method == method {
+			return call, true
+		}
+	}
+	return fakeBotCall{}, false
+}
+
+func (x *fakeBotAPI) waitFor(t *testing.T, method string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := x.call(method); ok {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("%s was not called, calls: %v", method, x.methods())
+}
+
+func newTestPoller(t *testing.T, fake *fakeBotAPI, mode string) *Poller {
+	config := &configuration.Config{}
+	config.Telegram.BotToken = testBotToken
+	config.Telegram.APIEndpoint = fake.endpoint()
+	config.Telegram.Mode = mode
+	config.Telegram.AllowedUpdates = []string{"message", "edited_message", "callback_query", "inline_query"}
+	config.Telegram.Webhook.URL = "https://xi.example.com/telegram/webhook"
+	config.Telegram.Webhook.SecretToken = testSecretToken
+
+	log := tracing.NewConsoleLogger()
+	streams := &StreamDispatcher{config: config, log: log}
+
+	return NewPoller(NewBotAPI(log, config), log, nil, config, nil, nil, nil, streams, nil)
+}
+
+func postUpdate(poller *Poller, secret string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, poller.WebhookPath(), strings.NewReader(body))
+	if secret != "" {
+		req.Header.Set(webhookSecretHeader, secret)
+	}
+
+	rec := httptest.NewRecorder()
+	poller.ServeWebhook(rec, req)
+	return rec
+}
+
+func TestWebhookRegistersAndDeletesWebhook(t *testing.T) {
+	fake := newFakeBotAPI(t)
+	poller := newTestPoller(t, fake, TelegramModeWebhook)
+
+	poller.Start()
+
+	call, ok := fake.call("setWebhook")
+	if !ok {
+		t.Fatalf("setWebhook was not called, calls: %v", fake.methods())
+	}
+	if call.params["secret_token"] != testSecretToken {
+		t.Errorf("setWebhook secret_token = %q, want %q", call.params["secret_token"], testSecretToken)
+	}
+	if !strings.Contains(call.params["allowed_updates"], "callback_query") {
+		t.Errorf("setWebhook allowed_updates = %q, want callback_query in it", call.params["allowed_updates"])
+	}
+	if _, ok := fake.call("getUpdates"); ok {
+		t.Errorf("getUpdates was called in webhook mode")
+	}
+
+	poller.Stop()
+
+	if _, ok := fake.call("deleteWebhook"); !ok {
+		t.Errorf("deleteWebhook was not called on stop, calls: %v", fake.methods())
+	}
+}
+
+func TestWebhookRejectsWrongSecretToken(t *testing.T) {
+	fake := newFakeBotAPI(t)
+	poller := newTestPoller(t, fake, TelegramModeWebhook)
+	defer poller.Stop()
+
+	queue := &chatQueue{messages: make(chan tgbotapi.Update, 1)}
+	poller.chatQueues[42] = queue
+
+	body := `{"update_id":1,"message":{"message_id":7,"date":0,"chat":{"id":42,"type":"private"},"text":"hi"}}`
+
+	for _, secret := range []string{"", "wrong-secret"} {
+		if rec := postUpdate(poller, secret, body); rec.Code != http.StatusUnauthorized {
+			t.Errorf("secret %q: status = %d, want %d", secret, rec.Code, http.StatusUnauthorized)
+		}
+	}
+
+	if len(queue.messages) != 0 {
+		t.Errorf("update with a wrong secret token was enqueued")
+	}
+}
+
+func TestWebhookAcceptsUpdate(t *testing.T) {
+	fake := newFakeBotAPI(t)
+	poller := newTestPoller(t, fake, TelegramModeWebhook)
+	defer poller.Stop()
+
+	// a queue without a processor, the update stays there to be checked
+	queue := &chatQueue{messages: make(chan tgbotapi.Update, 1)}
+	poller.chatQueues[42] = queue
+
+	body := `{"update_id":1,"message":{"message_id":7,"date":0,"chat":{"id":42,"type":"private"},"text":"hi"}}`
+
+	if rec := postUpdate(poller, testSecretToken, body); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	select {
+	case update := <-queue.messages:
+		if update.UpdateID != 1 || update.Message == nil || update.Message.Text != "hi" {
+			t.Errorf("enqueued update = %+v, want update 1 with text hi", update)
+		}
+	default:
+		t.Errorf("update was not enqueued")
+	}
+}
+
+func TestWebhookRefusesUpdateForRedelivery(t *testing.T) {
+	fake := newFakeBotAPI(t)
+	poller := newTestPoller(t, fake, TelegramModeWebhook)
+
+	// a stopping poller accepts nothing, Telegram has to redeliver the update to the next instance
+	poller.Stop()
+
+	body := `{"update_id":1,"message":{"message_id":7,"date":0,"chat":{"id":42,"type":"private"},"text":"hi"}}`
+
+	if rec := postUpdate(poller, testSecretToken, body); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestWebhookRejectsMalformedRequests(t *testing.T) {
+	fake := newFakeBotAPI(t)
+	poller := newTestPoller(t, fake, TelegramModeWebhook)
+	defer poller.Stop()
+
+	if rec := postUpdate(poller, testSecretToken, `{"update_id":`); rec.Code != http.StatusBadRequest {
+		t.Errorf("malformed body: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, poller.WebhookPath(), nil)
+	req.Header.Set(webhookSecretHeader, testSecretToken)
+	rec := httptest.NewRecorder()
+	poller.ServeWebhook(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestPollingDeletesWebhookBeforeGettingUpdates(t *testing.T) {
+	fake := newFakeBotAPI(t)
+	poller := newTestPoller(t, fake, TelegramModePolling)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		poller.Start()
+	}()
+
+	fake.waitFor(t, "getUpdates")
+	poller.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("poller did not stop polling")
+	}
+
+	deleted, polled := -1, -1
+	for i, method := range fake.methods() {
+		if method == "deleteWebhook" && deleted < 0 {
+			deleted = i
+		}
+		if method == "getUpdates" && polled < 0 {
+			polled = i
+		}
+	}
+
+	if deleted < 0 {
+		t.Fatalf("deleteWebhook was not called before polling, calls: %v", fake.methods())
+	}
+	if deleted > polled {
+		t.Errorf("deleteWebhook was called after getUpdates, calls: %v", fake.methods())
+	}
+	if _, ok := fake.call("setWebhook"); ok {
+		t.Errorf("setWebhook was called in polling mode")
+	}
+}
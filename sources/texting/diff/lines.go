@@ -0,0 +1,125 @@
+package diff
+
+import "strings"
+
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// Lines computes a line based diff of two texts using the longest common subsequence.
+//
+// Example:
+//   - "a\nb\nc", "a\nc\nd" -> [=a, -b, =c, +d]
+func Lines(before string, after string) []Line {
+	a := splitLines(before)
+	b := splitLines(after)
+
+	// lcs[i][j] is the length of the common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	result := make([]Line, 0, max(len(a), len(b)))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			result = append(result, Line{Op: Equal, Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			result = append(result, Line{Op: Delete, Text: a[i]})
+			i++
+		default:
+			result = append(result, Line{Op: Insert, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		result = append(result, Line{Op: Delete, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		result = append(result, Line{Op: Insert, Text: b[j]})
+	}
+
+	return result
+}
+
+// HasChanges reports whether the diff contains at least one inserted or deleted line
+func HasChanges(lines []Line) bool {
+	for _, line := range lines {
+		if line.Op != Equal {
+			return true
+		}
+	}
+	return false
+}
+
+// Unified renders the diff with "+" and "-" prefixes, keeping up to context unchanged lines around every change.
+// Skipped unchanged lines are collapsed into a single "…" line.
+func Unified(lines []Line, context int) string {
+	keep := make([]bool, len(lines))
+	for idx, line := range lines {
+		if line.Op == Equal {
+			continue
+		}
+		for k := max(0, idx-context); k <= min(len(lines)-1, idx+context); k++ {
+			keep[k] = true
+		}
+	}
+
+	var builder strings.Builder
+	skipped := false
+	for idx, line := range lines {
+		if !keep[idx] {
+			skipped = true
+			continue
+		}
+		if skipped {
+			builder.WriteString("…\n")
+			skipped = false
+		}
+
+		switch line.Op {
+		case Insert:
+			builder.WriteString("+ ")
+		case Delete:
+			builder.WriteString("- ")
+		default:
+			builder.WriteString("  ")
+		}
+		builder.WriteString(line.Text)
+		builder.WriteString("\n")
+	}
+	if skipped {
+		builder.WriteString("…\n")
+	}
+
+	return strings.TrimRight(builder.String(), "\n")
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+}